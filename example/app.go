@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+	"golang.org/x/sys/unix"
+)
+
+// drainIdle is how long the queue must stay empty after SIGTERM before exit.
+const drainIdle = 200 * time.Millisecond
+
+// app is the running tool, events go to stdout and diagnostics to stderr.
+type app struct {
+	notify *fanotify.NotifyFD
+	stdout *bufio.Writer
+	stats  *fanotify.Stats
+	// recorder is set by the record subcommand
+	recorder *fanotify.Recorder
+
+	// mu guards settings replaced by SIGHUP reload
+	mu     sync.Mutex
+	cfg    config
+	fields []string
+	out    writer
+	rules  *ruleSet
+	// routing is replaced on reload, the previous one closed once the new
+	// filters are set
+	routing *routing
+
+	// draining is 1 once SIGTERM removed all marks, 2 while queued events
+	// are read with an idle deadline
+	draining int32
+}
+
+func newApp(cfg config) (*app, error) {
+	a := &app{
+		stdout: bufio.NewWriter(os.Stdout),
+	}
+
+	if err := a.apply(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Stats {
+		interval, err := time.ParseDuration(cfg.StatsInterval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid stats interval %q", cfg.StatsInterval)
+		}
+
+		a.stats = fanotify.NewStats()
+
+		go printStats(os.Stdout, a.stats, interval, cfg.StatsTop)
+	}
+
+	if cfg.Record != "" {
+		f, err := os.OpenFile(cfg.Record, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, err
+		}
+
+		if a.recorder, err = fanotify.NewRecorder(f); err != nil {
+			f.Close()
+
+			return nil, err
+		}
+	}
+
+	class := fanotify.InitFlags(unix.FAN_CLASS_NOTIF)
+	if cfg.Enforce != "" {
+		class = unix.FAN_CLASS_CONTENT
+	}
+
+	// FAN_NONBLOCK lets signal handling interrupt a pending read
+	notify, err := fanotify.Initialize(
+		unix.FAN_CLOEXEC|
+			unix.FAN_NONBLOCK|
+			class|
+			unix.FAN_UNLIMITED_QUEUE|
+			unix.FAN_UNLIMITED_MARKS,
+		os.O_RDONLY,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	a.notify = notify
+	a.notify.SetFilters(cfg.filters(a.routing.ruleSet())...)
+
+	if err := a.mark(cfg); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// apply validates cfg and swaps in its output and rule settings.
+func (a *app) apply(cfg config) error {
+	fields, err := parseFields(cfg.Fields)
+	if err != nil {
+		return err
+	}
+
+	out, err := newWriter(cfg.Output, fields, a.stdout)
+	if err != nil {
+		return err
+	}
+
+	var rules *ruleSet
+
+	if cfg.Enforce != "" {
+		if rules, err = loadRules(cfg.Enforce); err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.notify != nil && (cfg.Enforce == "") != (a.cfg.Enforce == "") {
+		return fmt.Errorf("switching permission mode needs a restart")
+	}
+
+	routing, err := loadRouting(cfg)
+	if err != nil {
+		return err
+	}
+
+	a.cfg, a.fields, a.out, a.rules, a.routing = cfg, fields, out, rules, routing
+
+	return nil
+}
+
+// mark applies the marks of cfg, re-applied marks only change by the
+// difference to the current set, so the group and its queue are kept.
+func (a *app) mark(cfg config) error {
+	if _, err := cfg.markFlags(); err != nil {
+		return err
+	}
+
+	mask, err := cfg.mask()
+	if err != nil {
+		return err
+	}
+
+	want := make([]fanotify.PlanMark, 0, len(cfg.Paths))
+
+	for _, path := range cfg.Paths {
+		want = append(want, fanotify.PlanMark{Path: path, Type: cfg.Mark, Mask: mask})
+	}
+
+	return a.notify.ApplyDiff(fanotify.DiffMarks(a.notify.Plan().Marks, want))
+}
+
+// reload re-reads flags and config file, keeping the fanotify group.
+func (a *app) reload() error {
+	cfg, err := loadConfig(newFlagSet(), cliArgs)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	prev := a.routing
+	a.mu.Unlock()
+
+	if err := a.apply(cfg); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	routing := a.routing
+	a.mu.Unlock()
+
+	a.notify.SetFilters(cfg.filters(routing.ruleSet())...)
+	prev.close()
+
+	return a.mark(cfg)
+}
+
+// drain stops new events by removing all marks and makes the reader exit
+// once the already queued events are handled.
+func (a *app) drain() {
+	if !atomic.CompareAndSwapInt32(&a.draining, 0, 1) {
+		return
+	}
+
+	for _, flags := range []fanotify.MarkFlags{unix.FAN_MARK_INODE, unix.FAN_MARK_MOUNT, unix.FAN_MARK_FILESYSTEM} {
+		if err := a.notify.Mark(unix.FAN_MARK_FLUSH|flags, 0, unix.AT_FDCWD, ""); err != nil {
+			log.Printf("drain: %v\n", err)
+		}
+	}
+
+	_ = a.notify.File.SetReadDeadline(time.Now())
+}
+
+func (a *app) handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	for sig := range ch {
+		if sig != syscall.SIGHUP {
+			log.Printf("%v: draining\n", sig)
+			a.drain()
+
+			continue
+		}
+
+		if err := a.reload(); err != nil {
+			log.Printf("reload: %v\n", err)
+
+			continue
+		}
+
+		log.Printf("reloaded\n")
+	}
+}
+
+// run handles events until drained after SIGTERM/SIGINT, or until reading
+// fails with an error that is not transient.
+func (a *app) run() error {
+	go a.handleSignals()
+
+	for {
+		data, err := a.notify.WaitEvent()
+
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if atomic.LoadInt32(&a.draining) == 2 {
+				return a.close()
+			}
+
+			// drain until the queue stays empty for drainIdle
+			atomic.StoreInt32(&a.draining, 2)
+			_ = a.notify.File.SetReadDeadline(time.Now().Add(drainIdle))
+
+			continue
+		}
+
+		if atomic.LoadInt32(&a.draining) == 2 {
+			_ = a.notify.File.SetReadDeadline(time.Now().Add(drainIdle))
+		}
+
+		if err != nil {
+			if !transientReadError(err) {
+				_ = a.close()
+
+				return err
+			}
+
+			log.Printf("%v\n", err)
+
+			continue
+		}
+
+		r, err := a.handle(data)
+		if err != nil {
+			log.Printf("%v\n", err)
+
+			continue
+		}
+
+		if r == nil || a.stats != nil {
+			continue
+		}
+
+		if err := a.write(r); err != nil {
+			return err
+		}
+	}
+}
+
+// close releases the fanotify group and finishes the recording.
+func (a *app) close() error {
+	err := a.notify.Close()
+
+	a.routing.close()
+
+	if a.recorder != nil {
+		if cerr := a.recorder.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func (a *app) write(r *record) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.out.Write(r); err != nil {
+		return err
+	}
+
+	if err := a.out.Flush(); err != nil {
+		return err
+	}
+
+	return a.stdout.Flush()
+}
+
+// transientReadError reports whether reading can go on after err, an
+// interrupted read or a malformed event the stream resynchronized after.
+func transientReadError(err error) bool {
+	var (
+		truncated *fanotify.TruncatedEventError
+		version   *fanotify.VersionError
+	)
+
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) ||
+		errors.As(err, &truncated) || errors.As(err, &version)
+}
+
+// handle handles one event, returning the record to print.
+func (a *app) handle(data *fanotify.EventMetadata) (*record, error) {
+	defer data.Close()
+
+	a.mu.Lock()
+	rules, fields := a.rules, a.fields
+	a.mu.Unlock()
+
+	path, err := data.GetPath()
+
+	if a.recorder != nil {
+		if err := a.recorder.Record(data); err != nil {
+			log.Printf("%v\n", err)
+		}
+	}
+
+	if a.stats != nil {
+		a.stats.Observe(fanotify.Event{PID: data.GetPID(), Path: path, Mask: data.Mask})
+
+		if pending, err := a.notify.Pending(); err == nil {
+			a.stats.ObservePending(pending)
+		}
+	}
+
+	if rules != nil && data.IsPermission() {
+		return enforce(a.notify, rules, data, path, fields)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newRecord(data, path, fields), nil
+}
+
+// writePidFile creates path holding the current PID, refusing to replace a
+// pidfile of a still running process.
+func writePidFile(path string) error {
+	if content, err := os.ReadFile(path); err == nil {
+		var pid int
+
+		if _, err := fmt.Sscanf(string(content), "%d", &pid); err == nil && pid > 0 &&
+			unix.Kill(pid, 0) == nil {
+			return fmt.Errorf("pidfile %s: process %d is running", path, pid)
+		}
+	}
+
+	return os.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0o644)
+}
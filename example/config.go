@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+	"golang.org/x/sys/unix"
+)
+
+// config is the tool configuration, loaded from an optional JSON file and
+// overridden by explicitly set flags.
+type config struct {
+	Output string   `json:"output"`
+	Fields string   `json:"fields"`
+	Mark   string   `json:"mark"`
+	Events []string `json:"events"`
+	Paths  []string `json:"paths"`
+	// Enforce is a rule file, it switches the tool to permission mode.
+	Enforce string `json:"enforce"`
+	// Rules is a fanotify.RulesFile routing events, Sinks maps route sink
+	// names to JSON lines files, "stderr" is always available.
+	Rules string            `json:"rules"`
+	Sinks map[string]string `json:"sinks"`
+	// Stats switches output to periodic top-N process and path counts.
+	Stats         bool   `json:"stats"`
+	StatsInterval string `json:"stats_interval"`
+	StatsTop      int    `json:"stats_top"`
+	// PidFile is written on start and removed on exit.
+	PidFile string `json:"pidfile"`
+
+	ExcludePIDs  []int    `json:"exclude_pids"`
+	ExcludeUIDs  []int    `json:"exclude_uids"`
+	IncludePaths []string `json:"include_paths"`
+	ExcludePaths []string `json:"exclude_paths"`
+	// Noise are fanotify.NoisePresets names, their paths are dropped.
+	Noise []string `json:"noise"`
+
+	// Record is the recording file of the record subcommand.
+	Record string `json:"-"`
+}
+
+// markTypes maps --mark values to fanotify_mark flags.
+var markTypes = map[string]fanotify.MarkFlags{
+	"inode": unix.FAN_MARK_INODE,
+	"mount": unix.FAN_MARK_MOUNT,
+	"fs":    unix.FAN_MARK_FILESYSTEM,
+}
+
+// stringList is a repeatable, comma separated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+
+	return nil
+}
+
+// intList is a repeatable, comma separated integer flag.
+type intList []int
+
+func (l *intList) String() string {
+	out := make([]string, 0, len(*l))
+
+	for _, v := range *l {
+		out = append(out, strconv.Itoa(v))
+	}
+
+	return strings.Join(out, ",")
+}
+
+func (l *intList) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+
+		*l = append(*l, i)
+	}
+
+	return nil
+}
+
+// filters maps filter settings onto the library filter pipeline, the tool
+// itself is always excluded, routing rules run last.
+func (cfg config) filters(routing *fanotify.RuleSet) []fanotify.Filter {
+	out := []fanotify.Filter{
+		fanotify.ExcludePIDs(append([]int{os.Getpid()}, cfg.ExcludePIDs...)...),
+	}
+
+	if len(cfg.ExcludeUIDs) > 0 {
+		out = append(out, fanotify.ExcludeUIDs(cfg.ExcludeUIDs...))
+	}
+
+	if len(cfg.IncludePaths) > 0 {
+		out = append(out, fanotify.IncludePaths(cfg.IncludePaths...))
+	}
+
+	if len(cfg.ExcludePaths) > 0 {
+		out = append(out, fanotify.ExcludePaths(cfg.ExcludePaths...))
+	}
+
+	// names are checked by loadConfig
+	if presets, err := fanotify.LookupNoisePresets(cfg.Noise...); err == nil && len(presets) > 0 {
+		out = append(out, fanotify.NoiseFilter(presets...))
+	}
+
+	if routing != nil {
+		out = append(out, routing.Apply)
+	}
+
+	return out
+}
+
+func defaultConfig() config {
+	mountpoint := "/"
+
+	if val, ok := os.LookupEnv("MOUNT_POINT"); ok {
+		mountpoint = val
+	}
+
+	return config{
+		Output: formatText,
+		Fields: "pid,path,mtime",
+		Mark:   "mount",
+		Events: []string{"modify", "close_write"},
+		Paths:  []string{mountpoint},
+
+		StatsInterval: "2s",
+		StatsTop:      10,
+	}
+}
+
+// newFlagSet returns a flag set for re-parsing the command line on reload.
+func newFlagSet() *flag.FlagSet {
+	return flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+}
+
+// loadConfig parses flags on top of the optional config file.
+func loadConfig(fs *flag.FlagSet, args []string) (config, error) {
+	cfg := defaultConfig()
+
+	var (
+		paths, events              stringList
+		includePaths, excludePaths stringList
+		noise                      stringList
+		excludePIDs, excludeUIDs   intList
+		configFile                 string
+	)
+
+	output := fs.String("output", cfg.Output, "output format: text, json or csv")
+	fields := fs.String("fields", cfg.Fields, "comma separated output fields: "+strings.Join(fieldOrder, ",")+" or all")
+	mark := fs.String("mark", cfg.Mark, "mark type: inode, mount or fs")
+	fs.Var(&events, "event", "event to watch, repeatable or comma separated: "+strings.Join(fanotify.EventNames(), ","))
+	fs.Var(&paths, "path", "path to mark, repeatable (default $MOUNT_POINT or /)")
+	stats := fs.Bool("stats", false, "print top processes and paths by event count instead of events")
+	statsInterval := fs.String("stats-interval", cfg.StatsInterval, "stats print interval")
+	statsTop := fs.Int("stats-top", cfg.StatsTop, "number of top processes and paths printed")
+	fs.Var(&excludePIDs, "exclude-pid", "drop events of this PID, repeatable or comma separated")
+	fs.Var(&excludeUIDs, "exclude-uid", "drop events of processes with this real UID, repeatable or comma separated")
+	fs.Var(&includePaths, "include-path", "only report paths matching this glob (trailing / matches a subtree), repeatable")
+	fs.Var(&excludePaths, "exclude-path", "drop paths matching this glob (trailing / matches a subtree), repeatable")
+	fs.Var(&noise, "noise", "drop well-known benign paths of a preset, repeatable or comma separated: "+strings.Join(fanotify.NoisePresetNames(), ","))
+	pidFile := fs.String("pidfile", "", "write PID to this file while running")
+	enforce := fs.String("enforce", "", "JSON rule file, enforce allow/deny decisions on permission events")
+	rules := fs.String("rules", "", "JSON routing rule file: drop, tag, route or escalate events")
+	fs.StringVar(&configFile, "config", "", "JSON config file (TOML and YAML are not supported) with output, fields, mark, events, paths, enforce, rules and sinks keys")
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	// nil marks values left for mode dependent defaults
+	cfg.Events, cfg.Fields = nil, ""
+
+	if configFile != "" {
+		content, err := os.ReadFile(configFile)
+		if err != nil {
+			return cfg, err
+		}
+
+		if err := json.Unmarshal(content, &cfg); err != nil {
+			return cfg, fmt.Errorf("config %s: %w", configFile, err)
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "output":
+			cfg.Output = *output
+		case "fields":
+			cfg.Fields = *fields
+		case "mark":
+			cfg.Mark = *mark
+		case "event":
+			cfg.Events = events
+		case "path":
+			cfg.Paths = paths
+		case "enforce":
+			cfg.Enforce = *enforce
+		case "rules":
+			cfg.Rules = *rules
+		case "stats":
+			cfg.Stats = *stats
+		case "stats-interval":
+			cfg.StatsInterval = *statsInterval
+		case "stats-top":
+			cfg.StatsTop = *statsTop
+		case "pidfile":
+			cfg.PidFile = *pidFile
+		case "exclude-pid":
+			cfg.ExcludePIDs = excludePIDs
+		case "exclude-uid":
+			cfg.ExcludeUIDs = excludeUIDs
+		case "include-path":
+			cfg.IncludePaths = includePaths
+		case "exclude-path":
+			cfg.ExcludePaths = excludePaths
+		case "noise":
+			cfg.Noise = noise
+		}
+	})
+
+	if _, err := fanotify.LookupNoisePresets(cfg.Noise...); err != nil {
+		return cfg, err
+	}
+
+	// permission mode watches permission events and prints decisions
+	switch {
+	case cfg.Events != nil:
+	case cfg.Enforce != "":
+		cfg.Events = []string{"open_perm", "open_exec_perm"}
+	default:
+		cfg.Events = defaultConfig().Events
+	}
+
+	switch {
+	case cfg.Fields != "":
+	case cfg.Enforce != "":
+		cfg.Fields = "pid,comm,path,action"
+	default:
+		cfg.Fields = defaultConfig().Fields
+	}
+
+	return cfg, nil
+}
+
+// markFlags returns fanotify_mark type flags for cfg.
+func (cfg config) markFlags() (fanotify.MarkFlags, error) {
+	flags, ok := markTypes[cfg.Mark]
+	if !ok {
+		return 0, fmt.Errorf("unknown mark type %q, valid types: inode,mount,fs", cfg.Mark)
+	}
+
+	return flags, nil
+}
+
+// mask returns fanotify event mask for cfg.
+func (cfg config) mask() (fanotify.EventMask, error) {
+	var mask fanotify.EventMask
+
+	for _, name := range cfg.Events {
+		bits, err := fanotify.ParseMask(name)
+		if err != nil {
+			return 0, fmt.Errorf("%w, valid events: %s", err, strings.Join(fanotify.EventNames(), ","))
+		}
+
+		mask |= bits
+	}
+
+	if mask == 0 {
+		return 0, fmt.Errorf("no events selected")
+	}
+
+	return mask, nil
+}
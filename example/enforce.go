@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// Rule actions.
+const (
+	actionAllow = "allow"
+	actionDeny  = "deny"
+)
+
+// rule matches when all of its set conditions match.
+type rule struct {
+	Action string `json:"action"`
+	// Path is a filepath.Match glob, a trailing "/" matches everything below.
+	Path string `json:"path,omitempty"`
+	// SHA256 is the hex digest of the opened file content.
+	SHA256 string `json:"sha256,omitempty"`
+	// UID is the real UID of the process opening the file.
+	UID *int `json:"uid,omitempty"`
+}
+
+// ruleSet is the permission rule file, the first matching rule wins.
+type ruleSet struct {
+	Default string `json:"default"`
+	// MaxHashSize bounds sha256 rule evaluation, bigger files never match.
+	MaxHashSize int64  `json:"max_hash_size"`
+	Rules       []rule `json:"rules"`
+}
+
+func loadRules(path string) (*ruleSet, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &ruleSet{
+		Default:     actionAllow,
+		MaxHashSize: 64 << 20,
+	}
+
+	if err := json.Unmarshal(content, rs); err != nil {
+		return nil, fmt.Errorf("rules %s: %w", path, err)
+	}
+
+	for i, r := range append(rs.Rules, rule{Action: rs.Default}) {
+		if r.Action != actionAllow && r.Action != actionDeny {
+			return nil, fmt.Errorf("rules %s: rule %d: unknown action %q", path, i, r.Action)
+		}
+
+		if r.Path != "" {
+			if _, err := filepath.Match(r.Path, ""); err != nil {
+				return nil, fmt.Errorf("rules %s: rule %d: %w", path, i, err)
+			}
+		}
+	}
+
+	return rs, nil
+}
+
+// enforce answers a permission event, an unresolvable path falls back to
+// the default action.
+func enforce(
+	notify *fanotify.NotifyFD, rules *ruleSet, data *fanotify.EventMetadata, path string, fields []string,
+) (*record, error) {
+	action := rules.decide(data, path)
+
+	respond := notify.ResponseAllow
+	if action == actionDeny {
+		respond = notify.ResponseDeny
+	}
+
+	if err := respond(data); err != nil {
+		return nil, err
+	}
+
+	r := newRecord(data, path, fields)
+	r.Action = action
+
+	return r, nil
+}
+
+// decide returns action for a permission event on path, uid rules never
+// match a process whose UID cannot be read.
+func (rs *ruleSet) decide(data *fanotify.EventMetadata, path string) string {
+	var (
+		digest string
+		uid    int
+		uidErr error
+		uidSet bool
+	)
+
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+
+		if r.Path != "" && !fanotify.MatchPath(r.Path, path) {
+			continue
+		}
+
+		if r.UID != nil {
+			if !uidSet {
+				uid, uidErr = data.GetUID()
+				uidSet = true
+			}
+
+			if uidErr != nil || uid != *r.UID {
+				continue
+			}
+		}
+
+		if r.SHA256 != "" {
+			if digest == "" {
+				digest = rs.hash(data)
+			}
+
+			if !strings.EqualFold(digest, r.SHA256) {
+				continue
+			}
+		}
+
+		return r.Action
+	}
+
+	return rs.Default
+}
+
+// hash returns sha256 of the opened file, read with pread so the opening
+// process file offset is not changed.
+func (rs *ruleSet) hash(data *fanotify.EventMetadata) string {
+	size, err := data.Size()
+	if err != nil || size > rs.MaxHashSize {
+		return "-"
+	}
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, io.NewSectionReader(data.ReaderAt(), 0, size)); err != nil {
+		return "-"
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -1,91 +1,66 @@
 package main
 
 import (
-	"fmt"
+	"flag"
 	"log"
 	"os"
-
-	"github.com/s3rj1k/go-fanotify/fanotify"
-	"golang.org/x/sys/unix"
 )
 
+// cliArgs are the flags re-parsed on reload, without subcommand.
+var cliArgs = os.Args[1:]
+
 func main() {
 	log.SetFlags(log.Lshortfile)
 
-	notify, err := fanotify.Initialize(
-		unix.FAN_CLOEXEC|
-			unix.FAN_CLASS_NOTIF|
-			unix.FAN_UNLIMITED_QUEUE|
-			unix.FAN_UNLIMITED_MARKS,
-		os.O_RDONLY|
-			unix.O_LARGEFILE|
-			unix.O_CLOEXEC,
-	)
-	if err != nil {
-		log.Fatalf("%v\n", err)
-	}
-
-	var mountpoint string
-
-	if val, ok := os.LookupEnv("MOUNT_POINT"); !ok {
-		mountpoint = "/"
-	} else {
-		mountpoint = val
+	// journald timestamps every line itself
+	if _, ok := os.LookupEnv("JOURNAL_STREAM"); ok {
+		log.SetFlags(0)
 	}
 
-	if err = notify.Mark(
-		unix.FAN_MARK_ADD|
-			unix.FAN_MARK_MOUNT,
-		unix.FAN_MODIFY|
-			unix.FAN_CLOSE_WRITE,
-		unix.AT_FDCWD,
-		mountpoint,
-	); err != nil {
-		log.Fatalf("%v\n", err)
-	}
-
-	f := func(notify *fanotify.NotifyFD) (string, error) {
-		data, err := notify.GetEvent(os.Getpid())
-		if err != nil {
-			return "", fmt.Errorf("%w", err)
-		}
-
-		if data == nil {
-			return "", nil
-		}
-
-		defer data.Close()
+	args := os.Args[1:]
 
-		path, err := data.GetPath()
-		if err != nil {
-			return "", err
+	if len(args) > 0 && args[0] == "replay" {
+		if err := replay(args[1:]); err != nil {
+			log.Fatalf("%v\n", err)
 		}
 
-		dataFile := data.File()
-		defer dataFile.Close()
+		return
+	}
 
-		fInfo, err := dataFile.Stat()
-		if err != nil {
-			return "", err
-		}
+	record := len(args) > 0 && args[0] == "record"
+	if record {
+		cliArgs = args[1:]
+	}
 
-		mTime := fInfo.ModTime()
+	cfg, err := loadConfig(flag.CommandLine, cliArgs)
+	if err != nil {
+		log.Fatalf("%v\n", err)
+	}
 
-		if data.MatchMask(unix.FAN_CLOSE_WRITE) || data.MatchMask(unix.FAN_MODIFY) {
-			return fmt.Sprintf("PID:%d %s - %v", data.GetPID(), path, mTime), nil
+	if record {
+		if cfg.Record = flag.Arg(0); cfg.Record == "" {
+			log.Fatalf("usage: %s record [flags] FILE\n", os.Args[0])
 		}
+	}
 
-		return "", fmt.Errorf("fanotify: unknown event")
+	if err := run(cfg); err != nil {
+		log.Printf("%v\n", err)
+		os.Exit(1)
 	}
+}
 
-	for {
-		str, err := f(notify)
-		if err == nil && len(str) > 0 {
-			fmt.Printf("%s\n", str)
+func run(cfg config) error {
+	if cfg.PidFile != "" {
+		if err := writePidFile(cfg.PidFile); err != nil {
+			return err
 		}
+		defer os.Remove(cfg.PidFile)
+	}
 
-		if err != nil {
-			fmt.Printf("error: %v\n", err)
-		}
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
 	}
+
+	return a.run()
 }
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// Output formats.
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// record holds every field that can be selected for output, field names and
+// their order in json/csv output form the stable output schema.
+type record struct {
+	Time   time.Time
+	PID    int
+	Comm   string
+	Path   string
+	Mask   uint64
+	MTime  time.Time
+	Action string
+	Tags   []string
+}
+
+// fieldGetters maps selectable field names to text renderers.
+var fieldGetters = map[string]func(r *record) string{
+	"time":   func(r *record) string { return r.Time.Format(time.RFC3339Nano) },
+	"pid":    func(r *record) string { return strconv.Itoa(r.PID) },
+	"comm":   func(r *record) string { return r.Comm },
+	"path":   func(r *record) string { return r.Path },
+	"mask":   func(r *record) string { return fmt.Sprintf("%#x", r.Mask) },
+	"mtime":  func(r *record) string { return r.MTime.Format(time.RFC3339Nano) },
+	"action": func(r *record) string { return r.Action },
+	"tags":   func(r *record) string { return strings.Join(r.Tags, ",") },
+}
+
+// fieldOrder is the canonical field order.
+var fieldOrder = []string{"time", "pid", "comm", "path", "mask", "mtime", "action", "tags"}
+
+func parseFields(s string) ([]string, error) {
+	if s == "" || s == "all" {
+		return fieldOrder, nil
+	}
+
+	var out []string
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if _, ok := fieldGetters[name]; !ok {
+			return nil, fmt.Errorf("unknown field %q, valid fields: %s", name, strings.Join(fieldOrder, ","))
+		}
+
+		out = append(out, name)
+	}
+
+	return out, nil
+}
+
+// writer renders records in one of the output formats.
+type writer interface {
+	Write(r *record) error
+	Flush() error
+}
+
+func newWriter(format string, fields []string, w io.Writer) (writer, error) {
+	switch format {
+	case formatText:
+		return &textWriter{w: w, fields: fields}, nil
+	case formatJSON:
+		return &jsonWriter{w: w, fields: fields}, nil
+	case formatCSV:
+		out := &csvWriter{w: csv.NewWriter(w), fields: fields}
+
+		return out, out.w.Write(fields)
+	default:
+		return nil, fmt.Errorf("unknown output format %q, valid formats: text,json,csv", format)
+	}
+}
+
+type textWriter struct {
+	w      io.Writer
+	fields []string
+}
+
+func (t *textWriter) Write(r *record) error {
+	parts := make([]string, 0, len(t.fields))
+
+	for _, name := range t.fields {
+		val := fieldGetters[name](r)
+
+		if name != "path" {
+			val = strings.ToUpper(name) + ":" + val
+		}
+
+		parts = append(parts, val)
+	}
+
+	_, err := fmt.Fprintln(t.w, strings.Join(parts, " "))
+
+	return err
+}
+
+func (t *textWriter) Flush() error {
+	return nil
+}
+
+type jsonWriter struct {
+	w      io.Writer
+	fields []string
+}
+
+func (j *jsonWriter) Write(r *record) error {
+	// typed values keep numbers as json numbers
+	values := map[string]interface{}{
+		"time":   r.Time,
+		"pid":    r.PID,
+		"comm":   r.Comm,
+		"path":   r.Path,
+		"mask":   r.Mask,
+		"mtime":  r.MTime,
+		"action": r.Action,
+		"tags":   r.Tags,
+	}
+
+	// keys are written in selected field order, encoding/json sorts maps
+	var b bytes.Buffer
+
+	b.WriteByte('{')
+
+	for i, name := range j.fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		val, err := json.Marshal(values[name])
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&b, "%q:%s", name, val)
+	}
+
+	b.WriteString("}\n")
+
+	_, err := j.w.Write(b.Bytes())
+
+	return err
+}
+
+func (j *jsonWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	fields []string
+}
+
+func (c *csvWriter) Write(r *record) error {
+	row := make([]string, 0, len(c.fields))
+
+	for _, name := range c.fields {
+		row = append(row, fieldGetters[name](r))
+	}
+
+	return c.w.Write(row)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+
+	return c.w.Error()
+}
+
+// newRecord fills record, fields that need extra syscalls are only
+// looked up when selected.
+func newRecord(data *fanotify.EventMetadata, path string, fields []string) *record {
+	r := &record{
+		Time: data.Time,
+		PID:  data.GetPID(),
+		Path: path,
+		Mask: data.Mask,
+		Tags: data.Tags,
+	}
+
+	if hasField(fields, "comm") {
+		r.Comm, _ = data.GetComm()
+	}
+
+	if hasField(fields, "mtime") {
+		if st, err := data.Stat(); err == nil {
+			r.MTime = st.Mtime
+		}
+	}
+
+	return r
+}
+
+func hasField(fields []string, name string) bool {
+	for _, v := range fields {
+		if v == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// replay prints events of a recording made with the record subcommand, it
+// needs no privileges and no fanotify support.
+func replay(args []string) error {
+	fs := flag.NewFlagSet(os.Args[0]+" replay", flag.ExitOnError)
+
+	output := fs.String("output", formatText, "output format: text, json or csv")
+	fields := fs.String("fields", "time,pid,path,mask", "comma separated output fields: time,pid,path,mask")
+	speed := fs.Float64("speed", 0, "replay with original timing divided by speed, 0 prints at once")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s replay [flags] FILE", os.Args[0])
+	}
+
+	names, err := parseFields(*fields)
+	if err != nil {
+		return err
+	}
+
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+
+	out, err := newWriter(*output, names, stdout)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rp, err := fanotify.NewReplayer(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	err = rp.Replay(ctx, *speed, func(ev fanotify.Event) error {
+		r := &record{
+			Time: ev.Time,
+			PID:  ev.PID,
+			Path: ev.Path,
+			Mask: ev.Mask,
+		}
+
+		if err := out.Write(r); err != nil {
+			return err
+		}
+
+		if err := out.Flush(); err != nil {
+			return err
+		}
+
+		// keep timed replay readable as it goes
+		if *speed > 0 {
+			return stdout.Flush()
+		}
+
+		return nil
+	})
+	if err != nil && err != ctx.Err() {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+	"github.com/s3rj1k/go-fanotify/fanotify/sink"
+)
+
+// routing is the rule set of the rules key with the sinks it routes to.
+type routing struct {
+	rules *fanotify.RuleSet
+	sinks []fanotify.Sink
+}
+
+// loadRouting builds the routing rules of cfg, nil without a rule file.
+func loadRouting(cfg config) (*routing, error) {
+	if cfg.Rules == "" {
+		return nil, nil
+	}
+
+	rules, err := fanotify.LoadRules(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	rs, err := fanotify.NewRuleSet(rules...)
+	if err != nil {
+		return nil, fmt.Errorf("rules %s: %w", cfg.Rules, err)
+	}
+
+	r := &routing{rules: rs}
+
+	rs.Route("stderr", sink.NewJSONLines(os.Stderr))
+
+	for name, path := range cfg.Sinks {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			r.close()
+
+			return nil, fmt.Errorf("sink %s: %w", name, err)
+		}
+
+		s := sink.NewJSONLines(f)
+		r.sinks = append(r.sinks, s)
+		rs.Route(name, s)
+	}
+
+	rs.OnEscalate(func(ev *fanotify.EventMetadata) {
+		path, _ := ev.GetPath()
+		log.Printf("escalated: pid %d %s %v\n", ev.GetPID(), path, fanotify.EventMask(ev.Mask))
+	})
+
+	rs.OnError(func(err error) {
+		log.Printf("%v\n", err)
+	})
+
+	return r, nil
+}
+
+// ruleSet returns the rule set, nil for a nil routing.
+func (r *routing) ruleSet() *fanotify.RuleSet {
+	if r == nil {
+		return nil
+	}
+
+	return r.rules
+}
+
+// close closes the file sinks.
+func (r *routing) close() {
+	if r == nil {
+		return
+	}
+
+	for _, s := range r.sinks {
+		if err := s.Close(); err != nil {
+			log.Printf("%v\n", err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// printStats prints top processes and paths of stats every interval and
+// starts counting anew, like a minimal iotop for file events.
+func printStats(w io.Writer, stats *fanotify.Stats, interval time.Duration, top int) {
+	for range time.Tick(interval) {
+		total := stats.Total()
+		procs := stats.TopProcesses(top)
+		paths := stats.TopPaths(top)
+		pending, peak := stats.Pending()
+		stats.Reset()
+
+		fmt.Fprintf(w, "--- %s: %d events, %.1f/s, queued %d bytes (peak %d)\n",
+			time.Now().Format(time.RFC3339), total, float64(total)/interval.Seconds(), pending, peak)
+
+		fmt.Fprintf(w, "%8s %8s  %s\n", "EVENTS", "PID", "COMM")
+
+		for _, v := range procs {
+			fmt.Fprintf(w, "%8d %8d  %s\n", v.Count, v.PID, comm(v.PID))
+		}
+
+		fmt.Fprintf(w, "%8s  %s\n", "EVENTS", "PATH")
+
+		for _, v := range paths {
+			fmt.Fprintf(w, "%8d  %s\n", v.Count, v.Path)
+		}
+	}
+}
+
+// comm returns process command name, or "-" for exited processes.
+func comm(pid int) string {
+	content, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return "-"
+	}
+
+	return strings.TrimSpace(string(content))
+}
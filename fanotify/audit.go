@@ -0,0 +1,302 @@
+package fanotify
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// auditRuleInfoLen is the size of struct fanotify_response_info_audit_rule.
+const auditRuleInfoLen = infoHeaderLen + 12
+
+// defaultAuditDecisions is the default number of decisions kept by
+// AuditCorrelator.
+const defaultAuditDecisions = 4096
+
+// InitializeWithAudit initializes a permission group with FAN_ENABLE_AUDIT,
+// so that responses sent with ResponseAudit are logged by the kernel audit
+// subsystem as AUDIT_FANOTIFY records. It needs CAP_AUDIT_WRITE and kernel
+// 4.15+, both are reported as descriptive errors.
+func InitializeWithAudit(fanotifyFlags InitFlags, openFlags int, opts ...Option) (*NotifyFD, error) {
+	if fanotifyFlags&(FAN_CLASS_CONTENT|FAN_CLASS_PRE_CONTENT) == 0 {
+		return nil, fmt.Errorf("fanotify: audit error, audit needs FAN_CLASS_CONTENT or FAN_CLASS_PRE_CONTENT")
+	}
+
+	handle, err := Initialize(fanotifyFlags|FAN_ENABLE_AUDIT, openFlags, opts...)
+
+	switch {
+	case errors.Is(err, syscall.EPERM):
+		return nil, fmt.Errorf("fanotify: audit error, FAN_ENABLE_AUDIT needs CAP_AUDIT_WRITE, %w", err)
+	case errors.Is(err, syscall.EINVAL):
+		return nil, fmt.Errorf("fanotify: audit error, kernel without FAN_ENABLE_AUDIT support, %w", err)
+	case err != nil:
+		return nil, err
+	}
+
+	return handle, nil
+}
+
+// AuditRule is the FAN_RESPONSE_INFO_AUDIT_RULE sent with an audited
+// response, the kernel logs it as fan_info, subj_trust and obj_trust.
+type AuditRule struct {
+	Number    uint32
+	SubjTrust uint32
+	ObjTrust  uint32
+}
+
+// ResponseAudit sends an allow or deny response with FAN_AUDIT, on a group
+// initialized with FAN_ENABLE_AUDIT. A non zero rule is attached with
+// FAN_INFO (kernel 6.3+), older kernels get the response without it. An
+// event is answered once, see EventMetadata.Allow.
+func (handle *NotifyFD) ResponseAudit(ev *EventMetadata, allow bool, rule AuditRule) error {
+	if !ev.claimResponse() {
+		return ErrResponded
+	}
+
+	response := uint32(FAN_DENY | FAN_AUDIT)
+	if allow {
+		response = FAN_ALLOW | FAN_AUDIT
+	}
+
+	if rule == (AuditRule{}) || atomic.LoadInt32(&handle.auditNoInfo) != 0 {
+		return handle.writeResponse(ev, response)
+	}
+
+	buf := make([]byte, responseSize+auditRuleInfoLen)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(ev.Fd))
+	binary.LittleEndian.PutUint32(buf[4:], response|FAN_INFO)
+	buf[responseSize] = FAN_RESPONSE_INFO_AUDIT_RULE
+	binary.LittleEndian.PutUint16(buf[responseSize+2:], auditRuleInfoLen)
+	binary.LittleEndian.PutUint32(buf[responseSize+4:], rule.Number)
+	binary.LittleEndian.PutUint32(buf[responseSize+8:], rule.SubjTrust)
+	binary.LittleEndian.PutUint32(buf[responseSize+12:], rule.ObjTrust)
+
+	handle.writeMu.Lock()
+	_, err := handle.File.Write(buf)
+	handle.writeMu.Unlock()
+
+	if errors.Is(err, syscall.EINVAL) {
+		// kernel before 6.3, the rejected response was not consumed
+		atomic.StoreInt32(&handle.auditNoInfo, 1)
+
+		return handle.writeResponse(ev, response)
+	}
+
+	if err != nil {
+		return fmt.Errorf("fanotify: response error, %w", err)
+	}
+
+	return nil
+}
+
+// AllowWithAudit answers a permission event with FAN_ALLOW and FAN_AUDIT,
+// see ResponseAudit and Allow.
+func (metadata *EventMetadata) AllowWithAudit(rule AuditRule) error {
+	return metadata.answer(func(handle *NotifyFD) error {
+		return handle.ResponseAudit(metadata, true, rule)
+	})
+}
+
+// DenyWithAudit answers a permission event with FAN_DENY and FAN_AUDIT,
+// see ResponseAudit and Allow.
+func (metadata *EventMetadata) DenyWithAudit(rule AuditRule) error {
+	return metadata.answer(func(handle *NotifyFD) error {
+		return handle.ResponseAudit(metadata, false, rule)
+	})
+}
+
+// AuditRecord is a kernel AUDIT_FANOTIFY record, e.g. a line of
+// '/var/log/audit/audit.log' or of the audit netlink stream.
+type AuditRecord struct {
+	Time time.Time
+	// Serial is the audit event serial, shared with the SYSCALL and PATH
+	// records of the same access.
+	Serial    uint64
+	Resp      uint32
+	FanType   uint32
+	FanInfo   uint32
+	SubjTrust uint32
+	ObjTrust  uint32
+}
+
+// ParseAuditRecord parses an AUDIT_FANOTIFY record, fields missing on older
+// kernels are left zero.
+func ParseAuditRecord(line string) (AuditRecord, error) {
+	var rec AuditRecord
+
+	start := strings.Index(line, "audit(")
+	end := strings.Index(line, "):")
+
+	if start < 0 || end < start {
+		return rec, fmt.Errorf("fanotify: audit error, no audit(time:serial) in %q", line)
+	}
+
+	stamp := strings.SplitN(line[start+len("audit("):end], ":", 2)
+	if len(stamp) != 2 {
+		return rec, fmt.Errorf("fanotify: audit error, invalid audit(time:serial) in %q", line)
+	}
+
+	secs, frac := stamp[0], "0"
+	if i := strings.IndexByte(secs, '.'); i >= 0 {
+		secs, frac = secs[:i], (secs[i+1:] + "000000000")[:9]
+	}
+
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return rec, fmt.Errorf("fanotify: audit error, %w", err)
+	}
+
+	nsec, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return rec, fmt.Errorf("fanotify: audit error, %w", err)
+	}
+
+	rec.Time = time.Unix(sec, nsec)
+
+	if rec.Serial, err = strconv.ParseUint(stamp[1], 10, 64); err != nil {
+		return rec, fmt.Errorf("fanotify: audit error, %w", err)
+	}
+
+	resp := false
+
+	for _, field := range strings.Fields(line[end+2:]) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		base, dst := 10, (*uint32)(nil)
+
+		switch kv[0] {
+		case "resp":
+			dst, resp = &rec.Resp, true
+		case "fan_type":
+			dst = &rec.FanType
+		case "fan_info":
+			base, dst = 16, &rec.FanInfo
+		case "subj_trust":
+			dst = &rec.SubjTrust
+		case "obj_trust":
+			dst = &rec.ObjTrust
+		default:
+			continue
+		}
+
+		v, err := strconv.ParseUint(kv[1], base, 32)
+		if err != nil {
+			return rec, fmt.Errorf("fanotify: audit error, %s: %w", kv[0], err)
+		}
+
+		*dst = uint32(v)
+	}
+
+	if !resp {
+		return rec, fmt.Errorf("fanotify: audit error, not a fanotify record: %q", line)
+	}
+
+	return rec, nil
+}
+
+// AuditDecision is a permission decision sent by AuditCorrelator.
+type AuditDecision struct {
+	// ID is the correlation ID, sent as the audit rule number.
+	ID    uint32
+	PID   int
+	Path  string
+	Allow bool
+	Time  time.Time
+}
+
+// AuditCorrelator sends audited responses tagged with a correlation ID as
+// rule number and matches AUDIT_FANOTIFY records back to the decisions, so
+// compliance pipelines can join the kernel audit trail (and its serial)
+// with the reason for a decision. It needs kernel 6.3+ for FAN_INFO.
+type AuditCorrelator struct {
+	handle *NotifyFD
+	max    int
+
+	mu        sync.Mutex
+	next      uint32
+	order     []uint32
+	decisions map[uint32]AuditDecision
+}
+
+// NewAuditCorrelator returns a correlator responding through notify, keeping
+// up to max unmatched decisions, 4096 when zero.
+func NewAuditCorrelator(notify *NotifyFD, max int) *AuditCorrelator {
+	if max <= 0 {
+		max = defaultAuditDecisions
+	}
+
+	return &AuditCorrelator{
+		handle:    notify,
+		max:       max,
+		decisions: make(map[uint32]AuditDecision),
+	}
+}
+
+// Allow sends an audited allow response, returning the decision.
+func (c *AuditCorrelator) Allow(ev *EventMetadata) (AuditDecision, error) {
+	return c.respond(ev, true)
+}
+
+// Deny sends an audited deny response, returning the decision.
+func (c *AuditCorrelator) Deny(ev *EventMetadata) (AuditDecision, error) {
+	return c.respond(ev, false)
+}
+
+func (c *AuditCorrelator) respond(ev *EventMetadata, allow bool) (AuditDecision, error) {
+	decision := AuditDecision{
+		PID:   ev.GetPID(),
+		Allow: allow,
+		Time:  time.Now(),
+	}
+	decision.Path, _ = ev.GetPath()
+
+	c.mu.Lock()
+
+	c.next++
+	if c.next == 0 {
+		c.next++ // rule number 0 means no rule
+	}
+
+	decision.ID = c.next
+
+	c.order = append(c.order, decision.ID)
+	c.decisions[decision.ID] = decision
+
+	for len(c.order) > c.max {
+		delete(c.decisions, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.mu.Unlock()
+
+	if err := c.handle.ResponseAudit(ev, allow, AuditRule{Number: decision.ID}); err != nil {
+		c.mu.Lock()
+		delete(c.decisions, decision.ID)
+		c.mu.Unlock()
+
+		return decision, err
+	}
+
+	return decision, nil
+}
+
+// Match returns the decision rec was logged for and forgets it.
+func (c *AuditCorrelator) Match(rec AuditRecord) (AuditDecision, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	decision, ok := c.decisions[rec.FanInfo]
+	if ok {
+		delete(c.decisions, rec.FanInfo)
+	}
+
+	return decision, ok
+}
@@ -0,0 +1,132 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Backend is the kernel interface a Watcher reads events from.
+//
+// The inotify backend differs from fanotify:
+//   - events carry no PID, skip PIDs and NotifyFD filters do not apply,
+//   - paths are the watched path joined with the entry name, they are not
+//     resolved and go stale when a watched directory is renamed,
+//   - only the watched directories and files are reported, there are no
+//     mount or filesystem wide watches,
+//   - exec, permission, filesystem error and rename events do not exist,
+//   - WithRecovery is not supported.
+type Backend int
+
+// Watcher backends.
+const (
+	BackendFanotify Backend = iota + 1
+	BackendInotify
+)
+
+// String returns "fanotify" or "inotify".
+func (b Backend) String() string {
+	switch b {
+	case BackendFanotify:
+		return "fanotify"
+	case BackendInotify:
+		return "inotify"
+	default:
+		return fmt.Sprintf("Backend(%d)", int(b))
+	}
+}
+
+// watchInitFlags are the init flags of groups created by WatchPaths.
+const watchInitFlags = profileInitFlags | FAN_CLASS_NOTIF
+
+// DetectBackend returns the backend WatchPaths uses for mask: fanotify when
+// this process can create a notification group, inotify when fanotify is
+// missing (ENOSYS), not permitted (EPERM, e.g. no CAP_SYS_ADMIN or a
+// container seccomp profile) or lacks init flags (EINVAL), and for directory
+// entry and attribute events, which fanotify would report without a path.
+// An error is returned when no backend can report mask.
+func DetectBackend(mask EventMask) (Backend, error) {
+	backend, notify, err := detectBackend(mask)
+	if notify != nil {
+		_ = notify.Close()
+	}
+
+	return backend, err
+}
+
+// detectBackend returns the fanotify group for BackendFanotify.
+func detectBackend(mask EventMask) (Backend, *NotifyFD, error) {
+	if err := mask.Validate(); err != nil {
+		return 0, nil, err
+	}
+
+	if unsupported := mask &^ (inotifyEvents | FAN_ONDIR | FAN_EVENT_ON_CHILD); unsupported != 0 {
+		return 0, nil, invalidFlags("events %s are not supported by WatchPaths", unsupported)
+	}
+
+	if mask&eventInodeBits != 0 {
+		return BackendInotify, nil, nil
+	}
+
+	notify, err := Initialize(watchInitFlags, os.O_RDONLY)
+	switch {
+	case err == nil:
+		return BackendFanotify, notify, nil
+	case errors.Is(err, syscall.ENOSYS), errors.Is(err, syscall.EPERM), errors.Is(err, syscall.EINVAL):
+		return BackendInotify, nil, nil
+	default:
+		return 0, nil, err
+	}
+}
+
+// WatchPaths returns a Watcher for events in mask on paths, directories
+// report events of their direct children. The backend is chosen by
+// DetectBackend, see Backend for the semantic differences of inotify.
+// Unlike NewWatcher the Watcher owns the backend, Close closes it.
+func WatchPaths(mask EventMask, paths []string, opts ...WatcherOption) (*Watcher, error) {
+	backend, notify, err := detectBackend(mask)
+	if err != nil {
+		return nil, err
+	}
+
+	if backend == BackendInotify {
+		in, err := newInotifyWatch(mask, paths)
+		if err != nil {
+			return nil, err
+		}
+
+		w := NewWatcher(nil, opts...)
+		w.inotify, w.owned = in, true
+
+		return w, nil
+	}
+
+	for _, path := range paths {
+		pathMask := mask &^ FAN_EVENT_ON_CHILD
+
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			pathMask |= FAN_EVENT_ON_CHILD
+		}
+
+		if err := notify.Mark(FAN_MARK_ADD, pathMask, AT_FDCWD, path); err != nil {
+			_ = notify.Close()
+
+			return nil, err
+		}
+	}
+
+	w := NewWatcher(notify, opts...)
+	w.owned = true
+
+	return w, nil
+}
+
+// Backend returns the backend the Watcher reads from.
+func (w *Watcher) Backend() Backend {
+	if w.inotify != nil {
+		return BackendInotify
+	}
+
+	return BackendFanotify
+}
@@ -0,0 +1,12 @@
+// Package bench is the benchmark suite of the fanotify package, it has no
+// code outside its tests.
+//
+// Synthetic benchmarks decode events from prepared buffers and run
+// anywhere, live benchmarks (BenchmarkLive*) drive a real fanotify group
+// and are skipped without CAP_SYS_ADMIN. Regressions are found by comparing
+// runs with benchstat:
+//
+//	go test -run - -bench . -count 10 ./bench > base.txt
+//	go test -run - -bench . -count 10 ./bench > new.txt
+//	benchstat base.txt new.txt
+package bench
@@ -0,0 +1,162 @@
+package bench
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// liveFile creates a file in a fresh directory, returning both.
+func liveFile(b *testing.B) (dir, path string) {
+	dir = b.TempDir()
+	path = filepath.Join(dir, "file")
+
+	if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+		b.Fatal(err)
+	}
+
+	return dir, path
+}
+
+// BenchmarkLiveRead measures an open of a watched file until its event was
+// read.
+func BenchmarkLiveRead(b *testing.B) {
+	dir, path := liveFile(b)
+
+	notify, err := fanotify.Initialize(fanotify.FAN_CLASS_NOTIF|fanotify.FAN_CLOEXEC, os.O_RDONLY)
+	if err != nil {
+		b.Skip(err)
+	}
+	defer notify.Close()
+
+	if err := notify.Mark(fanotify.FAN_MARK_ADD, fanotify.FAN_OPEN|fanotify.FAN_EVENT_ON_CHILD, fanotify.AT_FDCWD, dir); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_ = f.Close()
+
+		ev, err := notify.GetEvent()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_ = ev.Close()
+	}
+}
+
+// BenchmarkLivePermission measures an open of a gated file, including the
+// round trip to the handler allowing it.
+func BenchmarkLivePermission(b *testing.B) {
+	dir, path := liveFile(b)
+
+	gate, err := fanotify.NewAccessGate(dir)
+	if err != nil {
+		b.Skip(err)
+	}
+	defer gate.Close()
+
+	gate.OnPerm(fanotify.FAN_OPEN_PERM, func(*fanotify.EventMetadata) bool {
+		return true
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_ = gate.Run(ctx)
+	}()
+
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_ = f.Close()
+	}
+}
+
+// BenchmarkLivePermissionWork is the scaling model of RunSharded, it
+// measures parallel opens of a gated file whose handler hashes 64KiB, read
+// by Run (parallel) or by RunSharded with GOMAXPROCS readers (sharded).
+func BenchmarkLivePermissionWork(b *testing.B) {
+	b.Run("parallel", benchLivePermissionWork(false))
+	b.Run("sharded", benchLivePermissionWork(true))
+}
+
+func benchLivePermissionWork(sharded bool) func(b *testing.B) {
+	return func(b *testing.B) {
+		dir, path := liveFile(b)
+
+		gate, err := fanotify.NewAccessGate(dir)
+		if err != nil {
+			b.Skip(err)
+		}
+		defer gate.Close()
+
+		work := make([]byte, 64<<10)
+
+		gate.OnPerm(fanotify.FAN_OPEN_PERM, func(*fanotify.EventMetadata) bool {
+			sha256.Sum256(work)
+
+			return true
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			if sharded {
+				_ = gate.RunSharded(ctx, fanotify.ShardConfig{})
+			} else {
+				_ = gate.Run(ctx)
+			}
+		}()
+
+		defer func() {
+			cancel()
+			<-done
+		}()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				f, err := os.Open(path)
+				if err != nil {
+					b.Error(err)
+
+					return
+				}
+
+				_ = f.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// fileEvents is the number of events in the file read by read benchmarks.
+const fileEvents = 1 << 16
+
+// syntheticEvents returns n events of mask without an event Fd, so closing
+// them is free, optionally followed by an FID info record.
+func syntheticEvents(n int, mask uint64, info bool) []byte {
+	var buf bytes.Buffer
+
+	record := make([]byte, 32)
+	record[0] = fanotify.FAN_EVENT_INFO_TYPE_FID
+	binary.LittleEndian.PutUint16(record[2:], uint16(len(record)))
+
+	for i := 0; i < n; i++ {
+		ev := fanotify.FanotifyEventMetadata{
+			Event_len:    fanotify.FAN_EVENT_METADATA_LEN,
+			Vers:         fanotify.FANOTIFY_METADATA_VERSION,
+			Metadata_len: fanotify.FAN_EVENT_METADATA_LEN,
+			Mask:         mask,
+			Fd:           fanotify.FAN_NOFD,
+			Pid:          int32(1000 + i%64),
+		}
+
+		if info {
+			ev.Event_len += uint32(len(record))
+		}
+
+		_ = binary.Write(&buf, binary.LittleEndian, &ev)
+
+		if info {
+			buf.Write(record)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// loopReader endlessly repeats buf, which holds whole events.
+type loopReader struct {
+	buf []byte
+	off int
+}
+
+func (r *loopReader) Read(p []byte) (int, error) {
+	n := copy(p, r.buf[r.off:])
+	r.off = (r.off + n) % len(r.buf)
+
+	return n, nil
+}
+
+// rewindReader reads f from the start again at its end.
+type rewindReader struct {
+	f *os.File
+}
+
+func (r rewindReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	if err == io.EOF {
+		if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+
+		return r.f.Read(p)
+	}
+
+	return n, err
+}
+
+// loopHandle returns a handle endlessly reading events.
+func loopHandle(events []byte) *fanotify.NotifyFD {
+	return &fanotify.NotifyFD{
+		Rd: bufio.NewReaderSize(&loopReader{buf: events}, fanotify.ReadBufferSize),
+	}
+}
+
+// BenchmarkGetEvent decodes events from memory (metadata, info), from a
+// file through the read buffer used by Initialize or with two reads per
+// event (read/batch, read/single) and through a typical filter pipeline
+// (filters, compare with metadata for the filter cost).
+func BenchmarkGetEvent(b *testing.B) {
+	b.Run("metadata", benchDecode(syntheticEvents(1024, fanotify.FAN_OPEN, false)))
+	b.Run("info", benchDecode(syntheticEvents(1024, fanotify.FAN_OPEN, true)))
+	b.Run("read/batch", benchRead(true))
+	b.Run("read/single", benchRead(false))
+	b.Run("filters", benchFilters)
+}
+
+func benchDecode(events []byte) func(b *testing.B) {
+	return func(b *testing.B) {
+		handle := loopHandle(events)
+
+		b.ReportAllocs()
+		b.SetBytes(int64(len(events) / 1024))
+
+		for i := 0; i < b.N; i++ {
+			ev, err := handle.GetEvent()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			_ = ev.Close()
+		}
+	}
+}
+
+func benchRead(batch bool) func(b *testing.B) {
+	return func(b *testing.B) {
+		path := filepath.Join(b.TempDir(), "events")
+
+		if err := os.WriteFile(path, syntheticEvents(fileEvents, fanotify.FAN_OPEN, false), 0o600); err != nil {
+			b.Fatal(err)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer f.Close()
+
+		var rd io.Reader = rewindReader{f: f}
+		if batch {
+			rd = bufio.NewReaderSize(rd, fanotify.ReadBufferSize)
+		}
+
+		handle := &fanotify.NotifyFD{Rd: rd}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			ev, err := handle.GetEvent()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			_ = ev.Close()
+		}
+	}
+}
+
+func benchFilters(b *testing.B) {
+	handle := loopHandle(syntheticEvents(1024, fanotify.FAN_OPEN, false))
+
+	handle.SetFilters(
+		fanotify.ExcludePIDs(1, 2, 3, 4, 5, 6, 7, 8),
+		func(ev *fanotify.EventMetadata) bool {
+			return ev.MatchMask(fanotify.FAN_OPEN | fanotify.FAN_CLOSE_WRITE)
+		},
+		func(ev *fanotify.EventMetadata) bool { return ev.GetPID()%2 == 0 },
+	)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		// one read per iteration, most events are dropped by the filters
+		ev, err := handle.GetEventOnce(os.Getpid())
+		if errors.Is(err, fanotify.ErrSkipped) {
+			continue
+		}
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_ = ev.Close()
+	}
+}
+
+// BenchmarkEventRing decodes events into an EventRing, compare with
+// BenchmarkGetEvent/info for the allocations saved.
+func BenchmarkEventRing(b *testing.B) {
+	events := syntheticEvents(1024, fanotify.FAN_OPEN, true)
+
+	ring, err := fanotify.NewEventRing(loopHandle(events), 64, 4*fanotify.ReadBufferSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(events) / 1024))
+
+	for i := 0; i < b.N; i++ {
+		ev, err := ring.Next()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_ = ring.Release(ev)
+	}
+}
+
+// BenchmarkResponseBatcher answers permission events with one write per
+// response (write) or one writev per batch of n responses (batch/n), to
+// /dev/null so that only the syscall cost is measured.
+func BenchmarkResponseBatcher(b *testing.B) {
+	b.Run("write", func(b *testing.B) {
+		handle := responseHandle(b)
+
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			ev, err := handle.GetEvent()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			if err := handle.ResponseAllow(ev); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, n := range []int{16, 256} {
+		n := n
+
+		b.Run("batch/"+strconv.Itoa(n), func(b *testing.B) {
+			handle := responseHandle(b)
+			batcher := fanotify.NewResponseBatcher(handle, n, time.Hour)
+
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				ev, err := handle.GetEvent()
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if err := batcher.Allow(ev); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			if err := batcher.Close(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+// responseHandle returns a handle reading permission events from memory and
+// writing responses to /dev/null.
+func responseHandle(b *testing.B) *fanotify.NotifyFD {
+	f, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Cleanup(func() { f.Close() })
+
+	handle := loopHandle(syntheticEvents(1024, fanotify.FAN_OPEN_PERM, false))
+	handle.File = f
+	handle.Fd = int(f.Fd())
+
+	return handle
+}
+
+// BenchmarkGetPath resolves the path of an event Fd through procfs.
+func BenchmarkGetPath(b *testing.B) {
+	f, err := os.Create(filepath.Join(b.TempDir(), "file"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+
+	ev := &fanotify.EventMetadata{}
+	ev.Fd = int32(f.Fd())
+
+	if _, err := ev.GetPath(); err != nil {
+		b.Skip(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := ev.GetPath(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package fanotify
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func capabilities() (*unix.CapUserHeader, *[2]unix.CapUserData, error) {
+	hdr := &unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := new([2]unix.CapUserData)
+
+	if err := unix.Capget(hdr, &data[0]); err != nil {
+		return nil, nil, fmt.Errorf("fanotify: capget error, %w", err)
+	}
+
+	return hdr, data, nil
+}
+
+// HasCapability reports whether capability (e.g. unix.CAP_SYS_ADMIN) is in
+// the effective set of the current process.
+func HasCapability(capability int) (bool, error) {
+	_, data, err := capabilities()
+	if err != nil {
+		return false, err
+	}
+
+	return data[capability/32].Effective&(1<<(uint(capability)%32)) != 0, nil
+}
+
+// DropCapabilities removes every capability except keep from the effective,
+// permitted and inheritable sets of all threads of the process. Call it once
+// marks are established, reading events and writing permission responses
+// need no capabilities. It fails with ENOTSUP when the binary links cgo
+// (net does by default), build with CGO_ENABLED=0 to use it.
+func DropCapabilities(keep ...int) error {
+	hdr, data, err := capabilities()
+	if err != nil {
+		return err
+	}
+
+	var mask [2]uint32
+
+	for _, capability := range keep {
+		mask[capability/32] |= 1 << (uint(capability) % 32)
+	}
+
+	for i := range data {
+		data[i].Effective &= mask[i]
+		data[i].Permitted &= mask[i]
+		data[i].Inheritable &= mask[i]
+	}
+
+	// capset only affects the calling thread, apply it to every Go thread
+	if _, _, errno := syscall.AllThreadsSyscall(
+		unix.SYS_CAPSET,
+		uintptr(unsafe.Pointer(hdr)),
+		uintptr(unsafe.Pointer(&data[0])),
+		0,
+	); errno != 0 {
+		return fmt.Errorf("fanotify: capset error, %w", errno)
+	}
+
+	return nil
+}
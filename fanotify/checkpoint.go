@@ -0,0 +1,367 @@
+package fanotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrCheckpointClosed is returned by Checkpointer.Publish after Close.
+var ErrCheckpointClosed = errors.New("fanotify: checkpointer closed")
+
+// Acker receives the acknowledgements of an AckingSink.
+type Acker interface {
+	// Ack acknowledges delivered events by Event.Seq.
+	Ack(seqs ...uint64)
+	// Reconnected reports that the sink delivers again after failures,
+	// unacknowledged events are retransmitted.
+	Reconnected()
+}
+
+// AckingSink is a Sink that confirms delivery later than Publish returns,
+// e.g. once a batch was accepted by a remote system. A Checkpointer
+// registers itself as the sink Acker.
+type AckingSink interface {
+	Sink
+	SetAcker(acker Acker)
+}
+
+// CheckpointConfig configures a Checkpointer.
+type CheckpointConfig struct {
+	// Capacity bounds the retained unacknowledged events, the oldest are
+	// dropped to make room for new ones, 4096 when zero.
+	Capacity int
+	// OnError receives errors of retransmissions started by Reconnected,
+	// they are dropped when nil.
+	OnError func(error)
+}
+
+// CheckpointStats are Checkpointer counters.
+type CheckpointStats struct {
+	// Pending is the number of retained unacknowledged events.
+	Pending int
+	// Acked is the number of acknowledged events.
+	Acked uint64
+	// Retransmitted is the number of events published to the sink again.
+	Retransmitted uint64
+	// Dropped is the number of unacknowledged events lost to Capacity.
+	Dropped uint64
+}
+
+// Checkpointer is a Sink giving at-least-once delivery to next within the
+// process lifetime. Events are retained by Event.Seq, assigned by the
+// Watcher in read order, until next acknowledges them: an AckingSink by
+// its Acker, any other sink by Publish returning nil. After a failed
+// Publish of a plain sink, the retained events are retransmitted, in order,
+// before the next event; an AckingSink triggers the retransmission with
+// Reconnected. Retransmitted events may be delivered twice, and after newer
+// ones. Events without Seq are passed through and not retained.
+type Checkpointer struct {
+	next     Sink
+	async    bool
+	capacity int
+	onError  func(error)
+
+	// sendMu serializes publishing to next
+	sendMu sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	pending map[uint64]*retainedEvent
+	// order holds retained seqs oldest first, acknowledged ones are
+	// skipped and compacted lazily
+	order          []uint64
+	last           uint64
+	failing        bool
+	retransmitting bool
+	closed         bool
+	stats          CheckpointStats
+}
+
+type retainedEvent struct {
+	ev   Event
+	sent bool
+}
+
+// NewCheckpointer returns a Checkpointer publishing events to next.
+func NewCheckpointer(next Sink, cfg CheckpointConfig) *Checkpointer {
+	if cfg.Capacity <= 0 {
+		cfg.Capacity = 4096
+	}
+
+	c := &Checkpointer{
+		next:     next,
+		capacity: cfg.Capacity,
+		onError:  cfg.OnError,
+		pending:  make(map[uint64]*retainedEvent),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	if sink, ok := next.(AckingSink); ok {
+		c.async = true
+		sink.SetAcker(c)
+	}
+
+	return c
+}
+
+// Publish implements Sink, ev is retained until acknowledged.
+func (c *Checkpointer) Publish(ctx context.Context, ev Event) error {
+	if ev.Seq == 0 {
+		return c.send(ctx, ev)
+	}
+
+	c.mu.Lock()
+
+	if c.closed {
+		c.mu.Unlock()
+
+		return ErrCheckpointClosed
+	}
+
+	c.retainLocked(ev)
+	resend := c.failing
+	c.mu.Unlock()
+
+	if resend {
+		return c.Retransmit(ctx)
+	}
+
+	return c.deliver(ctx, ev.Seq)
+}
+
+// retainLocked stores ev, evicting the oldest event when full.
+func (c *Checkpointer) retainLocked(ev Event) {
+	if _, ok := c.pending[ev.Seq]; ok {
+		return
+	}
+
+	for len(c.pending) >= c.capacity && len(c.order) > 0 {
+		seq := c.order[0]
+		c.order = c.order[1:]
+
+		if _, ok := c.pending[seq]; ok {
+			delete(c.pending, seq)
+			c.stats.Dropped++
+		}
+	}
+
+	c.pending[ev.Seq] = &retainedEvent{ev: ev}
+	c.order = append(c.order, ev.Seq)
+
+	if ev.Seq > c.last {
+		c.last = ev.Seq
+	}
+}
+
+// deliver publishes the retained event seq, a plain sink acknowledges it by
+// accepting it.
+func (c *Checkpointer) deliver(ctx context.Context, seq uint64) error {
+	c.mu.Lock()
+	r, ok := c.pending[seq]
+
+	if !ok {
+		// acknowledged or dropped meanwhile
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	ev := r.ev
+
+	if r.sent {
+		c.stats.Retransmitted++
+	}
+
+	r.sent = true
+	c.mu.Unlock()
+
+	if err := c.send(ctx, ev); err != nil {
+		if !c.async {
+			c.mu.Lock()
+			c.failing = true
+			c.mu.Unlock()
+		}
+
+		return err
+	}
+
+	if !c.async {
+		c.Ack(seq)
+	}
+
+	return nil
+}
+
+func (c *Checkpointer) send(ctx context.Context, ev Event) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	return c.next.Publish(ctx, ev)
+}
+
+// Retransmit publishes all unacknowledged events to next again, oldest
+// first, and stops at the first error.
+func (c *Checkpointer) Retransmit(ctx context.Context) error {
+	c.mu.Lock()
+	seqs := c.seqsLocked()
+	c.mu.Unlock()
+
+	for _, seq := range seqs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := c.deliver(ctx, seq); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.failing = false
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Ack implements Acker, acknowledged events are released.
+func (c *Checkpointer) Ack(seqs ...uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, seq := range seqs {
+		if _, ok := c.pending[seq]; ok {
+			delete(c.pending, seq)
+			c.stats.Acked++
+		}
+	}
+
+	c.compactLocked()
+}
+
+// Reconnected implements Acker, it starts a retransmission unless one is
+// running.
+func (c *Checkpointer) Reconnected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || c.retransmitting || len(c.pending) == 0 {
+		return
+	}
+
+	c.retransmitting = true
+	c.wg.Add(1)
+
+	go func() {
+		defer c.wg.Done()
+
+		err := c.Retransmit(c.ctx)
+
+		c.mu.Lock()
+		c.retransmitting = false
+		c.mu.Unlock()
+
+		if err != nil && !errors.Is(err, context.Canceled) && c.onError != nil {
+			c.onError(fmt.Errorf("fanotify: checkpoint error, %w", err))
+		}
+	}()
+}
+
+// compactLocked drops acknowledged seqs from the head of order, and
+// rebuilds order once acknowledged seqs behind an old event pile up.
+func (c *Checkpointer) compactLocked() {
+	for len(c.order) > 0 {
+		if _, ok := c.pending[c.order[0]]; ok {
+			break
+		}
+
+		c.order = c.order[1:]
+	}
+
+	if len(c.order) > 2*c.capacity {
+		c.order = c.seqsLocked()
+	}
+}
+
+// seqsLocked returns the retained seqs, oldest first.
+func (c *Checkpointer) seqsLocked() []uint64 {
+	seqs := make([]uint64, 0, len(c.pending))
+	for seq := range c.pending {
+		seqs = append(seqs, seq)
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	return seqs
+}
+
+// Checkpoint returns the highest Seq up to which every event was
+// acknowledged or dropped, zero before the first acknowledgement.
+func (c *Checkpointer) Checkpoint() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.compactLocked()
+
+	if len(c.order) == 0 {
+		return c.last
+	}
+
+	return c.order[0] - 1
+}
+
+// Unacked returns copies of the unacknowledged events, oldest first.
+func (c *Checkpointer) Unacked() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seqs := c.seqsLocked()
+	events := make([]Event, len(seqs))
+
+	for i, seq := range seqs {
+		events[i] = c.pending[seq].ev
+	}
+
+	return events
+}
+
+// Stats returns current counters.
+func (c *Checkpointer) Stats() CheckpointStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Pending = len(c.pending)
+
+	return stats
+}
+
+// Run blocks until ctx is done, then closes the checkpointer, see
+// SpillBuffer.Run.
+func (c *Checkpointer) Run(ctx context.Context) error {
+	return runUntilDone(ctx, c.ctx.Done(), c.Close)
+}
+
+// Close implements Sink, it cancels a running retransmission and closes
+// next. Unacknowledged events are lost.
+func (c *Checkpointer) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	c.closed = true
+	c.cancel()
+	c.mu.Unlock()
+
+	c.wg.Wait()
+
+	return c.next.Close()
+}
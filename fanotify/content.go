@@ -0,0 +1,84 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+)
+
+// ErrContentTooLarge is returned by ReadContent when file content exceeds the requested limit.
+var ErrContentTooLarge = errors.New("fanotify: content exceeds size limit")
+
+// readChunk is the pread size used by ReadContent.
+const readChunk = 64 * 1024
+
+type fdReaderAt int32
+
+// ReadAt implements io.ReaderAt using pread, file offset is never changed.
+func (fd fdReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	var total int
+
+	for total < len(p) {
+		n, err := sysPread(int(fd), p[total:], off+int64(total))
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+
+		if err != nil {
+			return total, fmt.Errorf("fanotify: content error, %w", err)
+		}
+
+		if n == 0 {
+			return total, io.EOF
+		}
+
+		total += n
+	}
+
+	return total, nil
+}
+
+// ReaderAt returns io.ReaderAt over file content of event metadata supplied Fd.
+// Reads use pread, so the file offset shared with the process that triggered
+// the event is left untouched, unlike reading from File().
+func (metadata *EventMetadata) ReaderAt() io.ReaderAt {
+	return fdReaderAt(metadata.Fd)
+}
+
+// ReadContent reads file content of event metadata supplied Fd with pread.
+// When maxSize is positive and the content is larger, the first maxSize bytes
+// are returned together with ErrContentTooLarge.
+func (metadata *EventMetadata) ReadContent(maxSize int64) ([]byte, error) {
+	var (
+		out []byte
+		off int64
+	)
+
+	rd := metadata.ReaderAt()
+	buf := make([]byte, readChunk)
+
+	for {
+		chunk := buf
+		if maxSize > 0 && maxSize-off < int64(len(chunk)) {
+			// read one byte past the limit to tell "exactly maxSize" from "more"
+			chunk = buf[:maxSize-off+1]
+		}
+
+		n, err := rd.ReadAt(chunk, off)
+		out = append(out, chunk[:n]...)
+		off += int64(n)
+
+		if maxSize > 0 && off > maxSize {
+			return out[:maxSize], ErrContentTooLarge
+		}
+
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+
+		if err != nil {
+			return out, err
+		}
+	}
+}
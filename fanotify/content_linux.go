@@ -0,0 +1,113 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// contentSeals make a content memfd immutable.
+const contentSeals = unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE | unix.F_SEAL_SEAL
+
+// SpliceContent moves file content of event metadata supplied Fd into the
+// pipe pipeFd with splice(2), without copying it through userspace, for
+// scanners reading content from a pipe. It returns the number of bytes
+// moved, with ReadContent semantics for the file offset and maxSize. It
+// blocks while the pipe is full unless pipeFd is non-blocking, the error is
+// then EAGAIN.
+func (metadata *EventMetadata) SpliceContent(pipeFd int, maxSize int64) (int64, error) {
+	size, tooLarge, err := metadata.contentSize(maxSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var off int64
+
+	for off < size {
+		n, err := unix.Splice(int(metadata.Fd), &off, pipeFd, nil, int(size-off), unix.SPLICE_F_MOVE|unix.SPLICE_F_MORE)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+
+		if err != nil {
+			return off, fmt.Errorf("fanotify: content error, splice: %w", err)
+		}
+
+		if n == 0 {
+			return off, nil
+		}
+	}
+
+	return off, tooLarge
+}
+
+// ContentMemfd returns a sealed memfd holding file content of event metadata
+// supplied Fd, copied in the kernel with sendfile(2), for scanners consuming
+// an fd. The snapshot can not change while it is scanned, unlike the file
+// itself once the event is answered, close it when done. maxSize and the
+// file offset are handled as by ReadContent, the memfd holds the first
+// maxSize bytes along with ErrContentTooLarge then.
+func (metadata *EventMetadata) ContentMemfd(maxSize int64) (*os.File, error) {
+	size, tooLarge, err := metadata.contentSize(maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.MemfdCreate("fanotify-content", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: content error, memfd: %w", err)
+	}
+
+	file := os.NewFile(uintptr(fd), "fanotify-content")
+
+	var off int64
+
+	for off < size {
+		n, err := unix.Sendfile(fd, int(metadata.Fd), &off, int(size-off))
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+
+		if err != nil {
+			_ = file.Close()
+
+			return nil, fmt.Errorf("fanotify: content error, sendfile: %w", err)
+		}
+
+		if n == 0 {
+			break
+		}
+	}
+
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_ADD_SEALS, contentSeals); err != nil {
+		_ = file.Close()
+
+		return nil, fmt.Errorf("fanotify: content error, seal: %w", err)
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		_ = file.Close()
+
+		return nil, fmt.Errorf("fanotify: content error, %w", err)
+	}
+
+	return file, tooLarge
+}
+
+// contentSize returns the number of bytes to copy for maxSize, and
+// ErrContentTooLarge as tooLarge when the file is larger.
+func (metadata *EventMetadata) contentSize(maxSize int64) (size int64, tooLarge, err error) {
+	var st unix.Stat_t
+
+	if err := unix.Fstat(int(metadata.Fd), &st); err != nil {
+		return 0, nil, fmt.Errorf("fanotify: content error, %w", err)
+	}
+
+	if maxSize > 0 && st.Size > maxSize {
+		return maxSize, ErrContentTooLarge, nil
+	}
+
+	return st.Size, nil, nil
+}
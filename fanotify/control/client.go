@@ -0,0 +1,150 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// Client sends requests to a Server, it is safe for concurrent use.
+type Client struct {
+	mu   sync.Mutex
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+}
+
+// Dial connects to a Server listening on unix socket path.
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("control: dial error, %w", err)
+	}
+
+	return &Client{
+		conn: conn,
+		enc:  json.NewEncoder(conn),
+		dec:  json.NewDecoder(conn),
+	}, nil
+}
+
+// Do sends req and waits for its response, a Response.Error is returned as
+// error.
+func (c *Client) Do(req Request) (Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.enc.Encode(req); err != nil {
+		return Response{}, fmt.Errorf("control: request error, %w", err)
+	}
+
+	var resp Response
+
+	if err := c.dec.Decode(&resp); err != nil {
+		return Response{}, fmt.Errorf("control: response error, %w", err)
+	}
+
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+
+	return resp, nil
+}
+
+// Marks returns the recorded marks of the watcher.
+func (c *Client) Marks() ([]fanotify.PlanMark, error) {
+	resp, err := c.Do(Request{Op: OpMarks})
+
+	return resp.Marks, err
+}
+
+// AddMark adds mark.
+func (c *Client) AddMark(mark fanotify.PlanMark) error {
+	_, err := c.Do(Request{Op: OpAddMark, Mark: &mark})
+
+	return err
+}
+
+// RemoveMark removes the masks of mark.
+func (c *Client) RemoveMark(mark fanotify.PlanMark) error {
+	_, err := c.Do(Request{Op: OpRemoveMark, Mark: &mark})
+
+	return err
+}
+
+// SetFilters replaces the filters of the watcher, see Server.KeepFilters.
+func (c *Client) SetFilters(filters fanotify.PlanFilters) error {
+	_, err := c.Do(Request{Op: OpSetFilters, Filters: &filters})
+
+	return err
+}
+
+// Apply moves marks and filters of the watcher to plan and returns the
+// applied diff.
+func (c *Client) Apply(plan fanotify.WatchPlan) (fanotify.PlanDiff, error) {
+	resp, err := c.Do(Request{Op: OpApply, Plan: &plan})
+	if resp.Diff == nil {
+		return fanotify.PlanDiff{}, err
+	}
+
+	return *resp.Diff, err
+}
+
+// Stats returns the watcher health.
+func (c *Client) Stats() (Stats, error) {
+	resp, err := c.Do(Request{Op: OpStats})
+	if err != nil {
+		return Stats{}, err
+	}
+
+	if resp.Stats == nil {
+		return Stats{}, fmt.Errorf("control: response error, no stats")
+	}
+
+	return *resp.Stats, nil
+}
+
+// Drain stops the watcher once the events it read are published.
+func (c *Client) Drain() error {
+	_, err := c.Do(Request{Op: OpDrain})
+
+	return err
+}
+
+// Suppress opens window for d and returns it with its ID.
+func (c *Client) Suppress(window fanotify.Suppression, d time.Duration) (fanotify.Suppression, error) {
+	resp, err := c.Do(Request{Op: OpSuppress, Suppression: &window, Duration: d.String()})
+	if err != nil {
+		return fanotify.Suppression{}, err
+	}
+
+	if resp.Window == nil {
+		return fanotify.Suppression{}, fmt.Errorf("control: response error, no window")
+	}
+
+	return *resp.Window, nil
+}
+
+// Lift closes the suppression window with id.
+func (c *Client) Lift(id uint64) error {
+	_, err := c.Do(Request{Op: OpLift, ID: id})
+
+	return err
+}
+
+// Windows returns open suppression windows.
+func (c *Client) Windows() ([]fanotify.Suppression, error) {
+	resp, err := c.Do(Request{Op: OpWindows})
+
+	return resp.Windows, err
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,385 @@
+// Package control reconfigures a running fanotify.Watcher over a unix
+// domain socket: marks are added and removed, filters replaced, stats
+// queried and the watcher drained, without restarting the agent.
+//
+// The wire protocol is newline delimited JSON: a client writes one Request
+// object per line and the server answers each with one Response object, in
+// order, on the same connection.
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+	"github.com/s3rj1k/go-fanotify/fanotify/export"
+)
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("control: server closed")
+
+// Request operations.
+const (
+	// OpMarks lists the recorded marks as Response.Marks.
+	OpMarks = "marks"
+	// OpAddMark adds Request.Mark.
+	OpAddMark = "add_mark"
+	// OpRemoveMark removes the masks of Request.Mark.
+	OpRemoveMark = "remove_mark"
+	// OpSetFilters replaces the filters with Request.Filters.
+	OpSetFilters = "set_filters"
+	// OpApply moves marks and filters to Request.Plan, see
+	// fanotify.NotifyFD.ApplyConfig, and returns Response.Diff.
+	OpApply = "apply"
+	// OpStats returns Response.Stats.
+	OpStats = "stats"
+	// OpDrain stops a watcher run by Start after publishing the events it
+	// read, see fanotify.Watcher.Stop.
+	OpDrain = "drain"
+	// OpSuppress opens Request.Suppression for Request.Duration and returns
+	// it as Response.Window.
+	OpSuppress = "suppress"
+	// OpLift closes the suppression window Request.ID.
+	OpLift = "lift"
+	// OpWindows lists open suppression windows as Response.Windows.
+	OpWindows = "windows"
+)
+
+// Request is one command sent to a Server.
+type Request struct {
+	Op      string                `json:"op"`
+	Mark    *fanotify.PlanMark    `json:"mark,omitempty"`
+	Filters *fanotify.PlanFilters `json:"filters,omitempty"`
+	Plan    *fanotify.WatchPlan   `json:"plan,omitempty"`
+
+	Suppression *fanotify.Suppression `json:"suppression,omitempty"`
+	// Duration is a time.ParseDuration string, e.g. "30m".
+	Duration string `json:"duration,omitempty"`
+	ID       uint64 `json:"id,omitempty"`
+}
+
+// Response answers a Request, Error is set when it failed.
+type Response struct {
+	Error   string                 `json:"error,omitempty"`
+	Marks   []fanotify.PlanMark    `json:"marks,omitempty"`
+	Diff    *fanotify.PlanDiff     `json:"diff,omitempty"`
+	Stats   *Stats                 `json:"stats,omitempty"`
+	Window  *fanotify.Suppression  `json:"window,omitempty"`
+	Windows []fanotify.Suppression `json:"windows,omitempty"`
+}
+
+// Stats is the serializable fanotify.WatcherHealth.
+type Stats struct {
+	Running    bool      `json:"running"`
+	LastRead   time.Time `json:"last_read"`
+	LastEvent  time.Time `json:"last_event"`
+	Pending    int       `json:"pending"`
+	Published  uint64    `json:"published"`
+	Dropped    uint64    `json:"dropped"`
+	Recoveries int       `json:"recoveries"`
+	Err        string    `json:"err,omitempty"`
+}
+
+// Server executes requests against a Watcher.
+type Server struct {
+	// Authorize, when set, is called with the peer credentials of every
+	// client, see export.PeerCred, an error rejects the client. Without it
+	// the socket permissions are the only access control, see
+	// export.Listen.
+	Authorize func(peer export.Peer) error
+
+	// KeepFilters are kept in front of filters set by OpSetFilters and
+	// OpApply, e.g.
+	// a RuleSet or Suppressor Apply registered with the handle options.
+	KeepFilters []fanotify.Filter
+
+	// Suppressor enables OpSuppress, OpLift and OpWindows.
+	Suppressor *fanotify.Suppressor
+
+	watcher *fanotify.Watcher
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	// wg counts the goroutines serving connections
+	wg sync.WaitGroup
+}
+
+// NewServer returns a Server controlling w.
+func NewServer(w *fanotify.Watcher) *Server {
+	return &Server{
+		watcher:   w,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts clients on l until Close is called.
+func (srv *Server) Serve(l net.Listener) error {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+
+		return ErrServerClosed
+	}
+
+	srv.listeners[l] = struct{}{}
+	srv.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			srv.mu.Lock()
+			closed := srv.closed
+			delete(srv.listeners, l)
+			srv.mu.Unlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+
+			return fmt.Errorf("control: accept error, %w", err)
+		}
+
+		if !srv.track(conn) {
+			conn.Close()
+
+			continue
+		}
+
+		go srv.handle(conn)
+	}
+}
+
+// Run serves clients on l until ctx is done, then closes the server and
+// waits for the goroutines serving connections to return. It returns
+// ctx.Err(), nil after Close or the accept error, see export.Server.Run.
+func (srv *Server) Run(ctx context.Context, l net.Listener) error {
+	served := make(chan error, 1)
+
+	go func() {
+		served <- srv.Serve(l)
+	}()
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+		srv.Close()
+		<-served
+
+		err = ctx.Err()
+	case err = <-served:
+		if errors.Is(err, ErrServerClosed) {
+			err = nil
+		} else {
+			// disconnect clients of a failed listener
+			srv.Close()
+		}
+	}
+
+	srv.wg.Wait()
+
+	return err
+}
+
+// track registers a connection served by a goroutine, it returns 'false'
+// after Close.
+func (srv *Server) track(conn net.Conn) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.closed {
+		return false
+	}
+
+	srv.conns[conn] = struct{}{}
+	srv.wg.Add(1)
+
+	return true
+}
+
+func (srv *Server) untrack(conn net.Conn) {
+	srv.mu.Lock()
+	delete(srv.conns, conn)
+	srv.mu.Unlock()
+
+	conn.Close()
+	srv.wg.Done()
+}
+
+func (srv *Server) handle(conn net.Conn) {
+	defer srv.untrack(conn)
+
+	if srv.Authorize != nil {
+		peer, err := export.PeerCred(conn)
+		if err == nil {
+			err = srv.Authorize(peer)
+		}
+
+		if err != nil {
+			_ = json.NewEncoder(conn).Encode(Response{Error: err.Error()})
+
+			return
+		}
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+
+	for {
+		var req Request
+
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+
+		resp, err := srv.Do(req)
+		if err != nil {
+			resp = Response{Error: err.Error()}
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// Do executes req, it is what Serve runs for every request.
+func (srv *Server) Do(req Request) (Response, error) {
+	switch req.Op {
+	case OpStats:
+		return Response{Stats: stats(srv.watcher.Health())}, nil
+	case OpDrain:
+		return Response{}, srv.watcher.Stop()
+	case OpSuppress, OpLift, OpWindows:
+		return srv.suppress(req)
+	}
+
+	notify := srv.watcher.Notify()
+	if notify == nil {
+		return Response{}, fmt.Errorf("control: %s error, watcher has no fanotify handle", req.Op)
+	}
+
+	switch req.Op {
+	case OpMarks:
+		return Response{Marks: notify.Plan().Marks}, nil
+	case OpAddMark, OpRemoveMark:
+		if req.Mark == nil {
+			return Response{}, fmt.Errorf("control: %s error, no mark", req.Op)
+		}
+
+		if req.Op == OpAddMark {
+			return Response{}, notify.AddMark(*req.Mark)
+		}
+
+		return Response{}, notify.RemoveMark(*req.Mark)
+	case OpSetFilters:
+		if req.Filters == nil {
+			return Response{}, fmt.Errorf("control: %s error, no filters", req.Op)
+		}
+
+		srv.setFilters(notify, *req.Filters)
+
+		return Response{}, nil
+	case OpApply:
+		if req.Plan == nil {
+			return Response{}, fmt.Errorf("control: %s error, no plan", req.Op)
+		}
+
+		diff := fanotify.DiffMarks(notify.Plan().Marks, req.Plan.Marks)
+		if err := notify.ApplyDiff(diff); err != nil {
+			return Response{Diff: &diff}, err
+		}
+
+		srv.setFilters(notify, req.Plan.Filters)
+
+		return Response{Diff: &diff}, nil
+	default:
+		return Response{}, fmt.Errorf("control: unknown op %q", req.Op)
+	}
+}
+
+// setFilters replaces the filters of notify with KeepFilters and filters.
+func (srv *Server) setFilters(notify *fanotify.NotifyFD, filters fanotify.PlanFilters) {
+	keep := append([]fanotify.Filter(nil), srv.KeepFilters...)
+	notify.SetFilters(append(keep, filters.Filters()...)...)
+}
+
+// suppress executes the suppression window requests.
+func (srv *Server) suppress(req Request) (Response, error) {
+	if srv.Suppressor == nil {
+		return Response{}, fmt.Errorf("control: %s error, no suppressor", req.Op)
+	}
+
+	switch req.Op {
+	case OpSuppress:
+		if req.Suppression == nil {
+			return Response{}, fmt.Errorf("control: %s error, no suppression", req.Op)
+		}
+
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return Response{}, fmt.Errorf("control: %s error, invalid duration %q", req.Op, req.Duration)
+		}
+
+		window := srv.Suppressor.Suppress(*req.Suppression, d)
+
+		return Response{Window: &window}, nil
+	case OpLift:
+		if !srv.Suppressor.Lift(req.ID) {
+			return Response{}, fmt.Errorf("control: %s error, no window %d", req.Op, req.ID)
+		}
+
+		return Response{}, nil
+	default:
+		return Response{Windows: srv.Suppressor.Windows()}, nil
+	}
+}
+
+func stats(h fanotify.WatcherHealth) *Stats {
+	s := &Stats{
+		Running:    h.Running,
+		LastRead:   h.LastRead,
+		LastEvent:  h.LastEvent,
+		Pending:    h.Pending,
+		Published:  h.Published,
+		Dropped:    h.Dropped,
+		Recoveries: h.Recoveries,
+	}
+
+	if h.Err != nil {
+		s.Err = h.Err.Error()
+	}
+
+	return s
+}
+
+// Close stops all listeners and disconnects clients.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.closed = true
+
+	var err error
+
+	for l := range srv.listeners {
+		if e := l.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	for conn := range srv.conns {
+		conn.Close()
+	}
+
+	return err
+}
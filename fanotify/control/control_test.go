@@ -0,0 +1,77 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkGoroutines fails t when more than before goroutines are left, they
+// are given a moment to return.
+func checkGoroutines(t testing.TB, before int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines left, want %d:\n%s",
+				runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	path := filepath.Join(t.TempDir(), "control.sock")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewServer(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() { done <- srv.Run(ctx, l) }()
+
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// an answered request means the connection is being served
+	if _, err := c.Windows(); err == nil || !strings.Contains(err.Error(), "no suppressor") {
+		t.Fatalf("got %v, want the no suppressor error", err)
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Run: got %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+
+	if _, err := c.Windows(); err == nil || strings.Contains(err.Error(), "no suppressor") {
+		t.Fatalf("got %v, want a connection error", err)
+	}
+
+	c.Close()
+	checkGoroutines(t, before)
+}
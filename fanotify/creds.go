@@ -0,0 +1,198 @@
+package fanotify
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Credentials are the user and group IDs of the process that generated an
+// event.
+type Credentials struct {
+	UID  int `json:"uid"`
+	EUID int `json:"euid"`
+	GID  int `json:"gid"`
+	EGID int `json:"egid"`
+	// LoginUID is the audit login UID, kept across su and sudo, -1 for
+	// processes outside a login session such as daemons, or without
+	// kernel audit support.
+	LoginUID int `json:"login_uid"`
+}
+
+// unsetLoginUID is the loginuid of processes that never logged in.
+const unsetLoginUID = 4294967295
+
+// GetCredentials reads the credentials of the process that generated the
+// event from '/proc/PID/status' and '/proc/PID/loginuid'. When the group
+// reports pidfds, FAN_REPORT_PIDFD, the process is verified before and
+// after reading, and ErrProcessGone is returned for a recycled PID. The
+// result is memoized by the event, so that filters and enrichers share one
+// lookup.
+func (metadata *EventMetadata) GetCredentials() (Credentials, error) {
+	// states and memoization as for pathState
+	if atomic.LoadInt32(&metadata.credsState) == pathResolved {
+		return metadata.creds, metadata.credsErr
+	}
+
+	creds, err := metadata.readCredentials()
+
+	if atomic.CompareAndSwapInt32(&metadata.credsState, pathUnresolved, pathStoring) {
+		metadata.creds, metadata.credsErr = creds, err
+		atomic.StoreInt32(&metadata.credsState, pathResolved)
+	}
+
+	return creds, err
+}
+
+func (metadata *EventMetadata) readCredentials() (Credentials, error) {
+	if err := metadata.verifyProcessPidfd(); err != nil {
+		return Credentials{}, err
+	}
+
+	dir := filepath.Join(ProcFs, strconv.Itoa(metadata.GetPID()))
+
+	content, err := os.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	creds := Credentials{LoginUID: -1}
+
+	var uids, gids []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		switch {
+		case len(fields) < 3:
+		case fields[0] == "Uid:":
+			uids = fields[1:]
+		case fields[0] == "Gid:":
+			gids = fields[1:]
+		}
+	}
+
+	if uids == nil || gids == nil {
+		return Credentials{}, fmt.Errorf("fanotify: procfs error, no Uid or Gid in status of PID %d", metadata.GetPID())
+	}
+
+	for _, v := range []struct {
+		dst *int
+		id  string
+	}{
+		{&creds.UID, uids[0]},
+		{&creds.EUID, uids[1]},
+		{&creds.GID, gids[0]},
+		{&creds.EGID, gids[1]},
+	} {
+		if *v.dst, err = strconv.Atoi(v.id); err != nil {
+			return Credentials{}, fmt.Errorf("fanotify: procfs error, %w", err)
+		}
+	}
+
+	// loginuid is missing without CONFIG_AUDIT
+	if content, err := os.ReadFile(filepath.Join(dir, "loginuid")); err == nil {
+		if id, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 32); err == nil && id != unsetLoginUID {
+			creds.LoginUID = int(id)
+		}
+	}
+
+	if err := metadata.verifyProcessPidfd(); err != nil {
+		return Credentials{}, err
+	}
+
+	return creds, nil
+}
+
+// WithCredentials enriches every event with the credentials of its process,
+// see GetCredentials. Events of exited processes carry none.
+func WithCredentials() Option {
+	return WithEnricher(func(metadata *EventMetadata) {
+		if creds, err := metadata.GetCredentials(); err == nil {
+			metadata.Creds = &creds
+		}
+	})
+}
+
+// IncludeUIDs keeps only events generated by processes running with listed
+// real UIDs. Events of processes that already exited are dropped.
+func IncludeUIDs(uids ...int) Filter {
+	set := idSet(uids)
+
+	return func(metadata *EventMetadata) bool {
+		creds, err := metadata.GetCredentials()
+		if err != nil {
+			return false
+		}
+
+		_, ok := set[creds.UID]
+
+		return ok
+	}
+}
+
+// IncludeGIDs keeps only events generated by processes running with listed
+// real GIDs. Events of processes that already exited are dropped.
+func IncludeGIDs(gids ...int) Filter {
+	set := idSet(gids)
+
+	return func(metadata *EventMetadata) bool {
+		creds, err := metadata.GetCredentials()
+		if err != nil {
+			return false
+		}
+
+		_, ok := set[creds.GID]
+
+		return ok
+	}
+}
+
+// ExcludeGIDs drops events generated by processes running with listed real
+// GIDs. Events of processes that already exited are kept.
+func ExcludeGIDs(gids ...int) Filter {
+	set := idSet(gids)
+
+	return func(metadata *EventMetadata) bool {
+		creds, err := metadata.GetCredentials()
+		if err != nil {
+			return true
+		}
+
+		_, ok := set[creds.GID]
+
+		return !ok
+	}
+}
+
+// LoginSessions keeps only events of processes inside a login session,
+// having a login UID, when interactive is 'true', and only events of
+// processes outside one, e.g. daemons, otherwise. Events of processes that
+// already exited are dropped.
+func LoginSessions(interactive bool) Filter {
+	return func(metadata *EventMetadata) bool {
+		creds, err := metadata.GetCredentials()
+		if err != nil {
+			return false
+		}
+
+		return (creds.LoginUID >= 0) == interactive
+	}
+}
+
+func idSet(ids []int) map[int]struct{} {
+	set := make(map[int]struct{}, len(ids))
+
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+
+	return set
+}
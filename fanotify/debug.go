@@ -0,0 +1,185 @@
+package fanotify
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DebugFdLeaks enables accounting of every event Fd handed out by GetEvent,
+// recording the stack trace of the acquisition, plus a finalizer based
+// detector for events that were garbage collected while still open, events
+// of an EventRing are tracked without it. It costs
+// a stack capture and a finalizer per event and is meant for development
+// builds and tests, set it before reading events.
+var DebugFdLeaks = false
+
+// FdLeakHandler is called for every leaked event Fd found by the detector or
+// by a reporter started with StartFdLeakReporter. Fds found by the finalizer
+// are closed right after the handler returns.
+var FdLeakHandler = func(leak FdLeak) {
+	log.Printf("fanotify: %v\n", leak)
+}
+
+// FdLeak describes an event Fd that is still open.
+type FdLeak struct {
+	Fd       int
+	Acquired time.Time
+	Stack    string
+}
+
+// String implements fmt.Stringer.
+func (leak FdLeak) String() string {
+	return fmt.Sprintf(
+		"event Fd %d open since %s, acquired at:\n%s",
+		leak.Fd, leak.Acquired.Format(time.RFC3339Nano), leak.Stack,
+	)
+}
+
+var fdLeaks = struct {
+	sync.Mutex
+	open map[int32]FdLeak
+}{
+	open: make(map[int32]FdLeak),
+}
+
+func trackFdLeak(event *EventMetadata) {
+	if event.Fd < 0 {
+		return
+	}
+
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+
+	fdLeaks.Lock()
+	fdLeaks.open[event.Fd] = FdLeak{
+		Fd:       int(event.Fd),
+		Acquired: time.Now(),
+		Stack:    string(buf),
+	}
+	fdLeaks.Unlock()
+
+	// events of an EventRing live inside its slot array, which can not
+	// carry a finalizer, their Fds are only tracked
+	if event.ring != nil {
+		return
+	}
+
+	runtime.SetFinalizer(event, func(metadata *EventMetadata) {
+		if !atomic.CompareAndSwapInt32(&metadata.fdState, fdOpen, fdClosed) {
+			return
+		}
+
+		leak := untrackFdLeak(metadata)
+
+		if FdLeakHandler != nil {
+			FdLeakHandler(leak)
+		}
+
+		_ = sysClose(int(metadata.Fd))
+	})
+}
+
+func untrackFdLeak(event *EventMetadata) FdLeak {
+	fdLeaks.Lock()
+	defer fdLeaks.Unlock()
+
+	leak, ok := fdLeaks.open[event.Fd]
+	if !ok {
+		leak = FdLeak{Fd: int(event.Fd)}
+	}
+
+	delete(fdLeaks.open, event.Fd)
+
+	return leak
+}
+
+// OpenEventFds returns all tracked event Fds that were neither closed nor
+// handed over with TakeFile, oldest first.
+func OpenEventFds() []FdLeak {
+	fdLeaks.Lock()
+	out := make([]FdLeak, 0, len(fdLeaks.open))
+
+	for _, leak := range fdLeaks.open {
+		out = append(out, leak)
+	}
+	fdLeaks.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Acquired.Before(out[j].Acquired)
+	})
+
+	return out
+}
+
+// CheckFdLeaks returns an error listing every tracked event Fd that is still
+// open, it is meant to be deferred in tests after all events were handled,
+// see CheckFdLeaksT.
+func CheckFdLeaks() error {
+	leaks := OpenEventFds()
+	if len(leaks) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+
+	for i := range leaks {
+		fmt.Fprintf(&b, "\n%v", leaks[i])
+	}
+
+	return fmt.Errorf("fanotify: %d event Fd(s) leaked:%s", len(leaks), b.String())
+}
+
+// TestingT is the part of testing.TB used by CheckFdLeaksT.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// CheckFdLeaksT reports every tracked event Fd that is still open as an
+// error of t, with the stack it was acquired at, e.g.
+//
+//	defer fanotify.CheckFdLeaksT(t)
+func CheckFdLeaksT(t TestingT) {
+	t.Helper()
+
+	for _, leak := range OpenEventFds() {
+		t.Errorf("fanotify: leaked %v", leak)
+	}
+}
+
+// StartFdLeakReporter periodically passes tracked event Fds that are open
+// for longer than maxAge to FdLeakHandler, until the returned stop function
+// is called.
+func StartFdLeakReporter(interval, maxAge time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				for _, leak := range OpenEventFds() {
+					if now.Sub(leak.Acquired) > maxAge && FdLeakHandler != nil {
+						FdLeakHandler(leak)
+					}
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
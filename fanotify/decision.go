@@ -0,0 +1,238 @@
+package fanotify
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// defaultDecisionCacheSize is the number of files a DecisionCache holds when
+// no size is given.
+const defaultDecisionCacheSize = 4096
+
+// DecisionVersion returns the content version of the event file with st its
+// fstat data, a cached decision is reused only for the same version. An
+// error makes the decision uncacheable.
+type DecisionVersion func(ev *EventMetadata, st *FileStat) (string, error)
+
+// StatVersion versions files by size, mtime and ctime, it is cheap but
+// trusts timestamps, which the file owner can set back (mtime) but not
+// ctime.
+func StatVersion(ev *EventMetadata, st *FileStat) (string, error) {
+	buf := make([]byte, 0, 64)
+
+	for _, v := range []int64{
+		st.Size,
+		st.Mtime.Unix(), int64(st.Mtime.Nanosecond()),
+		st.Ctime.Unix(), int64(st.Ctime.Nanosecond()),
+	} {
+		buf = strconv.AppendInt(buf, v, 16)
+		buf = append(buf, ':')
+	}
+
+	return string(buf), nil
+}
+
+// HashVersion versions files by a SHA-256 of their content, read with pread
+// through the event Fd. Files larger than maxSize are not cached.
+func HashVersion(maxSize int64) DecisionVersion {
+	return func(ev *EventMetadata, st *FileStat) (string, error) {
+		if st.Size > maxSize {
+			return "", ErrContentTooLarge
+		}
+
+		h := sha256.New()
+
+		if _, err := io.Copy(h, io.NewSectionReader(ev.ReaderAt(), 0, st.Size)); err != nil {
+			return "", fmt.Errorf("fanotify: hash error, %w", err)
+		}
+
+		return string(h.Sum(nil)), nil
+	}
+}
+
+// fileKey identifies a file by device and inode.
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+type decisionEntry struct {
+	key     fileKey
+	version string
+}
+
+// DecisionCache caches allow decisions of permission events per file, keyed
+// by device, inode and content version, so that hot files are not rescanned
+// on every open. Deny decisions are never cached.
+//
+// Entries are dropped by Invalidate, register it for FAN_MODIFY and
+// FAN_CLOSE_WRITE events of the same marks:
+//
+//	cache := fanotify.NewDecisionCache(0, nil)
+//	gate.OnPerm(fanotify.AccessGateMask, cache.Wrap(scan))
+//	gate.On(fanotify.FileChangeMask, cache.Invalidate)
+//
+// with marks of AccessGateMask|FileChangeMask. The least recently used
+// entry is dropped when the cache is full.
+type DecisionCache struct {
+	max     int
+	version DecisionVersion
+
+	mu      sync.Mutex
+	entries map[fileKey]*list.Element
+	lru     *list.List
+	// gen counts invalidations, decisions overlapping one are not stored
+	gen    uint64
+	hits   uint64
+	misses uint64
+}
+
+// NewDecisionCache returns a cache of max files, 0 or less holds 4096, a nil
+// version uses StatVersion.
+func NewDecisionCache(max int, version DecisionVersion) *DecisionCache {
+	if max <= 0 {
+		max = defaultDecisionCacheSize
+	}
+
+	if version == nil {
+		version = StatVersion
+	}
+
+	return &DecisionCache{
+		max:     max,
+		version: version,
+		entries: make(map[fileKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Wrap returns a PermHandler allowing events of files with a cached allow
+// decision and calling fn for all others, allow decisions of fn are cached.
+// Events that can not be stat'ed or versioned always go to fn.
+func (c *DecisionCache) Wrap(fn PermHandler) PermHandler {
+	return func(ev *EventMetadata) bool {
+		st, err := ev.Stat()
+		if err != nil {
+			return fn(ev)
+		}
+
+		key := fileKey{dev: st.Dev, ino: st.Ino}
+
+		version, err := c.version(ev, &st)
+		if err != nil {
+			return fn(ev)
+		}
+
+		gen, ok := c.lookup(key, version)
+		if ok {
+			return true
+		}
+
+		allow := fn(ev)
+		if allow {
+			c.store(key, version, gen)
+		}
+
+		return allow
+	}
+}
+
+// Invalidate drops the cached decision of the event file, it is a Handler
+// for FAN_MODIFY and FAN_CLOSE_WRITE events.
+func (c *DecisionCache) Invalidate(ev *EventMetadata) {
+	st, err := ev.Stat()
+	if err != nil {
+		return
+	}
+
+	key := fileKey{dev: st.Dev, ino: st.Ino}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+
+	if elem, ok := c.entries[key]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// Purge drops all cached decisions, e.g. after scan rules changed.
+func (c *DecisionCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.entries = make(map[fileKey]*list.Element)
+	c.lru.Init()
+}
+
+// Len returns the number of cached decisions.
+func (c *DecisionCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// Stats returns cache hits and misses of Wrap.
+func (c *DecisionCache) Stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hits, c.misses
+}
+
+// lookup reports whether an allow decision for key at version is cached,
+// gen is the invalidation count to pass to store.
+func (c *DecisionCache) lookup(key fileKey, version string) (gen uint64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.entries[key]; found {
+		if elem.Value.(*decisionEntry).version == version {
+			c.lru.MoveToFront(elem)
+			c.hits++
+
+			return c.gen, true
+		}
+
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+
+	c.misses++
+
+	return c.gen, false
+}
+
+// store caches an allow decision, unless an invalidation happened since
+// gen was taken.
+func (c *DecisionCache) store(key fileKey, version string, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen != gen {
+		return
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*decisionEntry).version = version
+		c.lru.MoveToFront(elem)
+
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&decisionEntry{key: key, version: version})
+
+	if c.lru.Len() > c.max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*decisionEntry).key)
+	}
+}
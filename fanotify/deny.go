@@ -0,0 +1,179 @@
+package fanotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// DenyAction reacts to a permission event Run denied, e.g. quarantining
+// the file. Actions run on their own goroutine after the deny response was
+// written, so slow actions do not delay responses, the event Fd stays open
+// until all actions returned.
+type DenyAction func(ev *EventMetadata) error
+
+// OnDeny registers actions run in order for every permission event denied by
+// Run, errors are reported to OnError and do not stop later actions.
+func (handle *NotifyFD) OnDeny(actions ...DenyAction) {
+	handle.handlersMu.Lock()
+	defer handle.handlersMu.Unlock()
+
+	handle.denyActions = append(handle.denyActions, actions...)
+}
+
+// deny runs actions for ev in the background, ev is closed afterwards unless
+// a handler retained it. Without a free MemoryLimits.DenyWorkers slot the
+// actions are skipped.
+func (handle *NotifyFD) deny(ev *EventMetadata, actions []DenyAction) {
+	retained := atomic.LoadInt32(&ev.retained) != 0
+
+	if handle.denySlots != nil {
+		select {
+		case handle.denySlots <- struct{}{}:
+		default:
+			atomic.AddUint64(&handle.denyDropped, 1)
+
+			if err := ev.release(); err != nil {
+				handle.error(err)
+			}
+
+			return
+		}
+	}
+
+	handle.denyWg.Add(1)
+
+	go func() {
+		defer handle.denyWg.Done()
+
+		if handle.denySlots != nil {
+			defer func() { <-handle.denySlots }()
+		}
+
+		for _, action := range actions {
+			handle.callDeny(action, ev)
+		}
+
+		if retained {
+			return
+		}
+
+		if err := ev.Close(); err != nil {
+			handle.error(err)
+		}
+	}()
+}
+
+func (handle *NotifyFD) callDeny(action DenyAction, ev *EventMetadata) {
+	defer func() {
+		if r := recover(); r != nil {
+			handle.error(fmt.Errorf("fanotify: deny action panic, %v", r))
+		}
+	}()
+
+	if err := action(ev); err != nil {
+		handle.error(err)
+	}
+}
+
+// QuarantineAction moves denied files into dir, which should not be marked
+// by the group. The file is linked into dir through the event Fd, so the
+// very object that was denied is captured even when its path was replaced,
+// and its path is unlinked only while it still refers to that object. Across
+// filesystems the content is copied instead. Quarantined files are named
+// "<time>-<inode>-<name>" with all permissions removed.
+func QuarantineAction(dir string) DenyAction {
+	return func(ev *EventMetadata) error {
+		path, err := ev.GetPath()
+		if err != nil {
+			return fmt.Errorf("fanotify: quarantine error, %w", err)
+		}
+
+		st, err := ev.Stat()
+		if err != nil {
+			return fmt.Errorf("fanotify: quarantine error, %w", err)
+		}
+
+		if !st.IsRegular() {
+			return fmt.Errorf("fanotify: quarantine error, %s: not a regular file", path)
+		}
+
+		dst := filepath.Join(dir, strconv.FormatInt(time.Now().UnixNano(), 10)+"-"+
+			strconv.FormatUint(st.Ino, 10)+"-"+filepath.Base(path))
+
+		// the procfs magic link resolves to the event file without a path walk
+		err = sysLinkFollow(filepath.Join(ProcFsFd, strconv.Itoa(int(ev.Fd))), dst)
+		if errors.Is(err, syscall.EXDEV) {
+			err = copyQuarantine(ev, dst, st.Size)
+		}
+
+		if err != nil {
+			return fmt.Errorf("fanotify: quarantine error, %s: %w", path, err)
+		}
+
+		if err := sysChmod(dst, 0); err != nil {
+			return fmt.Errorf("fanotify: quarantine error, %s: %w", dst, err)
+		}
+
+		if cur, err := lstatPath(path); err != nil || cur.Dev != st.Dev || cur.Ino != st.Ino {
+			return nil
+		}
+
+		if err := sysUnlink(path); err != nil {
+			return fmt.Errorf("fanotify: quarantine error, %s: %w", path, err)
+		}
+
+		return nil
+	}
+}
+
+// copyQuarantine copies the event file content into a new file dst.
+func copyQuarantine(ev *EventMetadata, dst string, size int64) (err error) {
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+
+		if err != nil {
+			_ = os.Remove(dst)
+		}
+	}()
+
+	_, err = io.Copy(out, io.NewSectionReader(ev.ReaderAt(), 0, size))
+
+	return err
+}
+
+// ChmodAction sets permission bits of denied files to mode, e.g. 0 to make
+// them unusable in place. It changes the object behind the event Fd, not
+// whatever its path refers to by now.
+func ChmodAction(mode uint32) DenyAction {
+	return func(ev *EventMetadata) error {
+		if err := sysFchmod(int(ev.Fd), mode); err != nil {
+			return fmt.Errorf("fanotify: chmod error, %w", err)
+		}
+
+		return nil
+	}
+}
+
+// AlertAction publishes denied events to sink, e.g. a sink.JSONLines
+// alert log. Register it before QuarantineAction to report the original
+// path.
+func AlertAction(sink Sink) DenyAction {
+	return func(ev *EventMetadata) error {
+		return sink.Publish(context.Background(), ev.Event())
+	}
+}
@@ -0,0 +1,294 @@
+package fanotify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// descendantRecheck is how long a verdict from procfs is used before the
+// start time of its process is read again, to detect a reused PID, when
+// there is no proc connector.
+const descendantRecheck = time.Second
+
+// descendantLinger is how long the verdict of an exited descendant is kept,
+// so that its events still queued are dropped.
+const descendantLinger = time.Minute
+
+// descendantCapacity is the number of cached processes above which old
+// verdicts are pruned.
+const descendantCapacity = 8192
+
+// descendantDepth bounds the walk of a parent chain.
+const descendantDepth = 64
+
+// Proc connector event types, see linux/cn_proc.h.
+const (
+	procEventFork = 0x1
+	procEventExit = 0x80000000
+)
+
+// procEvent is a fork or exit reported by the proc connector, pid and tgid
+// are the child of a fork.
+type procEvent struct {
+	what       uint32
+	pid, tgid  int
+	parentTgid int
+}
+
+// descendantEntry is the cached verdict of a process, start and checked are
+// set for verdicts from procfs.
+type descendantEntry struct {
+	desc    bool
+	start   uint64
+	checked time.Time
+	exited  time.Time
+}
+
+// descendants tells whether processes descend from self. Forks reported by
+// the proc connector decide children before they run, processes the
+// connector did not report, as they were started before, or all without a
+// connector, are decided from their parent chain in procfs. A descendant
+// stays one when it is reparented, e.g. by double forking.
+type descendants struct {
+	self int
+	// tids is set for FAN_REPORT_TID groups, whose event PIDs are thread IDs
+	tids bool
+
+	mu     sync.Mutex
+	conn   *procConnector
+	procs  map[int]descendantEntry
+	pruned time.Time
+}
+
+// WithSkipSelf drops the events of this process, by adding it to
+// IgnoredPIDs.
+func WithSkipSelf() Option {
+	return func(handle *NotifyFD) {
+		handle.ignored.Add(os.Getpid())
+	}
+}
+
+// WithSkipDescendants drops the events of this process and of every process
+// it started, directly or not, such as tar, gpg or clamscan children of an
+// agent. Forks are followed with the kernel proc connector, so that also
+// events of children that exited before they were read are dropped, it
+// needs the initial PID namespace and on some kernels CAP_NET_ADMIN.
+// Without it processes are looked up in procfs when their first event is
+// read, events of children that exited by then are not dropped.
+func WithSkipDescendants() Option {
+	return func(handle *NotifyFD) {
+		handle.ignored.Add(os.Getpid())
+		handle.descendants = newDescendants(handle.initFlags&FAN_REPORT_TID != 0)
+	}
+}
+
+func newDescendants(tids bool) *descendants {
+	d := &descendants{
+		self:  os.Getpid(),
+		tids:  tids,
+		procs: make(map[int]descendantEntry),
+	}
+
+	if conn, err := openProcConnector(); err == nil {
+		d.conn = conn
+	}
+
+	return d
+}
+
+// contains reports whether pid descends from self.
+func (d *descendants) contains(pid int) bool {
+	return d.lookup(pid, 0)
+}
+
+// lookup returns the verdict of pid, depth bounds the walk of the parent
+// chain.
+func (d *descendants) lookup(pid, depth int) bool {
+	if pid == d.self {
+		return true
+	}
+
+	if pid <= 1 || depth > descendantDepth {
+		return false
+	}
+
+	now := time.Now()
+
+	d.mu.Lock()
+	d.drainLocked(now)
+	entry, ok := d.procs[pid]
+	// with a connector verdicts hold until the next fork of their PID
+	trusted := d.conn != nil
+	d.mu.Unlock()
+
+	if ok && (trusted || entry.checked.IsZero() || now.Sub(entry.checked) < descendantRecheck) {
+		return entry.desc
+	}
+
+	stat, err := readProcStat(pid)
+	if err != nil {
+		// exited, a known verdict stays valid until the PID is reused
+		return ok && entry.desc
+	}
+
+	if !ok || entry.start != stat.start {
+		entry = descendantEntry{
+			start: stat.start,
+			desc:  d.isSelfThread(pid) || d.lookup(stat.ppid, depth+1),
+		}
+	}
+
+	entry.checked = now
+
+	d.mu.Lock()
+	d.procs[pid] = entry
+	d.mu.Unlock()
+
+	return entry.desc
+}
+
+// drainLocked applies forks and exits queued on the connector, d.mu is held.
+func (d *descendants) drainLocked(now time.Time) {
+	if len(d.procs) >= descendantCapacity || now.Sub(d.pruned) >= descendantLinger {
+		d.pruneLocked(now)
+	}
+
+	if d.conn == nil {
+		return
+	}
+
+	apply := func(ev procEvent) {
+		d.applyLocked(ev, now)
+	}
+
+	err := d.conn.drain(apply)
+	if errors.Is(err, syscall.ENOBUFS) {
+		// forks were lost, verdicts of other processes may be stale
+		for pid, entry := range d.procs {
+			if !entry.desc {
+				delete(d.procs, pid)
+			}
+		}
+
+		err = d.conn.drain(apply)
+	}
+
+	if err != nil {
+		d.closeLocked()
+	}
+}
+
+// applyLocked applies a fork or exit, d.mu is held.
+func (d *descendants) applyLocked(ev procEvent, now time.Time) {
+	thread := ev.pid != ev.tgid
+
+	if thread && !d.tids {
+		return
+	}
+
+	switch ev.what {
+	case procEventFork:
+		parent, ok := d.procs[ev.parentTgid]
+		d.procs[ev.pid] = descendantEntry{desc: ev.parentTgid == d.self || ok && parent.desc}
+	case procEventExit:
+		entry, ok := d.procs[ev.pid]
+
+		switch {
+		case !ok:
+		case entry.desc:
+			entry.exited = now
+			d.procs[ev.pid] = entry
+		default:
+			delete(d.procs, ev.pid)
+		}
+	}
+}
+
+// isSelfThread reports whether pid is a thread ID of self.
+func (d *descendants) isSelfThread(pid int) bool {
+	if !d.tids {
+		return false
+	}
+
+	_, err := os.Stat(filepath.Join(ProcFs, strconv.Itoa(d.self), "task", strconv.Itoa(pid)))
+
+	return err == nil
+}
+
+// pruneLocked drops verdicts of descendants exited for descendantLinger and,
+// above descendantCapacity, verdicts of other processes from procfs not
+// checked within descendantRecheck, d.mu is held.
+func (d *descendants) pruneLocked(now time.Time) {
+	d.pruned = now
+
+	for pid, entry := range d.procs {
+		switch {
+		case !entry.exited.IsZero() && now.Sub(entry.exited) >= descendantLinger:
+			delete(d.procs, pid)
+		case len(d.procs) >= descendantCapacity && !entry.desc && !entry.checked.IsZero() &&
+			now.Sub(entry.checked) >= descendantRecheck:
+			delete(d.procs, pid)
+		}
+	}
+
+	if len(d.procs) >= descendantCapacity {
+		// keep descendants, they can not be found again once reparented
+		for pid, entry := range d.procs {
+			if !entry.desc {
+				delete(d.procs, pid)
+			}
+		}
+	}
+}
+
+// adopt takes over the descendants known to old, for WithRecovery.
+func (d *descendants) adopt(old *descendants) {
+	old.mu.Lock()
+	known := make(map[int]descendantEntry)
+
+	for pid, entry := range old.procs {
+		if entry.desc {
+			known[pid] = entry
+		}
+	}
+	old.mu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for pid, entry := range known {
+		if _, ok := d.procs[pid]; !ok {
+			d.procs[pid] = entry
+		}
+	}
+}
+
+// close closes the connector, later lookups use procfs.
+func (d *descendants) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closeLocked()
+}
+
+// closeLocked closes the connector and drops the verdicts of other
+// processes it decided, they can not be checked against procfs, d.mu is held.
+func (d *descendants) closeLocked() {
+	if d.conn == nil {
+		return
+	}
+
+	_ = d.conn.close()
+	d.conn = nil
+
+	for pid, entry := range d.procs {
+		if !entry.desc && entry.checked.IsZero() {
+			delete(d.procs, pid)
+		}
+	}
+}
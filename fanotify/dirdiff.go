@@ -0,0 +1,174 @@
+package fanotify
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// defaultDirDifferSize is the number of directories a DirDiffer keeps
+// listings of when no size is given.
+const defaultDirDifferSize = 1024
+
+// DirChange is an entry added to or removed from a directory.
+type DirChange struct {
+	// Dir is the directory path, Name the entry name in it.
+	Dir   string
+	Name  string
+	Added bool
+	IsDir bool
+}
+
+// Path returns the entry path.
+func (c DirChange) Path() string {
+	return filepath.Join(c.Dir, c.Name)
+}
+
+// DirDiffer approximates create and delete reporting for groups that only
+// see directory level events, e.g. FAN_ONDIR|FAN_OPEN on mount marks, which
+// do not report directory entry events. It keeps the listing of every
+// directory it saw an event for and reports entries added or removed since,
+// changes are therefore noticed only when the next directory event arrives,
+// and entries created and removed in between are never seen.
+//
+// Listings of the least recently seen directories are dropped beyond the
+// size given to NewDirDiffer.
+type DirDiffer struct {
+	max int
+
+	mu       sync.Mutex
+	listings map[fileKey]*list.Element
+	lru      *list.List
+}
+
+type dirListing struct {
+	key     fileKey
+	entries map[string]bool
+}
+
+// NewDirDiffer returns a differ keeping max listings, 0 or less keeps 1024.
+func NewDirDiffer(max int) *DirDiffer {
+	if max <= 0 {
+		max = defaultDirDifferSize
+	}
+
+	return &DirDiffer{
+		max:      max,
+		listings: make(map[fileKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Diff lists the directory of a directory event through the event Fd and
+// returns changes since its previous listing, sorted by name. The first
+// event of a directory only takes the listing, events on files are ignored.
+func (d *DirDiffer) Diff(ev *EventMetadata) ([]DirChange, error) {
+	if ev.Fd < 0 {
+		return nil, nil
+	}
+
+	// FAN_ONDIR is reported for FID groups only, which have no event Fd
+	st, err := ev.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if !st.IsDir() {
+		return nil, nil
+	}
+
+	dir, err := ev.GetPath()
+	if err != nil {
+		return nil, err
+	}
+
+	// reopen through procfs for a directory offset of our own
+	f, err := os.Open(filepath.Join(ProcFsFd, strconv.Itoa(int(ev.Fd))))
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: diff error, %w", err)
+	}
+
+	dirents, err := f.ReadDir(-1)
+	_ = f.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: diff error, %s: %w", dir, err)
+	}
+
+	entries := make(map[string]bool, len(dirents))
+
+	for _, entry := range dirents {
+		entries[entry.Name()] = entry.IsDir()
+	}
+
+	prev, ok := d.swap(fileKey{dev: st.Dev, ino: st.Ino}, entries)
+	if !ok {
+		return nil, nil
+	}
+
+	var changes []DirChange
+
+	for name, isDir := range entries {
+		if _, found := prev[name]; !found {
+			changes = append(changes, DirChange{Dir: dir, Name: name, Added: true, IsDir: isDir})
+		}
+	}
+
+	for name, isDir := range prev {
+		if _, found := entries[name]; !found {
+			changes = append(changes, DirChange{Dir: dir, Name: name, IsDir: isDir})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes, nil
+}
+
+// Forget drops all listings, e.g. after a queue overflow.
+func (d *DirDiffer) Forget() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.listings = make(map[fileKey]*list.Element)
+	d.lru.Init()
+}
+
+// Len returns the number of kept listings.
+func (d *DirDiffer) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.listings)
+}
+
+// swap stores entries as listing of key and returns the previous one.
+func (d *DirDiffer) swap(key fileKey, entries map[string]bool) (map[string]bool, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if elem, ok := d.listings[key]; ok {
+		listing := elem.Value.(*dirListing)
+		prev := listing.entries
+		listing.entries = entries
+		d.lru.MoveToFront(elem)
+
+		return prev, true
+	}
+
+	d.listings[key] = d.lru.PushFront(&dirListing{key: key, entries: entries})
+
+	if d.lru.Len() > d.max {
+		oldest := d.lru.Back()
+		d.lru.Remove(oldest)
+		delete(d.listings, oldest.Value.(*dirListing).key)
+	}
+
+	return nil, false
+}
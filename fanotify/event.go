@@ -0,0 +1,62 @@
+package fanotify
+
+import (
+	"time"
+)
+
+// Event is a serializable copy of event metadata that does not hold the
+// event Fd, it can be stored or sent to other processes.
+type Event struct {
+	// Seq numbers the events of a Watcher in read order, see Checkpointer.
+	Seq    uint64            `json:"seq,omitempty"`
+	Time   time.Time         `json:"time"`
+	Mask   uint64            `json:"mask"`
+	PID    int               `json:"pid"`
+	Path   string            `json:"path,omitempty"`
+	Xattrs map[string][]byte `json:"xattrs,omitempty"`
+	Mount  *MountInfo        `json:"mount,omitempty"`
+	Creds  *Credentials      `json:"creds,omitempty"`
+	// Security holds the MAC contexts, see WithSecurityContext.
+	Security *SecurityContext `json:"security,omitempty"`
+	// Lineage holds the process ancestry, see WithLineage.
+	Lineage *Lineage `json:"lineage,omitempty"`
+	// Groups are the mark groups covering the event, see MarkGroup.
+	Groups []string `json:"groups,omitempty"`
+	// Tags are added by tag rules, see RuleSet.
+	Tags []string `json:"tags,omitempty"`
+	// SampleWeight is set for sampled events, see Sampler.
+	SampleWeight float64 `json:"sample_weight,omitempty"`
+	// Synthetic marks events not reported by the kernel, such as existing
+	// files published by WithExistingFiles.
+	Synthetic bool `json:"synthetic,omitempty"`
+}
+
+// Event returns a serializable copy of event metadata, resolving path for
+// the event Fd when it is still open, see MappedPath.
+func (metadata *EventMetadata) Event() Event {
+	ev := Event{
+		Time:     metadata.Time,
+		Mask:     metadata.Mask,
+		PID:      metadata.GetPID(),
+		Xattrs:   metadata.Xattrs,
+		Mount:    metadata.Mount,
+		Creds:    metadata.Creds,
+		Security: metadata.Security,
+		Lineage:  metadata.Lineage,
+		Groups:   metadata.Groups(),
+		Tags:     metadata.Tags,
+
+		SampleWeight: metadata.SampleWeight,
+	}
+
+	if metadata.Fd >= 0 {
+		ev.Path, _ = metadata.MappedPath()
+	}
+
+	return ev
+}
+
+// MatchMask returns 'true' when event matches specified mask.
+func (ev Event) MatchMask(mask EventMask) bool {
+	return EventMask(ev.Mask)&mask == mask
+}
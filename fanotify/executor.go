@@ -0,0 +1,469 @@
+package fanotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrExecutorClosed is returned by DecisionExecutor.Submit after Close.
+var ErrExecutorClosed = errors.New("fanotify: decision executor closed")
+
+// latencySamples is the number of recent decision latencies percentiles
+// are computed from.
+const latencySamples = 1024
+
+// ExecutorConfig configures a DecisionExecutor.
+type ExecutorConfig struct {
+	// Workers is the global number of concurrent decisions,
+	// runtime.NumCPU() when zero.
+	Workers int
+	// PerMount limits concurrent decisions of events from one mount, so that
+	// a slow filesystem does not take all workers, Workers when zero.
+	PerMount int
+	// Queue bounds the events waiting for a worker, Submit blocks while it
+	// is full, 1024 when zero.
+	Queue int
+	// OnError receives response and close errors and recovered decide
+	// panics, they are dropped when nil.
+	OnError func(error)
+	// Watchdog answers events on behalf of a stalled decide, disabled when
+	// zero.
+	Watchdog WatchdogConfig
+}
+
+// LatencyStats are percentiles of recent decision latencies, from reading
+// the event to writing its response.
+type LatencyStats struct {
+	// Samples is the number of latencies the percentiles are taken from.
+	Samples int
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	// Max is the highest latency since the executor was created.
+	Max time.Duration
+}
+
+// ExecutorStats are DecisionExecutor counters.
+type ExecutorStats struct {
+	Allowed uint64
+	Denied  uint64
+	// Fallback is the number of events answered by the watchdog, they are
+	// included in Allowed or Denied.
+	Fallback uint64
+	// Queued is the number of events waiting for a worker, Active the
+	// number being decided, including the ones already answered by the
+	// watchdog.
+	Queued  int
+	Active  int
+	Latency LatencyStats
+}
+
+// DecisionExecutor decides permission events concurrently: events of
+// different files are independent, so a slow decision, e.g. a content scan,
+// only holds up its own process. Concurrency is limited globally and per
+// mount, and waiting events are taken from mounts in turn, so that a busy
+// mount can not starve the others. Within a mount decisions start in read
+// order, responses may be written out of order. See WatchdogConfig for a
+// safety valve against a stalled decide.
+type DecisionExecutor struct {
+	notify   *NotifyFD
+	decide   PermHandler
+	perMount int
+	queueMax int
+	onError  func(error)
+	watchdog WatchdogConfig
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	mounts   map[int]*mountQueue
+	rotation []int
+	inflight map[*decision]struct{}
+	queued   int
+	active   int
+	// stale is the number of active decisions answered by the watchdog
+	stale      int
+	overloaded bool
+	closed     bool
+	wg         sync.WaitGroup
+	stop       chan struct{}
+	watchWG    sync.WaitGroup
+
+	allowed   uint64
+	denied    uint64
+	fallback  uint64
+	latencies [latencySamples]time.Duration
+	samples   int
+	next      int
+	max       time.Duration
+}
+
+// mountQueue holds the waiting events of one mount.
+type mountQueue struct {
+	events []*decision
+	active int
+}
+
+// decision is a submitted event.
+type decision struct {
+	ev    *EventMetadata
+	mount int
+	// answered is set under DecisionExecutor.mu by whoever responds first,
+	// the worker or the watchdog
+	answered bool
+}
+
+// NewDecisionExecutor returns an executor answering permission events of
+// notify with decide, a 'false' result denies the event.
+func NewDecisionExecutor(notify *NotifyFD, decide PermHandler, cfg ExecutorConfig) *DecisionExecutor {
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+
+	if cfg.PerMount <= 0 || cfg.PerMount > cfg.Workers {
+		cfg.PerMount = cfg.Workers
+	}
+
+	if cfg.Queue <= 0 {
+		cfg.Queue = 1024
+	}
+
+	x := &DecisionExecutor{
+		notify:   notify,
+		decide:   decide,
+		perMount: cfg.PerMount,
+		queueMax: cfg.Queue,
+		onError:  cfg.OnError,
+		watchdog: cfg.Watchdog,
+		mounts:   make(map[int]*mountQueue),
+		inflight: make(map[*decision]struct{}),
+	}
+	x.cond = sync.NewCond(&x.mu)
+
+	x.wg.Add(cfg.Workers)
+
+	for i := 0; i < cfg.Workers; i++ {
+		go x.work()
+	}
+
+	if cfg.Watchdog.MaxAge > 0 {
+		x.stop = make(chan struct{})
+		x.watchWG.Add(1)
+
+		go x.watch()
+	}
+
+	return x
+}
+
+// Run reads events from the handle until ctx is done or reading fails and
+// submits permission events, other events are closed. It returns ctx.Err()
+// after cancellation, submitted events are still decided, see Close. The
+// handle should be initialized with FAN_NONBLOCK so that Run can be
+// interrupted by ctx.
+func (x *DecisionExecutor) Run(ctx context.Context, skipPIDs ...int) error {
+	stop := interruptOnDone(ctx, x.notify.File, x.error)
+	defer stop()
+
+	for {
+		ev, err := x.notify.WaitEvent(skipPIDs...)
+
+		if ctx.Err() != nil {
+			if ev != nil {
+				_ = x.notify.skip(ev)
+			}
+
+			return ctx.Err()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !ev.IsPermission() {
+			if err := ev.release(); err != nil {
+				x.error(err)
+			}
+
+			continue
+		}
+
+		if err := x.Submit(ev); err != nil {
+			_ = x.notify.skip(ev)
+
+			return err
+		}
+	}
+}
+
+// Submit queues the permission event ev for a decision, the executor takes
+// over the event and closes it once answered, events of Iter need Retain.
+// It blocks while the queue is full, unless the watchdog answers ev.
+func (x *DecisionExecutor) Submit(ev *EventMetadata) error {
+	mount := -1
+	if id, err := ev.GetMountID(); err == nil {
+		mount = id
+	}
+
+	x.mu.Lock()
+
+	for {
+		if x.closed {
+			x.mu.Unlock()
+
+			return ErrExecutorClosed
+		}
+
+		if alert, raise, ok := x.overloadLocked(); ok {
+			x.mu.Unlock()
+
+			x.answerRelease(ev, !x.watchdog.Deny)
+
+			if raise {
+				x.alert(alert)
+			}
+
+			return nil
+		}
+
+		if x.queued < x.queueMax {
+			break
+		}
+
+		x.cond.Wait()
+	}
+
+	q, ok := x.mounts[mount]
+	if !ok {
+		q = &mountQueue{}
+		x.mounts[mount] = q
+		x.rotation = append(x.rotation, mount)
+	}
+
+	q.events = append(q.events, &decision{ev: ev, mount: mount})
+	x.queued++
+	x.cond.Broadcast()
+	x.mu.Unlock()
+
+	return nil
+}
+
+// take waits for an event of the next mount in turn that is below the
+// per mount limit, it returns 'false' once closed and drained.
+func (x *DecisionExecutor) take() (*decision, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for {
+		for i, mount := range x.rotation {
+			q := x.mounts[mount]
+			if len(q.events) == 0 || q.active >= x.perMount {
+				continue
+			}
+
+			d := q.events[0]
+			q.events[0] = nil
+			q.events = q.events[1:]
+			q.active++
+			x.queued--
+			x.active++
+			x.inflight[d] = struct{}{}
+
+			// the mount goes to the back of the rotation
+			x.rotation = append(append(x.rotation[:i:i], x.rotation[i+1:]...), mount)
+			x.cond.Broadcast()
+
+			return d, true
+		}
+
+		if x.closed && x.queued == 0 {
+			return nil, false
+		}
+
+		x.cond.Wait()
+	}
+}
+
+// claim reports whether the worker is to answer d, 'false' when the
+// watchdog did already.
+func (x *DecisionExecutor) claim(d *decision) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if d.answered {
+		return false
+	}
+
+	d.answered = true
+
+	return true
+}
+
+// done accounts a decided event, answered by the worker when claimed.
+func (x *DecisionExecutor) done(d *decision, claimed, allow bool, latency time.Duration) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.mounts[d.mount].active--
+	x.active--
+	delete(x.inflight, d)
+	x.dropMountLocked(d.mount)
+	x.cond.Broadcast()
+
+	if !claimed {
+		x.stale--
+
+		return
+	}
+
+	x.countLocked(allow)
+
+	x.latencies[x.next] = latency
+	x.next = (x.next + 1) % latencySamples
+
+	if x.samples < latencySamples {
+		x.samples++
+	}
+
+	if latency > x.max {
+		x.max = latency
+	}
+}
+
+// dropMountLocked forgets mount once it has no queued or active events.
+func (x *DecisionExecutor) dropMountLocked(mount int) {
+	q := x.mounts[mount]
+	if len(q.events) != 0 || q.active != 0 {
+		return
+	}
+
+	delete(x.mounts, mount)
+
+	for i, m := range x.rotation {
+		if m == mount {
+			x.rotation = append(x.rotation[:i], x.rotation[i+1:]...)
+
+			break
+		}
+	}
+}
+
+func (x *DecisionExecutor) countLocked(allow bool) {
+	if allow {
+		x.allowed++
+	} else {
+		x.denied++
+	}
+}
+
+func (x *DecisionExecutor) work() {
+	defer x.wg.Done()
+
+	for {
+		d, ok := x.take()
+		if !ok {
+			return
+		}
+
+		allow := x.call(d.ev)
+
+		claimed := x.claim(d)
+		if claimed {
+			if err := x.respond(d.ev, allow); err != nil {
+				x.error(err)
+			}
+		}
+
+		latency := time.Since(d.ev.Time)
+
+		if err := d.ev.release(); err != nil {
+			x.error(err)
+		}
+
+		x.done(d, claimed, allow, latency)
+	}
+}
+
+// respond answers ev, a 'false' allow denies it.
+func (x *DecisionExecutor) respond(ev *EventMetadata, allow bool) error {
+	if allow {
+		return x.notify.ResponseAllow(ev)
+	}
+
+	return x.notify.ResponseDeny(ev)
+}
+
+// call runs decide, a panic allows the event, so that the process is not
+// left blocked.
+func (x *DecisionExecutor) call(ev *EventMetadata) (allow bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			x.error(fmt.Errorf("fanotify: handler panic, %v", r))
+
+			allow = true
+		}
+	}()
+
+	return x.decide(ev)
+}
+
+// Stats returns current counters and latency percentiles.
+func (x *DecisionExecutor) Stats() ExecutorStats {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	stats := ExecutorStats{
+		Allowed:  x.allowed,
+		Denied:   x.denied,
+		Fallback: x.fallback,
+		Queued:   x.queued,
+		Active:   x.active,
+		Latency:  LatencyStats{Samples: x.samples, Max: x.max},
+	}
+
+	if x.samples == 0 {
+		return stats
+	}
+
+	sorted := append([]time.Duration(nil), x.latencies[:x.samples]...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	percentile := func(p int) time.Duration {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+
+	stats.Latency.P50 = percentile(50)
+	stats.Latency.P90 = percentile(90)
+	stats.Latency.P99 = percentile(99)
+
+	return stats
+}
+
+// Close stops accepting events and waits until the submitted ones were
+// decided, the watchdog keeps answering them meanwhile.
+func (x *DecisionExecutor) Close() error {
+	x.mu.Lock()
+	closing := !x.closed
+	x.closed = true
+	x.cond.Broadcast()
+	x.mu.Unlock()
+
+	x.wg.Wait()
+
+	if closing && x.stop != nil {
+		close(x.stop)
+		x.watchWG.Wait()
+	}
+
+	return nil
+}
+
+func (x *DecisionExecutor) error(err error) {
+	if x.onError != nil {
+		x.onError(err)
+	}
+}
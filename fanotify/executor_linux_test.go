@@ -0,0 +1,100 @@
+package fanotify
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDecisionExecutor(t *testing.T) {
+	tests := []struct {
+		name    string
+		decide  PermHandler
+		want    uint32
+		wantErr string
+	}{
+		{
+			name:   "allow",
+			decide: func(ev *EventMetadata) bool { return true },
+			want:   FAN_ALLOW,
+		},
+		{
+			name:   "deny",
+			decide: func(ev *EventMetadata) bool { return false },
+			want:   FAN_DENY,
+		},
+		{
+			name:    "panic allows",
+			decide:  func(ev *EventMetadata) bool { panic("decide") },
+			want:    FAN_ALLOW,
+			wantErr: "handler panic, decide",
+		},
+		{
+			name: "answered by decide",
+			decide: func(ev *EventMetadata) bool {
+				if err := ev.Deny(); err != nil {
+					panic(err)
+				}
+
+				return true
+			},
+			want:    FAN_DENY,
+			wantErr: ErrResponded.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeHandle(t)
+
+			var (
+				mu   sync.Mutex
+				errs []string
+			)
+
+			x := NewDecisionExecutor(fake.NotifyFD, tt.decide, ExecutorConfig{
+				Workers: 1,
+				OnError: func(err error) {
+					mu.Lock()
+					errs = append(errs, err.Error())
+					mu.Unlock()
+				},
+			})
+
+			fd := eventFd(t)
+			fake.send(t, encodeEvent(FAN_OPEN_PERM, fd, 1))
+
+			ev, err := fake.GetEvent()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := x.Submit(ev); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := x.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := x.Submit(ev); err != ErrExecutorClosed {
+				t.Fatalf("Submit after Close: got %v, want ErrExecutorClosed", err)
+			}
+
+			responses := fake.closeResponses()
+			if len(responses) != 1 || responses[0].Fd != fd || responses[0].Response != tt.want {
+				t.Fatalf("got responses %+v, want %d for Fd %d", responses, tt.want, fd)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case tt.wantErr == "" && len(errs) != 0:
+				t.Fatalf("got errors %q, want none", errs)
+			case tt.wantErr != "" && (len(errs) != 1 || !strings.Contains(errs[0], tt.wantErr)):
+				t.Fatalf("got errors %q, want %q", errs, tt.wantErr)
+			}
+		})
+	}
+}
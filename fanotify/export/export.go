@@ -0,0 +1,518 @@
+// Package export streams fanotify events from one privileged process to
+// unprivileged subscribers over a unix domain socket.
+//
+// The wire protocol is newline delimited JSON: after connecting, a client
+// sends a single Filter object, then the server writes one fanotify.Event
+// object per line for every published event matching that filter.
+//
+// The server learns the connecting UID, GID and PID through SO_PEERCRED,
+// an Authorize hook can reject clients or scope their filter with Scope, so
+// that one privileged agent serves several unprivileged consumers, each
+// seeing only its own paths and events.
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// DefaultClientBuffer is the number of events queued per client before
+// events for that client are dropped.
+const DefaultClientBuffer = 1024
+
+// DefaultHandshakeTimeout is how long a new client has to send its filter.
+const DefaultHandshakeTimeout = 5 * time.Second
+
+// MaxFilterSize is the size limit of the filter line, including the
+// newline, clients sending longer lines are rejected.
+const MaxFilterSize = 4 << 10
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("export: server closed")
+
+// Filter selects events a client is subscribed to, zero value selects all.
+type Filter struct {
+	// Mask selects events having any of the mask bits set.
+	Mask uint64 `json:"mask,omitempty"`
+	// Paths selects events for files under any of the path prefixes.
+	Paths []string `json:"paths,omitempty"`
+}
+
+// Match returns 'true' when event is selected by filter.
+func (f Filter) Match(ev fanotify.Event) bool {
+	if f.Mask != 0 && ev.Mask&f.Mask == 0 {
+		return false
+	}
+
+	if len(f.Paths) == 0 {
+		return true
+	}
+
+	for _, prefix := range f.Paths {
+		if under(ev.Path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Peer is the identity of a connected client, as reported by the kernel for
+// the connecting process.
+type Peer struct {
+	UID int
+	GID int
+	PID int
+}
+
+// Namespace is the part of the event stream a client may see: events with
+// any of the Mask bits set, for files under any of the Paths prefixes. Zero
+// Mask or empty Paths do not restrict.
+type Namespace struct {
+	Mask  uint64   `json:"mask,omitempty"`
+	Paths []string `json:"paths,omitempty"`
+}
+
+// ErrNotVisible is returned by Scope when a filter selects nothing inside
+// the namespace.
+var ErrNotVisible = errors.New("export: filter selects nothing visible")
+
+// Scope narrows filter to ns: mask bits outside ns are dropped and path
+// prefixes are limited to ns paths, an empty filter becomes ns itself.
+func Scope(filter Filter, ns Namespace) (Filter, error) {
+	if ns.Mask != 0 {
+		if filter.Mask == 0 {
+			filter.Mask = ns.Mask
+		}
+
+		if filter.Mask &= ns.Mask; filter.Mask == 0 {
+			return Filter{}, ErrNotVisible
+		}
+	}
+
+	if len(ns.Paths) == 0 {
+		return filter, nil
+	}
+
+	if len(filter.Paths) == 0 {
+		filter.Paths = append([]string(nil), ns.Paths...)
+
+		return filter, nil
+	}
+
+	var paths []string
+
+	for _, path := range filter.Paths {
+		for _, root := range ns.Paths {
+			switch {
+			case under(path, root):
+				paths = append(paths, path)
+			case under(root, path):
+				paths = append(paths, root)
+			default:
+				continue
+			}
+
+			break
+		}
+	}
+
+	if len(paths) == 0 {
+		return Filter{}, ErrNotVisible
+	}
+
+	filter.Paths = paths
+
+	return filter, nil
+}
+
+// UIDNamespaces returns an Authorize hook scoping clients by their UID to
+// namespaces, clients with a UID not in namespaces are rejected.
+func UIDNamespaces(namespaces map[int]Namespace) func(Peer, Filter) (Filter, error) {
+	return func(peer Peer, filter Filter) (Filter, error) {
+		ns, ok := namespaces[peer.UID]
+		if !ok {
+			return Filter{}, fmt.Errorf("export: uid %d not authorized", peer.UID)
+		}
+
+		return Scope(filter, ns)
+	}
+}
+
+// PeerCred returns the credentials of the process that connected conn, a
+// unix socket, via SO_PEERCRED.
+func PeerCred(conn net.Conn) (Peer, error) {
+	return peerCred(conn)
+}
+
+// under returns 'true' when path is prefix or a file below it.
+func under(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// Server fans published events out to connected clients.
+type Server struct {
+	// ClientBuffer overrides DefaultClientBuffer when positive.
+	ClientBuffer int
+
+	// HandshakeTimeout overrides DefaultHandshakeTimeout when positive.
+	HandshakeTimeout time.Duration
+
+	// Authorize, when set, is called with the peer credentials and the
+	// requested filter of every client, it returns the filter the client is
+	// subscribed with, typically narrowed by Scope, or an error to reject
+	// the client. Without it all clients get their requested filter.
+	Authorize func(peer Peer, filter Filter) (Filter, error)
+
+	// OnReject, when set, is called for clients that failed credential
+	// lookup or Authorize.
+	OnReject func(peer Peer, err error)
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	clients   map[*client]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	// wg counts the goroutines serving connections
+	wg sync.WaitGroup
+
+	dropped uint64
+}
+
+type client struct {
+	conn   net.Conn
+	filter Filter
+	events chan fanotify.Event
+}
+
+// NewServer returns a new Server.
+func NewServer() *Server {
+	return &Server{
+		listeners: make(map[net.Listener]struct{}),
+		clients:   make(map[*client]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen creates a unix socket at path with given permissions, removing a
+// stale socket left by a previous run.
+func Listen(path string, perm os.FileMode) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("export: listen error, %w", err)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("export: listen error, %w", err)
+	}
+
+	if err := os.Chmod(path, perm); err != nil {
+		l.Close()
+
+		return nil, fmt.Errorf("export: listen error, %w", err)
+	}
+
+	return l, nil
+}
+
+// Serve accepts clients on l until Close is called.
+func (srv *Server) Serve(l net.Listener) error {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+
+		return ErrServerClosed
+	}
+
+	srv.listeners[l] = struct{}{}
+	srv.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			srv.mu.Lock()
+			closed := srv.closed
+			delete(srv.listeners, l)
+			srv.mu.Unlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+
+			return fmt.Errorf("export: accept error, %w", err)
+		}
+
+		if !srv.track(conn) {
+			conn.Close()
+
+			continue
+		}
+
+		go srv.handle(conn)
+	}
+}
+
+// Run serves clients on l until ctx is done, then closes the server and
+// waits for the goroutines serving connections to return. It returns
+// ctx.Err(), nil after Close or the accept error, so that it composes with
+// the Run methods of fanotify in an errgroup.
+func (srv *Server) Run(ctx context.Context, l net.Listener) error {
+	served := make(chan error, 1)
+
+	go func() {
+		served <- srv.Serve(l)
+	}()
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+		srv.Close()
+		<-served
+
+		err = ctx.Err()
+	case err = <-served:
+		if errors.Is(err, ErrServerClosed) {
+			err = nil
+		} else {
+			// disconnect clients of a failed listener
+			srv.Close()
+		}
+	}
+
+	srv.wg.Wait()
+
+	return err
+}
+
+// track registers a connection served by a goroutine, it returns 'false'
+// after Close.
+func (srv *Server) track(conn net.Conn) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.closed {
+		return false
+	}
+
+	srv.conns[conn] = struct{}{}
+	srv.wg.Add(1)
+
+	return true
+}
+
+func (srv *Server) untrack(conn net.Conn) {
+	srv.mu.Lock()
+	delete(srv.conns, conn)
+	srv.mu.Unlock()
+
+	srv.wg.Done()
+}
+
+func (srv *Server) handle(conn net.Conn) {
+	defer srv.untrack(conn)
+
+	timeout := srv.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+
+	var f Filter
+
+	// a slow or oversized handshake must not hold the connection
+	err := conn.SetReadDeadline(time.Now().Add(timeout))
+	if err == nil {
+		var line []byte
+
+		line, err = bufio.NewReader(io.LimitReader(conn, MaxFilterSize)).ReadBytes('\n')
+		if err == nil {
+			err = json.Unmarshal(line, &f)
+		}
+	}
+
+	if err == nil {
+		err = conn.SetReadDeadline(time.Time{})
+	}
+
+	if err != nil {
+		conn.Close()
+
+		return
+	}
+
+	if srv.Authorize != nil {
+		peer, err := peerCred(conn)
+		if err == nil {
+			f, err = srv.Authorize(peer, f)
+		}
+
+		if err != nil {
+			if srv.OnReject != nil {
+				srv.OnReject(peer, err)
+			}
+
+			conn.Close()
+
+			return
+		}
+	}
+
+	size := srv.ClientBuffer
+	if size <= 0 {
+		size = DefaultClientBuffer
+	}
+
+	c := &client{
+		conn:   conn,
+		filter: f,
+		events: make(chan fanotify.Event, size),
+	}
+
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		conn.Close()
+
+		return
+	}
+
+	srv.clients[c] = struct{}{}
+	srv.mu.Unlock()
+
+	defer srv.remove(c)
+
+	// notice disconnects of clients that never receive a matching event
+	srv.wg.Add(1)
+
+	go func() {
+		defer srv.wg.Done()
+
+		_, _ = io.Copy(io.Discard, conn)
+		srv.remove(c)
+	}()
+
+	enc := json.NewEncoder(conn)
+
+	for ev := range c.events {
+		if err := enc.Encode(ev); err != nil {
+			return
+		}
+	}
+}
+
+func (srv *Server) remove(c *client) {
+	srv.mu.Lock()
+	if _, ok := srv.clients[c]; ok {
+		delete(srv.clients, c)
+		close(c.events)
+	}
+	srv.mu.Unlock()
+
+	c.conn.Close()
+}
+
+// Publish queues event for every client whose filter matches it, events
+// for clients with a full queue are dropped.
+func (srv *Server) Publish(ev fanotify.Event) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	for c := range srv.clients {
+		if !c.filter.Match(ev) {
+			continue
+		}
+
+		select {
+		case c.events <- ev:
+		default:
+			atomic.AddUint64(&srv.dropped, 1)
+		}
+	}
+}
+
+// Dropped returns the number of events dropped for slow clients.
+func (srv *Server) Dropped() uint64 {
+	return atomic.LoadUint64(&srv.dropped)
+}
+
+// Close stops all listeners and disconnects clients.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.closed = true
+
+	var err error
+
+	for l := range srv.listeners {
+		if e := l.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	for c := range srv.clients {
+		delete(srv.clients, c)
+		close(c.events)
+	}
+
+	// clients and connections still in the filter handshake
+	for conn := range srv.conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+// Client receives events from a Server.
+type Client struct {
+	conn net.Conn
+	dec  *json.Decoder
+}
+
+// Dial connects to a Server listening on unix socket path and subscribes
+// with filter.
+func Dial(path string, filter Filter) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("export: dial error, %w", err)
+	}
+
+	if err := json.NewEncoder(conn).Encode(filter); err != nil {
+		conn.Close()
+
+		return nil, fmt.Errorf("export: subscribe error, %w", err)
+	}
+
+	return &Client{
+		conn: conn,
+		dec:  json.NewDecoder(conn),
+	}, nil
+}
+
+// Recv blocks until the next event is received.
+func (c *Client) Recv() (fanotify.Event, error) {
+	var ev fanotify.Event
+
+	if err := c.dec.Decode(&ev); err != nil {
+		return ev, fmt.Errorf("export: receive error, %w", err)
+	}
+
+	return ev, nil
+}
+
+// Close disconnects from the Server.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
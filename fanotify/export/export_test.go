@@ -0,0 +1,182 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// serve starts srv on a socket in a temporary directory and returns its
+// path, the server is closed at the end of the test.
+func serve(t *testing.T, srv *Server) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "export.sock")
+
+	l, err := Listen(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+
+	go func() { done <- srv.Serve(l) }()
+
+	t.Cleanup(func() {
+		srv.Close()
+
+		if err := <-done; err != ErrServerClosed {
+			t.Errorf("Serve: got %v, want ErrServerClosed", err)
+		}
+	})
+
+	return path
+}
+
+// checkGoroutines fails t when more than before goroutines are left, they
+// are given a moment to return.
+func checkGoroutines(t testing.TB, before int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines left, want %d:\n%s",
+				runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandshakeRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		handshake string
+	}{
+		{name: "oversized filter", handshake: `{"paths":["` + strings.Repeat("a", MaxFilterSize) + `"]}` + "\n"},
+		{name: "no newline", handshake: `{}`},
+		{name: "invalid filter", handshake: "{\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer()
+			srv.HandshakeTimeout = 50 * time.Millisecond
+
+			conn, err := net.Dial("unix", serve(t, srv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if _, err := io.WriteString(conn, tt.handshake); err != nil {
+				t.Fatal(err)
+			}
+
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			// the server closes the connection without writing, unread data
+			// resets it
+			n, err := conn.Read(make([]byte, 1))
+			if ne, ok := err.(net.Error); n != 0 || err == nil || ok && ne.Timeout() {
+				t.Fatalf("got %d bytes and %v, want the connection closed", n, err)
+			}
+		})
+	}
+}
+
+func TestHandshakeDeadlineCleared(t *testing.T) {
+	srv := NewServer()
+	srv.HandshakeTimeout = 20 * time.Millisecond
+
+	c, err := Dial(serve(t, srv), Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// the client stays subscribed past the handshake deadline
+	time.Sleep(5 * srv.HandshakeTimeout)
+
+	srv.Publish(fanotify.Event{PID: 1})
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if ev, err := c.Recv(); err != nil || ev.PID != 1 {
+		t.Fatalf("got %+v and %v, want the published event", ev, err)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	path := filepath.Join(t.TempDir(), "export.sock")
+
+	l, err := Listen(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewServer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() { done <- srv.Run(ctx, l) }()
+
+	c, err := Dial(path, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// publish until the client is served
+	stop := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				srv.Publish(fanotify.Event{PID: 1})
+			}
+		}
+	}()
+
+	_, err = c.Recv()
+	close(stop)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Run: got %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+
+	if _, err := c.Recv(); err == nil {
+		t.Fatal("client still connected after Run returned")
+	}
+
+	c.Close()
+	checkGoroutines(t, before)
+}
@@ -0,0 +1,39 @@
+package export
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCred returns the credentials of the process that connected conn,
+// via SO_PEERCRED.
+func peerCred(conn net.Conn) (Peer, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return Peer{}, fmt.Errorf("export: peer error, %T is not a unix socket", conn)
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return Peer{}, fmt.Errorf("export: peer error, %w", err)
+	}
+
+	var (
+		cred *unix.Ucred
+		cerr error
+	)
+
+	if err := raw.Control(func(fd uintptr) {
+		cred, cerr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return Peer{}, fmt.Errorf("export: peer error, %w", err)
+	}
+
+	if cerr != nil {
+		return Peer{}, fmt.Errorf("export: peer error, %w", cerr)
+	}
+
+	return Peer{UID: int(cred.Uid), GID: int(cred.Gid), PID: int(cred.Pid)}, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package export
+
+import (
+	"net"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// peerCred returns fanotify.ErrUnsupportedPlatform.
+func peerCred(conn net.Conn) (Peer, error) {
+	return Peer{}, fanotify.ErrUnsupportedPlatform
+}
@@ -1,10 +1,17 @@
 // Package fanotify package provides a simple fanotify API.
+//
+// Errors wrap the underlying errno with %w, so they can be matched with
+// errors.Is, e.g. errors.Is(err, unix.EBADF).
+//
+// The package builds on every platform, Windows included, off Linux every
+// fanotify call returns ErrUnsupportedPlatform.
 package fanotify
 
 import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,10 +19,16 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-
-	"golang.org/x/sys/unix"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// ErrUnsupportedPlatform is returned on platforms without fanotify, where the
+// package only builds so that portable code can check support at runtime.
+var ErrUnsupportedPlatform = errors.New("fanotify: unsupported platform")
+
 // Procfs constants.
 const (
 	ProcFsFd     = "/proc/self/fd"
@@ -29,9 +42,101 @@ type FdInfo struct {
 	MountID  int
 }
 
+// Event fd ownership states.
+const (
+	fdOpen int32 = iota
+	fdTaken
+	fdClosed
+)
+
 // EventMetadata is a struct returned from 'NotifyFD.GetEvent'.
 type EventMetadata struct {
-	unix.FanotifyEventMetadata
+	FanotifyEventMetadata
+
+	// Time is when the event was read from the fanotify handle.
+	Time time.Time
+
+	// Xattrs holds extended attributes attached by WithXattrs.
+	Xattrs map[string][]byte
+
+	// Mount holds the mount the event came through, attached by WithMountInfo.
+	Mount *MountInfo
+
+	// Creds holds the process credentials, attached by WithCredentials.
+	Creds *Credentials
+
+	// Security holds the security contexts, attached by WithSecurityContext.
+	Security *SecurityContext
+
+	// Lineage holds the process ancestry, attached by WithLineage.
+	Lineage *Lineage
+
+	// Times are the pipeline timestamps, set with WithLatency.
+	Times EventTimes
+
+	// Info holds info records decoded by parsers registered with
+	// RegisterInfoParser, keyed by record type.
+	Info map[uint8]interface{}
+
+	// Tags are added by tag rules, see RuleSet.
+	Tags []string
+
+	// SampleWeight is the number of events a sampled event stands for, zero
+	// for events no Sampler rule matched.
+	SampleWeight float64
+
+	raw []byte
+
+	fdState  int32
+	retained int32
+
+	pidfd      int32
+	pidfdState int32
+
+	// pathMappers are the WithPathMapper mappers of the reading handle
+	pathMappers []PathMapper
+
+	// path and pathErr memoize GetPath once pathState is pathResolved,
+	// pathCache is the batch cache of the reading handle
+	path      string
+	pathErr   error
+	pathState int32
+	pathCache *pathCache
+
+	// creds and credsErr memoize GetCredentials like path and pathErr
+	creds      Credentials
+	credsErr   error
+	credsState int32
+
+	// groups are the mark groups of the reading handle
+	groups *markGroups
+
+	// handle is the reading handle, it sends the responses of Allow and
+	// Deny, responded is set once a response was sent or queued
+	handle    *NotifyFD
+	responded int32
+
+	// ring is the EventRing owning the event storage, slot its index there
+	ring *EventRing
+	slot int
+}
+
+// Retain keeps event Fd open after the handler returns, for events handed
+// out by Run and Iter, which otherwise close it. The caller becomes
+// responsible for calling Close.
+func (metadata *EventMetadata) Retain() *EventMetadata {
+	atomic.StoreInt32(&metadata.retained, 1)
+
+	return metadata
+}
+
+// release closes event Fd unless it was retained.
+func (metadata *EventMetadata) release() error {
+	if atomic.LoadInt32(&metadata.retained) != 0 {
+		return nil
+	}
+
+	return metadata.Close()
 }
 
 // GetPID return PID from event metadata.
@@ -40,30 +145,38 @@ func (metadata *EventMetadata) GetPID() int {
 }
 
 // Close is used to Close event Fd, use it to prevent Fd leak.
+// Close is a no-op when the Fd was already closed or handed over with TakeFile.
+// A reported pidfd is closed as well.
 func (metadata *EventMetadata) Close() error {
-	if err := unix.Close(int(metadata.Fd)); err != nil {
-		return fmt.Errorf("fanotify: failed to close Fd: %w", err)
+	if err := metadata.closePidfd(); err != nil {
+		_ = metadata.closeFd()
+
+		return err
 	}
 
-	return nil
+	return metadata.closeFd()
 }
 
-// GetPath returns path to file for FD inside event metadata.
-func (metadata *EventMetadata) GetPath() (string, error) {
-	path, err := os.Readlink(
-		filepath.Join(
-			ProcFsFd,
-			strconv.FormatUint(
-				uint64(metadata.Fd),
-				10,
-			),
-		),
-	)
-	if err != nil {
-		return "", fmt.Errorf("fanotify: %w", err)
+func (metadata *EventMetadata) closeFd() error {
+	if metadata.Fd < 0 || !atomic.CompareAndSwapInt32(&metadata.fdState, fdOpen, fdClosed) {
+		return nil
+	}
+
+	if DebugFdLeaks {
+		untrackFdLeak(metadata)
+	}
+
+	if err := sysClose(int(metadata.Fd)); err != nil {
+		return fmt.Errorf("fanotify: close error, %w", err)
 	}
 
-	return path, nil
+	return nil
+}
+
+// GetPath returns path to file for FD inside event metadata, it is resolved
+// once and memoized, see WithPathResolution.
+func (metadata *EventMetadata) GetPath() (string, error) {
+	return metadata.resolvePath()
 }
 
 // GetFdInfo returns parsed '/proc/self/fdinfo/%d' data.
@@ -80,7 +193,7 @@ func (metadata *EventMetadata) GetFdInfo() (FdInfo, error) {
 		),
 	)
 	if err != nil {
-		return out, fmt.Errorf("cnotifyd: procfs error, %w", err)
+		return out, fmt.Errorf("fanotify: procfs error, %w", err)
 	}
 
 	scanner := bufio.NewScanner(bytes.NewReader(content))
@@ -95,7 +208,7 @@ func (metadata *EventMetadata) GetFdInfo() (FdInfo, error) {
 			if i, err = strconv.ParseInt(
 				strings.TrimSpace(strings.TrimPrefix(s, "pos:")), 10, 32,
 			); err != nil {
-				return out, fmt.Errorf("cnotifyd: procfs error, %w", err)
+				return out, fmt.Errorf("fanotify: procfs error, %w", err)
 			}
 
 			out.Position = int(i)
@@ -103,7 +216,7 @@ func (metadata *EventMetadata) GetFdInfo() (FdInfo, error) {
 			if i, err = strconv.ParseInt(
 				strings.TrimSpace(strings.TrimPrefix(s, "flags:")), 8, 32,
 			); err != nil {
-				return out, fmt.Errorf("cnotifyd: procfs error, %w", err)
+				return out, fmt.Errorf("fanotify: procfs error, %w", err)
 			}
 
 			out.Flags = int(i)
@@ -111,7 +224,7 @@ func (metadata *EventMetadata) GetFdInfo() (FdInfo, error) {
 			if i, err = strconv.ParseInt(
 				strings.TrimSpace(strings.TrimPrefix(s, "mnt_id:")), 10, 32,
 			); err != nil {
-				return out, fmt.Errorf("cnotifyd: procfs error, %w", err)
+				return out, fmt.Errorf("fanotify: procfs error, %w", err)
 			}
 
 			out.MountID = int(i)
@@ -119,19 +232,30 @@ func (metadata *EventMetadata) GetFdInfo() (FdInfo, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return out, fmt.Errorf("cnotifyd: procfs error, %w", err)
+		return out, fmt.Errorf("fanotify: procfs error, %w", err)
 	}
 
 	return out, nil
 }
 
 // MatchMask returns 'true' when event metadata matches specified mask.
-func (metadata *EventMetadata) MatchMask(mask int) bool {
-	return (metadata.Mask & uint64(mask)) == uint64(mask)
+func (metadata *EventMetadata) MatchMask(mask EventMask) bool {
+	return EventMask(metadata.Mask)&mask == mask
 }
 
-// File returns pointer to os.File created from event metadata supplied Fd.
-// File needs to be Closed after usage.
+// permissionEvents is the mask of all permission events, pre-content
+// FAN_PRE_ACCESS included, the deprecated FAN_ALL_PERM_EVENTS lacks
+// FAN_OPEN_EXEC_PERM.
+const permissionEvents = FAN_OPEN_PERM | FAN_ACCESS_PERM | FAN_OPEN_EXEC_PERM | FAN_PRE_ACCESS
+
+// IsPermission returns 'true' for permission events, that need a response.
+func (metadata *EventMetadata) IsPermission() bool {
+	return metadata.Mask&permissionEvents != 0
+}
+
+// File returns pointer to os.File created from a duplicate of event metadata
+// supplied Fd, the event itself keeps owning its Fd. File needs to be Closed
+// after usage, in addition to the event Close.
 func (metadata *EventMetadata) File() *os.File {
 	// The fd used in os.NewFile() can be garbage collected, making the fd
 	// used to create it invalid. This can be problematic, as now the fd can
@@ -146,7 +270,11 @@ func (metadata *EventMetadata) File() *os.File {
 	// For more details on when this can happen, see:
 	// https://pkg.go.dev/os#File.Fd, that is referenced from:
 	// https://pkg.go.dev/os#NewFile
-	fd, err := unix.Dup(int(metadata.Fd))
+	if metadata.Fd < 0 || atomic.LoadInt32(&metadata.fdState) != fdOpen {
+		return nil
+	}
+
+	fd, err := sysDup(int(metadata.Fd))
 	if err != nil {
 		return nil
 	}
@@ -154,88 +282,365 @@ func (metadata *EventMetadata) File() *os.File {
 	return os.NewFile(uintptr(fd), "")
 }
 
+// TakeFile transfers ownership of event metadata supplied Fd to the returned
+// os.File without duplicating it, later calls to Close become no-ops. It
+// returns nil when the Fd was already closed or taken. Permission responses
+// still use the original Fd number, so respond before closing the file.
+func (metadata *EventMetadata) TakeFile() *os.File {
+	if metadata.Fd < 0 || !atomic.CompareAndSwapInt32(&metadata.fdState, fdOpen, fdTaken) {
+		return nil
+	}
+
+	if DebugFdLeaks {
+		untrackFdLeak(metadata)
+	}
+
+	return os.NewFile(uintptr(metadata.Fd), "")
+}
+
 // NotifyFD is a notify file handle, used by all fanotify functions.
+//
+// Its methods are safe for concurrent use: GetEvent serializes reads, so an
+// event is never split between callers, and responses written with
+// ResponseAllow, ResponseDeny or a ResponseBatcher are serialized as whole
+// frames, independently of reads. Reading Rd or writing File directly
+// bypasses this and must not be mixed with concurrent method calls.
 type NotifyFD struct {
 	Fd   int
 	File *os.File
 	Rd   io.Reader
+
+	initFlags     InitFlags
+	enrichers     []Enricher
+	versionPolicy VersionPolicy
+	pathMappers   []PathMapper
+	pathCache     *pathCache
+	retryPolicy   *RetryPolicy
+	rawOpenFlags  bool
+	auditNoInfo   int32
+	eventAccess   EventAccess
+	eventNoatime  bool
+	eventAppend   bool
+	observer      bool
+	latency       *LatencyRecorder
+	faults        *FaultInjector
+
+	pathResolution PathResolution
+
+	filtersMu sync.RWMutex
+	filters   []Filter
+
+	// ignored are the IgnoredPIDs, descendants is set by
+	// WithSkipDescendants
+	ignored     PIDSet
+	descendants *descendants
+
+	// markFds are duplicates of fds recorded in marks, owned by the handle
+	marksMu sync.Mutex
+	marks   []MarkSpec
+	markFds map[int]fileObject
+
+	groups markGroups
+
+	handlersMu   sync.RWMutex
+	handlers     []handler
+	permHandlers []permHandler
+	denyActions  []DenyAction
+	onError      func(error)
+	denyWg       sync.WaitGroup
+
+	// memoryLimits are set by WithMemoryLimits, denySlots bound deny runs
+	memoryLimits *MemoryLimits
+	denySlots    chan struct{}
+	denyDropped  uint64
+
+	// readMu serializes event reads through Rd, writeMu response writes
+	readMu  sync.Mutex
+	writeMu sync.Mutex
+	// hdr is the event header read buffer, batch the read time of the
+	// buffered batch for WithLatency, both guarded by readMu
+	hdr   [FAN_EVENT_METADATA_LEN]byte
+	batch time.Time
 }
 
-// Initialize initializes the fanotify support.
-func Initialize(fanotifyFlags uint, openFlags int) (*NotifyFD, error) {
-	fd, err := unix.FanotifyInit(fanotifyFlags, uint(openFlags))
-	if err != nil {
-		return nil, fmt.Errorf("fanotify: init error, %w", err)
-	}
+// PendingEvents returns an upper bound of events queued in the kernel, every
+// event takes at least FAN_EVENT_METADATA_LEN bytes, see Pending.
+func (handle *NotifyFD) PendingEvents() (int, error) {
+	n, err := handle.Pending()
 
-	file := os.NewFile(uintptr(fd), "")
-	rd := bufio.NewReader(file)
+	return n / FAN_EVENT_METADATA_LEN, err
+}
+
+// Close closes the fanotify file handle, pending reads on a FAN_NONBLOCK
+// handle return an error, event Fds already read stay open.
+func (handle *NotifyFD) Close() error {
+	handle.closeMarkFds()
 
-	return &NotifyFD{
-		Fd:   fd,
-		File: file,
-		Rd:   rd,
-	}, err
+	return handle.close()
 }
 
-// Mark implements Add/Delete/Modify for a fanotify mark.
-func (handle *NotifyFD) Mark(flags uint, mask uint64, dirFd int, path string) error {
-	if err := unix.FanotifyMark(handle.Fd, flags, mask, dirFd, path); err != nil {
-		return fmt.Errorf("fanotify: mark error, %w", err)
+// close closes the fanotify file handle, keeping the fds of recorded marks
+// open for adopt.
+func (handle *NotifyFD) close() error {
+	if handle.descendants != nil {
+		handle.descendants.close()
+	}
+
+	if err := handle.File.Close(); err != nil {
+		return fmt.Errorf("fanotify: close error, %w", err)
 	}
 
 	return nil
 }
 
-// GetEvent returns an event from the fanotify handle.
+// ErrSkipped is returned by GetEventOnce for events generated by skipPIDs or
+// IgnoredPIDs or rejected by filters.
+var ErrSkipped = errors.New("fanotify: event skipped")
+
+// GetEvent returns the next event from the fanotify handle, events generated
+// by skipPIDs or IgnoredPIDs or rejected by filters are dropped (permission
+// events are allowed) and the following event is read. It returns an event
+// or an error, never both nil, checks of callers for a nil event are no
+// longer needed.
 func (handle *NotifyFD) GetEvent(skipPIDs ...int) (*EventMetadata, error) {
-	event := new(EventMetadata)
+	for {
+		event, err := handle.GetEventOnce(skipPIDs...)
+		if !errors.Is(err, ErrSkipped) {
+			return event, err
+		}
+	}
+}
 
-	if err := binary.Read(handle.Rd, binary.LittleEndian, event); err != nil {
-		return nil, fmt.Errorf("fanotify: event error, %w", err)
+// WaitEvent returns the next event like GetEvent, but waits for one on a
+// FAN_NONBLOCK handle instead of returning ErrWouldBlock, until the read
+// deadline of File passes or the handle is closed. Run and Iter read
+// through it.
+func (handle *NotifyFD) WaitEvent(skipPIDs ...int) (*EventMetadata, error) {
+	for {
+		event, err := handle.GetEvent(skipPIDs...)
+		if !errors.Is(err, ErrWouldBlock) {
+			return event, err
+		}
+
+		if err := handle.waitReadable(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// GetEventOnce reads exactly one event, like GetEvent, but returns
+// ErrSkipped for a dropped event instead of reading the next one. It is for
+// loops that act between reads, e.g. to count skipped events, and replaces
+// the nil event checks of the former GetEvent contract:
+//
+//	ev, err := handle.GetEventOnce()
+//	if errors.Is(err, fanotify.ErrSkipped) {
+//		continue
+//	}
+func (handle *NotifyFD) GetEventOnce(skipPIDs ...int) (*EventMetadata, error) {
+	handle.readMu.Lock()
+	event, err := handle.readEvent(new(EventMetadata), nil)
+	handle.readMu.Unlock()
+
+	if err != nil {
+		return nil, err
 	}
 
-	if event.Vers != unix.FANOTIFY_METADATA_VERSION {
-		if err := event.Close(); err != nil {
+	return handle.process(event, skipPIDs)
+}
+
+// process applies version policy, skipPIDs, filters and enrichers to a read
+// event, ErrSkipped is returned for dropped events.
+func (handle *NotifyFD) process(event *EventMetadata, skipPIDs []int) (*EventMetadata, error) {
+	if event.Vers != FANOTIFY_METADATA_VERSION {
+		policy := handle.versionPolicy
+		if policy == nil {
+			policy = StrictVersion
+		}
+
+		if err := policy(event); err != nil {
+			_ = event.Close()
+
 			return nil, err
 		}
+	}
+
+	if DebugFdLeaks {
+		trackFdLeak(event)
+	}
+
+	// filters and enrichers may already answer the event
+	event.handle = handle
+
+	if handle.skipPID(int(event.Pid), skipPIDs) {
+		handle.stampFiltered(event, false)
+
+		return nil, handle.drop(event)
+	}
+
+	handle.preparePath(event)
+
+	if !handle.pass(event) {
+		handle.stampFiltered(event, false)
+
+		return nil, handle.drop(event)
+	}
+
+	handle.stampFiltered(event, true)
+
+	event.parseInfo()
+	event.pathMappers = handle.pathMappers
+	event.groups = &handle.groups
 
-		return nil, fmt.Errorf("fanotify: wrong metadata version")
+	for _, enrich := range handle.enrichers {
+		enrich(event)
 	}
 
-	for i := range skipPIDs {
-		if int(event.Pid) == skipPIDs[i] {
-			return nil, event.Close()
+	handle.stampEnriched(event)
+
+	return event, nil
+}
+
+// readEvent reads one event with its info records into event, which is
+// reset first, handle.readMu is held. The event is stored in raw when it has
+// room for it, otherwise in a new slice.
+func (handle *NotifyFD) readEvent(event *EventMetadata, raw []byte) (*EventMetadata, error) {
+	if ev, ok, err := handle.injectRead(event, raw); ok {
+		return ev, err
+	}
+
+	fresh := handle.startBatch()
+
+	event, err := handle.decodeEvent(handle.Rd, handle.hdr[:], event, raw)
+	if err == nil {
+		handle.injectVersion(event)
+		handle.stampBatch(event, &handle.batch, fresh)
+	}
+
+	return event, err
+}
+
+// decodeEvent reads one event from rd, a buffered reader of whole events,
+// using hdr as header buffer, see readEvent. The Fd of an event dropped
+// after its header was read is closed, a permission event allowed first.
+func (handle *NotifyFD) decodeEvent(rd io.Reader, hdr []byte, event *EventMetadata, raw []byte) (*EventMetadata, error) {
+	*event = EventMetadata{}
+
+	if n, err := io.ReadFull(rd, hdr); err != nil {
+		if errors.Is(err, syscall.EAGAIN) {
+			return nil, ErrWouldBlock
 		}
+
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			resync(rd)
+
+			return nil, &TruncatedEventError{EventLen: FAN_EVENT_METADATA_LEN, Read: n}
+		}
+
+		return nil, fmt.Errorf("fanotify: event error, %w", err)
+	}
+
+	event.FanotifyEventMetadata = FanotifyEventMetadata{
+		Event_len:    binary.LittleEndian.Uint32(hdr[0:]),
+		Vers:         hdr[4],
+		Reserved:     hdr[5],
+		Metadata_len: binary.LittleEndian.Uint16(hdr[6:]),
+		Mask:         binary.LittleEndian.Uint64(hdr[8:]),
+		Fd:           int32(binary.LittleEndian.Uint32(hdr[16:])),
+		Pid:          int32(binary.LittleEndian.Uint32(hdr[20:])),
 	}
 
+	event.Time = time.Now()
+
+	if event.Event_len < FAN_EVENT_METADATA_LEN || event.Event_len > ReadBufferSize {
+		_ = handle.skip(event)
+
+		resync(rd)
+
+		return nil, &TruncatedEventError{EventLen: event.Event_len, Read: len(hdr)}
+	}
+
+	// read trailing info records even for an unknown version, so that the
+	// stream stays in sync
+	if cap(raw) >= int(event.Event_len) {
+		event.raw = raw[:event.Event_len]
+	} else {
+		event.raw = make([]byte, event.Event_len)
+	}
+
+	copy(event.raw, hdr)
+
+	if n, err := io.ReadFull(rd, event.raw[len(hdr):]); err != nil {
+		_ = handle.skip(event)
+
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			resync(rd)
+
+			return nil, &TruncatedEventError{EventLen: event.Event_len, Read: len(hdr) + n}
+		}
+
+		return nil, fmt.Errorf("fanotify: event error, %w", err)
+	}
+
+	event.parsePidfd()
+
 	return event, nil
 }
 
-// ResponseAllow sends an allow message back to fanotify, used for permission checks.
-func (handle *NotifyFD) ResponseAllow(ev *EventMetadata) error {
-	if err := binary.Write(
-		handle.File,
-		binary.LittleEndian,
-		&unix.FanotifyResponse{
-			Fd:       ev.Fd,
-			Response: unix.FAN_ALLOW,
-		},
-	); err != nil {
-		return fmt.Errorf("fanotify: response error, %w", err)
+// drop skips a dropped event, it returns ErrSkipped unless skipping failed.
+func (handle *NotifyFD) drop(event *EventMetadata) error {
+	if err := handle.skip(event); err != nil {
+		return err
 	}
 
-	return nil
+	return ErrSkipped
+}
+
+// skip drops event, permission events not answered yet are allowed first,
+// so that skipped processes are never left blocked waiting for a response.
+func (handle *NotifyFD) skip(event *EventMetadata) error {
+	if event.IsPermission() {
+		if err := handle.ResponseAllow(event); err != nil && !errors.Is(err, ErrResponded) {
+			_ = event.Close()
+
+			return err
+		}
+	}
+
+	return event.Close()
+}
+
+// ResponseAllow sends an allow message back to fanotify, used for permission checks.
+// An event is answered once, see EventMetadata.Allow.
+func (handle *NotifyFD) ResponseAllow(ev *EventMetadata) error {
+	return handle.respond(ev, FAN_ALLOW)
 }
 
 // ResponseDeny sends a deny message back to fanotify, used for permission checks.
+// An event is answered once, see EventMetadata.Deny.
 func (handle *NotifyFD) ResponseDeny(ev *EventMetadata) error {
+	return handle.respond(ev, FAN_DENY)
+}
+
+// respond answers ev, it returns ErrResponded when ev was answered before.
+func (handle *NotifyFD) respond(ev *EventMetadata, response uint32) error {
+	if !ev.claimResponse() {
+		return ErrResponded
+	}
+
+	return handle.writeResponse(ev, response)
+}
+
+func (handle *NotifyFD) writeResponse(ev *EventMetadata, response uint32) error {
+	handle.writeMu.Lock()
+	defer handle.writeMu.Unlock()
+
 	if err := binary.Write(
 		handle.File,
 		binary.LittleEndian,
-		&unix.FanotifyResponse{
+		&FanotifyResponse{
 			Fd:       ev.Fd,
-			Response: unix.FAN_DENY,
+			Response: response,
 		},
 	); err != nil {
 		return fmt.Errorf("fanotify: response error, %w", err)
@@ -0,0 +1,288 @@
+package fanotify
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Initialize initializes the fanotify support. openFlags are the event Fd
+// open flags, amended by WithEventAccess, WithNoatime and WithAppend,
+// O_LARGEFILE and O_CLOEXEC are added unless WithRawOpenFlags is given.
+// fanotifyFlags are validated first, see InitFlags.Validate and WithObserver.
+func Initialize(fanotifyFlags InitFlags, openFlags int, opts ...Option) (*NotifyFD, error) {
+	if err := fanotifyFlags.Validate(); err != nil {
+		return nil, err
+	}
+
+	handle := &NotifyFD{
+		initFlags: fanotifyFlags,
+	}
+
+	for _, opt := range opts {
+		opt(handle)
+	}
+
+	if err := handle.checkObserverInit(fanotifyFlags); err != nil {
+		return nil, err
+	}
+
+	if err := handle.checkMemoryLimits(); err != nil {
+		return nil, err
+	}
+
+	openFlags, err := handle.openFlags(openFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.FanotifyInit(uint(fanotifyFlags), uint(openFlags))
+	if errors.Is(err, unix.EINVAL) && openFlags&unix.O_PATH != 0 {
+		return nil, fmt.Errorf("fanotify: init error, O_PATH event fds unsupported by kernel, %w", err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: init error, %w", err)
+	}
+
+	handle.Fd = fd
+	handle.File = os.NewFile(uintptr(fd), "")
+	handle.Rd = bufio.NewReaderSize(handle.File, ReadBufferSize)
+
+	// the Go poller would park reads of a FAN_NONBLOCK fd on EAGAIN
+	if fanotifyFlags&FAN_NONBLOCK != 0 {
+		conn, err := handle.File.SyscallConn()
+		if err != nil {
+			_ = handle.File.Close()
+
+			return nil, fmt.Errorf("fanotify: init error, %w", err)
+		}
+
+		handle.Rd = bufio.NewReaderSize(&nonblockReader{file: handle.File, conn: conn}, ReadBufferSize)
+	}
+
+	return handle, nil
+}
+
+// nonblockReader reads a FAN_NONBLOCK fanotify fd past the Go poller, so
+// that an empty queue fails with ErrWouldBlock, see WaitEvent. Read
+// deadlines of the file still apply.
+type nonblockReader struct {
+	file *os.File
+	conn syscall.RawConn
+}
+
+func (r *nonblockReader) Read(p []byte) (int, error) {
+	var (
+		n   int
+		err error
+	)
+
+	if cerr := r.conn.Read(func(fd uintptr) bool {
+		for {
+			n, err = unix.Read(int(fd), p)
+			if err != unix.EINTR {
+				return true
+			}
+		}
+	}); cerr != nil {
+		return 0, r.pathError(cerr)
+	}
+
+	switch {
+	case err == unix.EAGAIN:
+		return 0, ErrWouldBlock
+	case err != nil:
+		return 0, r.pathError(err)
+	case n == 0 && len(p) > 0:
+		return 0, io.EOF
+	}
+
+	return n, nil
+}
+
+// pathError wraps err as os.File.Read does, reads of a closed file fail
+// with os.ErrClosed.
+func (r *nonblockReader) pathError(err error) error {
+	if _, serr := r.file.Stat(); errors.Is(serr, os.ErrClosed) {
+		err = os.ErrClosed
+	}
+
+	return &os.PathError{Op: "read", Path: r.file.Name(), Err: err}
+}
+
+// waitReadable waits until the handle has an event queued, events already
+// buffered by Rd included, the read deadline of File passes or the handle is
+// closed. It returns at once for handles without FAN_NONBLOCK, whose reads
+// block.
+func (handle *NotifyFD) waitReadable() error {
+	if rd, ok := handle.Rd.(*bufio.Reader); ok && rd.Buffered() != 0 {
+		return nil
+	}
+
+	if handle.initFlags&FAN_NONBLOCK == 0 || handle.File == nil {
+		return nil
+	}
+
+	conn, err := handle.File.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var perr error
+
+	// returning false waits for the poller to report the fd readable
+	if err := conn.Read(func(fd uintptr) bool {
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+
+		n, err := unix.Poll(fds, 0)
+		if err != nil && err != unix.EINTR {
+			perr = err
+
+			return true
+		}
+
+		return n > 0
+	}); err != nil {
+		return (&nonblockReader{file: handle.File}).pathError(err)
+	}
+
+	if perr != nil {
+		return fmt.Errorf("fanotify: poll error, %w", perr)
+	}
+
+	return nil
+}
+
+// Mark implements Add/Delete/Modify for a fanotify mark.
+// When path is empty the object referred to by dirFd itself is marked, as
+// by MarkFd.
+// The mark is validated against the group first, see ValidateMark and
+// WithObserver, kernel rejections are returned as *MarkError.
+func (handle *NotifyFD) Mark(flags MarkFlags, mask EventMask, dirFd int, path string) error {
+	if path == "" && dirFd >= 0 && flags&FAN_MARK_FLUSH == 0 {
+		return handle.MarkFd(flags, mask, dirFd)
+	}
+
+	if err := handle.checkObserverMask(mask); err != nil {
+		return err
+	}
+
+	if err := ValidateMark(handle.initFlags, flags, mask); err != nil {
+		return err
+	}
+
+	if err := handle.retry(func() error {
+		if err := handle.injectFault(FaultMarkENOSPC); err != nil {
+			return err
+		}
+
+		return unix.FanotifyMark(handle.Fd, uint(flags), uint64(mask), dirFd, path)
+	}); err != nil {
+		return markError(flags, mask, dirFd, path, err)
+	}
+
+	if path == "" && flags&FAN_MARK_FLUSH == 0 {
+		handle.recordMarkFd(flags, mask, dirFd)
+	} else {
+		handle.recordMark(flags, mask, dirFd, path)
+	}
+
+	return nil
+}
+
+// MarkFd implements Add/Delete/Modify for a fanotify mark on the object
+// referred to by an already open fd (O_PATH fds included),
+// avoiding a second path lookup between open and mark.
+// Fds of the mount API are accepted, such as a detached mount of
+// open_tree(2) with OPEN_TREE_CLONE or fsmount(2), use FAN_MARK_MOUNT or
+// FAN_MARK_FILESYSTEM to mark the whole mount or filesystem. Paths of events
+// on a detached mount are relative to its root, see Marks for how such marks
+// are recorded.
+func (handle *NotifyFD) MarkFd(flags MarkFlags, mask EventMask, fd int) error {
+	if fd < 0 {
+		return markError(flags, mask, fd, "", unix.EBADF)
+	}
+
+	if err := handle.checkObserverMask(mask); err != nil {
+		return err
+	}
+
+	if err := ValidateMark(handle.initFlags, flags, mask); err != nil {
+		return err
+	}
+
+	err := handle.retry(func() error {
+		if err := handle.injectFault(FaultMarkENOSPC); err != nil {
+			return err
+		}
+
+		return unix.FanotifyMark(handle.Fd, uint(flags), uint64(mask), fd, "")
+	})
+	if errors.Is(err, unix.EBADF) {
+		// Kernel refuses O_PATH fds when no pathname is supplied, the procfs
+		// magic link resolves to the very same object without a path walk.
+		if handle.retry(func() error {
+			return unix.FanotifyMark(
+				handle.Fd,
+				uint(flags&^FAN_MARK_DONT_FOLLOW),
+				uint64(mask),
+				unix.AT_FDCWD,
+				filepath.Join(ProcFsFd, strconv.Itoa(fd)),
+			)
+		}) == nil {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		return markError(flags, mask, fd, "", err)
+	}
+
+	handle.recordMarkFd(flags, mask, fd)
+
+	return nil
+}
+
+// MarkPathSecure implements Add/Delete/Modify for a fanotify mark on path,
+// resolved relative to root with openat2 so that symlinks are never followed
+// and the lookup can not escape root (RESOLVE_NO_SYMLINKS|RESOLVE_BENEATH).
+// Use it when marks are configured from untrusted input.
+func (handle *NotifyFD) MarkPathSecure(flags MarkFlags, mask EventMask, root, path string) error {
+	rootFd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("fanotify: mark error, %s: %w", root, err)
+	}
+	defer unix.Close(rootFd)
+
+	var fd int
+
+	err = handle.retry(func() (err error) {
+		fd, err = unix.Openat2(rootFd, path, &unix.OpenHow{
+			Flags:   unix.O_PATH | unix.O_CLOEXEC,
+			Resolve: unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_BENEATH,
+		})
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("fanotify: mark error, %s beneath %s: %w", path, root, err)
+	}
+	defer unix.Close(fd)
+
+	err = handle.MarkFd(flags, mask, fd)
+
+	var markErr *MarkError
+	if errors.As(err, &markErr) {
+		markErr.Path = filepath.Join(root, path)
+	}
+
+	return err
+}
@@ -0,0 +1,86 @@
+package fanotify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNonblockRead(t *testing.T) {
+	notify, err := Initialize(FAN_CLASS_NOTIF|FAN_CLOEXEC|FAN_NONBLOCK, os.O_RDONLY)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	dir := t.TempDir()
+
+	if err := notify.Mark(FAN_MARK_ADD, FAN_OPEN|FAN_EVENT_ON_CHILD, AT_FDCWD, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// an empty queue fails at once
+	done := make(chan error, 1)
+
+	go func() {
+		ev, err := notify.GetEvent()
+		if ev != nil {
+			_ = ev.Close()
+		}
+
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrWouldBlock) {
+			t.Fatalf("GetEvent: got %v, want ErrWouldBlock", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("GetEvent blocked on an empty queue")
+	}
+
+	// WaitEvent honors the read deadline
+	if err := notify.File.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := notify.WaitEvent(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("WaitEvent: got %v, want os.ErrDeadlineExceeded", err)
+	}
+
+	if err := notify.File.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// and returns events queued while it waits
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+
+		if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0o600); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	ev, err := notify.WaitEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ev.MatchMask(FAN_OPEN) {
+		t.Fatalf("got mask %#x, want FAN_OPEN", ev.Mask)
+	}
+
+	_ = ev.Close()
+
+	// Close unblocks a waiting reader
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = notify.Close()
+	}()
+
+	if _, err := notify.WaitEvent(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("WaitEvent after Close: got %v, want os.ErrClosed", err)
+	}
+}
@@ -0,0 +1,188 @@
+package fanotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"syscall"
+)
+
+// FaultPoint is a kernel failure a FaultInjector can simulate.
+type FaultPoint int
+
+// Fault points.
+const (
+	// FaultReadEINTR fails a read with EINTR, as a raw read(2) interrupted
+	// by a signal, os.File retries it so that it never happens otherwise.
+	FaultReadEINTR FaultPoint = iota
+	// FaultShortRead reads a truncated event before the next event, see
+	// TruncatedEventError. Buffered events are kept.
+	FaultShortRead
+	// FaultOverflow reads a FAN_Q_OVERFLOW event before the next event.
+	FaultOverflow
+	// FaultVersion bumps the metadata version of the next event, see
+	// VersionPolicy.
+	FaultVersion
+	// FaultEINTR fails an attempt of a syscall covered by RetryPolicy with
+	// EINTR: marks, path resolution and batched responses.
+	FaultEINTR
+	// FaultMarkENOSPC fails a mark with ENOSPC, as when the marks limit of
+	// the user is reached.
+	FaultMarkENOSPC
+
+	faultPoints
+)
+
+var faultPointNames = [faultPoints]string{"read_eintr", "short_read", "overflow", "version", "eintr", "mark_enospc"}
+
+func (point FaultPoint) String() string {
+	if point < 0 || point >= faultPoints {
+		return fmt.Sprintf("FaultPoint(%d)", int(point))
+	}
+
+	return faultPointNames[point]
+}
+
+// FaultInjector injects simulated kernel failures into the reads and
+// syscalls of a NotifyFD, so that consumers can test their resilience paths
+// deterministically. Faults fire the next times their point is reached, in
+// reading order for events, see WithFaults. It is safe for concurrent use.
+type FaultInjector struct {
+	mu    sync.Mutex
+	armed [faultPoints]int
+	hits  [faultPoints]uint64
+}
+
+// NewFaultInjector returns a FaultInjector with no armed faults.
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{}
+}
+
+// WithFaults injects the faults armed in f. Event faults apply to reads of
+// GetEvent, and so of Run, Iter, Watcher and EventRing, not to RunSharded and
+// URingReader.
+func WithFaults(f *FaultInjector) Option {
+	return func(handle *NotifyFD) {
+		handle.faults = f
+	}
+}
+
+// Inject arms point for the next n times it is reached, n < 0 arms it until
+// Clear.
+func (f *FaultInjector) Inject(point FaultPoint, n int) {
+	if point < 0 || point >= faultPoints {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.armed[point] = n
+}
+
+// Clear disarms all points.
+func (f *FaultInjector) Clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.armed = [faultPoints]int{}
+}
+
+// Injected returns how often point fired.
+func (f *FaultInjector) Injected(point FaultPoint) uint64 {
+	if point < 0 || point >= faultPoints {
+		return 0
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.hits[point]
+}
+
+// fire reports whether point is armed and counts it.
+func (f *FaultInjector) fire(point FaultPoint) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.armed[point] == 0 {
+		return false
+	}
+
+	if f.armed[point] > 0 {
+		f.armed[point]--
+	}
+
+	f.hits[point]++
+
+	return true
+}
+
+// injectFault returns the error of a fired syscall fault point.
+func (handle *NotifyFD) injectFault(point FaultPoint) error {
+	if handle.faults == nil || !handle.faults.fire(point) {
+		return nil
+	}
+
+	switch point {
+	case FaultMarkENOSPC:
+		return syscall.ENOSPC
+	default:
+		return syscall.EINTR
+	}
+}
+
+// injectRead returns a fired read fault instead of reading an event into
+// event, ok is false when none fired, handle.readMu is held.
+func (handle *NotifyFD) injectRead(event *EventMetadata, raw []byte) (_ *EventMetadata, ok bool, _ error) {
+	if handle.faults == nil {
+		return nil, false, nil
+	}
+
+	if handle.faults.fire(FaultReadEINTR) {
+		return nil, true, fmt.Errorf("fanotify: event error, %w", syscall.EINTR)
+	}
+
+	var frame []byte
+
+	switch {
+	case handle.faults.fire(FaultOverflow):
+		frame = faultFrame(FAN_EVENT_METADATA_LEN, FAN_Q_OVERFLOW)
+	case handle.faults.fire(FaultShortRead):
+		// the header claims an info record that is missing
+		frame = faultFrame(FAN_EVENT_METADATA_LEN+infoHeaderLen, FAN_OPEN)
+	default:
+		return nil, false, nil
+	}
+
+	ev, err := handle.decodeEvent(bytes.NewReader(frame), handle.hdr[:], event, raw)
+
+	return ev, true, err
+}
+
+// injectVersion bumps the metadata version of a read event when
+// FaultVersion fires.
+func (handle *NotifyFD) injectVersion(event *EventMetadata) {
+	if handle.faults == nil || !handle.faults.fire(FaultVersion) {
+		return
+	}
+
+	event.Vers = FANOTIFY_METADATA_VERSION + 1
+	event.raw[4] = event.Vers
+}
+
+// faultFrame returns an event header of eventLen and mask without an event
+// Fd.
+func faultFrame(eventLen uint32, mask uint64) []byte {
+	frame := make([]byte, FAN_EVENT_METADATA_LEN)
+	noFd := int32(FAN_NOFD)
+
+	binary.LittleEndian.PutUint32(frame[0:], eventLen)
+	frame[4] = FANOTIFY_METADATA_VERSION
+	binary.LittleEndian.PutUint16(frame[6:], FAN_EVENT_METADATA_LEN)
+	binary.LittleEndian.PutUint64(frame[8:], mask)
+	binary.LittleEndian.PutUint32(frame[16:], uint32(noFd))
+
+	return frame
+}
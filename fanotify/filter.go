@@ -0,0 +1,116 @@
+package fanotify
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Filter decides whether an event is delivered, returning 'false' drops it.
+// Dropped events are handled like skipped PIDs in GetEvent: permission
+// events are allowed, the event Fd is closed and the next event is read.
+type Filter func(*EventMetadata) bool
+
+// WithFilter adds filters every event has to pass, in order.
+func WithFilter(filters ...Filter) Option {
+	return func(handle *NotifyFD) {
+		handle.filters = append(handle.filters, filters...)
+	}
+}
+
+// SetFilters replaces all filters, it is safe to call while events are read.
+func (handle *NotifyFD) SetFilters(filters ...Filter) {
+	handle.filtersMu.Lock()
+	defer handle.filtersMu.Unlock()
+
+	handle.filters = append([]Filter(nil), filters...)
+}
+
+// Filters returns current filters.
+func (handle *NotifyFD) Filters() []Filter {
+	handle.filtersMu.RLock()
+	defer handle.filtersMu.RUnlock()
+
+	return append([]Filter(nil), handle.filters...)
+}
+
+// pass reports whether event passes all filters.
+func (handle *NotifyFD) pass(event *EventMetadata) bool {
+	handle.filtersMu.RLock()
+	defer handle.filtersMu.RUnlock()
+
+	for _, filter := range handle.filters {
+		if !filter(event) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ExcludePIDs drops events generated by listed processes.
+func ExcludePIDs(pids ...int) Filter {
+	set := make(map[int]struct{}, len(pids))
+
+	for _, pid := range pids {
+		set[pid] = struct{}{}
+	}
+
+	return func(metadata *EventMetadata) bool {
+		_, ok := set[metadata.GetPID()]
+
+		return !ok
+	}
+}
+
+// ExcludeUIDs drops events generated by processes running with listed real
+// UIDs. Events of processes that already exited are kept.
+func ExcludeUIDs(uids ...int) Filter {
+	set := idSet(uids)
+
+	return func(metadata *EventMetadata) bool {
+		creds, err := metadata.GetCredentials()
+		if err != nil {
+			return true
+		}
+
+		_, ok := set[creds.UID]
+
+		return !ok
+	}
+}
+
+// IncludePaths keeps only events for paths matching any of the patterns,
+// see MatchPath and IncludePathsFold. Events without a resolvable path are
+// dropped.
+func IncludePaths(patterns ...string) Filter {
+	return IncludePathsFold(0, patterns...)
+}
+
+// ExcludePaths drops events for paths matching any of the patterns, see
+// MatchPath and ExcludePathsFold. Events without a resolvable path are kept.
+func ExcludePaths(patterns ...string) Filter {
+	return ExcludePathsFold(0, patterns...)
+}
+
+// MatchPath reports whether path matches pattern: a pattern ending with "/"
+// matches everything below that directory, any other pattern is matched as
+// a filepath.Match glob.
+func MatchPath(pattern, path string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(path, pattern)
+	}
+
+	ok, _ := filepath.Match(pattern, path)
+
+	return ok
+}
+
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if MatchPath(pattern, path) {
+			return true
+		}
+	}
+
+	return false
+}
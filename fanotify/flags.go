@@ -0,0 +1,147 @@
+package fanotify
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// InitFlags are fanotify_init flags, FAN_CLASS_*, FAN_REPORT_* and friends.
+type InitFlags uint
+
+// MarkFlags are fanotify_mark flags, FAN_MARK_*.
+type MarkFlags uint
+
+// EventMask is a fanotify event mask, FAN_* event bits.
+type EventMask uint64
+
+// Flag groups used by validation, mirroring the kernel internal ones.
+const (
+	initClassBits InitFlags = FAN_CLASS_CONTENT | FAN_CLASS_PRE_CONTENT
+	initFidBits   InitFlags = FAN_REPORT_FID | FAN_REPORT_DFID_NAME | FAN_REPORT_TARGET_FID
+	initAllBits   InitFlags = FAN_CLOEXEC | FAN_NONBLOCK | initClassBits |
+		FAN_UNLIMITED_QUEUE | FAN_UNLIMITED_MARKS | FAN_ENABLE_AUDIT |
+		FAN_REPORT_PIDFD | FAN_REPORT_TID | initFidBits |
+		FAN_REPORT_FD_ERROR | FAN_REPORT_MNT
+
+	markActionBits MarkFlags = FAN_MARK_ADD | FAN_MARK_REMOVE | FAN_MARK_FLUSH
+	markAllBits    MarkFlags = markActionBits | markTypeFlags |
+		FAN_MARK_DONT_FOLLOW | FAN_MARK_ONLYDIR | FAN_MARK_IGNORED_MASK |
+		FAN_MARK_IGNORED_SURV_MODIFY | FAN_MARK_EVICTABLE | FAN_MARK_IGNORE
+
+	// eventInodeBits are events only inode and filesystem marks of FID
+	// groups can report.
+	eventInodeBits EventMask = FAN_ATTRIB | FAN_MOVE | FAN_CREATE | FAN_DELETE |
+		FAN_DELETE_SELF | FAN_MOVE_SELF | FAN_RENAME
+	eventPermBits EventMask = permissionEvents
+	// eventMountBits are the events of mount namespace marks.
+	eventMountBits EventMask = FAN_MNT_ATTACH | FAN_MNT_DETACH
+	eventAllBits   EventMask = FAN_ACCESS | FAN_MODIFY | FAN_CLOSE | FAN_OPEN |
+		FAN_OPEN_EXEC | eventInodeBits | FAN_FS_ERROR |
+		eventPermBits | eventMountBits | FAN_EVENT_ON_CHILD | FAN_ONDIR
+)
+
+// Class returns the notification class, FAN_CLASS_NOTIF, FAN_CLASS_CONTENT
+// or FAN_CLASS_PRE_CONTENT.
+func (f InitFlags) Class() InitFlags {
+	return f & initClassBits
+}
+
+// Validate rejects init flag combinations fanotify_init fails with EINVAL,
+// the returned error wraps unix.EINVAL.
+func (f InitFlags) Validate() error {
+	switch {
+	case f&^initAllBits != 0:
+		return invalidFlags("unknown init flags %#x", uint(f&^initAllBits))
+	case f.Class() == initClassBits:
+		return invalidFlags("FAN_CLASS_CONTENT and FAN_CLASS_PRE_CONTENT are exclusive")
+	case f&FAN_REPORT_PIDFD != 0 && f&FAN_REPORT_TID != 0:
+		return invalidFlags("FAN_REPORT_PIDFD and FAN_REPORT_TID are exclusive")
+	case f&FAN_REPORT_NAME != 0 && f&FAN_REPORT_DIR_FID == 0:
+		return invalidFlags("FAN_REPORT_NAME needs FAN_REPORT_DIR_FID")
+	case f&FAN_REPORT_TARGET_FID != 0 && f&(FAN_REPORT_FID|FAN_REPORT_DFID_NAME) != FAN_REPORT_FID|FAN_REPORT_DFID_NAME:
+		return invalidFlags("FAN_REPORT_TARGET_FID needs FAN_REPORT_FID and FAN_REPORT_DFID_NAME")
+	case f&initFidBits != 0 && f.Class() != FAN_CLASS_NOTIF:
+		return invalidFlags("FID reporting needs FAN_CLASS_NOTIF")
+	case f&FAN_REPORT_MNT != 0 && f&initFidBits != 0:
+		return invalidFlags("FAN_REPORT_MNT and FID reporting are exclusive")
+	}
+
+	return nil
+}
+
+// Validate rejects mark flag combinations fanotify_mark fails with EINVAL,
+// see ValidateMark for checks against the group and the event mask.
+func (f MarkFlags) Validate() error {
+	switch {
+	case f&^markAllBits != 0:
+		return invalidFlags("unknown mark flags %#x", uint(f&^markAllBits))
+	case f&markActionBits != FAN_MARK_ADD && f&markActionBits != FAN_MARK_REMOVE &&
+		f&markActionBits != FAN_MARK_FLUSH:
+		return invalidFlags("exactly one of FAN_MARK_ADD, FAN_MARK_REMOVE and FAN_MARK_FLUSH is needed")
+	case f&FAN_MARK_EVICTABLE != 0 && f&markTypeFlags != 0:
+		return invalidFlags("FAN_MARK_EVICTABLE needs an inode mark")
+	case f&FAN_MARK_IGNORE != 0 && f&FAN_MARK_IGNORED_MASK != 0:
+		return invalidFlags("FAN_MARK_IGNORE and FAN_MARK_IGNORED_MASK are exclusive")
+	}
+
+	return nil
+}
+
+// Validate rejects bits that can not be set in a mark mask.
+func (m EventMask) Validate() error {
+	if m&^eventAllBits != 0 {
+		return invalidFlags("unknown event bits %#x", uint64(m&^eventAllBits))
+	}
+
+	return nil
+}
+
+// ValidateMark rejects a mark before the kernel returns an opaque EINVAL:
+// it checks flags and mask on their own and against the group init flags,
+// e.g. permission events on a FAN_CLASS_NOTIF group or directory entry
+// events on a mount mark.
+func ValidateMark(init InitFlags, flags MarkFlags, mask EventMask) error {
+	if err := flags.Validate(); err != nil {
+		return err
+	}
+
+	if err := mask.Validate(); err != nil {
+		return err
+	}
+
+	// flush and remove only drop what was added before
+	if flags&FAN_MARK_ADD == 0 || flags&(FAN_MARK_IGNORED_MASK|FAN_MARK_IGNORE) != 0 {
+		return nil
+	}
+
+	fid := init&initFidBits != 0
+	// FAN_MARK_MNTNS is FAN_MARK_MOUNT|FAN_MARK_FILESYSTEM
+	mntns := flags&markTypeFlags == FAN_MARK_MNTNS
+
+	switch {
+	case mntns != (init&FAN_REPORT_MNT != 0):
+		return invalidFlags("FAN_MARK_MNTNS marks and FAN_REPORT_MNT groups go together")
+	case mntns && mask&^eventMountBits != 0:
+		return invalidFlags("mount namespace marks report %s only", eventMountBits)
+	case !mntns && mask&eventMountBits != 0:
+		return invalidFlags("mount events %s need a FAN_MARK_MNTNS mark", mask&eventMountBits)
+	case mask&FAN_PRE_ACCESS != 0 && init.Class() != FAN_CLASS_PRE_CONTENT:
+		return invalidFlags("FAN_PRE_ACCESS needs FAN_CLASS_PRE_CONTENT")
+	case mask&eventPermBits != 0 && init.Class() == FAN_CLASS_NOTIF:
+		return invalidFlags("permission events %s need FAN_CLASS_CONTENT or FAN_CLASS_PRE_CONTENT", mask&eventPermBits)
+	case mask&eventInodeBits != 0 && flags&FAN_MARK_MOUNT != 0:
+		return invalidFlags("directory entry, attribute and self events %s can not be reported by mount marks", mask&eventInodeBits)
+	case mask&eventInodeBits != 0 && !fid:
+		return invalidFlags("directory entry, attribute and self events %s need FID reporting", mask&eventInodeBits)
+	case mask&FAN_RENAME != 0 && init&FAN_REPORT_NAME == 0:
+		return invalidFlags("FAN_RENAME needs FAN_REPORT_DFID_NAME")
+	case mask&FAN_FS_ERROR != 0 && (flags&FAN_MARK_FILESYSTEM == 0 || !fid):
+		return invalidFlags("FAN_FS_ERROR needs a filesystem mark of a FID group")
+	}
+
+	return nil
+}
+
+func invalidFlags(format string, args ...interface{}) error {
+	return fmt.Errorf("fanotify: flags error, %s, %w", fmt.Sprintf(format, args...), syscall.EINVAL)
+}
@@ -0,0 +1,82 @@
+package fanotify
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// String implements fmt.Stringer, e.g.
+// `mask=open,close_write pid=42 fd=7 fd_state=open path="/etc/hosts"`. The
+// path is shown once resolved, it is never resolved by String, FID events
+// show the name of their first named record instead.
+func (metadata *EventMetadata) String() string {
+	var b strings.Builder
+
+	b.WriteString("mask=")
+	b.WriteString(EventMask(metadata.Mask).String())
+	b.WriteString(" pid=")
+	b.WriteString(strconv.Itoa(metadata.GetPID()))
+	b.WriteString(" fd=")
+	b.WriteString(strconv.Itoa(int(metadata.Fd)))
+	b.WriteString(" fd_state=")
+	b.WriteString(metadata.fdStateName())
+
+	if path, ok := metadata.cachedPath(); ok {
+		b.WriteString(" path=")
+		b.WriteString(strconv.Quote(path))
+	} else if name := metadata.recordName(); name != "" {
+		b.WriteString(" name=")
+		b.WriteString(strconv.Quote(name))
+	}
+
+	return b.String()
+}
+
+// fdStateName returns the ownership state of the event Fd: "none" for
+// events without one, "open", "retained", "taken" or "closed".
+func (metadata *EventMetadata) fdStateName() string {
+	if metadata.Fd < 0 {
+		return "none"
+	}
+
+	switch atomic.LoadInt32(&metadata.fdState) {
+	case fdTaken:
+		return "taken"
+	case fdClosed:
+		return "closed"
+	}
+
+	if atomic.LoadInt32(&metadata.retained) != 0 {
+		return "retained"
+	}
+
+	return "open"
+}
+
+// cachedPath returns the memoized event path without resolving it, ok is
+// false when it was not resolved or resolving failed.
+func (metadata *EventMetadata) cachedPath() (string, bool) {
+	if atomic.LoadInt32(&metadata.pathState) != pathResolved || metadata.pathErr != nil {
+		return "", false
+	}
+
+	return metadata.path, metadata.path != ""
+}
+
+// recordName returns the name of the first named FID record.
+func (metadata *EventMetadata) recordName() string {
+	var name string
+
+	metadata.EachInfoRecord(func(record InfoRecord) bool {
+		if _, n, ok := record.FID(); ok && n != "" {
+			name = n
+
+			return false
+		}
+
+		return true
+	})
+
+	return name
+}
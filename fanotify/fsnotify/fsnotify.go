@@ -0,0 +1,298 @@
+// Package fsnotify provides an fsnotify-like API (Event{Name, Op},
+// Watcher.Events/Errors) backed by fanotify mount marks, so code written
+// against github.com/fsnotify/fsnotify can switch to whole-mount monitoring
+// with minimal changes.
+//
+// Semantic differences to fsnotify:
+//   - Add marks the whole mount containing the path, events for every file
+//     on that mount are delivered, not only for direct children of path.
+//   - Mount marks only report file content events, so only Write is ever
+//     delivered, Create, Remove, Rename and Chmod are never seen.
+//   - Event names are absolute paths as resolved through /proc/self/fd.
+//   - CAP_SYS_ADMIN is required.
+package fsnotify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// Op describes a set of file operations.
+type Op uint32
+
+// Operations, same values as in fsnotify.
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	Chmod
+)
+
+// Common errors, same meaning as in fsnotify.
+var (
+	ErrNonExistentWatch = errors.New("fsnotify: can't remove non-existent watch")
+	ErrEventOverflow    = errors.New("fsnotify: queue or buffer overflow")
+	ErrClosed           = errors.New("fsnotify: watcher already closed")
+)
+
+// String returns operations as "CREATE|WRITE".
+func (op Op) String() string {
+	var out []string
+
+	for _, v := range []struct {
+		op   Op
+		name string
+	}{
+		{Create, "CREATE"},
+		{Write, "WRITE"},
+		{Remove, "REMOVE"},
+		{Rename, "RENAME"},
+		{Chmod, "CHMOD"},
+	} {
+		if op.Has(v.op) {
+			out = append(out, v.name)
+		}
+	}
+
+	if len(out) == 0 {
+		return "[no events]"
+	}
+
+	return strings.Join(out, "|")
+}
+
+// Has reports whether op has h set.
+func (op Op) Has(h Op) bool {
+	return op&h != 0
+}
+
+// Event represents a file system notification.
+type Event struct {
+	Name string
+	Op   Op
+}
+
+// Has reports whether event has op set.
+func (e Event) Has(op Op) bool {
+	return e.Op.Has(op)
+}
+
+// String returns event as `WRITE "/path/to/file"`.
+func (e Event) String() string {
+	return fmt.Sprintf("%-13s %q", e.Op.String(), e.Name)
+}
+
+// Watcher watches mounts of a set of paths, delivering events to a channel.
+type Watcher struct {
+	Events chan Event
+	Errors chan error
+
+	notify *fanotify.NotifyFD
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	paths []string
+}
+
+// mask is the fanotify event mask mapped onto Write.
+const mask = fanotify.FAN_MODIFY
+
+// NewWatcher creates a new Watcher.
+func NewWatcher() (*Watcher, error) {
+	// FAN_NONBLOCK makes the Go runtime poll the fd, so Close unblocks the reader.
+	notify, err := fanotify.Initialize(
+		fanotify.FAN_CLOEXEC|
+			fanotify.FAN_CLASS_NOTIF|
+			fanotify.FAN_NONBLOCK|
+			fanotify.FAN_UNLIMITED_QUEUE|
+			fanotify.FAN_UNLIMITED_MARKS,
+		os.O_RDONLY,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		Events: make(chan Event),
+		Errors: make(chan error),
+		notify: notify,
+		done:   make(chan struct{}),
+	}
+
+	w.wg.Add(1)
+
+	go w.readEvents()
+
+	return w, nil
+}
+
+// Add starts watching the mount containing name.
+func (w *Watcher) Add(name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.isClosed() {
+		return ErrClosed
+	}
+
+	for _, path := range w.paths {
+		if path == name {
+			return nil
+		}
+	}
+
+	if err := w.notify.Mark(
+		fanotify.FAN_MARK_ADD|fanotify.FAN_MARK_MOUNT, mask, fanotify.AT_FDCWD, name,
+	); err != nil {
+		return err
+	}
+
+	w.paths = append(w.paths, name)
+
+	return nil
+}
+
+// Remove stops watching the mount containing name, other added paths on the
+// same mount keep it watched.
+func (w *Watcher) Remove(name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.isClosed() {
+		return nil
+	}
+
+	idx := -1
+
+	for i, path := range w.paths {
+		if path == name {
+			idx = i
+		}
+	}
+
+	if idx < 0 {
+		return fmt.Errorf("%w: %s", ErrNonExistentWatch, name)
+	}
+
+	w.paths = append(w.paths[:idx], w.paths[idx+1:]...)
+
+	if err := w.notify.Mark(
+		fanotify.FAN_MARK_REMOVE|fanotify.FAN_MARK_MOUNT, mask, fanotify.AT_FDCWD, name,
+	); err != nil && !errors.Is(err, syscall.ENOENT) {
+		return err
+	}
+
+	// re-add mount marks that were shared with the removed path
+	for _, path := range w.paths {
+		if err := w.notify.Mark(
+			fanotify.FAN_MARK_ADD|fanotify.FAN_MARK_MOUNT, mask, fanotify.AT_FDCWD, path,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WatchList returns all paths added with Add.
+func (w *Watcher) WatchList() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]string(nil), w.paths...)
+}
+
+// Close removes all watches and closes the Events and Errors channels.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+
+	if w.isClosed() {
+		w.mu.Unlock()
+
+		return nil
+	}
+
+	close(w.done)
+	w.mu.Unlock()
+
+	err := w.notify.Close()
+	w.wg.Wait()
+
+	return err
+}
+
+func (w *Watcher) isClosed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Watcher) readEvents() {
+	defer w.wg.Done()
+	defer close(w.Events)
+	defer close(w.Errors)
+
+	for {
+		ev, err := w.notify.WaitEvent()
+		if w.isClosed() {
+			if ev != nil {
+				_ = ev.Close()
+			}
+
+			return
+		}
+
+		if err != nil {
+			if !w.sendError(err) {
+				return
+			}
+
+			continue
+		}
+
+		if ev.MatchMask(fanotify.FAN_Q_OVERFLOW) {
+			if !w.sendError(ErrEventOverflow) {
+				return
+			}
+
+			continue
+		}
+
+		path, err := ev.GetPath()
+		_ = ev.Close()
+
+		if err != nil {
+			if !w.sendError(err) {
+				return
+			}
+
+			continue
+		}
+
+		select {
+		case w.Events <- Event{Name: path, Op: Write}:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Watcher) sendError(err error) bool {
+	select {
+	case w.Errors <- err:
+		return true
+	case <-w.done:
+		return false
+	}
+}
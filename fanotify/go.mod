@@ -2,4 +2,7 @@ module github.com/s3rj1k/go-fanotify/fanotify
 
 go 1.18
 
-require golang.org/x/sys v0.17.0
+require (
+	golang.org/x/sys v0.17.0
+	golang.org/x/text v0.14.0
+)
@@ -0,0 +1,324 @@
+package fanotify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// MarkGroup is a named set of marks on a NotifyFD, e.g. "app-data" or
+// "etc-config", that is enabled, disabled or flushed independently of other
+// groups. Events are tagged with the names of enabled groups having a mark
+// that covers them, see EventMetadata.Groups.
+//
+// The kernel keeps one mark per object and group of the NotifyFD, groups
+// marking the same object share it: disabling a group only removes mask bits
+// no other enabled group needs.
+type MarkGroup struct {
+	name   string
+	handle *NotifyFD
+
+	// marks and enabled are guarded by handle.groups.mu
+	marks   []groupMark
+	enabled bool
+}
+
+// groupMark is a mark of a group, dev is the marked device for mount and
+// filesystem marks.
+type groupMark struct {
+	MarkSpec
+	dev uint64
+}
+
+// markGroups are the groups of a NotifyFD, mu guards them all.
+type markGroups struct {
+	mu     sync.RWMutex
+	byName map[string]*MarkGroup
+}
+
+// Group returns the group called name, creating an enabled empty group on
+// first use.
+func (handle *NotifyFD) Group(name string) *MarkGroup {
+	handle.groups.mu.Lock()
+	defer handle.groups.mu.Unlock()
+
+	if g, ok := handle.groups.byName[name]; ok {
+		return g
+	}
+
+	if handle.groups.byName == nil {
+		handle.groups.byName = make(map[string]*MarkGroup)
+	}
+
+	g := &MarkGroup{name: name, handle: handle, enabled: true}
+	handle.groups.byName[name] = g
+
+	return g
+}
+
+// Groups returns names of all groups, sorted.
+func (handle *NotifyFD) Groups() []string {
+	handle.groups.mu.RLock()
+	defer handle.groups.mu.RUnlock()
+
+	names := make([]string, 0, len(handle.groups.byName))
+
+	for name := range handle.groups.byName {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Name returns the group name.
+func (g *MarkGroup) Name() string {
+	return g.name
+}
+
+// Enabled reports whether group marks are applied.
+func (g *MarkGroup) Enabled() bool {
+	g.handle.groups.mu.RLock()
+	defer g.handle.groups.mu.RUnlock()
+
+	return g.enabled
+}
+
+// Marks returns group marks, applied or not.
+func (g *MarkGroup) Marks() []MarkSpec {
+	g.handle.groups.mu.RLock()
+	defer g.handle.groups.mu.RUnlock()
+
+	out := make([]MarkSpec, 0, len(g.marks))
+
+	for _, mark := range g.marks {
+		out = append(out, mark.MarkSpec)
+	}
+
+	return out
+}
+
+// Mark adds a mark to the group, see NotifyFD.Mark. flags select the mark
+// type, FAN_MARK_ADD is implied. The mark is applied right away when the
+// group is enabled, and recorded only otherwise. Marks of an fd, with an
+// empty path, are recorded by the path the fd refers to.
+func (g *MarkGroup) Mark(flags MarkFlags, mask EventMask, dirFd int, path string) error {
+	flags &= markSpecFlags
+
+	if path == "" {
+		target, err := os.Readlink(filepath.Join(ProcFsFd, strconv.Itoa(dirFd)))
+		if err != nil {
+			return markError(flags, mask, dirFd, path, err)
+		}
+
+		dirFd, path = AT_FDCWD, target
+	} else if dirFd != AT_FDCWD && !filepath.IsAbs(path) {
+		dir, err := os.Readlink(filepath.Join(ProcFsFd, strconv.Itoa(dirFd)))
+		if err != nil {
+			return markError(flags, mask, dirFd, path, err)
+		}
+
+		dirFd, path = AT_FDCWD, filepath.Join(dir, path)
+	}
+
+	mark := groupMark{MarkSpec: MarkSpec{Flags: flags, Mask: mask, DirFd: dirFd, Path: path}}
+
+	if flags&markTypeFlags != 0 {
+		st, err := statPath(path)
+		if err != nil {
+			return markError(flags, mask, dirFd, path, err)
+		}
+
+		mark.dev = st.Dev
+	}
+
+	g.handle.groups.mu.Lock()
+	defer g.handle.groups.mu.Unlock()
+
+	if g.enabled {
+		if err := g.handle.Mark(FAN_MARK_ADD|flags, mask, dirFd, path); err != nil {
+			return err
+		}
+	}
+
+	for i := range g.marks {
+		if g.marks[i].same(mark.MarkSpec) {
+			g.marks[i].Flags |= flags
+			g.marks[i].Mask |= mask
+
+			return nil
+		}
+	}
+
+	g.marks = append(g.marks, mark)
+
+	return nil
+}
+
+// Enable applies all group marks.
+func (g *MarkGroup) Enable() error {
+	g.handle.groups.mu.Lock()
+	defer g.handle.groups.mu.Unlock()
+
+	for _, mark := range g.marks {
+		if err := g.handle.Mark(FAN_MARK_ADD|mark.Flags, mark.Mask, mark.DirFd, mark.Path); err != nil {
+			return err
+		}
+	}
+
+	g.enabled = true
+
+	return nil
+}
+
+// Disable removes group marks from the kernel, keeping them for Enable.
+func (g *MarkGroup) Disable() error {
+	g.handle.groups.mu.Lock()
+	defer g.handle.groups.mu.Unlock()
+
+	if !g.enabled {
+		return nil
+	}
+
+	g.enabled = false
+
+	return g.unmark()
+}
+
+// Flush removes group marks from the kernel and drops them.
+func (g *MarkGroup) Flush() error {
+	g.handle.groups.mu.Lock()
+	defer g.handle.groups.mu.Unlock()
+
+	var err error
+
+	if g.enabled {
+		err = g.unmark()
+	}
+
+	g.marks = nil
+
+	return err
+}
+
+// unmark removes mask bits of group marks not needed by other enabled
+// groups, handle.groups.mu is held.
+func (g *MarkGroup) unmark() error {
+	var firstErr error
+
+	for _, mark := range g.marks {
+		mask := mark.Mask &^ g.handle.groupsMask(g, mark.MarkSpec)
+		if mask == 0 {
+			continue
+		}
+
+		flags := FAN_MARK_REMOVE | mark.Flags&(markTypeFlags|markIgnoreFlags|FAN_MARK_DONT_FOLLOW)
+
+		err := g.handle.Mark(flags, mask, mark.DirFd, mark.Path)
+		if err != nil && !errors.Is(err, syscall.ENOENT) && firstErr == nil {
+			// ENOENT: the object is gone, or its mark was already removed
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// groupsMask returns mask bits other enabled groups need on the object of
+// spec, handle.groups.mu is held.
+func (handle *NotifyFD) groupsMask(except *MarkGroup, spec MarkSpec) EventMask {
+	var mask EventMask
+
+	for _, g := range handle.groups.byName {
+		if g == except || !g.enabled {
+			continue
+		}
+
+		for _, mark := range g.marks {
+			if mark.same(spec) {
+				mask |= mark.Mask
+			}
+		}
+	}
+
+	return mask
+}
+
+// Groups returns names of enabled groups of the reading NotifyFD having a
+// mark that covers the event, sorted. Inode marks cover events on the marked
+// path, and on its children with FAN_EVENT_ON_CHILD, mount and filesystem
+// marks cover events on the marked device, so that bind mounts of one
+// filesystem are not told apart. Ignore marks are not considered.
+func (metadata *EventMetadata) Groups() []string {
+	if metadata.groups == nil {
+		return nil
+	}
+
+	metadata.groups.mu.RLock()
+	defer metadata.groups.mu.RUnlock()
+
+	if len(metadata.groups.byName) == 0 {
+		return nil
+	}
+
+	var (
+		names []string
+		dev   *uint64
+	)
+
+	path, pathErr := metadata.GetPath()
+
+	for name, g := range metadata.groups.byName {
+		if g.enabled && g.covers(metadata, path, pathErr == nil, &dev) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// covers reports whether a group mark covers event, dev caches the event
+// file device across groups.
+func (g *MarkGroup) covers(event *EventMetadata, path string, hasPath bool, dev **uint64) bool {
+	for _, mark := range g.marks {
+		if mark.Flags&markIgnoreFlags != 0 ||
+			uint64(mark.Mask)&event.Mask&^uint64(FAN_ONDIR|FAN_EVENT_ON_CHILD) == 0 {
+			continue
+		}
+
+		if mark.Flags&markTypeFlags != 0 {
+			if *dev == nil {
+				st, err := event.Stat()
+				if err != nil {
+					continue
+				}
+
+				d := st.Dev
+				*dev = &d
+			}
+
+			if **dev == mark.dev {
+				return true
+			}
+
+			continue
+		}
+
+		if !hasPath {
+			continue
+		}
+
+		if path == mark.Path || (mark.Mask&FAN_EVENT_ON_CHILD != 0 && filepath.Dir(path) == mark.Path) {
+			return true
+		}
+	}
+
+	return false
+}
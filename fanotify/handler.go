@@ -0,0 +1,186 @@
+package fanotify
+
+import (
+	"context"
+	"fmt"
+)
+
+// Handler handles an event dispatched by Run, the event Fd is closed after
+// all handlers returned unless a handler called Retain.
+type Handler func(*EventMetadata)
+
+// PermHandler decides a permission event dispatched by Run, returning
+// 'false' denies it. A handler may answer the event itself, e.g. with
+// AllowWithAudit, Run then skips the remaining handlers and its own
+// response, the returned verdict still selects OnDeny actions.
+type PermHandler func(*EventMetadata) (allow bool)
+
+type handler struct {
+	mask EventMask
+	fn   Handler
+}
+
+type permHandler struct {
+	mask EventMask
+	fn   PermHandler
+}
+
+// On registers fn for events matching any bit of mask.
+func (handle *NotifyFD) On(mask EventMask, fn Handler) {
+	handle.handlersMu.Lock()
+	defer handle.handlersMu.Unlock()
+
+	handle.handlers = append(handle.handlers, handler{mask: mask, fn: fn})
+}
+
+// OnCloseWrite registers fn for FAN_CLOSE_WRITE events.
+func (handle *NotifyFD) OnCloseWrite(fn Handler) {
+	handle.On(FAN_CLOSE_WRITE, fn)
+}
+
+// OnModify registers fn for FAN_MODIFY events.
+func (handle *NotifyFD) OnModify(fn Handler) {
+	handle.On(FAN_MODIFY, fn)
+}
+
+// OnOpen registers fn for FAN_OPEN events.
+func (handle *NotifyFD) OnOpen(fn Handler) {
+	handle.On(FAN_OPEN, fn)
+}
+
+// OnPerm registers fn for permission events matching any bit of mask. An
+// event is denied when any matching handler denies it and allowed otherwise,
+// also when no handler matches.
+func (handle *NotifyFD) OnPerm(mask EventMask, fn PermHandler) {
+	handle.handlersMu.Lock()
+	defer handle.handlersMu.Unlock()
+
+	handle.permHandlers = append(handle.permHandlers, permHandler{mask: mask & permissionEvents, fn: fn})
+}
+
+// OnError sets a handler for errors that do not stop Run: recovered handler
+// panics and failed responses or closes. They are dropped by default.
+func (handle *NotifyFD) OnError(fn func(error)) {
+	handle.handlersMu.Lock()
+	defer handle.handlersMu.Unlock()
+
+	handle.onError = fn
+}
+
+// Run reads events until ctx is done or reading fails and dispatches them to
+// registered handlers, it returns ctx.Err() after cancellation. Permission
+// events are answered and event Fds are closed after handlers returned,
+// unless a handler called Retain. A panicking handler is recovered and
+// reported to OnError, a panic in a PermHandler allows the event, so that
+// the process is not left blocked. Run returns once running OnDeny actions
+// finished. The handle should be initialized with FAN_NONBLOCK so that Run
+// can be interrupted by ctx.
+func (handle *NotifyFD) Run(ctx context.Context, skipPIDs ...int) error {
+	defer handle.denyWg.Wait()
+
+	stop := interruptOnDone(ctx, handle.File, handle.error)
+	defer stop()
+
+	for {
+		ev, err := handle.WaitEvent(skipPIDs...)
+
+		if ctx.Err() != nil {
+			if ev != nil {
+				_ = handle.skip(ev)
+			}
+
+			return ctx.Err()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		handle.dispatch(ev)
+	}
+}
+
+func (handle *NotifyFD) dispatch(ev *EventMetadata) {
+	handle.handlersMu.RLock()
+	handlers, permHandlers, denyActions := handle.handlers, handle.permHandlers, handle.denyActions
+	handle.handlersMu.RUnlock()
+
+	allow := true
+
+	if ev.IsPermission() {
+
+		for _, h := range permHandlers {
+			if EventMask(ev.Mask)&h.mask != 0 && !handle.callPerm(h.fn, ev) {
+				allow = false
+
+				break
+			}
+
+			if ev.Responded() {
+				break
+			}
+		}
+
+		// unless a handler answered the event itself
+		if !ev.Responded() {
+			respond := handle.ResponseAllow
+			if !allow {
+				respond = handle.ResponseDeny
+			}
+
+			if err := respond(ev); err != nil {
+				handle.error(err)
+			}
+		}
+	}
+
+	for _, h := range handlers {
+		if EventMask(ev.Mask)&h.mask != 0 {
+			handle.call(h.fn, ev)
+		}
+	}
+
+	handle.delivered(ev)
+
+	if !allow && len(denyActions) != 0 {
+		handle.deny(ev, denyActions)
+
+		return
+	}
+
+	if err := ev.release(); err != nil {
+		handle.error(err)
+	}
+}
+
+func (handle *NotifyFD) call(fn Handler, ev *EventMetadata) {
+	defer func() {
+		if r := recover(); r != nil {
+			handle.error(fmt.Errorf("fanotify: handler panic, %v", r))
+		}
+	}()
+
+	fn(ev)
+}
+
+func (handle *NotifyFD) callPerm(fn PermHandler, ev *EventMetadata) (allow bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			handle.error(fmt.Errorf("fanotify: handler panic, %v", r))
+
+			allow = true
+		}
+	}()
+
+	return fn(ev)
+}
+
+func (handle *NotifyFD) error(err error) {
+	handle.handlersMu.RLock()
+	fn := handle.onError
+	handle.handlersMu.RUnlock()
+
+	if fn != nil {
+		fn(err)
+	}
+}
@@ -0,0 +1,93 @@
+package fanotify
+
+//go:generate go run ./mkheaders
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The constants and structures of headers.go that golang.org/x/sys defines
+// too fail to compile when they differ, as only equal values give arrays of
+// length 0.
+var _ = [...][0]struct{}{
+	[FAN_CLOEXEC - unix.FAN_CLOEXEC]struct{}{},
+	[FAN_NONBLOCK - unix.FAN_NONBLOCK]struct{}{},
+	[FAN_CLASS_NOTIF - unix.FAN_CLASS_NOTIF]struct{}{},
+	[FAN_CLASS_CONTENT - unix.FAN_CLASS_CONTENT]struct{}{},
+	[FAN_CLASS_PRE_CONTENT - unix.FAN_CLASS_PRE_CONTENT]struct{}{},
+	[FAN_UNLIMITED_QUEUE - unix.FAN_UNLIMITED_QUEUE]struct{}{},
+	[FAN_UNLIMITED_MARKS - unix.FAN_UNLIMITED_MARKS]struct{}{},
+	[FAN_ENABLE_AUDIT - unix.FAN_ENABLE_AUDIT]struct{}{},
+	[FAN_REPORT_PIDFD - unix.FAN_REPORT_PIDFD]struct{}{},
+	[FAN_REPORT_TID - unix.FAN_REPORT_TID]struct{}{},
+	[FAN_REPORT_FID - unix.FAN_REPORT_FID]struct{}{},
+	[FAN_REPORT_DIR_FID - unix.FAN_REPORT_DIR_FID]struct{}{},
+	[FAN_REPORT_NAME - unix.FAN_REPORT_NAME]struct{}{},
+	[FAN_REPORT_TARGET_FID - unix.FAN_REPORT_TARGET_FID]struct{}{},
+	[FAN_REPORT_DFID_NAME - unix.FAN_REPORT_DFID_NAME]struct{}{},
+	[FAN_REPORT_DFID_NAME_TARGET - unix.FAN_REPORT_DFID_NAME_TARGET]struct{}{},
+	[FAN_ALL_CLASS_BITS - unix.FAN_ALL_CLASS_BITS]struct{}{},
+	[FAN_ALL_INIT_FLAGS - unix.FAN_ALL_INIT_FLAGS]struct{}{},
+	[FAN_ACCESS - unix.FAN_ACCESS]struct{}{},
+	[FAN_MODIFY - unix.FAN_MODIFY]struct{}{},
+	[FAN_ATTRIB - unix.FAN_ATTRIB]struct{}{},
+	[FAN_CLOSE_WRITE - unix.FAN_CLOSE_WRITE]struct{}{},
+	[FAN_CLOSE_NOWRITE - unix.FAN_CLOSE_NOWRITE]struct{}{},
+	[FAN_OPEN - unix.FAN_OPEN]struct{}{},
+	[FAN_MOVED_FROM - unix.FAN_MOVED_FROM]struct{}{},
+	[FAN_MOVED_TO - unix.FAN_MOVED_TO]struct{}{},
+	[FAN_CREATE - unix.FAN_CREATE]struct{}{},
+	[FAN_DELETE - unix.FAN_DELETE]struct{}{},
+	[FAN_DELETE_SELF - unix.FAN_DELETE_SELF]struct{}{},
+	[FAN_MOVE_SELF - unix.FAN_MOVE_SELF]struct{}{},
+	[FAN_OPEN_EXEC - unix.FAN_OPEN_EXEC]struct{}{},
+	[FAN_Q_OVERFLOW - unix.FAN_Q_OVERFLOW]struct{}{},
+	[FAN_FS_ERROR - unix.FAN_FS_ERROR]struct{}{},
+	[FAN_OPEN_PERM - unix.FAN_OPEN_PERM]struct{}{},
+	[FAN_ACCESS_PERM - unix.FAN_ACCESS_PERM]struct{}{},
+	[FAN_OPEN_EXEC_PERM - unix.FAN_OPEN_EXEC_PERM]struct{}{},
+	[FAN_EVENT_ON_CHILD - unix.FAN_EVENT_ON_CHILD]struct{}{},
+	[FAN_RENAME - unix.FAN_RENAME]struct{}{},
+	[FAN_ONDIR - unix.FAN_ONDIR]struct{}{},
+	[FAN_CLOSE - unix.FAN_CLOSE]struct{}{},
+	[FAN_MOVE - unix.FAN_MOVE]struct{}{},
+	[FAN_ALL_EVENTS - unix.FAN_ALL_EVENTS]struct{}{},
+	[FAN_ALL_PERM_EVENTS - unix.FAN_ALL_PERM_EVENTS]struct{}{},
+	[FAN_ALL_OUTGOING_EVENTS - unix.FAN_ALL_OUTGOING_EVENTS]struct{}{},
+	[FAN_MARK_ADD - unix.FAN_MARK_ADD]struct{}{},
+	[FAN_MARK_REMOVE - unix.FAN_MARK_REMOVE]struct{}{},
+	[FAN_MARK_FLUSH - unix.FAN_MARK_FLUSH]struct{}{},
+	[FAN_MARK_DONT_FOLLOW - unix.FAN_MARK_DONT_FOLLOW]struct{}{},
+	[FAN_MARK_ONLYDIR - unix.FAN_MARK_ONLYDIR]struct{}{},
+	[FAN_MARK_IGNORED_MASK - unix.FAN_MARK_IGNORED_MASK]struct{}{},
+	[FAN_MARK_IGNORED_SURV_MODIFY - unix.FAN_MARK_IGNORED_SURV_MODIFY]struct{}{},
+	[FAN_MARK_EVICTABLE - unix.FAN_MARK_EVICTABLE]struct{}{},
+	[FAN_MARK_IGNORE - unix.FAN_MARK_IGNORE]struct{}{},
+	[FAN_MARK_IGNORE_SURV - unix.FAN_MARK_IGNORE_SURV]struct{}{},
+	[FAN_MARK_INODE - unix.FAN_MARK_INODE]struct{}{},
+	[FAN_MARK_MOUNT - unix.FAN_MARK_MOUNT]struct{}{},
+	[FAN_MARK_FILESYSTEM - unix.FAN_MARK_FILESYSTEM]struct{}{},
+	[FAN_ALL_MARK_FLAGS - unix.FAN_ALL_MARK_FLAGS]struct{}{},
+	[FANOTIFY_METADATA_VERSION - unix.FANOTIFY_METADATA_VERSION]struct{}{},
+	[FAN_EVENT_METADATA_LEN - unix.FAN_EVENT_METADATA_LEN]struct{}{},
+	[FAN_NOFD - unix.FAN_NOFD]struct{}{},
+	[FAN_NOPIDFD - unix.FAN_NOPIDFD]struct{}{},
+	[FAN_EPIDFD - unix.FAN_EPIDFD]struct{}{},
+	[FAN_EVENT_INFO_TYPE_FID - unix.FAN_EVENT_INFO_TYPE_FID]struct{}{},
+	[FAN_EVENT_INFO_TYPE_DFID_NAME - unix.FAN_EVENT_INFO_TYPE_DFID_NAME]struct{}{},
+	[FAN_EVENT_INFO_TYPE_DFID - unix.FAN_EVENT_INFO_TYPE_DFID]struct{}{},
+	[FAN_EVENT_INFO_TYPE_PIDFD - unix.FAN_EVENT_INFO_TYPE_PIDFD]struct{}{},
+	[FAN_EVENT_INFO_TYPE_ERROR - unix.FAN_EVENT_INFO_TYPE_ERROR]struct{}{},
+	[FAN_EVENT_INFO_TYPE_OLD_DFID_NAME - unix.FAN_EVENT_INFO_TYPE_OLD_DFID_NAME]struct{}{},
+	[FAN_EVENT_INFO_TYPE_NEW_DFID_NAME - unix.FAN_EVENT_INFO_TYPE_NEW_DFID_NAME]struct{}{},
+	[FAN_ALLOW - unix.FAN_ALLOW]struct{}{},
+	[FAN_DENY - unix.FAN_DENY]struct{}{},
+	[FAN_AUDIT - unix.FAN_AUDIT]struct{}{},
+	[FAN_INFO - unix.FAN_INFO]struct{}{},
+	[FAN_RESPONSE_INFO_NONE - unix.FAN_RESPONSE_INFO_NONE]struct{}{},
+	[FAN_RESPONSE_INFO_AUDIT_RULE - unix.FAN_RESPONSE_INFO_AUDIT_RULE]struct{}{},
+	[unsafe.Sizeof(FanotifyEventMetadata{}) - unsafe.Sizeof(unix.FanotifyEventMetadata{})]struct{}{},
+	[unsafe.Sizeof(FanotifyResponse{}) - unsafe.Sizeof(unix.FanotifyResponse{})]struct{}{},
+}
@@ -0,0 +1,233 @@
+package fanotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// defaultRecoveryBackoff is the default wait between failed recovery attempts.
+const defaultRecoveryBackoff = time.Second
+
+// RecoveryConfig configures how a Watcher replaces a failed NotifyFD.
+type RecoveryConfig struct {
+	// Reinit creates the replacement NotifyFD, typically by calling
+	// Initialize with the original flags and options. Marks and filters of
+	// the failed handle are applied to it.
+	Reinit func() (*NotifyFD, error)
+	// OnRecover is called after every attempt with the read error that
+	// caused the recovery and the attempt result, nil on success.
+	OnRecover func(cause, err error)
+	// Backoff is the wait between failed attempts, 1s when zero.
+	Backoff time.Duration
+	// Attempts bounds consecutive failed attempts, 0 means no limit.
+	Attempts int
+}
+
+// WithRecovery makes Run survive a closed or failed fanotify fd: instead of
+// returning the read error, the handle is closed and replaced by one created
+// by cfg.Reinit, carrying over recorded marks and filters. Events generated
+// between the failure and the re-mark are lost.
+func WithRecovery(cfg RecoveryConfig) WatcherOption {
+	return func(w *Watcher) {
+		w.recovery = &cfg
+	}
+}
+
+// WithBackpressure samples the kernel queue depth in bytes (see
+// NotifyFD.Pending) after every published event and calls fn whenever it
+// reaches threshold, so callers can shed load before the queue overflows.
+func WithBackpressure(threshold int, fn func(pending int)) WatcherOption {
+	return func(w *Watcher) {
+		w.pendingThreshold = threshold
+		w.onPending = fn
+	}
+}
+
+// WatcherHealth is a snapshot of Watcher liveness.
+type WatcherHealth struct {
+	// Running is 'true' while Run is reading or processing events.
+	Running bool
+	// LastRead is when the last read from the fanotify fd returned.
+	LastRead time.Time
+	// LastEvent is when the last event was published.
+	LastEvent time.Time
+	// Pending is the kernel queue depth in bytes, -1 when unknown.
+	Pending int
+	// Published is the number of events published to sinks.
+	Published uint64
+	// Dropped is the number of events read during shutdown and closed,
+	// permission events among them were allowed.
+	Dropped uint64
+	// Recoveries is the number of times the NotifyFD was replaced.
+	Recoveries int
+	// Err is the last read error, nil when none occurred.
+	Err error
+}
+
+// Health returns current liveness data.
+func (w *Watcher) Health() WatcherHealth {
+	var source pendingSource = w.inotify
+	if w.inotify == nil {
+		source = w.Notify()
+	}
+
+	pending, err := source.Pending()
+	if err != nil {
+		pending = -1
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return WatcherHealth{
+		Pending:    pending,
+		Running:    atomic.LoadInt32(&w.readerState) != readerIdle,
+		LastRead:   unixNanoTime(atomic.LoadInt64(&w.lastRead)),
+		LastEvent:  unixNanoTime(atomic.LoadInt64(&w.lastEvent)),
+		Published:  atomic.LoadUint64(&w.published),
+		Dropped:    atomic.LoadUint64(&w.dropped),
+		Recoveries: w.recoveries,
+		Err:        w.lastErr,
+	}
+}
+
+// Alive reports whether the reader loop is waiting for the kernel or has
+// finished an event within d, a reader stuck in a sink is not alive.
+func (w *Watcher) Alive(d time.Duration) bool {
+	return w.readerAlive(d)
+}
+
+// Notify returns the NotifyFD currently read, it changes on recovery and is
+// nil for the inotify backend.
+func (w *Watcher) Notify() *NotifyFD {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.notify
+}
+
+// pendingSource is a backend reporting its kernel queue depth.
+type pendingSource interface {
+	Pending() (int, error)
+}
+
+// checkPending reports queue depth to the backpressure callback.
+func (w *Watcher) checkPending(source pendingSource) {
+	if w.onPending == nil {
+		return
+	}
+
+	pending, err := source.Pending()
+	if err != nil {
+		w.error(err)
+
+		return
+	}
+
+	if pending >= w.pendingThreshold {
+		w.onPending(pending)
+	}
+}
+
+// setError records a read error for Health.
+func (w *Watcher) setError(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastErr = err
+}
+
+// recover replaces the failed NotifyFD, it returns an error when recovery
+// is not configured, gave up or ctx is done.
+func (w *Watcher) recover(ctx context.Context, cause error) error {
+	if w.recovery == nil || w.recovery.Reinit == nil || w.inotify != nil {
+		return cause
+	}
+
+	backoff := w.recovery.Backoff
+	if backoff <= 0 {
+		backoff = defaultRecoveryBackoff
+	}
+
+	old := w.Notify()
+	// fds of recorded marks stay open until they are marked again
+	defer old.closeMarkFds()
+
+	if err := old.close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		w.error(err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		notify, err := w.recovery.Reinit()
+		if err == nil {
+			if err = notify.adopt(old); err != nil {
+				_ = notify.Close()
+			}
+		}
+
+		if w.recovery.OnRecover != nil {
+			w.recovery.OnRecover(cause, err)
+		}
+
+		if err == nil {
+			w.mu.Lock()
+			w.notify = notify
+			w.recoveries++
+			w.mu.Unlock()
+
+			return nil
+		}
+
+		if w.recovery.Attempts > 0 && attempt >= w.recovery.Attempts {
+			return fmt.Errorf("fanotify: recovery error, %w", err)
+		}
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// adopt applies filters, skipped processes and recorded marks of old to
+// handle.
+func (handle *NotifyFD) adopt(old *NotifyFD) error {
+	if len(handle.Filters()) == 0 {
+		handle.SetFilters(old.Filters()...)
+	}
+
+	handle.ignored.Add(old.ignored.List()...)
+
+	if old.descendants != nil {
+		if handle.descendants == nil {
+			handle.descendants = newDescendants(old.descendants.tids)
+		}
+
+		handle.descendants.adopt(old.descendants)
+	}
+
+	for _, spec := range old.Marks() {
+		if err := handle.Mark(FAN_MARK_ADD|spec.Flags, spec.Mask, spec.DirFd, spec.Path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unixNanoTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ns)
+}
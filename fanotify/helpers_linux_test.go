@@ -0,0 +1,154 @@
+package fanotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// encodeEvent returns a metadata only event as the kernel writes it.
+func encodeEvent(mask uint64, fd, pid int32) []byte {
+	var buf bytes.Buffer
+
+	_ = binary.Write(&buf, binary.LittleEndian, &FanotifyEventMetadata{
+		Event_len:    FAN_EVENT_METADATA_LEN,
+		Vers:         FANOTIFY_METADATA_VERSION,
+		Metadata_len: FAN_EVENT_METADATA_LEN,
+		Mask:         mask,
+		Fd:           fd,
+		Pid:          pid,
+	})
+
+	return buf.Bytes()
+}
+
+// eventFd returns an open fd standing in for an event Fd, it is closed with
+// the event, closing it again at the end of the test could hit a reused fd.
+func eventFd(t testing.TB) int32 {
+	t.Helper()
+
+	fd, err := unix.Open("/dev/null", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return int32(fd)
+}
+
+// fakeHandle is a NotifyFD reading events from a pipe, with responses
+// written to another pipe and decoded by Responses.
+type fakeHandle struct {
+	*NotifyFD
+
+	events    *os.File
+	responses *os.File
+
+	mu      sync.Mutex
+	decoded []FanotifyResponse
+	done    chan struct{}
+}
+
+// newFakeHandle returns a fakeHandle, opts are applied as by Initialize.
+func newFakeHandle(t testing.TB, opts ...Option) *fakeHandle {
+	t.Helper()
+
+	evRd, evWr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	respRd, respWr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handle := &NotifyFD{
+		Fd:   int(respWr.Fd()),
+		File: respWr,
+		Rd:   evRd,
+	}
+
+	for _, opt := range opts {
+		opt(handle)
+	}
+
+	fake := &fakeHandle{NotifyFD: handle, events: evWr, responses: respRd, done: make(chan struct{})}
+
+	go func() {
+		defer close(fake.done)
+
+		var resp FanotifyResponse
+
+		for binary.Read(respRd, binary.LittleEndian, &resp) == nil {
+			fake.mu.Lock()
+			fake.decoded = append(fake.decoded, resp)
+			fake.mu.Unlock()
+		}
+	}()
+
+	t.Cleanup(func() {
+		evWr.Close()
+		evRd.Close()
+		respWr.Close()
+		<-fake.done
+		respRd.Close()
+	})
+
+	return fake
+}
+
+// send queues events for reading.
+func (fake *fakeHandle) send(t testing.TB, events ...[]byte) {
+	t.Helper()
+
+	if _, err := fake.events.Write(bytes.Join(events, nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// closeEvents ends the event stream, reads then fail with io.EOF.
+func (fake *fakeHandle) closeEvents() {
+	fake.events.Close()
+}
+
+// Responses returns the responses written so far, once the handle File is
+// closed all of them.
+func (fake *fakeHandle) Responses() []FanotifyResponse {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return append([]FanotifyResponse(nil), fake.decoded...)
+}
+
+// waitResponses waits until n responses were written and returns them.
+func (fake *fakeHandle) waitResponses(t testing.TB, n int) []FanotifyResponse {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		responses := fake.Responses()
+		if len(responses) >= n {
+			return responses
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("got responses %+v, want %d", responses, n)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// closeResponses closes the response pipe and waits for all responses.
+func (fake *fakeHandle) closeResponses() []FanotifyResponse {
+	fake.File.Close()
+	<-fake.done
+
+	return fake.Responses()
+}
@@ -0,0 +1,93 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// ErrNoFileHandle is returned by OpenFile for FID group events that report
+// no handle of the file itself, e.g. FAN_REPORT_DIR_FID events on a child.
+var ErrNoFileHandle = errors.New("fanotify: no file handle reported")
+
+// OpenFile returns the file of the event whatever the group reports: a
+// duplicate of the event Fd, see File, for groups reporting fds, and for
+// FID groups the file opened with flags, e.g. unix.O_RDONLY, by its FID
+// handle or by the DFID_NAME directory handle and entry name. Resolving
+// handles needs CAP_DAC_READ_SEARCH and mountFd, a non O_PATH fd of any
+// file on the filesystem of the event, see MountPool.Open to pick it by
+// filesystem.
+//
+// Unlike the event Fd the opened file generates events of its own, skip the
+// watcher PID when the marks cover it.
+func (metadata *EventMetadata) OpenFile(mountFd, flags int) (*os.File, error) {
+	if metadata.Fd >= 0 {
+		if f := metadata.File(); f != nil {
+			return f, nil
+		}
+
+		return nil, fmt.Errorf("fanotify: handle error, event Fd already closed")
+	}
+
+	fd, err := metadata.openFID(func([2]int32) (int, error) { return mountFd, nil }, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(fd), ""), nil
+}
+
+// openFID opens the file reported by the FID records of the event, mountFd
+// returns the mount fd of a filesystem ID.
+func (metadata *EventMetadata) openFID(mountFd func(fsid [2]int32) (int, error), flags int) (int, error) {
+	handle, name, ok := metadata.fid(FAN_EVENT_INFO_TYPE_FID)
+	if !ok {
+		handle, name, ok = metadata.fid(FAN_EVENT_INFO_TYPE_DFID_NAME)
+		ok = ok && name != "" && name != "."
+	}
+
+	if !ok {
+		return -1, ErrNoFileHandle
+	}
+
+	fd, err := mountFd(handle.Fsid)
+	if err != nil {
+		return -1, err
+	}
+
+	return openHandle(fd, handle, name, flags)
+}
+
+// WithHybridFd opens, for FID group events accepted by selected, the file
+// by its handle on the filesystem mount from pool, see MountPool.Open, and
+// attaches it as the event Fd, so that
+// GetPath, content and xattr helpers work as for groups reporting fds, at
+// the cost of an open per selected event. The Fd is closed with the event.
+// Events already carrying an Fd, permission events and events whose file is
+// gone are left unchanged. Enrichers registered before it see no Fd.
+func WithHybridFd(pool *MountPool, flags int, selected Filter) Option {
+	return WithEnricher(func(metadata *EventMetadata) {
+		if metadata.Fd >= 0 || metadata.IsPermission() || (selected != nil && !selected(metadata)) {
+			return
+		}
+
+		fd, err := metadata.openFID(pool.MountFd, flags)
+		if err != nil {
+			return
+		}
+
+		metadata.Fd = int32(fd)
+
+		if DebugFdLeaks {
+			trackFdLeak(metadata)
+		}
+
+		// filters resolving the path saw no Fd, resolve it again
+		if atomic.LoadInt32(&metadata.pathState) == pathResolved && metadata.pathErr != nil &&
+			!errors.Is(metadata.pathErr, ErrPathUnresolved) {
+			metadata.path, metadata.pathErr = "", nil
+			atomic.StoreInt32(&metadata.pathState, pathUnresolved)
+		}
+	})
+}
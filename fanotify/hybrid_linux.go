@@ -0,0 +1,82 @@
+package fanotify
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// openHandle opens the file h on the filesystem of mountFd, or the entry
+// name of directory h when name is set.
+func openHandle(mountFd int, h FileHandle, name string, flags int) (int, error) {
+	if name == "" {
+		fd, err := unix.OpenByHandleAt(mountFd, unix.NewFileHandle(h.Type, h.Handle), flags|unix.O_CLOEXEC)
+		if err != nil {
+			return -1, fmt.Errorf("fanotify: handle error, %w", err)
+		}
+
+		return fd, nil
+	}
+
+	dirFd, err := unix.OpenByHandleAt(mountFd, unix.NewFileHandle(h.Type, h.Handle), unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC)
+	if err != nil {
+		return -1, fmt.Errorf("fanotify: handle error, %w", err)
+	}
+	defer unix.Close(dirFd)
+
+	fd, err := unix.Openat(dirFd, name, flags|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("fanotify: handle error, %s: %w", name, err)
+	}
+
+	return fd, nil
+}
+
+// mountFsid returns the filesystem ID of the mount at path, as reported in
+// FID records.
+func mountFsid(path string) ([2]int32, error) {
+	var st unix.Statfs_t
+
+	if err := unix.Statfs(path, &st); err != nil {
+		return [2]int32{}, fmt.Errorf("fanotify: statfs error, %w", err)
+	}
+
+	return st.Fsid.Val, nil
+}
+
+// openMount opens the mount at path for open_by_handle_at, it fails when
+// the filesystem does not support file handles or path no longer holds
+// filesystem fsid.
+func openMount(path string, fsid [2]int32) (int, error) {
+	// open_by_handle_at rejects O_PATH mount fds
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("fanotify: mount error, %w", err)
+	}
+
+	var st unix.Statfs_t
+
+	if err := unix.Fstatfs(fd, &st); err != nil || st.Fsid.Val != fsid {
+		unix.Close(fd)
+
+		return -1, fmt.Errorf("fanotify: mount error, %s changed", path)
+	}
+
+	if _, _, err := unix.NameToHandleAt(fd, "", unix.AT_EMPTY_PATH); err != nil {
+		unix.Close(fd)
+
+		return -1, fmt.Errorf("fanotify: mount error, %s: %w", path, err)
+	}
+
+	return fd, nil
+}
+
+// mountTableChanged reports whether the mountinfo file fd signals a mount
+// table change since it was last read.
+func mountTableChanged(fd int) bool {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLPRI}}
+
+	n, err := unix.Poll(fds, 0)
+
+	return err == nil && n > 0 && fds[0].Revents&(unix.POLLPRI|unix.POLLERR) != 0
+}
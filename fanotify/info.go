@@ -0,0 +1,259 @@
+package fanotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// infoHeaderLen is the size of struct fanotify_event_info_header.
+const infoHeaderLen = 4
+
+// Sizes of struct fanotify_event_info_range and fanotify_event_info_mnt,
+// the mount ID is aligned as the architecture aligns 64 bit integers.
+const (
+	rangeInfoLen = int(unsafe.Sizeof(FanotifyEventInfoRange{}))
+	mntInfoLen   = int(unsafe.Sizeof(FanotifyEventInfoMnt{}))
+	mntIDOffset  = int(unsafe.Offsetof(FanotifyEventInfoMnt{}.Mnt_id))
+)
+
+// InfoRecord is an information record following event metadata, as reported
+// by groups initialized with FAN_REPORT_* flags.
+type InfoRecord struct {
+	Type uint8
+	// Data is the whole record, including its header.
+	Data []byte
+}
+
+// infoTypeNames are the names of the record types the library decodes.
+var infoTypeNames = map[uint8]string{
+	FAN_EVENT_INFO_TYPE_FID:           "FID",
+	FAN_EVENT_INFO_TYPE_DFID_NAME:     "DFID_NAME",
+	FAN_EVENT_INFO_TYPE_DFID:          "DFID",
+	FAN_EVENT_INFO_TYPE_PIDFD:         "PIDFD",
+	FAN_EVENT_INFO_TYPE_ERROR:         "ERROR",
+	FAN_EVENT_INFO_TYPE_RANGE:         "RANGE",
+	FAN_EVENT_INFO_TYPE_MNT:           "MNT",
+	FAN_EVENT_INFO_TYPE_OLD_DFID_NAME: "OLD_DFID_NAME",
+	FAN_EVENT_INFO_TYPE_NEW_DFID_NAME: "NEW_DFID_NAME",
+}
+
+// String returns the record type name, e.g. "DFID_NAME", or "UNKNOWN(0x..)"
+// for types the library does not decode.
+func (record InfoRecord) String() string {
+	if name, ok := infoTypeNames[record.Type]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("UNKNOWN(%#x)", record.Type)
+}
+
+// Known reports whether the library decodes the record type, the Payload of
+// other records is left to RegisterInfoParser parsers.
+func (record InfoRecord) Known() bool {
+	_, ok := infoTypeNames[record.Type]
+
+	return ok
+}
+
+// Payload returns the record following its header.
+func (record InfoRecord) Payload() []byte {
+	if len(record.Data) < infoHeaderLen {
+		return nil
+	}
+
+	return record.Data[infoHeaderLen:]
+}
+
+// FID decodes FID, DFID and the DFID_NAME record types, name is set for the
+// latter. The handle refers to the record data, copy it to keep it past the
+// event.
+func (record InfoRecord) FID() (handle FileHandle, name string, ok bool) {
+	switch record.Type {
+	case FAN_EVENT_INFO_TYPE_FID, FAN_EVENT_INFO_TYPE_DFID, FAN_EVENT_INFO_TYPE_DFID_NAME,
+		FAN_EVENT_INFO_TYPE_OLD_DFID_NAME, FAN_EVENT_INFO_TYPE_NEW_DFID_NAME:
+	default:
+		return FileHandle{}, "", false
+	}
+
+	data := record.Data
+	if len(data) < fidInfoLen {
+		return FileHandle{}, "", false
+	}
+
+	size := int(binary.LittleEndian.Uint32(data[infoHeaderLen+8:]))
+	if fidInfoLen+size > len(data) {
+		return FileHandle{}, "", false
+	}
+
+	handle = FileHandle{
+		Fsid: [2]int32{
+			int32(binary.LittleEndian.Uint32(data[infoHeaderLen:])),
+			int32(binary.LittleEndian.Uint32(data[infoHeaderLen+4:])),
+		},
+		Type:   int32(binary.LittleEndian.Uint32(data[infoHeaderLen+12:])),
+		Handle: data[fidInfoLen : fidInfoLen+size],
+	}
+
+	if rest := data[fidInfoLen+size:]; len(rest) > 0 {
+		if i := bytes.IndexByte(rest, 0); i >= 0 {
+			rest = rest[:i]
+		}
+
+		name = string(rest)
+	}
+
+	return handle, name, true
+}
+
+// Pidfd decodes a PIDFD record, the pidfd is FAN_NOPIDFD or FAN_EPIDFD when
+// the kernel could not provide one. It is owned by the event, see
+// EventMetadata.PidFd.
+func (record InfoRecord) Pidfd() (pidfd int, ok bool) {
+	if record.Type != FAN_EVENT_INFO_TYPE_PIDFD || len(record.Data) < pidfdInfoLen {
+		return 0, false
+	}
+
+	return int(int32(binary.LittleEndian.Uint32(record.Data[infoHeaderLen:]))), true
+}
+
+// FsError decodes an ERROR record of FAN_FS_ERROR events, the errno and the
+// number of errors merged into the event.
+func (record InfoRecord) FsError() (errno syscall.Errno, count uint32, ok bool) {
+	if record.Type != FAN_EVENT_INFO_TYPE_ERROR || len(record.Data) < errorInfoLen {
+		return 0, 0, false
+	}
+
+	// take the magnitude, filesystems differ in the errno sign
+	err := int32(binary.LittleEndian.Uint32(record.Data[infoHeaderLen:]))
+	if err < 0 {
+		err = -err
+	}
+
+	return syscall.Errno(err), binary.LittleEndian.Uint32(record.Data[infoHeaderLen+4:]), true
+}
+
+// Range decodes a RANGE record of FAN_PRE_ACCESS events, the file range
+// about to be accessed.
+func (record InfoRecord) Range() (offset, count uint64, ok bool) {
+	if record.Type != FAN_EVENT_INFO_TYPE_RANGE || len(record.Data) < rangeInfoLen {
+		return 0, 0, false
+	}
+
+	return binary.LittleEndian.Uint64(record.Data[infoHeaderLen+4:]),
+		binary.LittleEndian.Uint64(record.Data[infoHeaderLen+12:]), true
+}
+
+// MountID decodes a MNT record of FAN_MNT_ATTACH and FAN_MNT_DETACH events,
+// the unique mount ID, see statmount(2).
+func (record InfoRecord) MountID() (id uint64, ok bool) {
+	if record.Type != FAN_EVENT_INFO_TYPE_MNT || len(record.Data) < mntInfoLen {
+		return 0, false
+	}
+
+	return binary.LittleEndian.Uint64(record.Data[mntIDOffset:]), true
+}
+
+// InfoParser decodes an info record, the result, or the error, is stored in
+// EventMetadata.Info under the record type.
+type InfoParser func(record InfoRecord) (interface{}, error)
+
+var infoParsers = struct {
+	sync.RWMutex
+	byType map[uint8]InfoParser
+}{
+	byType: make(map[uint8]InfoParser),
+}
+
+// RegisterInfoParser registers parser for info records of infoType, which
+// replaces a previously registered one. It lets consumers decode record
+// types the library does not know about, register parsers before reading
+// events.
+func RegisterInfoParser(infoType uint8, parser InfoParser) {
+	infoParsers.Lock()
+	defer infoParsers.Unlock()
+
+	infoParsers.byType[infoType] = parser
+}
+
+// Raw returns the event as read from the fanotify handle, metadata followed
+// by info records. It must not be modified.
+func (metadata *EventMetadata) Raw() []byte {
+	return metadata.raw
+}
+
+// InfoRecords splits info records following event metadata, in kernel
+// order, a truncated trailing record is left out. Use the record accessors,
+// e.g. InfoRecord.FID, to decode them.
+func (metadata *EventMetadata) InfoRecords() []InfoRecord {
+	var out []InfoRecord
+
+	metadata.EachInfoRecord(func(record InfoRecord) bool {
+		out = append(out, record)
+
+		return true
+	})
+
+	return out
+}
+
+// EachInfoRecord calls fn for every info record until it returns 'false',
+// without allocating. Records refer to the event storage and must not be
+// kept past the event.
+func (metadata *EventMetadata) EachInfoRecord(fn func(InfoRecord) bool) {
+	if int(metadata.Metadata_len) > len(metadata.raw) {
+		return
+	}
+
+	buf := metadata.raw[metadata.Metadata_len:]
+
+	for len(buf) >= infoHeaderLen {
+		size := int(binary.LittleEndian.Uint16(buf[2:4]))
+		if size < infoHeaderLen || size > len(buf) {
+			break
+		}
+
+		if !fn(InfoRecord{Type: buf[0], Data: buf[:size]}) {
+			return
+		}
+
+		buf = buf[size:]
+	}
+}
+
+// parseInfo runs registered parsers over info records.
+func (metadata *EventMetadata) parseInfo() {
+	if len(metadata.raw) <= int(metadata.Metadata_len) {
+		return
+	}
+
+	infoParsers.RLock()
+	defer infoParsers.RUnlock()
+
+	if len(infoParsers.byType) == 0 {
+		return
+	}
+
+	metadata.EachInfoRecord(func(record InfoRecord) bool {
+		parser, ok := infoParsers.byType[record.Type]
+		if !ok {
+			return true
+		}
+
+		val, err := parser(record)
+		if err != nil {
+			val = err
+		}
+
+		if metadata.Info == nil {
+			metadata.Info = make(map[uint8]interface{})
+		}
+
+		metadata.Info[record.Type] = val
+
+		return true
+	})
+}
@@ -0,0 +1,29 @@
+package fanotify
+
+import (
+	"bufio"
+	"os"
+	"sync"
+)
+
+// inotifyEvents are the event bits inotify reports, they have the same
+// values in both APIs, as do IN_ISDIR and FAN_ONDIR, IN_Q_OVERFLOW and
+// FAN_Q_OVERFLOW.
+const inotifyEvents EventMask = FAN_ACCESS | FAN_MODIFY | FAN_ATTRIB | FAN_CLOSE | FAN_OPEN |
+	FAN_MOVE | FAN_CREATE | FAN_DELETE | FAN_DELETE_SELF | FAN_MOVE_SELF
+
+// inotifyWatch is the inotify backend of a Watcher, reading events of a
+// fixed set of watched paths.
+type inotifyWatch struct {
+	file *os.File
+	rd   *bufio.Reader
+	mask EventMask
+
+	mu      sync.Mutex
+	watches map[int32]string
+}
+
+// Close closes the inotify fd.
+func (in *inotifyWatch) Close() error {
+	return in.file.Close()
+}
@@ -0,0 +1,135 @@
+package fanotify
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// newInotifyWatch watches paths for events in mask, directories report
+// events of their direct children.
+func newInotifyWatch(mask EventMask, paths []string) (*inotifyWatch, error) {
+	if unsupported := mask &^ (inotifyEvents | FAN_ONDIR | FAN_EVENT_ON_CHILD); unsupported != 0 {
+		return nil, fmt.Errorf("fanotify: inotify error, events %s not supported by inotify, %w", unsupported, unix.EINVAL)
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: inotify error, %w", err)
+	}
+
+	in := &inotifyWatch{
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		mask:    mask,
+		watches: make(map[int32]string, len(paths)),
+	}
+
+	for _, path := range paths {
+		wd, err := unix.InotifyAddWatch(fd, path, uint32(mask&inotifyEvents))
+		if err != nil {
+			_ = in.Close()
+
+			return nil, fmt.Errorf("fanotify: inotify error, %s: %w", path, err)
+		}
+
+		in.watches[int32(wd)] = filepath.Clean(path)
+	}
+
+	in.rd = bufio.NewReaderSize(in.file, ReadBufferSize)
+
+	return in, nil
+}
+
+// next reads the next inotify event, it returns 'false' for events that are
+// not published: removed watches, unmounts and directory events without
+// FAN_ONDIR.
+func (in *inotifyWatch) next() (Event, bool, error) {
+	var hdr [unix.SizeofInotifyEvent]byte
+
+	if _, err := io.ReadFull(in.rd, hdr[:]); err != nil {
+		if errors.Is(err, unix.EAGAIN) {
+			return Event{}, false, fmt.Errorf("fanotify: inotify error, %w", unix.EAGAIN)
+		}
+
+		return Event{}, false, fmt.Errorf("fanotify: inotify error, %w", err)
+	}
+
+	wd := int32(binary.LittleEndian.Uint32(hdr[0:]))
+	mask := binary.LittleEndian.Uint32(hdr[4:])
+	size := binary.LittleEndian.Uint32(hdr[12:])
+
+	name := make([]byte, size)
+
+	if _, err := io.ReadFull(in.rd, name); err != nil {
+		return Event{}, false, fmt.Errorf("fanotify: inotify error, %w", err)
+	}
+
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+
+	ev := Event{Time: time.Now()}
+
+	switch {
+	case mask&unix.IN_Q_OVERFLOW != 0:
+		ev.Mask = FAN_Q_OVERFLOW
+
+		return ev, true, nil
+	case mask&unix.IN_IGNORED != 0:
+		in.mu.Lock()
+		delete(in.watches, wd)
+		in.mu.Unlock()
+
+		return ev, false, nil
+	case mask&unix.IN_ISDIR != 0 && in.mask&FAN_ONDIR == 0:
+		return ev, false, nil
+	}
+
+	ev.Mask = uint64(EventMask(mask) & (inotifyEvents | FAN_ONDIR))
+	if ev.Mask&^FAN_ONDIR == 0 {
+		return ev, false, nil
+	}
+
+	in.mu.Lock()
+	ev.Path = in.watches[wd]
+	in.mu.Unlock()
+
+	if len(name) > 0 {
+		ev.Path = filepath.Join(ev.Path, string(name))
+	}
+
+	return ev, true, nil
+}
+
+// Pending returns the number of bytes of events queued in the kernel.
+func (in *inotifyWatch) Pending() (int, error) {
+	raw, err := in.file.SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("fanotify: pending error, %w", err)
+	}
+
+	var (
+		n    int
+		ierr error
+	)
+
+	if err := raw.Control(func(fd uintptr) {
+		n, ierr = unix.IoctlGetInt(int(fd), unix.TIOCINQ)
+	}); err != nil {
+		return 0, fmt.Errorf("fanotify: pending error, %w", err)
+	}
+
+	if ierr != nil {
+		return 0, fmt.Errorf("fanotify: pending error, %w", ierr)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,89 @@
+//go:build go1.23
+
+package fanotify
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"sync/atomic"
+)
+
+// Iter returns a sequence of events read from the handle until ctx is done:
+//
+//	for ev, err := range notify.Iter(ctx) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// Every event Fd is closed once the loop body returns, also on continue and
+// break, unless the event is retained with Retain. Permission events are
+// answered in the loop body, e.g. with Allow or Deny, those left unanswered
+// and not retained are allowed once it returns. The sequence ends after the first
+// error, it is ctx.Err() after cancellation. The handle should be initialized with FAN_NONBLOCK so
+// that a pending read can be interrupted by ctx.
+func (handle *NotifyFD) Iter(ctx context.Context, skipPIDs ...int) iter.Seq2[*EventMetadata, error] {
+	return func(yield func(*EventMetadata, error) bool) {
+		stop := interruptOnDone(ctx, handle.File, nil)
+		defer stop()
+
+		for {
+			ev, err := handle.WaitEvent(skipPIDs...)
+
+			if ctx.Err() != nil {
+				if ev != nil {
+					_ = handle.skip(ev)
+				}
+
+				yield(nil, ctx.Err())
+
+				return
+			}
+
+			if err != nil {
+				yield(nil, err)
+
+				return
+			}
+
+			if !handle.yieldEvent(yield, ev) {
+				return
+			}
+		}
+	}
+}
+
+// yieldEvent passes ev to yield and releases it afterwards, even when the
+// loop body panics.
+func (handle *NotifyFD) yieldEvent(yield func(*EventMetadata, error) bool, ev *EventMetadata) bool {
+	defer func() {
+		// a permission event the loop body left unanswered is allowed, so
+		// that the process is not left blocked
+		if ev.IsPermission() && atomic.LoadInt32(&ev.retained) == 0 {
+			if err := handle.ResponseAllow(ev); err != nil && !errors.Is(err, ErrResponded) {
+				handle.error(err)
+			}
+		}
+
+		_ = ev.release()
+	}()
+
+	ok := yield(ev, nil)
+	handle.delivered(ev)
+
+	return ok
+}
+
+// AllInfoRecords returns a sequence of the event info records, see
+// EachInfoRecord:
+//
+//	for record := range ev.AllInfoRecords() {
+//		if handle, name, ok := record.FID(); ok {
+//			...
+//		}
+//	}
+func (metadata *EventMetadata) AllInfoRecords() iter.Seq[InfoRecord] {
+	return metadata.EachInfoRecord
+}
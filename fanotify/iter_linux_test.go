@@ -0,0 +1,59 @@
+//go:build go1.23
+
+package fanotify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// cancelReader cancels a context once it returned data, as if ctx was
+// cancelled while the event was being read.
+type cancelReader struct {
+	rd     io.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	if n > 0 {
+		r.cancel()
+	}
+
+	return n, err
+}
+
+func TestIterCancelAllowsPermissionEvent(t *testing.T) {
+	DebugFdLeaks = true
+	defer func() { DebugFdLeaks = false }()
+
+	// the allowed event is closed as well
+	defer CheckFdLeaksT(t)
+
+	fake := newFakeHandle(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake.Rd = &cancelReader{rd: fake.Rd, cancel: cancel}
+
+	fd := eventFd(t)
+	fake.send(t, encodeEvent(FAN_OPEN_PERM, fd, 1))
+
+	for ev, err := range fake.Iter(ctx) {
+		if ev != nil {
+			t.Fatalf("event %v yielded after cancellation", ev.Mask)
+		}
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	}
+
+	responses := fake.closeResponses()
+	if len(responses) != 1 || responses[0].Fd != fd || responses[0].Response != FAN_ALLOW {
+		t.Fatalf("got responses %+v, want FAN_ALLOW for Fd %d", responses, fd)
+	}
+}
@@ -0,0 +1,221 @@
+package fanotify
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// KernelVersion is a Linux kernel release, e.g. 5.15.0.
+type KernelVersion struct {
+	Major, Minor, Patch int
+}
+
+// String returns the version as "major.minor.patch".
+func (v KernelVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v is other or newer.
+func (v KernelVersion) AtLeast(other KernelVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+
+	return v.Patch >= other.Patch
+}
+
+// ParseKernelVersion parses a kernel release as reported by uname -r, e.g.
+// "6.1.0-18-amd64", suffixes after the numbers are ignored.
+func ParseKernelVersion(release string) (KernelVersion, error) {
+	var parts [3]int
+
+	fields := strings.SplitN(release, ".", 3)
+	if len(fields) < 2 {
+		return KernelVersion{}, fmt.Errorf("fanotify: kernel version error, invalid release %q", release)
+	}
+
+	for i, field := range fields {
+		end := 0
+		for end < len(field) && field[end] >= '0' && field[end] <= '9' {
+			end++
+		}
+
+		if end == 0 {
+			if i < 2 {
+				return KernelVersion{}, fmt.Errorf("fanotify: kernel version error, invalid release %q", release)
+			}
+
+			break
+		}
+
+		n, err := strconv.Atoi(field[:end])
+		if err != nil {
+			return KernelVersion{}, fmt.Errorf("fanotify: kernel version error, invalid release %q, %w", release, err)
+		}
+
+		parts[i] = n
+
+		if end < len(field) {
+			break
+		}
+	}
+
+	return KernelVersion{Major: parts[0], Minor: parts[1], Patch: parts[2]}, nil
+}
+
+// flagKernel is the first kernel release supporting a uapi bit.
+type flagKernel struct {
+	name string
+	bit  uint64
+	min  KernelVersion
+}
+
+// Kernel releases that introduced fanotify uapi bits, see fanotify_init(2)
+// and fanotify_mark(2), bits without an entry exist since 2.6.37, the
+// first release with fanotify enabled.
+var (
+	initFlagKernels = []flagKernel{
+		{"FAN_ENABLE_AUDIT", FAN_ENABLE_AUDIT, KernelVersion{4, 15, 0}},
+		{"FAN_REPORT_TID", FAN_REPORT_TID, KernelVersion{4, 20, 0}},
+		{"FAN_REPORT_FID", FAN_REPORT_FID, KernelVersion{5, 1, 0}},
+		{"FAN_REPORT_DIR_FID", FAN_REPORT_DIR_FID, KernelVersion{5, 9, 0}},
+		{"FAN_REPORT_NAME", FAN_REPORT_NAME, KernelVersion{5, 9, 0}},
+		{"FAN_REPORT_PIDFD", FAN_REPORT_PIDFD, KernelVersion{5, 15, 0}},
+		{"FAN_REPORT_TARGET_FID", FAN_REPORT_TARGET_FID, KernelVersion{5, 17, 0}},
+		{"FAN_REPORT_FD_ERROR", FAN_REPORT_FD_ERROR, KernelVersion{6, 13, 0}},
+		{"FAN_REPORT_MNT", FAN_REPORT_MNT, KernelVersion{6, 15, 0}},
+	}
+
+	markFlagKernels = []flagKernel{
+		{"FAN_MARK_FILESYSTEM", FAN_MARK_FILESYSTEM, KernelVersion{4, 20, 0}},
+		{"FAN_MARK_EVICTABLE", FAN_MARK_EVICTABLE, KernelVersion{5, 19, 0}},
+		{"FAN_MARK_IGNORE", FAN_MARK_IGNORE, KernelVersion{6, 0, 0}},
+		{"FAN_MARK_MNTNS", FAN_MARK_MNTNS, KernelVersion{6, 15, 0}},
+	}
+
+	eventKernels = []flagKernel{
+		{"FAN_OPEN_EXEC", FAN_OPEN_EXEC, KernelVersion{5, 0, 0}},
+		{"FAN_OPEN_EXEC_PERM", FAN_OPEN_EXEC_PERM, KernelVersion{5, 0, 0}},
+		{"FAN_ATTRIB", FAN_ATTRIB, KernelVersion{5, 1, 0}},
+		{"FAN_MOVED_FROM", FAN_MOVED_FROM, KernelVersion{5, 1, 0}},
+		{"FAN_MOVED_TO", FAN_MOVED_TO, KernelVersion{5, 1, 0}},
+		{"FAN_CREATE", FAN_CREATE, KernelVersion{5, 1, 0}},
+		{"FAN_DELETE", FAN_DELETE, KernelVersion{5, 1, 0}},
+		{"FAN_DELETE_SELF", FAN_DELETE_SELF, KernelVersion{5, 1, 0}},
+		{"FAN_MOVE_SELF", FAN_MOVE_SELF, KernelVersion{5, 1, 0}},
+		{"FAN_FS_ERROR", FAN_FS_ERROR, KernelVersion{5, 16, 0}},
+		{"FAN_RENAME", FAN_RENAME, KernelVersion{5, 17, 0}},
+		{"FAN_PRE_ACCESS", FAN_PRE_ACCESS, KernelVersion{6, 14, 0}},
+		{"FAN_MNT_ATTACH", FAN_MNT_ATTACH, KernelVersion{6, 15, 0}},
+		{"FAN_MNT_DETACH", FAN_MNT_DETACH, KernelVersion{6, 15, 0}},
+	}
+)
+
+// FlagSet is a fanotify configuration checked by RequiresKernel, Mark and
+// Mask are all planned mark flags and event masks OR-ed together.
+type FlagSet struct {
+	Init InitFlags
+	Mark MarkFlags
+	Mask EventMask
+}
+
+// UnsupportedFlag is a bit of a FlagSet the kernel is too old for.
+type UnsupportedFlag struct {
+	Name     string
+	Requires KernelVersion
+}
+
+// KernelError lists the bits of a FlagSet the kernel does not support, it
+// wraps unix.EINVAL, which fanotify_init and fanotify_mark fail with.
+type KernelError struct {
+	Kernel      KernelVersion
+	Unsupported []UnsupportedFlag
+}
+
+// Error implements error.
+func (err *KernelError) Error() string {
+	parts := make([]string, 0, len(err.Unsupported))
+
+	for _, flag := range err.Unsupported {
+		parts = append(parts, fmt.Sprintf("%s (%s+)", flag.Name, flag.Requires))
+	}
+
+	return fmt.Sprintf("fanotify: kernel error, %s does not support %s", err.Kernel, strings.Join(parts, ", "))
+}
+
+// Unwrap returns unix.EINVAL.
+func (err *KernelError) Unwrap() error {
+	return syscall.EINVAL
+}
+
+// MinKernel returns the oldest kernel release supporting every bit of set.
+func (set FlagSet) MinKernel() KernelVersion {
+	oldest := KernelVersion{2, 6, 37}
+
+	for _, flag := range set.required() {
+		if !oldest.AtLeast(flag.min) {
+			oldest = flag.min
+		}
+	}
+
+	return oldest
+}
+
+// CheckKernel returns a *KernelError listing the bits of set kernel does
+// not support, nil when it supports all of them.
+func (set FlagSet) CheckKernel(kernel KernelVersion) error {
+	var unsupported []UnsupportedFlag
+
+	for _, flag := range set.required() {
+		if !kernel.AtLeast(flag.min) {
+			unsupported = append(unsupported, UnsupportedFlag{Name: flag.name, Requires: flag.min})
+		}
+	}
+
+	if len(unsupported) > 0 {
+		return &KernelError{Kernel: kernel, Unsupported: unsupported}
+	}
+
+	return nil
+}
+
+// required returns the table entries whose bits are all set, FAN_MARK_MNTNS
+// spans the bits of FAN_MARK_MOUNT and FAN_MARK_FILESYSTEM.
+func (set FlagSet) required() []flagKernel {
+	var out []flagKernel
+
+	for _, table := range []struct {
+		flags   uint64
+		entries []flagKernel
+	}{
+		{uint64(set.Init), initFlagKernels},
+		{uint64(set.Mark), markFlagKernels},
+		{uint64(set.Mask), eventKernels},
+	} {
+		for _, flag := range table.entries {
+			if table.flags&flag.bit == flag.bit {
+				out = append(out, flag)
+			}
+		}
+	}
+
+	return out
+}
+
+// RequiresKernel validates set against the running kernel, see CheckKernel
+// and CurrentKernel. Distribution kernels may backport bits to older
+// releases, feature probing by fanotify_init is authoritative.
+func RequiresKernel(set FlagSet) error {
+	kernel, err := CurrentKernel()
+	if err != nil {
+		return err
+	}
+
+	return set.CheckKernel(kernel)
+}
@@ -0,0 +1,32 @@
+package fanotify
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+var currentKernel struct {
+	once    sync.Once
+	version KernelVersion
+	err     error
+}
+
+// CurrentKernel returns the release of the running kernel, read once by
+// uname(2).
+func CurrentKernel() (KernelVersion, error) {
+	currentKernel.once.Do(func() {
+		var uts unix.Utsname
+
+		if err := unix.Uname(&uts); err != nil {
+			currentKernel.err = fmt.Errorf("fanotify: uname error, %w", err)
+
+			return
+		}
+
+		currentKernel.version, currentKernel.err = ParseKernelVersion(unix.ByteSliceToString(uts.Release[:]))
+	})
+
+	return currentKernel.version, currentKernel.err
+}
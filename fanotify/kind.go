@@ -0,0 +1,262 @@
+package fanotify
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Info record sizes, struct fanotify_event_info_fid up to the file handle
+// and struct fanotify_event_info_error.
+const (
+	fidInfoLen   = infoHeaderLen + 8 + 8
+	errorInfoLen = infoHeaderLen + 8
+)
+
+// dirEntryEvents are events reported for a directory entry, the event
+// carries the parent directory and the entry name.
+const dirEntryEvents EventMask = FAN_CREATE | FAN_DELETE | FAN_MOVE | FAN_RENAME
+
+// TypedEvent is an event classified by kind, one of *FileEvent,
+// *DirEntryEvent, *PermissionEvent, *OverflowEvent or *FsErrorEvent, see
+// EventMetadata.Typed.
+type TypedEvent interface {
+	// Metadata returns the classified event, which still owns the event Fd.
+	Metadata() *EventMetadata
+
+	typedEvent()
+}
+
+// Typed classifies the event, so that consumers can switch on its type
+// instead of probing mask bits and Fd values:
+//   - *OverflowEvent for FAN_Q_OVERFLOW,
+//   - *FsErrorEvent for FAN_FS_ERROR,
+//   - *PermissionEvent for events that need a response,
+//   - *DirEntryEvent for create, delete, move and rename events,
+//   - *FileEvent for all other events.
+//
+// The wrapper shares the event, closing it is still up to the caller.
+func (metadata *EventMetadata) Typed() TypedEvent {
+	mask := EventMask(metadata.Mask)
+
+	switch {
+	case mask&FAN_Q_OVERFLOW != 0:
+		return &OverflowEvent{ev: metadata}
+	case mask&FAN_FS_ERROR != 0:
+		return &FsErrorEvent{ev: metadata}
+	case metadata.IsPermission():
+		return &PermissionEvent{ev: metadata}
+	case mask&dirEntryEvents != 0:
+		return &DirEntryEvent{ev: metadata}
+	default:
+		return &FileEvent{ev: metadata}
+	}
+}
+
+// FileHandle identifies a file of a FID reporting group, as reported in
+// FID info records, it can be opened with unix.OpenByHandleAt.
+type FileHandle struct {
+	Fsid   [2]int32
+	Type   int32
+	Handle []byte
+}
+
+// FileEvent is an event on a file or directory itself: access, modify,
+// attrib, open, close and self events.
+type FileEvent struct {
+	ev *EventMetadata
+}
+
+// Metadata returns the classified event.
+func (e *FileEvent) Metadata() *EventMetadata { return e.ev }
+
+func (*FileEvent) typedEvent() {}
+
+// Mask returns the event bits, FAN_ONDIR excluded.
+func (e *FileEvent) Mask() EventMask { return EventMask(e.ev.Mask) &^ FAN_ONDIR }
+
+// PID returns the PID, or the TID for FAN_REPORT_TID groups, of the process
+// causing the event.
+func (e *FileEvent) PID() int { return e.ev.GetPID() }
+
+// IsDir returns 'true' when the event is on a directory.
+func (e *FileEvent) IsDir() bool { return e.ev.Mask&FAN_ONDIR != 0 }
+
+// Path returns the path of the event Fd, FID reporting groups report a
+// FileHandle instead.
+func (e *FileEvent) Path() (string, error) { return eventPath(e.ev) }
+
+// File returns a duplicate of the event Fd, see EventMetadata.File.
+func (e *FileEvent) File() *os.File { return e.ev.File() }
+
+// Handle returns the file handle reported by FID groups, the parent
+// directory handle for groups with FAN_REPORT_DIR_FID only.
+func (e *FileEvent) Handle() (FileHandle, bool) {
+	handle, _, ok := e.ev.fid(FAN_EVENT_INFO_TYPE_FID, FAN_EVENT_INFO_TYPE_DFID)
+
+	return handle, ok
+}
+
+// DirEntryEvent is a change of a directory entry: create, delete, move and
+// rename events, reported by groups with FAN_REPORT_DFID_NAME. There is no
+// event Fd, the parent directory is reported as a FileHandle.
+type DirEntryEvent struct {
+	ev *EventMetadata
+}
+
+// Metadata returns the classified event.
+func (e *DirEntryEvent) Metadata() *EventMetadata { return e.ev }
+
+func (*DirEntryEvent) typedEvent() {}
+
+// Mask returns the event bits, FAN_ONDIR excluded.
+func (e *DirEntryEvent) Mask() EventMask { return EventMask(e.ev.Mask) &^ FAN_ONDIR }
+
+// PID returns the PID of the process causing the event.
+func (e *DirEntryEvent) PID() int { return e.ev.GetPID() }
+
+// IsDir returns 'true' when the entry is a directory.
+func (e *DirEntryEvent) IsDir() bool { return e.ev.Mask&FAN_ONDIR != 0 }
+
+// Dir returns the handle of the directory holding the entry, for FAN_RENAME
+// the old directory.
+func (e *DirEntryEvent) Dir() (FileHandle, bool) {
+	handle, _, ok := e.ev.fid(FAN_EVENT_INFO_TYPE_DFID_NAME, FAN_EVENT_INFO_TYPE_OLD_DFID_NAME)
+
+	return handle, ok
+}
+
+// Name returns the entry name, for FAN_RENAME the old name.
+func (e *DirEntryEvent) Name() string {
+	_, name, _ := e.ev.fid(FAN_EVENT_INFO_TYPE_DFID_NAME, FAN_EVENT_INFO_TYPE_OLD_DFID_NAME)
+
+	return name
+}
+
+// NewDir returns the handle of the directory a FAN_RENAME moved the entry to.
+func (e *DirEntryEvent) NewDir() (FileHandle, bool) {
+	handle, _, ok := e.ev.fid(FAN_EVENT_INFO_TYPE_NEW_DFID_NAME)
+
+	return handle, ok
+}
+
+// NewName returns the name a FAN_RENAME gave the entry.
+func (e *DirEntryEvent) NewName() string {
+	_, name, _ := e.ev.fid(FAN_EVENT_INFO_TYPE_NEW_DFID_NAME)
+
+	return name
+}
+
+// PermissionEvent is an event waiting for a response, answer it with
+// ResponseAllow or ResponseDeny on Metadata.
+type PermissionEvent struct {
+	ev *EventMetadata
+}
+
+// Metadata returns the classified event.
+func (e *PermissionEvent) Metadata() *EventMetadata { return e.ev }
+
+func (*PermissionEvent) typedEvent() {}
+
+// Mask returns the permission event bits.
+func (e *PermissionEvent) Mask() EventMask { return EventMask(e.ev.Mask) & permissionEvents }
+
+// PID returns the PID of the process waiting for the response.
+func (e *PermissionEvent) PID() int { return e.ev.GetPID() }
+
+// Path returns the path of the file being accessed.
+func (e *PermissionEvent) Path() (string, error) { return eventPath(e.ev) }
+
+// File returns a duplicate of the event Fd, see EventMetadata.File.
+func (e *PermissionEvent) File() *os.File { return e.ev.File() }
+
+// OverflowEvent reports that the event queue overflowed and events were
+// lost, it carries no file and no process.
+type OverflowEvent struct {
+	ev *EventMetadata
+}
+
+// Metadata returns the classified event.
+func (e *OverflowEvent) Metadata() *EventMetadata { return e.ev }
+
+func (*OverflowEvent) typedEvent() {}
+
+// FsErrorEvent reports filesystem errors of a filesystem mark, errors are
+// merged, ErrorCount is the number of errors since the last event.
+type FsErrorEvent struct {
+	ev *EventMetadata
+}
+
+// Metadata returns the classified event.
+func (e *FsErrorEvent) Metadata() *EventMetadata { return e.ev }
+
+func (*FsErrorEvent) typedEvent() {}
+
+// Errno returns the first error reported, 0 when the record is missing.
+func (e *FsErrorEvent) Errno() syscall.Errno {
+	errno, _ := e.ev.fsError()
+
+	return errno
+}
+
+// ErrorCount returns the number of errors merged into the event.
+func (e *FsErrorEvent) ErrorCount() uint32 {
+	_, count := e.ev.fsError()
+
+	return count
+}
+
+// Handle returns the handle of the file that failed, the filesystem root
+// handle when the error is not tied to a file.
+func (e *FsErrorEvent) Handle() (FileHandle, bool) {
+	handle, _, ok := e.ev.fid(FAN_EVENT_INFO_TYPE_FID)
+
+	return handle, ok
+}
+
+func eventPath(ev *EventMetadata) (string, error) {
+	if ev.Fd < 0 {
+		return "", fmt.Errorf("fanotify: path error, event without Fd, %w", syscall.EBADF)
+	}
+
+	return ev.GetPath()
+}
+
+// fid decodes the first FID record of one of types, with the name following
+// the handle of DFID_NAME records.
+func (metadata *EventMetadata) fid(types ...uint8) (handle FileHandle, name string, ok bool) {
+	metadata.EachInfoRecord(func(record InfoRecord) bool {
+		if !hasType(types, record.Type) {
+			return true
+		}
+
+		handle, name, ok = record.FID()
+
+		return !ok
+	})
+
+	return handle, name, ok
+}
+
+// fsError decodes the FAN_FS_ERROR info record.
+func (metadata *EventMetadata) fsError() (errno syscall.Errno, count uint32) {
+	metadata.EachInfoRecord(func(record InfoRecord) bool {
+		var ok bool
+
+		errno, count, ok = record.FsError()
+
+		return !ok
+	})
+
+	return errno, count
+}
+
+func hasType(types []uint8, t uint8) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,299 @@
+package fanotify
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyStage is a part of the event pipeline a LatencyRecorder measures.
+//
+// The kernel does not timestamp queued events, so the time an event waited
+// in the kernel queue is not measured, a backlog there shows as a growing
+// Pending depth instead, see WithBackpressure.
+type LatencyStage int
+
+// Pipeline stages, in order.
+const (
+	// StageBuffer is the wait in the read buffer, from the read(2) returning
+	// the batch of the event until it was decoded, behind earlier events of
+	// the batch.
+	StageBuffer LatencyStage = iota
+	// StageFilter is skipPIDs, path resolution and filters, until
+	// EventTimes.Filtered. Also dropped events are counted.
+	StageFilter
+	// StageEnrich is the enrichers, until EventTimes.Enriched.
+	StageEnrich
+	// StageSink is the sinks of a Watcher, the handlers of Run or the loop
+	// body of Iter, until they returned.
+	StageSink
+	// StageTotal is from the read(2) until StageSink ended.
+	StageTotal
+
+	latencyStages
+)
+
+var latencyStageNames = [latencyStages]string{"buffer", "filter", "enrich", "sink", "total"}
+
+func (stage LatencyStage) String() string {
+	if stage < 0 || stage >= latencyStages {
+		return "unknown"
+	}
+
+	return latencyStageNames[stage]
+}
+
+// latencyBuckets is the number of bounded histogram buckets, the bounds
+// double from 1µs to about 16.8s.
+const latencyBuckets = 25
+
+// EventTimes are the pipeline timestamps of an event, EventMetadata.Time is
+// when it was decoded. They are set with WithLatency only.
+type EventTimes struct {
+	// Batch is when the read(2) returning the event completed.
+	Batch time.Time
+	// Filtered is when skipPIDs and filters passed the event.
+	Filtered time.Time
+	// Enriched is when the enrichers returned.
+	Enriched time.Time
+}
+
+// LatencyHistogram is a snapshot of the latencies of a stage.
+type LatencyHistogram struct {
+	// Bounds are the inclusive upper bounds of Counts, the last count is of
+	// latencies above the last bound.
+	Bounds []time.Duration `json:"bounds"`
+	Counts []uint64        `json:"counts"`
+	Count  uint64          `json:"count"`
+	Sum    time.Duration   `json:"sum"`
+	Max    time.Duration   `json:"max"`
+}
+
+// Mean returns the average latency.
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns the upper bound of the bucket holding quantile q, e.g.
+// 0.99, capped at Max.
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+
+	rank := uint64(q*float64(h.Count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen uint64
+
+	for i, n := range h.Counts {
+		if seen += n; seen < rank {
+			continue
+		}
+
+		if i < len(h.Bounds) && h.Bounds[i] < h.Max {
+			return h.Bounds[i]
+		}
+
+		break
+	}
+
+	return h.Max
+}
+
+// latencyHistogram holds the counters of a stage, updated atomically.
+type latencyHistogram struct {
+	counts [latencyBuckets + 1]uint64
+	count  uint64
+	sum    uint64
+	max    uint64
+}
+
+// LatencyRecorder keeps latency histograms of the pipeline stages, so that
+// delays can be told apart between buffering, filtering, enrichment and
+// sinks. It is safe for concurrent use, see WithLatency.
+type LatencyRecorder struct {
+	stages [latencyStages]latencyHistogram
+}
+
+// NewLatencyRecorder returns an empty LatencyRecorder.
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{}
+}
+
+// WithLatency stamps read events with EventTimes and records their stage
+// latencies in rec. Watcher, Run and Iter record StageSink and StageTotal,
+// callers of GetEvent record them with Delivered.
+func WithLatency(rec *LatencyRecorder) Option {
+	return func(handle *NotifyFD) {
+		handle.latency = rec
+	}
+}
+
+// Observe records latency d of stage.
+func (rec *LatencyRecorder) Observe(stage LatencyStage, d time.Duration) {
+	if stage < 0 || stage >= latencyStages {
+		return
+	}
+
+	if d < 0 {
+		d = 0
+	}
+
+	h := &rec.stages[stage]
+	ns := uint64(d)
+
+	atomic.AddUint64(&h.counts[latencyBucket(d)], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, ns)
+
+	for {
+		cur := atomic.LoadUint64(&h.max)
+		if ns <= cur || atomic.CompareAndSwapUint64(&h.max, cur, ns) {
+			return
+		}
+	}
+}
+
+// Delivered records StageSink and StageTotal of event, once the consumer of
+// an event returned by GetEvent is done with it.
+func (rec *LatencyRecorder) Delivered(event *EventMetadata) {
+	if event.Times.Enriched.IsZero() {
+		return
+	}
+
+	now := time.Now()
+
+	rec.Observe(StageSink, now.Sub(event.Times.Enriched))
+	rec.Observe(StageTotal, now.Sub(event.Times.Batch))
+}
+
+// Histogram returns a snapshot of stage.
+func (rec *LatencyRecorder) Histogram(stage LatencyStage) LatencyHistogram {
+	out := LatencyHistogram{
+		Bounds: make([]time.Duration, latencyBuckets),
+		Counts: make([]uint64, latencyBuckets+1),
+	}
+
+	for i := range out.Bounds {
+		out.Bounds[i] = time.Microsecond << i
+	}
+
+	if stage < 0 || stage >= latencyStages {
+		return out
+	}
+
+	h := &rec.stages[stage]
+
+	for i := range out.Counts {
+		out.Counts[i] = atomic.LoadUint64(&h.counts[i])
+		out.Count += out.Counts[i]
+	}
+
+	out.Sum = time.Duration(atomic.LoadUint64(&h.sum))
+	out.Max = time.Duration(atomic.LoadUint64(&h.max))
+
+	return out
+}
+
+// Snapshot returns the histograms of all stages keyed by stage name.
+func (rec *LatencyRecorder) Snapshot() map[string]LatencyHistogram {
+	out := make(map[string]LatencyHistogram, latencyStages)
+
+	for stage := LatencyStage(0); stage < latencyStages; stage++ {
+		out[stage.String()] = rec.Histogram(stage)
+	}
+
+	return out
+}
+
+// Reset drops all recorded latencies.
+func (rec *LatencyRecorder) Reset() {
+	for stage := range rec.stages {
+		h := &rec.stages[stage]
+
+		for i := range h.counts {
+			atomic.StoreUint64(&h.counts[i], 0)
+		}
+
+		atomic.StoreUint64(&h.count, 0)
+		atomic.StoreUint64(&h.sum, 0)
+		atomic.StoreUint64(&h.max, 0)
+	}
+}
+
+// latencyBucket returns the index of the bucket of d.
+func latencyBucket(d time.Duration) int {
+	us := uint64((d + time.Microsecond - 1) / time.Microsecond)
+	if us <= 1 {
+		return 0
+	}
+
+	i := bits.Len64(us - 1)
+	if i > latencyBuckets {
+		return latencyBuckets
+	}
+
+	return i
+}
+
+// stampBatch sets the batch time of a decoded event, batch holds the time of
+// the current batch of the reader and is moved to event when it started a
+// new one.
+func (handle *NotifyFD) stampBatch(event *EventMetadata, batch *time.Time, fresh bool) {
+	if handle.latency == nil {
+		return
+	}
+
+	if fresh || batch.IsZero() {
+		*batch = event.Time
+	}
+
+	event.Times.Batch = *batch
+}
+
+// stampFiltered records StageBuffer and StageFilter of event, pass is
+// whether it was kept.
+func (handle *NotifyFD) stampFiltered(event *EventMetadata, pass bool) {
+	if handle.latency == nil {
+		return
+	}
+
+	if event.Times.Batch.IsZero() {
+		event.Times.Batch = event.Time
+	}
+
+	now := time.Now()
+
+	handle.latency.Observe(StageBuffer, event.Time.Sub(event.Times.Batch))
+	handle.latency.Observe(StageFilter, now.Sub(event.Time))
+
+	if pass {
+		event.Times.Filtered = now
+	}
+}
+
+// stampEnriched records StageEnrich of event.
+func (handle *NotifyFD) stampEnriched(event *EventMetadata) {
+	if handle.latency == nil {
+		return
+	}
+
+	event.Times.Enriched = time.Now()
+
+	handle.latency.Observe(StageEnrich, event.Times.Enriched.Sub(event.Times.Filtered))
+}
+
+// delivered records StageSink and StageTotal of event, see
+// LatencyRecorder.Delivered.
+func (handle *NotifyFD) delivered(event *EventMetadata) {
+	if handle.latency != nil {
+		handle.latency.Delivered(event)
+	}
+}
@@ -0,0 +1,94 @@
+package fanotify
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// lifecycle owns the goroutine running a blocking Run method, it backs the
+// Start and Stop methods of Watcher, Manager and OrderedMerge.
+type lifecycle struct {
+	mu      sync.Mutex
+	started bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+}
+
+// start runs run on a new goroutine with a ctx cancelled by stop, a
+// lifecycle can be started once.
+func (l *lifecycle) start(ctx context.Context, run func(context.Context) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.started {
+		return errors.New("fanotify: already started")
+	}
+
+	if l.done == nil {
+		l.done = make(chan struct{})
+	}
+
+	l.started = true
+	ctx, l.cancel = context.WithCancel(ctx)
+	done := l.done
+
+	go func() {
+		defer close(done)
+
+		err := run(ctx)
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		}
+
+		l.err = err
+	}()
+
+	return nil
+}
+
+// stop cancels run and waits for it to return, returning its error.
+func (l *lifecycle) stop() error {
+	l.mu.Lock()
+	cancel, done := l.cancel, l.done
+	l.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	<-done
+
+	return l.err
+}
+
+// wait returns a channel closed once run returned.
+func (l *lifecycle) wait() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.done == nil {
+		l.done = make(chan struct{})
+	}
+
+	return l.done
+}
+
+// runUntilDone blocks until ctx is done or done is closed by Close, it
+// backs the Run methods of components whose goroutines start with their
+// constructor. After ctx it calls close and returns its error or ctx.Err().
+func runUntilDone(ctx context.Context, done <-chan struct{}, close func() error) error {
+	select {
+	case <-ctx.Done():
+	case <-done:
+		return nil
+	}
+
+	if err := close(); err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
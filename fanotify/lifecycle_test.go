@@ -0,0 +1,146 @@
+package fanotify
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingSink is an AckingSink whose Publish blocks until ctx is done.
+type blockingSink struct {
+	published int32
+	closed    int32
+}
+
+func (s *blockingSink) Publish(ctx context.Context, ev Event) error {
+	atomic.AddInt32(&s.published, 1)
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func (s *blockingSink) Close() error {
+	atomic.StoreInt32(&s.closed, 1)
+
+	return nil
+}
+
+func (s *blockingSink) SetAcker(acker Acker) {}
+
+// waitPublished waits until n events reached s.
+func (s *blockingSink) waitPublished(t testing.TB, n int32) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for atomic.LoadInt32(&s.published) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d events published, want %d", atomic.LoadInt32(&s.published), n)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// checkGoroutines fails t when more than before goroutines are left, they
+// are given a moment to return.
+func checkGoroutines(t testing.TB, before int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines left, want %d:\n%s",
+				runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSinkRunCancel(t *testing.T) {
+	tests := []struct {
+		name string
+		// start returns the Run method of a sink with a delivery to next in
+		// progress
+		start func(t *testing.T, next *blockingSink) func(context.Context) error
+	}{
+		{
+			name: "SpillBuffer",
+			start: func(t *testing.T, next *blockingSink) func(context.Context) error {
+				s, err := NewSpillBuffer(next, SpillConfig{
+					Path:     filepath.Join(t.TempDir(), "spill"),
+					MaxBytes: 1 << 16,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := s.Publish(context.Background(), Event{PID: 1}); err != nil {
+					t.Fatal(err)
+				}
+
+				next.waitPublished(t, 1)
+
+				return s.Run
+			},
+		},
+		{
+			name: "Checkpointer",
+			start: func(t *testing.T, next *blockingSink) func(context.Context) error {
+				c := NewCheckpointer(next, CheckpointConfig{})
+
+				// a cancelled Publish leaves the event retained
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				if err := c.Publish(ctx, Event{Seq: 1}); !errors.Is(err, context.Canceled) {
+					t.Fatalf("got %v, want context.Canceled", err)
+				}
+
+				// the retransmission goroutine blocks in next
+				c.Reconnected()
+				next.waitPublished(t, 2)
+
+				return c.Run
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := runtime.NumGoroutine()
+			next := &blockingSink{}
+
+			run := tt.start(t, next)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+
+			go func() { done <- run(ctx) }()
+
+			cancel()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("Run: got %v, want context.Canceled", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run did not return after cancellation")
+			}
+
+			if atomic.LoadInt32(&next.closed) == 0 {
+				t.Fatal("next sink not closed")
+			}
+
+			checkGoroutines(t, before)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcFsFanotify is the directory holding fanotify sysctl limits.
+const ProcFsFanotify = "/proc/sys/fs/fanotify"
+
+// Limits holds per-user fanotify limits from /proc/sys/fs/fanotify, zero
+// means the limit is unknown (kernels before 5.13 do not expose them).
+type Limits struct {
+	MaxUserGroups   int
+	MaxUserMarks    int
+	MaxQueuedEvents int
+}
+
+// Names of fanotify sysctl limit files.
+const (
+	limitMaxUserGroups   = "max_user_groups"
+	limitMaxUserMarks    = "max_user_marks"
+	limitMaxQueuedEvents = "max_queued_events"
+)
+
+// ReadLimits returns current fanotify limits, limits missing on this kernel
+// are left zero.
+func ReadLimits() (Limits, error) {
+	var out Limits
+
+	for _, v := range []struct {
+		name string
+		dst  *int
+	}{
+		{limitMaxUserGroups, &out.MaxUserGroups},
+		{limitMaxUserMarks, &out.MaxUserMarks},
+		{limitMaxQueuedEvents, &out.MaxQueuedEvents},
+	} {
+		val, err := readLimit(v.name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return out, err
+		}
+
+		*v.dst = val
+	}
+
+	return out, nil
+}
+
+// SetLimits writes every non-zero limit, it needs CAP_SYS_ADMIN in the
+// initial user namespace. Limits only ever raised by callers should use
+// RaiseLimits instead.
+func SetLimits(l Limits) error {
+	for _, v := range []struct {
+		name string
+		val  int
+	}{
+		{limitMaxUserGroups, l.MaxUserGroups},
+		{limitMaxUserMarks, l.MaxUserMarks},
+		{limitMaxQueuedEvents, l.MaxQueuedEvents},
+	} {
+		if v.val <= 0 {
+			continue
+		}
+
+		if err := os.WriteFile(
+			filepath.Join(ProcFsFanotify, v.name), []byte(strconv.Itoa(v.val)), 0o644,
+		); err != nil {
+			return fmt.Errorf("fanotify: procfs error, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RaiseLimits raises every current limit that is lower than in l, lower or
+// unknown limits in l are never applied.
+func RaiseLimits(l Limits) error {
+	cur, err := ReadLimits()
+	if err != nil {
+		return err
+	}
+
+	var out Limits
+
+	if cur.MaxUserGroups != 0 && l.MaxUserGroups > cur.MaxUserGroups {
+		out.MaxUserGroups = l.MaxUserGroups
+	}
+
+	if cur.MaxUserMarks != 0 && l.MaxUserMarks > cur.MaxUserMarks {
+		out.MaxUserMarks = l.MaxUserMarks
+	}
+
+	if cur.MaxQueuedEvents != 0 && l.MaxQueuedEvents > cur.MaxQueuedEvents {
+		out.MaxQueuedEvents = l.MaxQueuedEvents
+	}
+
+	return SetLimits(out)
+}
+
+// Warnings returns a message for every limit the planned configuration will
+// exceed, the kernel reports those only later as EMFILE (groups), ENOSPC
+// (marks) or a queue overflow event.
+func (l Limits) Warnings(cfg PreflightConfig) []string {
+	var out []string
+
+	groups := cfg.Groups
+	if groups <= 0 {
+		groups = 1
+	}
+
+	if l.MaxUserGroups > 0 && groups > l.MaxUserGroups {
+		out = append(out, fmt.Sprintf(
+			"%d groups requested, %s/%s is %d, fanotify_init will fail with EMFILE",
+			groups, ProcFsFanotify, limitMaxUserGroups, l.MaxUserGroups))
+	}
+
+	if l.MaxUserMarks > 0 && cfg.InitFlags&FAN_UNLIMITED_MARKS == 0 && cfg.Marks*groups > l.MaxUserMarks {
+		out = append(out, fmt.Sprintf(
+			"%d marks requested, %s/%s is %d, fanotify_mark will fail with ENOSPC, raise it or use FAN_UNLIMITED_MARKS",
+			cfg.Marks*groups, ProcFsFanotify, limitMaxUserMarks, l.MaxUserMarks))
+	}
+
+	if l.MaxQueuedEvents > 0 && cfg.InitFlags&FAN_UNLIMITED_QUEUE == 0 && cfg.QueuedEvents > l.MaxQueuedEvents {
+		out = append(out, fmt.Sprintf(
+			"bursts of %d events expected, %s/%s is %d, the queue will overflow, raise it or use FAN_UNLIMITED_QUEUE",
+			cfg.QueuedEvents, ProcFsFanotify, limitMaxQueuedEvents, l.MaxQueuedEvents))
+	}
+
+	return out
+}
+
+// readLimit reads a fanotify sysctl limit.
+func readLimit(name string) (int, error) {
+	content, err := os.ReadFile(filepath.Join(ProcFsFanotify, name))
+	if err != nil {
+		return 0, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	val, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	return val, nil
+}
@@ -0,0 +1,475 @@
+package fanotify
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Exec limits mirrored from the kernel.
+const (
+	// taskCommLen is TASK_COMM_LEN without the terminating NUL.
+	taskCommLen = 15
+	// binprmBufSize is BINPRM_BUF_SIZE, the head of an executable the
+	// kernel reads the '#!' line from.
+	binprmBufSize = 256
+)
+
+// ProcessNode is a process of a ProcessTree.
+type ProcessNode struct {
+	PID  int `json:"pid"`
+	PPID int `json:"ppid"`
+	// Comm is the command name, after an exec event the base name of Exe
+	// truncated as by the kernel.
+	Comm string `json:"comm,omitempty"`
+	// Exe is the executable the process runs, the file of its latest exec
+	// event, a script for interpreted programs, or '/proc/PID/exe' when the
+	// process was first seen. It is empty for kernel threads.
+	Exe string `json:"exe,omitempty"`
+}
+
+// Lineage is the ancestry of the process that generated an event.
+type Lineage struct {
+	Process ProcessNode `json:"process"`
+	// Parents are the ancestors, parent first, up to init, the first
+	// ancestor the tree does not know or ProcessTreeConfig.MaxDepth. The
+	// executable that spawned the process is the Exe of the first parent.
+	Parents []ProcessNode `json:"parents,omitempty"`
+}
+
+// ProcessTreeConfig configures a ProcessTree.
+type ProcessTreeConfig struct {
+	// MaxDepth bounds the returned parent chains, 64 when zero.
+	MaxDepth int
+	// Capacity is the number of processes after which exited ones are
+	// pruned, see Prune, 32768 when zero.
+	Capacity int
+}
+
+// ProcessTree tracks process ancestry for events, so that an event carries
+// the chain of processes that led to it even after some of them exited: it
+// is seeded from procfs, processes created since are added when they first
+// generate an event, and exec events, FAN_OPEN_EXEC or FAN_OPEN_EXEC_PERM,
+// refresh the executable of their process. The script and ELF interpreters
+// an exec opens are recognized when the event has an Fd, they do not
+// replace the executable. Processes are told apart by their start time, so
+// reused PIDs do not mix up chains. Exited processes are kept as long as
+// live processes descend from them. It is safe for concurrent use.
+type ProcessTree struct {
+	maxDepth int
+	capacity int
+
+	mu    sync.Mutex
+	nodes map[procKey]*processNode
+	// current maps PIDs to the latest process seen with them
+	current map[int]procKey
+}
+
+// procKey identifies a process, start is in clock ticks since boot.
+type procKey struct {
+	pid   int
+	start uint64
+}
+
+type processNode struct {
+	ProcessNode
+	parent procKey
+	// interps are the interpreters the latest exec is still to open
+	interps []fileKey
+}
+
+// procStat are the '/proc/PID/stat' fields used by ProcessTree.
+type procStat struct {
+	ppid  int
+	comm  string
+	start uint64
+}
+
+// NewProcessTree returns a ProcessTree seeded with the running processes.
+func NewProcessTree(cfg ProcessTreeConfig) (*ProcessTree, error) {
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = 64
+	}
+
+	if cfg.Capacity <= 0 {
+		cfg.Capacity = 32768
+	}
+
+	entries, err := os.ReadDir(ProcFs)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	t := &ProcessTree{
+		maxDepth: cfg.MaxDepth,
+		capacity: cfg.Capacity,
+		nodes:    make(map[procKey]*processNode),
+		current:  make(map[int]procKey),
+	}
+
+	stats := make(map[int]procStat, len(entries))
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		if st, err := readProcStat(pid); err == nil {
+			stats[pid] = st
+		}
+	}
+
+	for pid, st := range stats {
+		node := newProcessNode(pid, st)
+
+		if parent, ok := stats[st.ppid]; ok {
+			node.parent = procKey{pid: st.ppid, start: parent.start}
+		}
+
+		key := procKey{pid: pid, start: st.start}
+		t.nodes[key] = node
+		t.current[pid] = key
+	}
+
+	return t, nil
+}
+
+// Observe refreshes the process of an exec event, other events are
+// ignored. WithLineage observes the events it enriches.
+func (t *ProcessTree) Observe(metadata *EventMetadata) {
+	if metadata.Mask&uint64(FAN_OPEN_EXEC|FAN_OPEN_EXEC_PERM) == 0 {
+		return
+	}
+
+	pid := metadata.GetPID()
+
+	st, err := readProcStat(pid)
+	if err != nil {
+		return
+	}
+
+	var file fileKey
+
+	fst, statErr := metadata.Stat()
+	if statErr == nil {
+		file = fileKey{dev: fst.Dev, ino: fst.Ino}
+	}
+
+	path, pathErr := metadata.GetPath()
+	interps := execInterpreters(metadata, pid)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := procKey{pid: pid, start: st.start}
+
+	node, ok := t.nodes[key]
+	if !ok {
+		node = t.registerLocked(pid, st, 0)
+	}
+
+	if statErr == nil && node.takeInterpreter(file) {
+		node.interps = append(node.interps, interps...)
+
+		return
+	}
+
+	// exec keeps PID, parent and start time, it replaces comm and exe
+	node.interps = interps
+
+	if pathErr != nil {
+		node.Comm = st.comm
+		node.Exe = readProcExe(pid)
+
+		return
+	}
+
+	node.Exe = path
+	node.Comm = filepath.Base(path)
+
+	if len(node.Comm) > taskCommLen {
+		node.Comm = node.Comm[:taskCommLen]
+	}
+}
+
+// takeInterpreter reports whether file is an interpreter the latest exec
+// of the process was still to open, and drops it.
+func (node *processNode) takeInterpreter(file fileKey) bool {
+	for i, interp := range node.interps {
+		if interp == file {
+			node.interps = node.interps[i+1:]
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Lineage returns the ancestry of the process pid. A process that exited
+// before it was seen is unknown, the returned error wraps os.ErrNotExist
+// then.
+func (t *ProcessTree) Lineage(pid int) (*Lineage, error) {
+	st, statErr := readProcStat(pid)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var node *processNode
+
+	if statErr == nil {
+		node = t.nodes[procKey{pid: pid, start: st.start}]
+		if node == nil {
+			node = t.registerLocked(pid, st, 0)
+		}
+	} else if key, ok := t.current[pid]; ok {
+		// exited since the event, the latest process of pid is the best guess
+		node = t.nodes[key]
+	}
+
+	if node == nil {
+		return nil, statErr
+	}
+
+	lineage := &Lineage{Process: node.ProcessNode}
+
+	for key := node.parent; key.pid > 0 && len(lineage.Parents) < t.maxDepth; {
+		parent, ok := t.nodes[key]
+		if !ok {
+			break
+		}
+
+		lineage.Parents = append(lineage.Parents, parent.ProcessNode)
+		key = parent.parent
+	}
+
+	return lineage, nil
+}
+
+// registerLocked adds the process pid and, unless known, its ancestors.
+func (t *ProcessTree) registerLocked(pid int, st procStat, depth int) *processNode {
+	if len(t.nodes) >= t.capacity {
+		t.pruneLocked()
+	}
+
+	node := newProcessNode(pid, st)
+	key := procKey{pid: pid, start: st.start}
+	t.nodes[key] = node
+	t.current[pid] = key
+
+	if st.ppid <= 0 {
+		return node
+	}
+
+	pst, err := readProcStat(st.ppid)
+	if err != nil {
+		// the parent exited and the process was not reparented yet
+		if parent, ok := t.current[st.ppid]; ok {
+			node.parent = parent
+		}
+
+		return node
+	}
+
+	node.parent = procKey{pid: st.ppid, start: pst.start}
+
+	if _, ok := t.nodes[node.parent]; !ok && depth < t.maxDepth {
+		t.registerLocked(st.ppid, pst, depth+1)
+	}
+
+	return node
+}
+
+// Prune drops processes that exited and have no live descendants.
+func (t *ProcessTree) Prune() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pruneLocked()
+}
+
+func (t *ProcessTree) pruneLocked() {
+	keep := make(map[procKey]struct{}, len(t.nodes))
+
+	for key := range t.nodes {
+		if _, ok := keep[key]; ok {
+			continue
+		}
+
+		if st, err := readProcStat(key.pid); err != nil || st.start != key.start {
+			continue
+		}
+
+		// a live process keeps its ancestors
+		for k := key; k.pid > 0; {
+			if _, ok := keep[k]; ok {
+				break
+			}
+
+			node, ok := t.nodes[k]
+			if !ok {
+				break
+			}
+
+			keep[k] = struct{}{}
+			k = node.parent
+		}
+	}
+
+	for key := range t.nodes {
+		if _, ok := keep[key]; ok {
+			continue
+		}
+
+		delete(t.nodes, key)
+
+		if t.current[key.pid] == key {
+			delete(t.current, key.pid)
+		}
+	}
+}
+
+// Len returns the number of tracked processes.
+func (t *ProcessTree) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.nodes)
+}
+
+// WithLineage enriches every event with the ancestry of its process, see
+// ProcessTree, exec events update the tree first. The group should report
+// FAN_OPEN_EXEC on the marked mounts for executables to stay current,
+// exec events removed by filters are not seen.
+func WithLineage(tree *ProcessTree) Option {
+	return WithEnricher(func(metadata *EventMetadata) {
+		tree.Observe(metadata)
+
+		if lineage, err := tree.Lineage(metadata.GetPID()); err == nil {
+			metadata.Lineage = lineage
+		}
+	})
+}
+
+func newProcessNode(pid int, st procStat) *processNode {
+	return &processNode{ProcessNode: ProcessNode{
+		PID:  pid,
+		PPID: st.ppid,
+		Comm: st.comm,
+		Exe:  readProcExe(pid),
+	}}
+}
+
+// readProcStat parses '/proc/PID/stat', comm is enclosed in parentheses and
+// may contain any character, the other fields follow the last ')'.
+func readProcStat(pid int) (procStat, error) {
+	content, err := os.ReadFile(filepath.Join(ProcFs, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	open := bytes.IndexByte(content, '(')
+	end := bytes.LastIndexByte(content, ')')
+
+	if open < 0 || end < open {
+		return procStat{}, fmt.Errorf("fanotify: procfs error, malformed stat of PID %d", pid)
+	}
+
+	// state ppid pgrp session tty_nr tpgid flags minflt cminflt majflt
+	// cmajflt utime stime cutime cstime priority nice num_threads
+	// itrealvalue starttime
+	fields := strings.Fields(string(content[end+1:]))
+	if len(fields) < 20 {
+		return procStat{}, fmt.Errorf("fanotify: procfs error, malformed stat of PID %d", pid)
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return procStat{}, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return procStat{}, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	return procStat{ppid: ppid, comm: string(content[open+1 : end]), start: start}, nil
+}
+
+// execInterpreters returns the interpreters the executable of an exec event
+// makes the kernel open, the '#!' interpreter of a script or the PT_INTERP
+// of an ELF binary, looked up in the root of pid.
+func execInterpreters(metadata *EventMetadata, pid int) []fileKey {
+	if metadata.Fd < 0 {
+		return nil
+	}
+
+	head := make([]byte, binprmBufSize)
+
+	n, err := metadata.ReaderAt().ReadAt(head, 0)
+	if n == 0 && err != nil {
+		return nil
+	}
+
+	head = head[:n]
+
+	var interp string
+
+	switch {
+	case bytes.HasPrefix(head, []byte("#!")):
+		line := head[2:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+
+		if fields := strings.Fields(string(line)); len(fields) > 0 {
+			interp = fields[0]
+		}
+	case bytes.HasPrefix(head, []byte(elf.ELFMAG)):
+		f, err := elf.NewFile(metadata.ReaderAt())
+		if err != nil {
+			return nil
+		}
+
+		for _, prog := range f.Progs {
+			if prog.Type != elf.PT_INTERP {
+				continue
+			}
+
+			b, err := io.ReadAll(prog.Open())
+			if err == nil {
+				interp = string(bytes.TrimRight(b, "\x00"))
+			}
+
+			break
+		}
+	}
+
+	if !filepath.IsAbs(interp) {
+		return nil
+	}
+
+	st, err := statPath(filepath.Join(ProcFs, strconv.Itoa(pid), "root", interp))
+	if err != nil {
+		return nil
+	}
+
+	return []fileKey{{dev: st.Dev, ino: st.Ino}}
+}
+
+// readProcExe returns the executable of pid, empty when unavailable.
+func readProcExe(pid int) string {
+	exe, err := os.Readlink(filepath.Join(ProcFs, strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return ""
+	}
+
+	return exe
+}
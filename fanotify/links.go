@@ -0,0 +1,240 @@
+package fanotify
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// defaultLinkIndexSize is the number of names a LinkIndex keeps when no size
+// is given.
+const defaultLinkIndexSize = 65536
+
+// LinkName is a known name of a file.
+type LinkName struct {
+	Path string
+	// Symlink marks a symbolic link resolving to the file, other names are
+	// hard links.
+	Symlink bool
+}
+
+// LinkIndex maps files, by device and inode, to the names they were seen
+// under, so that events on one name can be cross-referenced with its other
+// hard links and with symbolic links pointing at it. Names are learned from
+// events passed to Observe and from Scan, the index is therefore only as
+// complete as the paths seen so far.
+//
+// Names are verified with lstat when reported, stale ones are dropped. At
+// most the number of names given to NewLinkIndex is kept, further names are
+// ignored until stale ones are dropped or Forget is called.
+type LinkIndex struct {
+	max int
+
+	mu    sync.Mutex
+	names map[fileKey]map[LinkName]struct{}
+	paths map[LinkName]fileKey
+}
+
+// NewLinkIndex returns an index keeping max names, 0 or less keeps 65536.
+func NewLinkIndex(max int) *LinkIndex {
+	if max <= 0 {
+		max = defaultLinkIndexSize
+	}
+
+	return &LinkIndex{
+		max:   max,
+		names: make(map[fileKey]map[LinkName]struct{}),
+		paths: make(map[LinkName]fileKey),
+	}
+}
+
+// Observe records the path of event under the event file inode.
+func (idx *LinkIndex) Observe(ev *EventMetadata) error {
+	if ev.Fd < 0 {
+		return nil
+	}
+
+	st, err := ev.Stat()
+	if err != nil {
+		return err
+	}
+
+	path, err := ev.GetPath()
+	if err != nil {
+		return err
+	}
+
+	idx.add(fileKey{dev: st.Dev, ino: st.Ino}, LinkName{Path: path})
+
+	return nil
+}
+
+// Scan walks root, without crossing mounts, recording regular files having
+// more than one hard link and symbolic links resolving to regular files.
+// Unreadable directories are skipped, Scan stops early when ctx is done.
+func (idx *LinkIndex) Scan(ctx context.Context, root string) error {
+	rootSt, err := lstatPath(root)
+	if err != nil {
+		return &fs.PathError{Op: "lstat", Path: root, Err: err}
+	}
+
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if err != nil {
+			if entry != nil && entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		switch entry.Type() {
+		case fs.ModeDir:
+			if st, err := lstatPath(path); err == nil && st.Dev != rootSt.Dev {
+				return filepath.SkipDir
+			}
+		case fs.ModeSymlink:
+			if st, err := statPath(path); err == nil && st.IsRegular() {
+				idx.add(fileKey{dev: st.Dev, ino: st.Ino}, LinkName{Path: path, Symlink: true})
+			}
+		case 0:
+			if st, err := lstatPath(path); err == nil && st.Nlink > 1 {
+				idx.add(fileKey{dev: st.Dev, ino: st.Ino}, LinkName{Path: path})
+			}
+		}
+
+		return nil
+	})
+}
+
+// Links returns known names of the event file other than the event path,
+// sorted by path.
+func (idx *LinkIndex) Links(ev *EventMetadata) ([]LinkName, error) {
+	if ev.Fd < 0 {
+		return nil, nil
+	}
+
+	st, err := ev.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := ev.GetPath()
+	if err != nil {
+		return nil, err
+	}
+
+	key := fileKey{dev: st.Dev, ino: st.Ino}
+
+	idx.mu.Lock()
+	names := make([]LinkName, 0, len(idx.names[key]))
+
+	for name := range idx.names[key] {
+		names = append(names, name)
+	}
+	idx.mu.Unlock()
+
+	out := names[:0]
+
+	for _, name := range names {
+		if !name.refers(key) {
+			idx.remove(key, name)
+
+			continue
+		}
+
+		if name.Path != path || name.Symlink {
+			out = append(out, name)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Path < out[j].Path
+	})
+
+	return out, nil
+}
+
+// Forget drops all names, e.g. after a queue overflow.
+func (idx *LinkIndex) Forget() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.names = make(map[fileKey]map[LinkName]struct{})
+	idx.paths = make(map[LinkName]fileKey)
+}
+
+// Len returns the number of kept names.
+func (idx *LinkIndex) Len() int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return len(idx.paths)
+}
+
+// add records name under key, moving it from the file it named before.
+func (idx *LinkIndex) add(key fileKey, name LinkName) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if prev, ok := idx.paths[name]; ok {
+		if prev == key {
+			return
+		}
+
+		idx.unlink(prev, name)
+	}
+
+	if len(idx.paths) >= idx.max {
+		return
+	}
+
+	names, ok := idx.names[key]
+	if !ok {
+		names = make(map[LinkName]struct{})
+		idx.names[key] = names
+	}
+
+	names[name] = struct{}{}
+	idx.paths[name] = key
+}
+
+// remove drops name when it is still recorded under key.
+func (idx *LinkIndex) remove(key fileKey, name LinkName) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.paths[name] == key {
+		idx.unlink(key, name)
+	}
+}
+
+func (idx *LinkIndex) unlink(key fileKey, name LinkName) {
+	delete(idx.paths, name)
+	delete(idx.names[key], name)
+
+	if len(idx.names[key]) == 0 {
+		delete(idx.names, key)
+	}
+}
+
+// refers returns 'true' when name still resolves to the file of key.
+func (name LinkName) refers(key fileKey) bool {
+	var (
+		st  FileStat
+		err error
+	)
+
+	if name.Symlink {
+		st, err = statPath(name.Path)
+	} else {
+		st, err = lstatPath(name.Path)
+	}
+
+	return err == nil && (fileKey{dev: st.Dev, ino: st.Ino}) == key
+}
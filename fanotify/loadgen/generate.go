@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Operation kinds.
+const (
+	kindOpen   = "open"
+	kindWrite  = "write"
+	kindRename = "rename"
+)
+
+// tick is the pacing interval, operations due within one are issued
+// together.
+const tick = time.Millisecond
+
+// generator issues operations on its files at target rates.
+type generator struct {
+	dir     string
+	files   int
+	tracker *tracker
+
+	// writers are kept open, so that writes do not report opens
+	writers []*os.File
+	// renamed flips the names of rename files between ".a" and ".b", it is
+	// guarded by renameMu of the file
+	renamed  []bool
+	renameMu []sync.Mutex
+}
+
+// op is an operation on file of kind.
+type op struct {
+	kind string
+	file int
+}
+
+func newGenerator(dir string, files int, tracker *tracker) (*generator, error) {
+	g := &generator{
+		dir:      dir,
+		files:    files,
+		tracker:  tracker,
+		writers:  make([]*os.File, files),
+		renamed:  make([]bool, files),
+		renameMu: make([]sync.Mutex, files),
+	}
+
+	for i := 0; i < files; i++ {
+		for _, name := range []string{g.openName(i), g.renameName(i, false)} {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+				g.close()
+
+				return nil, err
+			}
+		}
+
+		f, err := os.OpenFile(filepath.Join(dir, g.writeName(i)), os.O_WRONLY|os.O_CREATE, 0o600)
+		if err != nil {
+			g.close()
+
+			return nil, fmt.Errorf("%w, writes keep one fd open per file", err)
+		}
+
+		g.writers[i] = f
+	}
+
+	return g, nil
+}
+
+func (g *generator) openName(i int) string  { return fmt.Sprintf("o%06d", i) }
+func (g *generator) writeName(i int) string { return fmt.Sprintf("w%06d", i) }
+
+func (g *generator) renameName(i int, b bool) string {
+	if b {
+		return fmt.Sprintf("r%06d.b", i)
+	}
+
+	return fmt.Sprintf("r%06d.a", i)
+}
+
+func (g *generator) close() {
+	for _, f := range g.writers {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// run issues operations with workers until ctx is done, rates are per
+// second by kind. Operations are dropped rather than queued when the
+// workers fall behind, so the achieved rates show the limit.
+func (g *generator) run(ctx context.Context, workers int, rates map[string]int) {
+	ops := make(chan op, workers*64)
+
+	var wg sync.WaitGroup
+
+	wg.Add(workers)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			for o := range ops {
+				g.do(o)
+			}
+		}()
+	}
+
+	start := time.Now()
+	issued := make(map[string]int, len(rates))
+	next := make(map[string]int, len(rates))
+
+	ticker := time.NewTicker(tick)
+
+	defer func() {
+		ticker.Stop()
+		close(ops)
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			elapsed := now.Sub(start)
+
+			for kind, rate := range rates {
+				due := int(elapsed.Seconds()*float64(rate)) - issued[kind]
+
+				for ; due > 0; due-- {
+					issued[kind]++
+
+					select {
+					case ops <- op{kind: kind, file: next[kind]}:
+					default:
+						// workers saturated
+					}
+
+					next[kind] = (next[kind] + 1) % g.files
+				}
+			}
+		}
+	}
+}
+
+// do issues o, the tracker expects its event before the syscall starts.
+func (g *generator) do(o op) {
+	var err error
+
+	switch o.kind {
+	case kindOpen:
+		name := g.openName(o.file)
+		mark := g.tracker.expect(o.kind, name)
+
+		var f *os.File
+		if f, err = os.Open(filepath.Join(g.dir, name)); err == nil {
+			f.Close()
+		}
+
+		g.tracker.issued(o.kind, mark, err)
+	case kindWrite:
+		mark := g.tracker.expect(o.kind, g.writeName(o.file))
+
+		_, err = g.writers[o.file].WriteAt([]byte{'x'}, 0)
+
+		g.tracker.issued(o.kind, mark, err)
+	case kindRename:
+		g.renameMu[o.file].Lock()
+		defer g.renameMu[o.file].Unlock()
+
+		b := g.renamed[o.file]
+		from, to := g.renameName(o.file, b), g.renameName(o.file, !b)
+		mark := g.tracker.expect(o.kind, to)
+
+		if err = os.Rename(filepath.Join(g.dir, from), filepath.Join(g.dir, to)); err == nil {
+			g.renamed[o.file] = !b
+		}
+
+		g.tracker.issued(o.kind, mark, err)
+	}
+}
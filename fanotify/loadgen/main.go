@@ -0,0 +1,139 @@
+// Command loadgen produces controlled filesystem activity and measures how
+// the fanotify package keeps up with it, to size agents for a workload.
+//
+// Opens, writes and renames are issued at target rates across -files files
+// per kind in a watched directory, while a reader receives their events
+// through the library, optionally spending -work on each one. Every event
+// is matched to the operations it reports, which gives the end-to-end
+// latency from the operation to the read of its event. Operations the
+// kernel merged into one event are counted as coalesced, operations still
+// without an event -drain after the run as lost, and queue overflows are
+// reported. An event accounts all operations issued before it was read, so
+// a later event for the same operations is counted as redundant. Needs
+// CAP_SYS_ADMIN.
+//
+//	go run ./loadgen -duration 10s -opens 5000 -writes 5000 -renames 500
+//	go run ./loadgen -work 200us -json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// config is the load description.
+type config struct {
+	Dir       string        `json:"dir"`
+	Files     int           `json:"files"`
+	Duration  time.Duration `json:"duration"`
+	Opens     int           `json:"opens_per_sec"`
+	Writes    int           `json:"writes_per_sec"`
+	Renames   int           `json:"renames_per_sec"`
+	Workers   int           `json:"workers"`
+	Work      time.Duration `json:"work"`
+	Drain     time.Duration `json:"drain"`
+	Unlimited bool          `json:"unlimited_queue"`
+}
+
+// kindReport are the results for one operation kind.
+type kindReport struct {
+	Ops       uint64  `json:"ops"`
+	Rate      float64 `json:"ops_per_sec"`
+	Failed    uint64  `json:"failed"`
+	Delivered uint64  `json:"delivered"`
+	Coalesced uint64  `json:"coalesced"`
+	Lost      uint64  `json:"lost"`
+	// LostRate is Lost per issued operation.
+	LostRate float64       `json:"lost_rate"`
+	P50      time.Duration `json:"p50"`
+	P90      time.Duration `json:"p90"`
+	P99      time.Duration `json:"p99"`
+	Max      time.Duration `json:"max"`
+}
+
+// report are the results of a run.
+type report struct {
+	Config    config                `json:"config"`
+	Kinds     map[string]kindReport `json:"kinds"`
+	Events    uint64                `json:"events"`
+	Redundant uint64                `json:"redundant"`
+	Overflows uint64                `json:"overflows"`
+}
+
+func main() {
+	var cfg config
+
+	flag.StringVar(&cfg.Dir, "dir", "", "directory to create the files in, a temporary one when empty")
+	flag.IntVar(&cfg.Files, "files", 100, "number of files per operation kind")
+	flag.DurationVar(&cfg.Duration, "duration", 10*time.Second, "load duration")
+	flag.IntVar(&cfg.Opens, "opens", 1000, "target opens per second")
+	flag.IntVar(&cfg.Writes, "writes", 1000, "target writes per second")
+	flag.IntVar(&cfg.Renames, "renames", 100, "target renames per second")
+	flag.IntVar(&cfg.Workers, "workers", 4, "number of goroutines issuing operations")
+	flag.DurationVar(&cfg.Work, "work", 0, "busy time the reader spends on every event, models agent processing")
+	flag.DurationVar(&cfg.Drain, "drain", time.Second, "time to wait for late events after the load")
+	flag.BoolVar(&cfg.Unlimited, "unlimited-queue", false, "initialize the group with FAN_UNLIMITED_QUEUE")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+
+	flag.Parse()
+
+	if cfg.Files <= 0 || cfg.Workers <= 0 || cfg.Duration <= 0 {
+		log.Fatalf("-files, -workers and -duration must be positive\n")
+	}
+
+	if cfg.Dir == "" {
+		dir, err := os.MkdirTemp("", "loadgen")
+		if err != nil {
+			log.Fatalf("%v\n", err)
+		}
+		defer os.RemoveAll(dir)
+
+		cfg.Dir = dir
+	}
+
+	rep, err := run(cfg)
+	if err != nil {
+		log.Fatalf("%v\n", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(rep); err != nil {
+			log.Fatalf("%v\n", err)
+		}
+
+		return
+	}
+
+	rep.print()
+}
+
+func (rep report) print() {
+	names := make([]string, 0, len(rep.Kinds))
+	for name := range rep.Kinds {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Printf("%-8s %9s %10s %8s %10s %10s %8s %7s %10s %10s %10s %10s\n",
+		"kind", "ops", "ops/s", "failed", "delivered", "coalesced", "lost", "lost%", "p50", "p90", "p99", "max")
+
+	for _, name := range names {
+		k := rep.Kinds[name]
+
+		fmt.Printf("%-8s %9d %10.0f %8d %10d %10d %8d %6.2f%% %10v %10v %10v %10v\n",
+			name, k.Ops, k.Rate, k.Failed, k.Delivered, k.Coalesced, k.Lost, k.LostRate*100,
+			k.P50.Round(time.Microsecond), k.P90.Round(time.Microsecond),
+			k.P99.Round(time.Microsecond), k.Max.Round(time.Microsecond))
+	}
+
+	fmt.Printf("events %d, redundant %d, queue overflows %d\n", rep.Events, rep.Redundant, rep.Overflows)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// eventKinds maps event bits to the operation kind they report.
+var eventKinds = []struct {
+	mask uint64
+	kind string
+}{
+	{fanotify.FAN_OPEN, kindOpen},
+	{fanotify.FAN_MODIFY, kindWrite},
+	{fanotify.FAN_MOVED_TO, kindRename},
+}
+
+// pendingKey is an operation kind on a file name.
+type pendingKey struct {
+	kind string
+	name string
+}
+
+// pendingOp is an operation waiting for its event.
+type pendingOp struct {
+	at     time.Time
+	failed bool
+}
+
+// kindStats are the counters of one operation kind.
+type kindStats struct {
+	ops, failed, delivered, coalesced uint64
+	latencies                         []time.Duration
+}
+
+// tracker matches events to the operations they report.
+type tracker struct {
+	mu      sync.Mutex
+	pending map[pendingKey][]*pendingOp
+	kinds   map[string]*kindStats
+
+	// redundant are events without pending operations, an earlier event
+	// read after the operations were issued already accounted them
+	events, redundant, overflows uint64
+}
+
+func newTracker() *tracker {
+	return &tracker{
+		pending: make(map[pendingKey][]*pendingOp),
+		kinds: map[string]*kindStats{
+			kindOpen:   {},
+			kindWrite:  {},
+			kindRename: {},
+		},
+	}
+}
+
+// expect registers an operation of kind on name that is about to be
+// issued, the returned mark is passed to issued.
+func (t *tracker) expect(kind, name string) *pendingOp {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := &pendingOp{at: time.Now()}
+	key := pendingKey{kind, name}
+	t.pending[key] = append(t.pending[key], p)
+
+	return p
+}
+
+// issued accounts an operation, a failed one reports no event.
+func (t *tracker) issued(kind string, p *pendingOp, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := t.kinds[kind]
+	stats.ops++
+
+	if err != nil {
+		p.failed = true
+		stats.failed++
+	}
+}
+
+// deliver accounts an event of kind for name read at, it reports all
+// operations pending for them, more than one were merged by the kernel.
+func (t *tracker) deliver(kind, name string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := pendingKey{kind, name}
+	stats := t.kinds[kind]
+
+	var n uint64
+
+	rest := t.pending[key][:0]
+
+	for _, p := range t.pending[key] {
+		switch {
+		case p.failed:
+		case p.at.After(at):
+			// issued after the event was read, it waits for the next one
+			rest = append(rest, p)
+		default:
+			stats.latencies = append(stats.latencies, at.Sub(p.at))
+			n++
+		}
+	}
+
+	if len(rest) == 0 {
+		delete(t.pending, key)
+	} else {
+		t.pending[key] = rest
+	}
+
+	if n == 0 {
+		t.redundant++
+
+		return
+	}
+
+	stats.delivered++
+	stats.coalesced += n - 1
+}
+
+func (t *tracker) handle(ev *fanotify.EventMetadata) {
+	at := time.Now()
+
+	t.mu.Lock()
+	t.events++
+
+	if ev.Mask&fanotify.FAN_Q_OVERFLOW != 0 {
+		t.overflows++
+		t.mu.Unlock()
+
+		return
+	}
+
+	t.mu.Unlock()
+
+	var name string
+
+	ev.EachInfoRecord(func(record fanotify.InfoRecord) bool {
+		_, n, ok := record.FID()
+		if ok && n != "" {
+			name = n
+
+			return false
+		}
+
+		return true
+	})
+
+	for _, k := range eventKinds {
+		if ev.Mask&k.mask != 0 {
+			t.deliver(k.kind, name, at)
+		}
+	}
+}
+
+// report returns the results, operations still pending are lost.
+func (t *tracker) report(cfg config, elapsed time.Duration) report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rep := report{
+		Config:    cfg,
+		Kinds:     make(map[string]kindReport, len(t.kinds)),
+		Events:    t.events,
+		Redundant: t.redundant,
+		Overflows: t.overflows,
+	}
+
+	lost := make(map[string]uint64, len(t.kinds))
+
+	for key, ops := range t.pending {
+		for _, p := range ops {
+			if !p.failed {
+				lost[key.kind]++
+			}
+		}
+	}
+
+	for kind, stats := range t.kinds {
+		k := kindReport{
+			Ops:       stats.ops,
+			Rate:      float64(stats.ops) / elapsed.Seconds(),
+			Failed:    stats.failed,
+			Delivered: stats.delivered,
+			Coalesced: stats.coalesced,
+			Lost:      lost[kind],
+		}
+
+		if stats.ops > 0 {
+			k.LostRate = float64(k.Lost) / float64(stats.ops)
+		}
+
+		if n := len(stats.latencies); n > 0 {
+			sorted := append([]time.Duration(nil), stats.latencies...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+			k.P50 = sorted[(n-1)*50/100]
+			k.P90 = sorted[(n-1)*90/100]
+			k.P99 = sorted[(n-1)*99/100]
+			k.Max = sorted[n-1]
+		}
+
+		rep.Kinds[kind] = k
+	}
+
+	return rep
+}
+
+// run generates the load of cfg and measures its events.
+func run(cfg config) (report, error) {
+	flags := fanotify.InitFlags(fanotify.FAN_CLASS_NOTIF | fanotify.FAN_CLOEXEC | fanotify.FAN_NONBLOCK |
+		fanotify.FAN_REPORT_DFID_NAME)
+
+	if cfg.Unlimited {
+		flags |= fanotify.FAN_UNLIMITED_QUEUE
+	}
+
+	notify, err := fanotify.Initialize(flags, os.O_RDONLY)
+	if err != nil {
+		return report{}, err
+	}
+	defer notify.Close()
+
+	tracker := newTracker()
+
+	gen, err := newGenerator(cfg.Dir, cfg.Files, tracker)
+	if err != nil {
+		return report{}, err
+	}
+	defer gen.close()
+
+	mask := fanotify.EventMask(fanotify.FAN_OPEN | fanotify.FAN_MODIFY | fanotify.FAN_MOVED_TO | fanotify.FAN_EVENT_ON_CHILD)
+
+	if err := notify.Mark(fanotify.FAN_MARK_ADD, mask, fanotify.AT_FDCWD, cfg.Dir); err != nil {
+		return report{}, err
+	}
+
+	notify.On(fanotify.FAN_OPEN|fanotify.FAN_MODIFY|fanotify.FAN_MOVED_TO|fanotify.FAN_Q_OVERFLOW,
+		func(ev *fanotify.EventMetadata) {
+			tracker.handle(ev)
+
+			// busy wait, sleeping would not model CPU bound processing
+			for start := time.Now(); time.Since(start) < cfg.Work; {
+			}
+		})
+
+	readCtx, stopReading := context.WithCancel(context.Background())
+	readErr := make(chan error, 1)
+
+	go func() {
+		readErr <- notify.Run(readCtx)
+	}()
+
+	loadCtx, stopLoad := context.WithTimeout(context.Background(), cfg.Duration)
+	defer stopLoad()
+
+	start := time.Now()
+
+	gen.run(loadCtx, cfg.Workers, map[string]int{
+		kindOpen:   cfg.Opens,
+		kindWrite:  cfg.Writes,
+		kindRename: cfg.Renames,
+	})
+
+	elapsed := time.Since(start)
+
+	time.Sleep(cfg.Drain)
+	stopReading()
+
+	if err := <-readErr; err != nil && !errors.Is(err, context.Canceled) {
+		return report{}, err
+	}
+
+	return tracker.report(cfg, elapsed), nil
+}
@@ -0,0 +1,337 @@
+package fanotify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// SourcedEvent is an event, or a read error, tagged with the name of the
+// NotifyFD it came from. The receiver owns Event and must Close it.
+type SourcedEvent struct {
+	Source string
+	Event  *EventMetadata
+	Err    error
+}
+
+// defaultQueueSize is the default Manager queue of notification events.
+const defaultQueueSize = 1024
+
+// ManagerOption configures a Manager created by NewManager.
+type ManagerOption func(*Manager)
+
+// WithQueueSize sets how many notification events are queued ahead of the
+// consumer, permission events are never queued behind them.
+func WithQueueSize(n int) ManagerOption {
+	return func(m *Manager) {
+		m.normal = make(chan SourcedEvent, n)
+	}
+}
+
+// Manager owns several NotifyFD instances with distinct configurations
+// (e.g. a notification and a permission group, or FID and fd based groups)
+// and merges their events into one stream.
+//
+// Events are merged through two lanes: permission events bypass queued
+// notification events, so that they are answered quickly regardless of a
+// notification backlog.
+type Manager struct {
+	mu        sync.Mutex
+	names     []string
+	instances map[string]*NotifyFD
+	events    chan SourcedEvent
+	running   bool
+
+	perm   chan SourcedEvent
+	normal chan SourcedEvent
+
+	delivered uint64
+	dropped   uint64
+	life      lifecycle
+}
+
+// NewManager returns an empty Manager.
+func NewManager(opts ...ManagerOption) *Manager {
+	m := &Manager{
+		instances: make(map[string]*NotifyFD),
+		events:    make(chan SourcedEvent),
+		perm:      make(chan SourcedEvent),
+		normal:    make(chan SourcedEvent, defaultQueueSize),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Add registers notify under name, instances must be added before Run and
+// should be initialized with FAN_NONBLOCK so that Run can be interrupted.
+func (m *Manager) Add(name string, notify *NotifyFD) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return fmt.Errorf("fanotify: manager error, %q added while running", name)
+	}
+
+	if _, ok := m.instances[name]; ok {
+		return fmt.Errorf("fanotify: manager error, %q already added", name)
+	}
+
+	m.names = append(m.names, name)
+	m.instances[name] = notify
+
+	return nil
+}
+
+// Get returns instance registered under name, or nil.
+func (m *Manager) Get(name string) *NotifyFD {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.instances[name]
+}
+
+// Names returns names of all instances in the order they were added.
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.names...)
+}
+
+// Events returns the merged stream, it is closed when Run returns.
+func (m *Manager) Events() <-chan SourcedEvent {
+	return m.events
+}
+
+// Run reads all instances concurrently until ctx is done, forwarding events
+// to Events. A read error is forwarded once and stops reading that instance.
+func (m *Manager) Run(ctx context.Context) error {
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+
+		return fmt.Errorf("fanotify: manager error, already running")
+	}
+
+	m.running = true
+	names := append([]string(nil), m.names...)
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+
+	for _, name := range names {
+		wg.Add(1)
+
+		go func(name string, notify *NotifyFD) {
+			defer wg.Done()
+
+			m.read(ctx, name, notify)
+		}(name, m.Get(name))
+	}
+
+	forwarded := make(chan struct{})
+
+	go func() {
+		defer close(forwarded)
+
+		m.forward(ctx)
+	}()
+
+	wg.Wait()
+	close(m.perm)
+	close(m.normal)
+	<-forwarded
+
+	m.drop()
+	close(m.events)
+
+	return ctx.Err()
+}
+
+// Start runs Run on a goroutine owned by the Manager, until Stop is called
+// or ctx is done.
+func (m *Manager) Start(ctx context.Context) error {
+	return m.life.start(ctx, m.Run)
+}
+
+// Stop stops a started Manager and waits for its goroutines to exit, it
+// returns the Run error, nil when stopped by Stop or ctx. Once Stop returns
+// Events is closed, nothing is sent anymore and every event read was either
+// delivered or dropped, see Delivered and Dropped.
+func (m *Manager) Stop() error {
+	return m.life.stop()
+}
+
+// Done returns a channel closed once a started Manager exited.
+func (m *Manager) Done() <-chan struct{} {
+	return m.life.wait()
+}
+
+// Delivered returns the number of events sent to Events.
+func (m *Manager) Delivered() uint64 {
+	return atomic.LoadUint64(&m.delivered)
+}
+
+// Dropped returns the number of events read but never delivered because of
+// shutdown, permission events among them were allowed.
+func (m *Manager) Dropped() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
+// lane returns the lane for event.
+func (m *Manager) lane(ev *EventMetadata) chan SourcedEvent {
+	if ev != nil && ev.IsPermission() {
+		return m.perm
+	}
+
+	return m.normal
+}
+
+// forward moves events from the lanes to Events until both lanes are closed
+// or ctx is done, taking permission events first.
+func (m *Manager) forward(ctx context.Context) {
+	perm, normal := m.perm, m.normal
+
+	for perm != nil || normal != nil {
+		select {
+		case ev, ok := <-perm:
+			if !ok {
+				perm = nil
+
+				continue
+			}
+
+			if !m.send(ctx, ev) {
+				return
+			}
+
+			continue
+		default:
+		}
+
+		select {
+		case ev, ok := <-perm:
+			if !ok {
+				perm = nil
+
+				continue
+			}
+
+			if !m.send(ctx, ev) {
+				return
+			}
+		case ev, ok := <-normal:
+			if !ok {
+				normal = nil
+
+				continue
+			}
+
+			if !m.send(ctx, ev) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// send passes ev to Events, it returns 'false' when ctx is done first.
+func (m *Manager) send(ctx context.Context, ev SourcedEvent) bool {
+	select {
+	case m.events <- ev:
+		if ev.Event != nil {
+			atomic.AddUint64(&m.delivered, 1)
+		}
+
+		return true
+	case <-ctx.Done():
+		m.release(ev)
+
+		return false
+	}
+}
+
+// drop releases events left in the closed lanes.
+func (m *Manager) drop() {
+	for ev := range m.perm {
+		m.release(ev)
+	}
+
+	for ev := range m.normal {
+		m.release(ev)
+	}
+}
+
+// release drops an event that was never delivered, permission events are
+// allowed so that the process is not left blocked.
+func (m *Manager) release(ev SourcedEvent) {
+	if ev.Event == nil {
+		return
+	}
+
+	atomic.AddUint64(&m.dropped, 1)
+
+	if notify := m.Get(ev.Source); notify != nil {
+		_ = notify.skip(ev.Event)
+
+		return
+	}
+
+	_ = ev.Event.Close()
+}
+
+func (m *Manager) read(ctx context.Context, name string, notify *NotifyFD) {
+	stop := interruptOnDone(ctx, notify.File, nil)
+	defer stop()
+
+	for {
+		ev, err := notify.WaitEvent()
+		if ctx.Err() != nil {
+			m.release(SourcedEvent{Source: name, Event: ev})
+
+			return
+		}
+
+		select {
+		case m.lane(ev) <- SourcedEvent{Source: name, Event: ev, Err: err}:
+		case <-ctx.Done():
+			m.release(SourcedEvent{Source: name, Event: ev})
+
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// RemarkAll re-applies recorded marks on every instance.
+func (m *Manager) RemarkAll() error {
+	for _, name := range m.Names() {
+		if err := m.Get(name).Remark(); err != nil {
+			return fmt.Errorf("fanotify: manager error, %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// CloseAll closes every instance, returning the first error.
+func (m *Manager) CloseAll() error {
+	var err error
+
+	for _, name := range m.Names() {
+		if e := m.Get(name).Close(); e != nil && err == nil {
+			err = fmt.Errorf("fanotify: manager error, %s: %w", name, e)
+		}
+	}
+
+	return err
+}
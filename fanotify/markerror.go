@@ -0,0 +1,80 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"syscall"
+)
+
+// MarkError is returned by Mark, MarkFd and MarkPathSecure when the kernel
+// rejects a mark, it wraps the errno and carries a remediation hint.
+type MarkError struct {
+	// Path is the marked path, empty for marks set through an fd.
+	Path string
+	// Fd is the dirfd or marked fd.
+	Fd    int
+	Flags MarkFlags
+	Mask  EventMask
+	Err   error
+}
+
+// Error implements error.
+func (err *MarkError) Error() string {
+	target := err.Path
+	if target == "" {
+		target = "fd " + strconv.Itoa(err.Fd)
+	}
+
+	msg := fmt.Sprintf("fanotify: mark error, %s (flags %#x, mask %s): %v", target, uint(err.Flags), err.Mask, err.Err)
+
+	if hint := err.Hint(); hint != "" {
+		msg += ", " + hint
+	}
+
+	return msg
+}
+
+// Unwrap returns the underlying error, usually an unix.Errno.
+func (err *MarkError) Unwrap() error {
+	return err.Err
+}
+
+// Hint returns guidance for common causes of the errno, or "".
+func (err *MarkError) Hint() string {
+	var errno syscall.Errno
+
+	if !errors.As(err.Err, &errno) {
+		return ""
+	}
+
+	switch errno {
+	case syscall.ENOSPC:
+		return "marks limit reached, raise fs.fanotify.max_user_marks or initialize with FAN_UNLIMITED_MARKS"
+	case syscall.EPERM:
+		return "missing CAP_SYS_ADMIN, unprivileged groups support inode marks and notification events only"
+	case syscall.EINVAL:
+		if err.Flags&(FAN_MARK_MOUNT|FAN_MARK_FILESYSTEM) != 0 {
+			return "mask incompatible with mark type or group, e.g. directory entry events on a mount mark or without FAN_REPORT_FID"
+		}
+
+		return "mask or flags incompatible with the group or kernel, e.g. FID events without FAN_REPORT_FID"
+	case syscall.EXDEV:
+		return "filesystem object not usable for this mark type, e.g. a subvolume or overlayfs path with FID reporting"
+	case syscall.ENODEV, syscall.EOPNOTSUPP:
+		return "filesystem does not support the file handles required by FID reporting"
+	case syscall.ENOENT:
+		return "path does not exist"
+	case syscall.ENOTDIR:
+		return "FAN_MARK_ONLYDIR given for a non-directory"
+	case syscall.EEXIST:
+		return "FAN_MARK_EVICTABLE conflicts with an existing non-evictable mark"
+	}
+
+	return ""
+}
+
+// markError wraps a fanotify_mark error.
+func markError(flags MarkFlags, mask EventMask, fd int, path string, err error) error {
+	return &MarkError{Path: path, Fd: fd, Flags: flags, Mask: mask, Err: err}
+}
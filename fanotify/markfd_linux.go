@@ -0,0 +1,61 @@
+package fanotify
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// fdObject returns the file fd refers to, fd can be an O_PATH fd, e.g. of
+// open_tree(2) or fsmount(2).
+func fdObject(fd int) (fileObject, error) {
+	return statxObject(fd, "", unix.AT_EMPTY_PATH)
+}
+
+// pathObject returns the file path refers to, without following a final
+// symlink.
+func pathObject(path string) (fileObject, error) {
+	return statxObject(unix.AT_FDCWD, path, 0)
+}
+
+func statxObject(dirFd int, path string, flags int) (fileObject, error) {
+	obj, _, err := statxFile(dirFd, path, flags)
+
+	return obj, err
+}
+
+// statxFile returns the file path refers to and its statx data, with the
+// type and link count.
+func statxFile(dirFd int, path string, flags int) (fileObject, *unix.Statx_t, error) {
+	var st unix.Statx_t
+
+	mask := unix.STATX_TYPE | unix.STATX_NLINK | unix.STATX_INO | unix.STATX_MNT_ID
+
+	if err := unix.Statx(dirFd, path, flags|unix.AT_SYMLINK_NOFOLLOW, mask, &st); err != nil {
+		return fileObject{}, nil, fmt.Errorf("fanotify: statx error, %w", err)
+	}
+
+	obj := fileObject{
+		dev: unix.Mkdev(st.Dev_major, st.Dev_minor),
+		ino: st.Ino,
+	}
+
+	// STATX_MNT_ID needs kernel 5.8+
+	if st.Mask&unix.STATX_MNT_ID != 0 {
+		obj.mnt = st.Mnt_id
+	}
+
+	return obj, &st, nil
+}
+
+// pathKey returns the batch path cache key of fd, shared is 'false' for
+// files the key does not give one path for, non-directories with several
+// hard links.
+func pathKey(fd int) (key fileObject, shared bool, err error) {
+	key, st, err := statxFile(fd, "", unix.AT_EMPTY_PATH)
+	if err != nil {
+		return key, false, err
+	}
+
+	return key, st.Mode&unix.S_IFMT == unix.S_IFDIR || st.Nlink <= 1, nil
+}
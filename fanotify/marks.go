@@ -0,0 +1,221 @@
+package fanotify
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Mark flags that describe a mark rather than the operation on it.
+const markSpecFlags = FAN_MARK_MOUNT | FAN_MARK_FILESYSTEM |
+	FAN_MARK_IGNORED_MASK | FAN_MARK_IGNORE | FAN_MARK_IGNORED_SURV_MODIFY |
+	FAN_MARK_ONLYDIR | FAN_MARK_DONT_FOLLOW
+
+// Mark flags that select mark type.
+const markTypeFlags = FAN_MARK_MOUNT | FAN_MARK_FILESYSTEM
+
+// Mark flags that select the ignore mask of a mark.
+const markIgnoreFlags = FAN_MARK_IGNORED_MASK | FAN_MARK_IGNORE
+
+// MarkSpec describes a mark currently applied through NotifyFD.
+type MarkSpec struct {
+	// Flags are fanotify_mark flags without FAN_MARK_ADD/REMOVE/FLUSH.
+	Flags MarkFlags
+	Mask  EventMask
+	DirFd int
+	Path  string
+}
+
+// AT_FDCWD is the DirFd of Mark resolving Path from the working directory,
+// mirroring unix.AT_FDCWD so that callers build on every platform.
+const AT_FDCWD = -0x64
+
+// fileObject identifies a file by mount, device and inode, files of a
+// detached mount differ from the same files reached through a path.
+type fileObject struct {
+	mnt uint64
+	dev uint64
+	ino uint64
+}
+
+func (spec MarkSpec) same(other MarkSpec) bool {
+	return spec.Flags&(markTypeFlags|markIgnoreFlags) ==
+		other.Flags&(markTypeFlags|markIgnoreFlags) &&
+		spec.DirFd == other.DirFd && spec.Path == other.Path
+}
+
+// recordMark keeps track of applied marks, so they can be re-applied.
+func (handle *NotifyFD) recordMark(flags MarkFlags, mask EventMask, dirFd int, path string) {
+	handle.marksMu.Lock()
+	defer handle.marksMu.Unlock()
+
+	handle.recordMarkLocked(flags, mask, dirFd, path)
+}
+
+// recordMarkLocked records a mark and closes owned fds no longer recorded,
+// handle.marksMu is held.
+func (handle *NotifyFD) recordMarkLocked(flags MarkFlags, mask EventMask, dirFd int, path string) {
+	defer handle.releaseMarkFdsLocked()
+
+	spec := MarkSpec{
+		Flags: flags & markSpecFlags,
+		Mask:  mask,
+		DirFd: dirFd,
+		Path:  path,
+	}
+
+	switch {
+	case flags&FAN_MARK_FLUSH != 0:
+		out := handle.marks[:0]
+
+		for _, v := range handle.marks {
+			if v.Flags&markTypeFlags != spec.Flags&markTypeFlags {
+				out = append(out, v)
+			}
+		}
+
+		handle.marks = out
+	case flags&FAN_MARK_REMOVE != 0:
+		for i := range handle.marks {
+			if !handle.marks[i].same(spec) {
+				continue
+			}
+
+			handle.marks[i].Mask &^= mask
+
+			if handle.marks[i].Mask == 0 {
+				handle.marks = append(handle.marks[:i], handle.marks[i+1:]...)
+			}
+
+			return
+		}
+	case flags&FAN_MARK_ADD != 0:
+		for i := range handle.marks {
+			if handle.marks[i].same(spec) {
+				handle.marks[i].Flags |= spec.Flags
+				handle.marks[i].Mask |= mask
+
+				return
+			}
+		}
+
+		handle.marks = append(handle.marks, spec)
+	}
+}
+
+// recordMarkFd records a mark applied by fd under the path the fd refers to.
+// Objects without such a path, e.g. on a detached mount of open_tree(2) or
+// fsmount(2), in another mount namespace or deleted, are recorded by a
+// duplicate of fd owned by the handle.
+func (handle *NotifyFD) recordMarkFd(flags MarkFlags, mask EventMask, fd int) {
+	obj, err := fdObject(fd)
+	if err != nil {
+		return
+	}
+
+	path, err := os.Readlink(filepath.Join(ProcFsFd, strconv.Itoa(fd)))
+	if err == nil {
+		if other, err := pathObject(path); err == nil && other == obj {
+			handle.recordMark(flags, mask, AT_FDCWD, path)
+
+			return
+		}
+	}
+
+	handle.marksMu.Lock()
+	defer handle.marksMu.Unlock()
+
+	owned := -1
+
+	for dup, other := range handle.markFds {
+		if other == obj {
+			owned = dup
+
+			break
+		}
+	}
+
+	if owned < 0 {
+		if flags&FAN_MARK_ADD == 0 {
+			return
+		}
+
+		owned, err = sysDupCloexec(fd)
+		if err != nil {
+			return
+		}
+
+		if handle.markFds == nil {
+			handle.markFds = make(map[int]fileObject)
+		}
+
+		handle.markFds[owned] = obj
+	}
+
+	handle.recordMarkLocked(flags, mask, owned, "")
+}
+
+// releaseMarkFdsLocked closes owned fds no longer recorded, handle.marksMu
+// is held.
+func (handle *NotifyFD) releaseMarkFdsLocked() {
+	for fd := range handle.markFds {
+		recorded := false
+
+		for _, spec := range handle.marks {
+			if spec.DirFd == fd && spec.Path == "" {
+				recorded = true
+
+				break
+			}
+		}
+
+		if !recorded {
+			_ = sysClose(fd)
+			delete(handle.markFds, fd)
+		}
+	}
+}
+
+// closeMarkFds closes all owned fds and drops the marks recorded by them.
+func (handle *NotifyFD) closeMarkFds() {
+	handle.marksMu.Lock()
+	defer handle.marksMu.Unlock()
+
+	if len(handle.markFds) == 0 {
+		return
+	}
+
+	out := handle.marks[:0]
+
+	for _, spec := range handle.marks {
+		if _, ok := handle.markFds[spec.DirFd]; !ok || spec.Path != "" {
+			out = append(out, spec)
+		}
+	}
+
+	handle.marks = out
+	handle.releaseMarkFdsLocked()
+}
+
+// Marks returns marks currently applied through Mark, MarkFd and
+// MarkPathSecure. Marks applied by fd are recorded by their path, or when
+// the fd does not resolve to the same object by path, e.g. on a detached
+// mount, by a duplicate fd with an empty Path, owned by the handle and valid
+// until the mark is removed or the handle is closed.
+func (handle *NotifyFD) Marks() []MarkSpec {
+	handle.marksMu.Lock()
+	defer handle.marksMu.Unlock()
+
+	return append([]MarkSpec(nil), handle.marks...)
+}
+
+// Remark re-applies all recorded marks, e.g. after a kernel queue overflow.
+func (handle *NotifyFD) Remark() error {
+	for _, spec := range handle.Marks() {
+		if err := handle.Mark(FAN_MARK_ADD|spec.Flags, spec.Mask, spec.DirFd, spec.Path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
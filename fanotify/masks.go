@@ -0,0 +1,126 @@
+package fanotify
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maskNames names every event bit, lowest bit first, names are the FAN_*
+// constants without prefix in lower case.
+var maskNames = []struct {
+	bit  EventMask
+	name string
+}{
+	{FAN_ACCESS, "access"},
+	{FAN_MODIFY, "modify"},
+	{FAN_ATTRIB, "attrib"},
+	{FAN_CLOSE_WRITE, "close_write"},
+	{FAN_CLOSE_NOWRITE, "close_nowrite"},
+	{FAN_OPEN, "open"},
+	{FAN_MOVED_FROM, "moved_from"},
+	{FAN_MOVED_TO, "moved_to"},
+	{FAN_CREATE, "create"},
+	{FAN_DELETE, "delete"},
+	{FAN_DELETE_SELF, "delete_self"},
+	{FAN_MOVE_SELF, "move_self"},
+	{FAN_OPEN_EXEC, "open_exec"},
+	{FAN_Q_OVERFLOW, "q_overflow"},
+	{FAN_FS_ERROR, "fs_error"},
+	{FAN_OPEN_PERM, "open_perm"},
+	{FAN_ACCESS_PERM, "access_perm"},
+	{FAN_OPEN_EXEC_PERM, "open_exec_perm"},
+	{FAN_PRE_ACCESS, "pre_access"},
+	{FAN_MNT_ATTACH, "mnt_attach"},
+	{FAN_MNT_DETACH, "mnt_detach"},
+	{FAN_EVENT_ON_CHILD, "event_on_child"},
+	{FAN_RENAME, "rename"},
+	{FAN_ONDIR, "ondir"},
+}
+
+// maskAliases are names of multi bit masks accepted by ParseMask.
+var maskAliases = map[string]EventMask{
+	"close": FAN_CLOSE,
+	"move":  FAN_MOVE,
+}
+
+// EventNames returns all names accepted by ParseMask, single bits in bit
+// order followed by "close" and "move".
+func EventNames() []string {
+	out := make([]string, 0, len(maskNames)+len(maskAliases))
+
+	for _, v := range maskNames {
+		out = append(out, v.name)
+	}
+
+	return append(out, "close", "move")
+}
+
+// ParseMask parses a comma separated list of event names, as returned by
+// EventNames, e.g. "modify,close_write,ondir". Names are case insensitive,
+// numbers such as "0x2" are taken as raw bits.
+func ParseMask(s string) (EventMask, error) {
+	var mask EventMask
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		bits, ok := lookupMask(name)
+		if !ok {
+			return 0, fmt.Errorf("fanotify: mask error, unknown event %q", name)
+		}
+
+		mask |= bits
+	}
+
+	return mask, nil
+}
+
+func lookupMask(name string) (EventMask, bool) {
+	if bits, ok := maskAliases[name]; ok {
+		return bits, true
+	}
+
+	for _, v := range maskNames {
+		if v.name == name {
+			return v.bit, true
+		}
+	}
+
+	if bits, err := strconv.ParseUint(name, 0, 64); err == nil {
+		return EventMask(bits), true
+	}
+
+	return 0, false
+}
+
+// MaskNames returns names of bits set in mask, lowest bit first, remaining
+// unknown bits are returned as one hex number.
+func MaskNames(mask EventMask) []string {
+	var out []string
+
+	for _, v := range maskNames {
+		if mask&v.bit != 0 {
+			out = append(out, v.name)
+			mask &^= v.bit
+		}
+	}
+
+	if mask != 0 {
+		out = append(out, fmt.Sprintf("%#x", uint64(mask)))
+	}
+
+	return out
+}
+
+// String returns mask as "modify,close_write", which ParseMask accepts.
+func (m EventMask) String() string {
+	if m == 0 {
+		return "0"
+	}
+
+	return strings.Join(MaskNames(m), ",")
+}
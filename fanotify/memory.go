@@ -0,0 +1,88 @@
+package fanotify
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// MemoryLimits are hard caps on memory the library holds for an agent, for
+// deployments on memory-constrained devices. Every cap drops
+// deterministically once reached and counts what it dropped, so that usage
+// stays constant under any event rate.
+//
+// WithMemoryLimits enforces the caps of the NotifyFD itself, the other
+// fields are meant to be passed to the constructors named below, with the
+// drop policy and counter they document.
+type MemoryLimits struct {
+	// DenyWorkers caps OnDeny action runs in flight, further denied events
+	// skip their actions, see NotifyFD.Drops.
+	DenyWorkers int
+	// Queue is the Manager queue, see WithQueueSize and Manager.Dropped, and
+	// the export client buffer, see export.Server.ClientBuffer.
+	Queue int
+	// Cache caps entries of NewDecisionCache and NewDirDiffer, which evict
+	// least recently used entries, and of NewLinkIndex, which ignores new
+	// names.
+	Cache int
+	// Stats caps distinct processes and paths of NewLimitedStats, events of
+	// new ones are only counted in total, see Stats.Dropped.
+	Stats int
+}
+
+// EdgeMemoryLimits keep library memory in the low megabytes.
+var EdgeMemoryLimits = MemoryLimits{
+	DenyWorkers: 2,
+	Queue:       256,
+	Cache:       512,
+	Stats:       256,
+}
+
+// DropCounts are events a NotifyFD dropped work for to stay within
+// MemoryLimits.
+type DropCounts struct {
+	// DenyActions are denied events OnDeny actions were skipped for.
+	DenyActions uint64
+}
+
+// WithMemoryLimits enforces limits for the handle. Initialize fails for
+// FAN_UNLIMITED_QUEUE and FAN_UNLIMITED_MARKS groups, as the kernel charges
+// queued events and marks to the memory of the agent.
+func WithMemoryLimits(limits MemoryLimits) Option {
+	return func(handle *NotifyFD) {
+		handle.memoryLimits = &limits
+
+		if limits.DenyWorkers > 0 {
+			handle.denySlots = make(chan struct{}, limits.DenyWorkers)
+		}
+	}
+}
+
+// checkMemoryLimits rejects init flags lifting kernel caps under
+// WithMemoryLimits.
+func (handle *NotifyFD) checkMemoryLimits() error {
+	if handle.memoryLimits == nil {
+		return nil
+	}
+
+	if flags := handle.initFlags & (FAN_UNLIMITED_QUEUE | FAN_UNLIMITED_MARKS); flags != 0 {
+		return fmt.Errorf("fanotify: init error, flags %#x lift kernel caps under memory limits", uint(flags))
+	}
+
+	return nil
+}
+
+// MemoryLimits returns the limits set by WithMemoryLimits, 'false' without.
+func (handle *NotifyFD) MemoryLimits() (MemoryLimits, bool) {
+	if handle.memoryLimits == nil {
+		return MemoryLimits{}, false
+	}
+
+	return *handle.memoryLimits, true
+}
+
+// Drops returns work dropped to stay within MemoryLimits.
+func (handle *NotifyFD) Drops() DropCounts {
+	return DropCounts{
+		DenyActions: atomic.LoadUint64(&handle.denyDropped),
+	}
+}
@@ -0,0 +1,226 @@
+package fanotify
+
+import (
+	"container/heap"
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// OrderedMerge runs a Manager and re-orders its merged stream by receive
+// timestamp (EventMetadata.Time). Every event is held for window after it
+// was read, so that events of other groups read slightly later but received
+// earlier can overtake it. At most max events are held, the oldest is
+// released early when the window holds more.
+//
+// Events arriving after a newer event was already released are forwarded
+// at once and counted as late. Read errors and permission events are
+// forwarded at once, the latter are never held, as the accessing process
+// blocks until they are answered, and so are not ordered with the other
+// events.
+type OrderedMerge struct {
+	manager *Manager
+	window  time.Duration
+	max     int
+	events  chan SourcedEvent
+
+	pending mergeHeap
+	seq     uint64
+	last    time.Time
+	late    uint64
+
+	life lifecycle
+}
+
+// NewOrderedMerge returns an OrderedMerge on top of m, a max of 0 or less
+// holds up to the default Manager queue size.
+func NewOrderedMerge(m *Manager, window time.Duration, max int) *OrderedMerge {
+	if max <= 0 {
+		max = defaultQueueSize
+	}
+
+	return &OrderedMerge{
+		manager: m,
+		window:  window,
+		max:     max,
+		events:  make(chan SourcedEvent),
+	}
+}
+
+// Events returns the ordered stream, it is closed when Run returns.
+func (o *OrderedMerge) Events() <-chan SourcedEvent {
+	return o.events
+}
+
+// Late returns the number of events forwarded out of order.
+func (o *OrderedMerge) Late() uint64 {
+	return atomic.LoadUint64(&o.late)
+}
+
+// Run runs the Manager until ctx is done, forwarding its events to Events
+// in order. Events still held when ctx is done are dropped, see Manager.
+func (o *OrderedMerge) Run(ctx context.Context) error {
+	defer close(o.events)
+
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- o.manager.Run(ctx)
+	}()
+
+	in := o.manager.Events()
+
+	timer := time.NewTimer(time.Hour)
+	stopTimer(timer)
+
+	for in != nil {
+		var wait <-chan time.Time
+
+		if len(o.pending) > 0 {
+			d := time.Until(o.pending[0].ev.Event.Time.Add(o.window))
+			if d <= 0 || len(o.pending) > o.max {
+				if !o.send(ctx, o.pop()) {
+					break
+				}
+
+				continue
+			}
+
+			timer.Reset(d)
+			wait = timer.C
+		}
+
+		select {
+		case ev, ok := <-in:
+			if !ok {
+				in = nil
+
+				break
+			}
+
+			if !o.push(ctx, ev) {
+				in = nil
+			}
+		case <-wait:
+		case <-ctx.Done():
+			in = nil
+		}
+
+		stopTimer(timer)
+	}
+
+	// the input is closed, flush held events in order unless ctx is done
+	for len(o.pending) > 0 && ctx.Err() == nil {
+		if !o.send(ctx, o.pop()) {
+			break
+		}
+	}
+
+	for len(o.pending) > 0 {
+		o.manager.release(o.pop())
+	}
+
+	// the Manager releases what it can not deliver once ctx is done
+	for ev := range o.manager.Events() {
+		o.manager.release(ev)
+	}
+
+	return <-errc
+}
+
+// Start runs Run on a goroutine owned by the OrderedMerge, until Stop is
+// called or ctx is done.
+func (o *OrderedMerge) Start(ctx context.Context) error {
+	return o.life.start(ctx, o.Run)
+}
+
+// Stop stops a started OrderedMerge and waits for it and its Manager to
+// exit, after that Events is closed and held events were dropped, see
+// Manager.Dropped.
+func (o *OrderedMerge) Stop() error {
+	return o.life.stop()
+}
+
+// push holds ev, or forwards it at once when it is an error, a permission
+// event or late. It returns 'false' when ctx is done first.
+func (o *OrderedMerge) push(ctx context.Context, ev SourcedEvent) bool {
+	if ev.Event == nil || ev.Event.IsPermission() {
+		return o.send(ctx, ev)
+	}
+
+	if ev.Event.Time.Before(o.last) {
+		atomic.AddUint64(&o.late, 1)
+
+		return o.send(ctx, ev)
+	}
+
+	o.seq++
+	heap.Push(&o.pending, mergeItem{ev: ev, seq: o.seq})
+
+	return true
+}
+
+// pop removes the oldest held event.
+func (o *OrderedMerge) pop() SourcedEvent {
+	ev := heap.Pop(&o.pending).(mergeItem).ev
+
+	if ev.Event.Time.After(o.last) {
+		o.last = ev.Event.Time
+	}
+
+	return ev
+}
+
+// send passes ev to Events, it returns 'false' when ctx is done first.
+func (o *OrderedMerge) send(ctx context.Context, ev SourcedEvent) bool {
+	select {
+	case o.events <- ev:
+		return true
+	case <-ctx.Done():
+		o.manager.release(ev)
+
+		return false
+	}
+}
+
+// stopTimer stops t and drains its channel, so that it can be Reset.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
+
+// mergeItem is a held event, seq keeps arrival order for equal timestamps.
+type mergeItem struct {
+	ev  SourcedEvent
+	seq uint64
+}
+
+// mergeHeap implements heap.Interface ordered by receive timestamp.
+type mergeHeap []mergeItem
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	ti, tj := h[i].ev.Event.Time, h[j].ev.Event.Time
+	if ti.Equal(tj) {
+		return h[i].seq < h[j].seq
+	}
+
+	return ti.Before(tj)
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeItem)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return item
+}
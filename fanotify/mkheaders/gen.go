@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+)
+
+// section is a const block of headers.go.
+type section struct {
+	doc  string
+	with func(name string) bool
+}
+
+func hasPrefix(prefixes ...string) func(string) bool {
+	return func(name string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func oneOf(names ...string) func(string) bool {
+	return func(name string) bool {
+		for _, v := range names {
+			if name == v {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// sections are the const blocks in output order, a define goes to the first
+// section that takes it, defines no other section takes are event bits.
+var sections = []section{
+	{"fanotify_init flags.", func(name string) bool {
+		return hasPrefix("FAN_CLASS_", "FAN_UNLIMITED_", "FAN_REPORT_")(name) ||
+			oneOf("FAN_CLOEXEC", "FAN_NONBLOCK", "FAN_ENABLE_AUDIT",
+				"FAN_ALL_CLASS_BITS", "FAN_ALL_INIT_FLAGS")(name)
+	}},
+	{"Event mask bits.", nil},
+	{"fanotify_mark flags.", func(name string) bool {
+		return hasPrefix("FAN_MARK_")(name) || name == "FAN_ALL_MARK_FLAGS"
+	}},
+	{"Event metadata and info records.", func(name string) bool {
+		return hasPrefix("FAN_EVENT_INFO_TYPE_")(name) ||
+			oneOf("FANOTIFY_METADATA_VERSION", "FAN_EVENT_METADATA_LEN",
+				"FAN_NOFD", "FAN_NOPIDFD", "FAN_EPIDFD")(name)
+	}},
+	{"Permission responses.", func(name string) bool {
+		return hasPrefix("FAN_RESPONSE_INFO_", "FAN_ERRNO_")(name) ||
+			oneOf("FAN_ALLOW", "FAN_DENY", "FAN_AUDIT", "FAN_INFO")(name)
+	}},
+}
+
+// helpers are Go renderings of function-like macros, emitted when the
+// header defines them, other macros operate on buffers the package decodes
+// itself.
+var helpers = map[string]string{
+	"FAN_DENY_ERRNO": `// FanDenyErrno is the FAN_DENY_ERRNO macro, a FAN_DENY response that fails
+// the access with errno instead of EPERM.
+func FanDenyErrno(errno uint32) uint32 {
+	return FAN_DENY | (errno&FAN_ERRNO_MASK)<<FAN_ERRNO_SHIFT
+}
+`,
+}
+
+// skipped are the defines and macros not rendered to Go.
+var skipped = map[string]bool{
+	"_LINUX_FANOTIFY_H": true,
+	"FAN_EVENT_NEXT":    true,
+	"FAN_EVENT_OK":      true,
+}
+
+// generate renders headers.go from h, version names the kernel release of
+// the header.
+func generate(h *header, version string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	known := make(map[string]bool, len(h.defines))
+	for _, d := range h.defines {
+		known[d.name] = true
+	}
+
+	fmt.Fprintf(&buf, "// Code generated by mkheaders from linux/fanotify.h of Linux %s; DO NOT EDIT.\n\n", version)
+	buf.WriteString(`package fanotify
+
+// Constants and structures of the fanotify uapi, defined here so that the
+// package builds on every platform, see mkheaders to regenerate them from a
+// newer header. Values that golang.org/x/sys defines too are checked against
+// it at build time in headers_linux.go. The kernel releases that introduced
+// them are tabled in kernel.go, see RequiresKernel.
+`)
+
+	blocks := make([][]define, len(sections))
+
+	for _, d := range h.defines {
+		if skipped[d.name] {
+			continue
+		}
+
+		index := -1
+
+		for i, s := range sections {
+			if s.with == nil {
+				index = i
+			} else if s.with(d.name) {
+				index = i
+
+				break
+			}
+		}
+
+		blocks[index] = append(blocks[index], d)
+	}
+
+	for i, s := range sections {
+		if len(blocks[i]) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&buf, "\n// %s\nconst (\n", s.doc)
+
+		for j, d := range blocks[i] {
+			expr, err := h.goExpr(d, known)
+			if err != nil {
+				return nil, err
+			}
+
+			if j > 0 && (d.group || d.deprecated) {
+				buf.WriteString("\n")
+			}
+
+			if d.deprecated {
+				buf.WriteString("\t// Deprecated: kept for compatibility with the uapi, use explicit flags.\n")
+			}
+
+			fmt.Fprintf(&buf, "\t%s = %s\n", d.name, expr)
+		}
+
+		buf.WriteString(")\n")
+	}
+
+	macros := append([]string(nil), h.macros...)
+	sort.Strings(macros)
+
+	for _, name := range macros {
+		if skipped[name] {
+			continue
+		}
+
+		helper, ok := helpers[name]
+		if !ok {
+			return nil, fmt.Errorf("no Go rendering of macro %s, add one to helpers or skipped", name)
+		}
+
+		buf.WriteString("\n" + helper)
+	}
+
+	for _, s := range h.structs {
+		if err := writeStruct(&buf, s); err != nil {
+			return nil, err
+		}
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+func writeStruct(buf *bytes.Buffer, s cstruct) error {
+	doc := fmt.Sprintf("%s is struct %s", goName(s.name), s.name)
+
+	for _, f := range s.fields {
+		if f.flexible {
+			doc += ", without the " + f.name + " that follows it"
+		}
+	}
+
+	fmt.Fprintf(buf, "\n%stype %s struct {\n", wrapComment(doc+"."), goName(s.name))
+
+	for _, f := range s.fields {
+		if f.flexible {
+			continue
+		}
+
+		gotype := ""
+
+		if strings.HasPrefix(f.ctype, "struct ") {
+			gotype = goName(strings.TrimPrefix(f.ctype, "struct "))
+		} else if scalar, ok := scalars[f.ctype]; ok {
+			gotype = scalar.gotype
+		} else {
+			return fmt.Errorf("struct %s: unsupported type %s", s.name, f.ctype)
+		}
+
+		// member names follow golang.org/x/sys, the first letter upper case
+		fmt.Fprintf(buf, "\t%s %s\n", strings.ToUpper(f.name[:1])+f.name[1:], gotype)
+	}
+
+	buf.WriteString("}\n")
+
+	return nil
+}
+
+// wrapComment returns text as a comment of lines up to 76 columns.
+func wrapComment(text string) string {
+	var b strings.Builder
+
+	line := "//"
+
+	for _, word := range strings.Fields(text) {
+		if len(line)+1+len(word) > 76 && line != "//" {
+			b.WriteString(line + "\n")
+			line = "//"
+		}
+
+		line += " " + word
+	}
+
+	b.WriteString(line + "\n")
+
+	return b.String()
+}
+
+// goName returns the Go name of a C struct, fanotify_response becomes
+// FanotifyResponse.
+func goName(name string) string {
+	var b strings.Builder
+
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+
+	return b.String()
+}
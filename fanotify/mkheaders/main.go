@@ -0,0 +1,148 @@
+// Command mkheaders generates headers.go of the fanotify package from the
+// kernel uapi header linux/fanotify.h, so that constants and structures are
+// not transcribed by hand. Constants keep their C names and expressions, in
+// hex, structures follow the naming of golang.org/x/sys. The kernel release
+// recorded in the output is read from linux/version.h next to the header,
+// or the Makefile of a kernel tree.
+//
+// The header is -header, $FANOTIFY_H or /usr/include/linux/fanotify.h. A
+// header lacking names the existing output defines, e.g. of an older
+// kernel, is refused unless -force is given. From the package directory:
+//
+//	go generate
+//	FANOTIFY_H=$HOME/linux/include/uapi/linux/fanotify.h go generate
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	defaultHeader := os.Getenv("FANOTIFY_H")
+	if defaultHeader == "" {
+		defaultHeader = "/usr/include/linux/fanotify.h"
+	}
+
+	headerPath := flag.String("header", defaultHeader, "linux/fanotify.h to generate from")
+	output := flag.String("o", "headers.go", "file to write")
+	version := flag.String("version", "", "kernel release of the header, detected when empty")
+	force := flag.Bool("force", false, "write even when names of the existing output are dropped")
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix("mkheaders: ")
+
+	src, err := os.ReadFile(*headerPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	h, err := parseHeader(string(src))
+	if err != nil {
+		log.Fatalf("%s: %v", *headerPath, err)
+	}
+
+	if *version == "" {
+		if *version, err = detectVersion(*headerPath); err != nil {
+			log.Fatalf("%v, set -version", err)
+		}
+	}
+
+	out, err := generate(h, *version)
+	if err != nil {
+		log.Fatalf("%s: %v", *headerPath, err)
+	}
+
+	if old, err := os.ReadFile(*output); err == nil && !*force {
+		if dropped := droppedNames(old, out); len(dropped) > 0 {
+			log.Fatalf("%s lacks %s defined by %s, it is older than the header %s was generated from, use -force to drop them",
+				*headerPath, strings.Join(dropped, ", "), *output, *output)
+		}
+	}
+
+	if err := os.WriteFile(*output, out, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var (
+	versionMacroRe = regexp.MustCompile(`(?m)^#define\s+(LINUX_VERSION_MAJOR|LINUX_VERSION_PATCHLEVEL|LINUX_VERSION_CODE)\s+(\d+)`)
+	makefileRe     = regexp.MustCompile(`(?m)^(VERSION|PATCHLEVEL)\s*=\s*(\d+)`)
+	goNameRe       = regexp.MustCompile(`(?m)^(?:\t(FAN\w+)\s+=|type (\w+) struct|func (\w+)\()`)
+)
+
+// detectVersion returns the kernel release of the header at path, from
+// linux/version.h of installed headers or the Makefile of a kernel tree.
+func detectVersion(path string) (string, error) {
+	dir := filepath.Dir(path)
+
+	if src, err := os.ReadFile(filepath.Join(dir, "version.h")); err == nil {
+		macros := make(map[string]int)
+
+		for _, m := range versionMacroRe.FindAllStringSubmatch(string(src), -1) {
+			macros[m[1]], _ = strconv.Atoi(m[2])
+		}
+
+		if major, ok := macros["LINUX_VERSION_MAJOR"]; ok {
+			return fmt.Sprintf("%d.%d", major, macros["LINUX_VERSION_PATCHLEVEL"]), nil
+		}
+
+		if code, ok := macros["LINUX_VERSION_CODE"]; ok {
+			return fmt.Sprintf("%d.%d", code>>16, code>>8&0xff), nil
+		}
+	}
+
+	// include/uapi/linux of a kernel tree
+	if src, err := os.ReadFile(filepath.Join(dir, "..", "..", "..", "Makefile")); err == nil {
+		vars := make(map[string]string)
+
+		for _, m := range makefileRe.FindAllStringSubmatch(string(src), -1) {
+			if _, ok := vars[m[1]]; !ok {
+				vars[m[1]] = m[2]
+			}
+		}
+
+		if vars["VERSION"] != "" && vars["PATCHLEVEL"] != "" {
+			return vars["VERSION"] + "." + vars["PATCHLEVEL"], nil
+		}
+	}
+
+	return "", fmt.Errorf("kernel release of %s not found", path)
+}
+
+// droppedNames returns the constants, types and functions of old missing
+// in out.
+func droppedNames(old, out []byte) []string {
+	names := func(src []byte) map[string]bool {
+		set := make(map[string]bool)
+
+		for _, m := range goNameRe.FindAllSubmatch(src, -1) {
+			set[string(bytes.Join(m[1:], nil))] = true
+		}
+
+		return set
+	}
+
+	have := names(out)
+
+	var dropped []string
+
+	for name := range names(old) {
+		if !have[name] {
+			dropped = append(dropped, name)
+		}
+	}
+
+	sort.Strings(dropped)
+
+	return dropped
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+func TestGenerateGolden(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "fanotify.h"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := parseHeader(string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := generate(h, "6.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "headers.go.golden")
+
+	if *update {
+		if err := os.WriteFile(golden, out, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(out, want) {
+		t.Fatalf("generated output differs from %s, run go test -update after checking it:\n%s", golden, out)
+	}
+
+	// an older header lacking a define is caught before overwriting
+	older, err := parseHeader(strings.Replace(string(src), "#define FAN_MODIFY", "#define FAN_MODIFIED", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = generate(older, "6.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dropped := droppedNames(want, out); len(dropped) != 1 || dropped[0] != "FAN_MODIFY" {
+		t.Fatalf("got dropped names %v, want [FAN_MODIFY]", dropped)
+	}
+}
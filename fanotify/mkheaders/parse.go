@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// define is an object-like #define of the header.
+type define struct {
+	name string
+	// tokens is the C expression of the value, comments stripped
+	tokens []string
+	// deprecated is set when the preceding comment deprecates the define
+	deprecated bool
+	// group is set when the define starts a new group, after a blank line
+	group bool
+}
+
+// field is a member of a struct.
+type field struct {
+	ctype string
+	name  string
+	// flexible is set for a trailing flexible array member
+	flexible bool
+}
+
+// cstruct is a struct of the header.
+type cstruct struct {
+	name   string
+	fields []field
+}
+
+// header is what mkheaders uses of fanotify.h.
+type header struct {
+	defines []define
+	// macros are the names of function-like macros
+	macros  []string
+	structs []cstruct
+}
+
+var (
+	defineRe = regexp.MustCompile(`^#\s*define\s+([A-Za-z_]\w*)(\()?\s*(.*)$`)
+	structRe = regexp.MustCompile(`^struct\s+(\w+)\s*\{$`)
+	fieldRe  = regexp.MustCompile(`^((?:struct\s+|unsigned\s+)?\w+)\s+(\w+)(\[\])?;$`)
+	tokenRe  = regexp.MustCompile(`0[xX][0-9a-fA-F]+[uUlL]*|[0-9]+[uUlL]*|[A-Za-z_]\w*|<<|>>|\S`)
+)
+
+// parseHeader parses the defines and structs of a uapi header, the
+// preprocessor conditionals and includes are ignored.
+func parseHeader(src string) (*header, error) {
+	var (
+		h          header
+		current    *cstruct
+		inComment  bool
+		comment    strings.Builder
+		group      = true
+		deprecated bool
+	)
+
+	src = strings.ReplaceAll(src, "\\\n", " ")
+
+	for n, line := range strings.Split(src, "\n") {
+		var code strings.Builder
+
+		// split the line into code and comment text
+		for rest := line; rest != ""; {
+			if inComment {
+				end := strings.Index(rest, "*/")
+				if end < 0 {
+					comment.WriteString(rest + " ")
+
+					break
+				}
+
+				comment.WriteString(rest[:end] + " ")
+				rest = rest[end+2:]
+				inComment = false
+
+				continue
+			}
+
+			start := strings.Index(rest, "/*")
+			if start < 0 {
+				code.WriteString(rest)
+
+				break
+			}
+
+			code.WriteString(rest[:start] + " ")
+			rest = rest[start+2:]
+			inComment = true
+		}
+
+		text := strings.TrimSpace(code.String())
+
+		if current != nil {
+			if text == "" {
+				continue
+			}
+
+			if text == "};" {
+				h.structs = append(h.structs, *current)
+				current = nil
+
+				continue
+			}
+
+			m := fieldRe.FindStringSubmatch(strings.Join(strings.Fields(text), " "))
+			if m == nil {
+				return nil, fmt.Errorf("line %d: unsupported struct member %q", n+1, text)
+			}
+
+			current.fields = append(current.fields, field{ctype: m[1], name: m[2], flexible: m[3] != ""})
+
+			continue
+		}
+
+		switch {
+		case text == "":
+			if strings.TrimSpace(line) == "" {
+				group = true
+			}
+
+			if !inComment {
+				// a blank line or the end of a comment
+				if strings.HasPrefix(strings.TrimSpace(comment.String()), "Deprecated") {
+					deprecated = true
+				}
+
+				comment.Reset()
+			}
+		case structRe.MatchString(text):
+			current = &cstruct{name: structRe.FindStringSubmatch(text)[1]}
+			group, deprecated = true, false
+			comment.Reset()
+		case defineRe.MatchString(text):
+			m := defineRe.FindStringSubmatch(text)
+
+			switch {
+			case m[2] != "":
+				h.macros = append(h.macros, m[1])
+			case m[3] == "":
+				// include guard
+			default:
+				h.defines = append(h.defines, define{
+					name:       m[1],
+					tokens:     tokenRe.FindAllString(m[3], -1),
+					deprecated: deprecated,
+					group:      group,
+				})
+			}
+
+			group, deprecated = false, false
+			comment.Reset()
+		case strings.HasPrefix(text, "#"):
+			group, deprecated = true, false
+			comment.Reset()
+		default:
+			return nil, fmt.Errorf("line %d: unsupported declaration %q", n+1, text)
+		}
+	}
+
+	if current != nil {
+		return nil, fmt.Errorf("struct %s is not terminated", current.name)
+	}
+
+	return &h, nil
+}
+
+// scalars are the sizes and alignments of the C types used by the uapi
+// structs, __aligned_u64 keeps 8 byte alignment on every architecture.
+var scalars = map[string]struct {
+	gotype      string
+	size, align int
+}{
+	"__u8":            {"uint8", 1, 1},
+	"__u16":           {"uint16", 2, 2},
+	"__u32":           {"uint32", 4, 4},
+	"__u64":           {"uint64", 8, 8},
+	"__aligned_u64":   {"uint64", 8, 8},
+	"__s8":            {"int8", 1, 1},
+	"__s16":           {"int16", 2, 2},
+	"__s32":           {"int32", 4, 4},
+	"__s64":           {"int64", 8, 8},
+	"__kernel_fsid_t": {"[2]int32", 8, 4},
+	"unsigned char":   {"uint8", 1, 1},
+}
+
+// layout returns size and alignment of struct name.
+func (h *header) layout(name string) (size, align int, err error) {
+	for _, s := range h.structs {
+		if s.name != name {
+			continue
+		}
+
+		align = 1
+
+		for _, f := range s.fields {
+			fsize, falign, err := h.fieldLayout(f.ctype)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			if falign > align {
+				align = falign
+			}
+
+			size = (size + falign - 1) / falign * falign
+
+			if !f.flexible {
+				size += fsize
+			}
+		}
+
+		return (size + align - 1) / align * align, align, nil
+	}
+
+	return 0, 0, fmt.Errorf("unknown struct %s", name)
+}
+
+func (h *header) fieldLayout(ctype string) (size, align int, err error) {
+	if strings.HasPrefix(ctype, "struct ") {
+		return h.layout(strings.TrimPrefix(ctype, "struct "))
+	}
+
+	scalar, ok := scalars[ctype]
+	if !ok {
+		return 0, 0, fmt.Errorf("unsupported type %s", ctype)
+	}
+
+	return scalar.size, scalar.align, nil
+}
+
+// goExpr translates the C expression of d to Go: numbers are written in
+// hex, casts are dropped and sizeof is evaluated.
+func (h *header) goExpr(d define, known map[string]bool) (string, error) {
+	var out []string
+
+	toks := d.tokens
+
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+
+		switch {
+		case tok == "sizeof":
+			// sizeof(struct name)
+			if i+4 >= len(toks) || toks[i+1] != "(" || toks[i+2] != "struct" || toks[i+4] != ")" {
+				return "", fmt.Errorf("%s: unsupported sizeof", d.name)
+			}
+
+			size, _, err := h.layout(toks[i+3])
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", d.name, err)
+			}
+
+			out = append(out, fmt.Sprintf("%#x", size))
+			i += 4
+		case tok == "(" && i+2 < len(toks) && toks[i+2] == ")" && isCType(toks[i+1]):
+			// cast
+			i += 2
+		case tok[0] >= '0' && tok[0] <= '9':
+			v, err := strconv.ParseUint(strings.TrimRight(tok, "uUlL"), 0, 64)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", d.name, err)
+			}
+
+			out = append(out, fmt.Sprintf("%#x", v))
+		case isIdent(tok):
+			if !known[tok] {
+				return "", fmt.Errorf("%s: unknown name %s", d.name, tok)
+			}
+
+			out = append(out, tok)
+		case tok == "~":
+			out = append(out, "^")
+		case strings.Contains("()|&^+-*<<>>", tok):
+			out = append(out, tok)
+		default:
+			return "", fmt.Errorf("%s: unsupported token %q", d.name, tok)
+		}
+	}
+
+	// drop parentheses around the whole expression
+	for len(out) > 2 && out[0] == "(" && out[len(out)-1] == ")" && balanced(out[1:len(out)-1]) {
+		out = out[1 : len(out)-1]
+	}
+
+	return strings.Join(out, " "), nil
+}
+
+func isIdent(tok string) bool {
+	c := tok[0]
+
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isCType(tok string) bool {
+	_, ok := scalars[tok]
+
+	return ok || tok == "int" || tok == "long" || tok == "unsigned"
+}
+
+// balanced reports whether the parentheses of toks match.
+func balanced(toks []string) bool {
+	depth := 0
+
+	for _, tok := range toks {
+		switch tok {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+
+	return depth == 0
+}
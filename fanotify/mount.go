@@ -0,0 +1,231 @@
+package fanotify
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProcFsMountInfo is the mount table of the current mount namespace.
+const ProcFsMountInfo = "/proc/self/mountinfo"
+
+// MountInfo describes one line of '/proc/self/mountinfo'.
+type MountInfo struct {
+	ID         int    `json:"id"`
+	ParentID   int    `json:"parent_id"`
+	Major      int    `json:"major"`
+	Minor      int    `json:"minor"`
+	Root       string `json:"root"`
+	MountPoint string `json:"mount_point"`
+	FSType     string `json:"fstype"`
+	Source     string `json:"source"`
+}
+
+// ReadMountInfo returns parsed '/proc/self/mountinfo' data.
+func ReadMountInfo() ([]MountInfo, error) {
+	file, err := os.Open(ProcFsMountInfo)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+	defer file.Close()
+
+	return readMountInfo(file)
+}
+
+// readMountInfo parses mountinfo data read from r.
+func readMountInfo(r io.Reader) ([]MountInfo, error) {
+	var out []MountInfo
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		info, err := parseMountInfo(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, info)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	return out, nil
+}
+
+// parseMountInfo parses a mountinfo line:
+// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfo(line string) (MountInfo, error) {
+	var out MountInfo
+
+	fields := strings.Fields(line)
+
+	sep := -1
+
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+
+			break
+		}
+	}
+
+	if len(fields) < 5 || sep < 0 || len(fields) < sep+3 {
+		return out, fmt.Errorf("fanotify: procfs error, malformed mountinfo line %q", line)
+	}
+
+	var err error
+
+	if out.ID, err = strconv.Atoi(fields[0]); err != nil {
+		return out, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	if out.ParentID, err = strconv.Atoi(fields[1]); err != nil {
+		return out, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	if _, err = fmt.Sscanf(fields[2], "%d:%d", &out.Major, &out.Minor); err != nil {
+		return out, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	out.Root = unescapeMountInfo(fields[3])
+	out.MountPoint = unescapeMountInfo(fields[4])
+	out.FSType = fields[sep+1]
+	out.Source = unescapeMountInfo(fields[sep+2])
+
+	return out, nil
+}
+
+// unescapeMountInfo decodes octal escapes such as '\040' used for spaces.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+
+				continue
+			}
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// MountTable caches '/proc/self/mountinfo' by mount ID, it is re-read when
+// an unknown mount ID is looked up. IDs still unknown after a re-read, such
+// as those of detached mounts or of other mount namespaces, are remembered
+// until a re-read finds the table changed, so that their events do not
+// re-read it each.
+type MountTable struct {
+	mu      sync.Mutex
+	mounts  map[int]MountInfo
+	unknown map[int]struct{}
+	// read returns the mount table, ReadMountInfo unless set by tests
+	read func() ([]MountInfo, error)
+}
+
+// NewMountTable returns an empty MountTable, it is filled on first Lookup.
+func NewMountTable() *MountTable {
+	return &MountTable{}
+}
+
+// Lookup returns mount with given ID.
+func (table *MountTable) Lookup(id int) (MountInfo, bool) {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	if info, ok := table.mounts[id]; ok {
+		return info, true
+	}
+
+	if _, ok := table.unknown[id]; ok {
+		return MountInfo{}, false
+	}
+
+	if err := table.reload(); err != nil {
+		return MountInfo{}, false
+	}
+
+	info, ok := table.mounts[id]
+	if !ok {
+		table.unknown[id] = struct{}{}
+	}
+
+	return info, ok
+}
+
+func (table *MountTable) reload() error {
+	read := table.read
+	if read == nil {
+		read = ReadMountInfo
+	}
+
+	mounts, err := read()
+	if err != nil {
+		return err
+	}
+
+	previous := table.mounts
+	table.mounts = make(map[int]MountInfo, len(mounts))
+
+	for _, info := range mounts {
+		table.mounts[info.ID] = info
+	}
+
+	// unknown IDs may have been mounted since when the table changed
+	if table.unknown == nil || !sameMounts(previous, table.mounts) {
+		table.unknown = make(map[int]struct{})
+	}
+
+	return nil
+}
+
+// sameMounts reports whether a and b hold the same mounts.
+func sameMounts(a, b map[int]MountInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for id, info := range a {
+		if other, ok := b[id]; !ok || other != info {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WithMountInfo enriches every event with the mount it was generated
+// through, translated to mount point and filesystem type via mountinfo.
+func WithMountInfo() Option {
+	table := NewMountTable()
+
+	return WithEnricher(func(metadata *EventMetadata) {
+		if metadata.Fd < 0 {
+			return
+		}
+
+		id, err := metadata.GetMountID()
+		if err != nil {
+			return
+		}
+
+		if info, ok := table.Lookup(id); ok {
+			metadata.Mount = &info
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// GetMountID returns the ID of the mount the event was generated through,
+// using statx(STATX_MNT_ID) on event metadata supplied Fd and falling back to
+// '/proc/self/fdinfo' on kernels before 5.8.
+func (metadata *EventMetadata) GetMountID() (int, error) {
+	var stx unix.Statx_t
+
+	err := unix.Statx(int(metadata.Fd), "", unix.AT_EMPTY_PATH, unix.STATX_MNT_ID, &stx)
+	if err == nil && stx.Mask&unix.STATX_MNT_ID != 0 {
+		return int(stx.Mnt_id), nil
+	}
+
+	if err != nil && !errors.Is(err, unix.ENOSYS) && !errors.Is(err, unix.EINVAL) {
+		return 0, fmt.Errorf("fanotify: statx error, %w", err)
+	}
+
+	info, err := metadata.GetFdInfo()
+	if err != nil {
+		return 0, err
+	}
+
+	return info.MountID, nil
+}
@@ -0,0 +1,45 @@
+package fanotify
+
+import "testing"
+
+func TestMountTableUnknown(t *testing.T) {
+	var (
+		reads  int
+		mounts = []MountInfo{{ID: 1, MountPoint: "/"}}
+	)
+
+	table := NewMountTable()
+	table.read = func() ([]MountInfo, error) {
+		reads++
+
+		return mounts, nil
+	}
+
+	lookup := func(id int, want bool, wantReads int) {
+		t.Helper()
+
+		if _, ok := table.Lookup(id); ok != want || reads != wantReads {
+			t.Fatalf("Lookup(%d): got %v after %d reads, want %v after %d", id, ok, reads, want, wantReads)
+		}
+	}
+
+	lookup(1, true, 1)
+
+	lookup(42, false, 2)
+	lookup(43, false, 3)
+
+	// detached mounts are looked up for each of their events
+	for i := 0; i < 3; i++ {
+		lookup(42, false, 3)
+		lookup(43, false, 3)
+	}
+
+	lookup(1, true, 3)
+
+	// a changed table forgets unknown IDs
+	mounts = append(mounts, MountInfo{ID: 42, MountPoint: "/mnt"})
+
+	lookup(44, false, 4)
+	lookup(42, true, 4)
+	lookup(43, false, 5)
+}
@@ -0,0 +1,200 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrNoMount is returned by MountPool for filesystem IDs without a mount
+// supporting file handles in the mount namespace.
+var ErrNoMount = errors.New("fanotify: no mount for filesystem ID")
+
+// MountPool maps filesystem IDs, as reported in FID records, to mount fds
+// for open_by_handle_at, shared by the handle resolution of MoveCorrelator,
+// see SetMountPool, and WithHybridFd. A filesystem is looked up in
+// '/proc/self/mountinfo' the first time one of its handles is resolved, and
+// its first mount whose fd accepts name_to_handle_at is kept. The pool
+// follows mount table changes: mounts detached since are dropped, and
+// filesystems not found before are looked up again.
+//
+// Pooled fds are directory fds that keep their mount busy, umount other than
+// lazy fails with EBUSY until the pool is closed. It is safe for concurrent
+// use.
+type MountPool struct {
+	mu sync.Mutex
+	// mountinfo stays open, it signals mount table changes
+	mountinfo *os.File
+	mounts    []MountInfo
+	fds       map[[2]int32]pooledMount
+	missing   map[[2]int32]struct{}
+	closed    bool
+}
+
+type pooledMount struct {
+	fd      int
+	mountID int
+}
+
+// NewMountPool returns an empty MountPool.
+func NewMountPool() (*MountPool, error) {
+	// a blocking fd stays out of the runtime poller, whose epoll would
+	// acknowledge the change notifications
+	fd, err := sysOpenRead(ProcFsMountInfo)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	file := os.NewFile(uintptr(fd), ProcFsMountInfo)
+
+	pool := &MountPool{
+		mountinfo: file,
+		fds:       make(map[[2]int32]pooledMount),
+		missing:   make(map[[2]int32]struct{}),
+	}
+
+	if err := pool.reloadLocked(); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// MountFd returns the pooled fd of the filesystem fsid, it is owned by the
+// pool and valid until Close.
+func (pool *MountPool) MountFd(fsid [2]int32) (int, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.closed {
+		return -1, fmt.Errorf("fanotify: mount pool error, %w", os.ErrClosed)
+	}
+
+	if mountTableChanged(int(pool.mountinfo.Fd())) {
+		if err := pool.reloadLocked(); err != nil {
+			return -1, err
+		}
+	}
+
+	if m, ok := pool.fds[fsid]; ok {
+		return m.fd, nil
+	}
+
+	if _, ok := pool.missing[fsid]; ok {
+		return -1, ErrNoMount
+	}
+
+	for _, info := range pool.mounts {
+		// statfs would trigger automounts
+		if info.FSType == "autofs" {
+			continue
+		}
+
+		if id, err := mountFsid(info.MountPoint); err != nil || id != fsid {
+			continue
+		}
+
+		fd, err := openMount(info.MountPoint, fsid)
+		if err != nil {
+			continue
+		}
+
+		pool.fds[fsid] = pooledMount{fd: fd, mountID: info.ID}
+
+		return fd, nil
+	}
+
+	pool.missing[fsid] = struct{}{}
+
+	return -1, ErrNoMount
+}
+
+// Refresh re-reads the mount table, it is done by MountFd on mount table
+// changes already.
+func (pool *MountPool) Refresh() error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.closed {
+		return fmt.Errorf("fanotify: mount pool error, %w", os.ErrClosed)
+	}
+
+	return pool.reloadLocked()
+}
+
+// reloadLocked reads the mount table through the kept mountinfo file, which
+// also acknowledges the change notification.
+func (pool *MountPool) reloadLocked() error {
+	if _, err := pool.mountinfo.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	mounts, err := readMountInfo(pool.mountinfo)
+	if err != nil {
+		return err
+	}
+
+	ids := make(map[int]struct{}, len(mounts))
+	for _, info := range mounts {
+		ids[info.ID] = struct{}{}
+	}
+
+	for fsid, m := range pool.fds {
+		if _, ok := ids[m.mountID]; !ok {
+			sysClose(m.fd)
+			delete(pool.fds, fsid)
+		}
+	}
+
+	pool.mounts = mounts
+	pool.missing = make(map[[2]int32]struct{})
+
+	return nil
+}
+
+// Open opens the file of a FID group event, see EventMetadata.OpenFile.
+func (pool *MountPool) Open(metadata *EventMetadata, flags int) (*os.File, error) {
+	if metadata.Fd >= 0 {
+		return metadata.OpenFile(-1, flags)
+	}
+
+	fd, err := metadata.openFID(pool.MountFd, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(fd), ""), nil
+}
+
+// Resolve returns the current path of the directory h.
+func (pool *MountPool) Resolve(h FileHandle) (string, error) {
+	mountFd, err := pool.MountFd(h.Fsid)
+	if err != nil {
+		return "", err
+	}
+
+	return resolveHandle(mountFd, h)
+}
+
+// Close closes the pooled fds.
+func (pool *MountPool) Close() error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.closed {
+		return nil
+	}
+
+	pool.closed = true
+
+	for fsid, m := range pool.fds {
+		sysClose(m.fd)
+		delete(pool.fds, fsid)
+	}
+
+	return pool.mountinfo.Close()
+}
@@ -0,0 +1,205 @@
+package fanotify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NoisePreset is a curated set of well-known, high-volume and benign paths,
+// such as package manager caches or container storage, so that a new
+// deployment is usable before it is tuned. See WithNoisePresets and
+// IgnoreNoise.
+type NoisePreset struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Paths are MatchPath patterns of the noise.
+	Paths []string `json:"paths"`
+	// IgnoreDirs are filepath.Glob patterns of directories whose direct
+	// children are noise, they get kernel ignore marks by IgnoreNoise.
+	IgnoreDirs []string `json:"ignore_dirs,omitempty"`
+}
+
+// noisePresets are the built-in presets, sorted by name.
+var noisePresets = []NoisePreset{
+	{
+		Name:        "debian-apt",
+		Description: "apt and dpkg package lists, caches and logs",
+		Paths: []string{
+			"/var/cache/apt/",
+			"/var/cache/debconf/",
+			"/var/lib/apt/",
+			"/var/lib/dpkg/tmp.ci/",
+			"/var/lib/dpkg/updates/",
+			"/var/log/apt/",
+			"/var/log/dpkg.log",
+		},
+		IgnoreDirs: []string{
+			"/var/cache/apt",
+			"/var/cache/apt/archives",
+			"/var/lib/apt/lists",
+			"/var/lib/apt/lists/partial",
+		},
+	},
+	{
+		Name:        "docker-overlay",
+		Description: "docker and containerd image layers, container logs and runtime state",
+		Paths: []string{
+			"/run/containerd/",
+			"/run/docker/",
+			"/var/lib/containerd/",
+			"/var/lib/docker/image/",
+			"/var/lib/docker/overlay2/",
+			"/var/lib/docker/containers/*/*-json.log*",
+		},
+		IgnoreDirs: []string{
+			"/var/lib/docker/containers/*",
+		},
+	},
+	{
+		Name:        "rpm-dnf",
+		Description: "dnf and yum metadata caches, rpm database and logs",
+		Paths: []string{
+			"/var/cache/dnf/",
+			"/var/cache/yum/",
+			"/var/lib/dnf/",
+			"/var/lib/rpm/",
+			"/var/log/dnf*.log",
+		},
+		IgnoreDirs: []string{
+			"/var/lib/rpm",
+		},
+	},
+	{
+		Name:        "systemd-journal",
+		Description: "persistent and volatile journal files",
+		Paths: []string{
+			"/run/log/journal/",
+			"/var/log/journal/",
+		},
+		IgnoreDirs: []string{
+			"/run/log/journal/*",
+			"/var/log/journal/*",
+		},
+	},
+	{
+		Name:        "systemd-runtime",
+		Description: "systemd and udev runtime state",
+		Paths: []string{
+			"/run/systemd/",
+			"/run/udev/",
+			"/var/lib/systemd/timers/",
+		},
+	},
+	{
+		Name:        "user-cache",
+		Description: "per user XDG caches, such as browser and thumbnail caches",
+		Paths: []string{
+			"/home/*/.cache/",
+			"/root/.cache/",
+		},
+	},
+}
+
+// NoisePresets returns the built-in presets, sorted by name.
+func NoisePresets() []NoisePreset {
+	out := make([]NoisePreset, len(noisePresets))
+
+	for i, preset := range noisePresets {
+		out[i] = preset.clone()
+	}
+
+	return out
+}
+
+// NoisePresetNames returns the names of the built-in presets, sorted.
+func NoisePresetNames() []string {
+	names := make([]string, len(noisePresets))
+
+	for i, preset := range noisePresets {
+		names[i] = preset.Name
+	}
+
+	return names
+}
+
+// LookupNoisePresets returns the built-in presets with the given names.
+func LookupNoisePresets(names ...string) ([]NoisePreset, error) {
+	out := make([]NoisePreset, 0, len(names))
+
+	for _, name := range names {
+		i := sort.Search(len(noisePresets), func(i int) bool {
+			return noisePresets[i].Name >= name
+		})
+
+		if i == len(noisePresets) || noisePresets[i].Name != name {
+			return nil, fmt.Errorf("fanotify: noise preset error, unknown preset %q, valid presets: %s",
+				name, strings.Join(NoisePresetNames(), ","))
+		}
+
+		out = append(out, noisePresets[i].clone())
+	}
+
+	return out, nil
+}
+
+func (preset NoisePreset) clone() NoisePreset {
+	preset.Paths = append([]string(nil), preset.Paths...)
+	preset.IgnoreDirs = append([]string(nil), preset.IgnoreDirs...)
+
+	return preset
+}
+
+// NoiseFilter drops events for the paths of presets, see ExcludePaths.
+// Permission events are kept, as dropping them would allow them without a
+// decision.
+func NoiseFilter(presets ...NoisePreset) Filter {
+	var patterns []string
+
+	for _, preset := range presets {
+		patterns = append(patterns, preset.Paths...)
+	}
+
+	exclude := ExcludePaths(patterns...)
+
+	return func(metadata *EventMetadata) bool {
+		return metadata.IsPermission() || exclude(metadata)
+	}
+}
+
+// WithNoisePresets adds the NoiseFilter of presets to the filters.
+func WithNoisePresets(presets ...NoisePreset) Option {
+	return WithFilter(NoiseFilter(presets...))
+}
+
+// IgnoreNoise adds kernel ignore marks for the events of mask, without
+// permission events, to the existing IgnoreDirs of presets, so that events
+// of their direct children are not even queued. The marks use
+// FAN_MARK_IGNORE, kernel 6.0+, older kernels fail with EINVAL and leave
+// the noise to NoiseFilter.
+func (handle *NotifyFD) IgnoreNoise(mask EventMask, presets ...NoisePreset) error {
+	mask = mask&^(eventPermBits|FAN_ONDIR) | FAN_EVENT_ON_CHILD
+
+	for _, preset := range presets {
+		for _, pattern := range preset.IgnoreDirs {
+			dirs, err := filepath.Glob(pattern)
+			if err != nil {
+				return fmt.Errorf("fanotify: noise preset error, %s: %w", preset.Name, err)
+			}
+
+			for _, dir := range dirs {
+				if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+					continue
+				}
+
+				if err := handle.Mark(FAN_MARK_ADD|FAN_MARK_IGNORE_SURV|FAN_MARK_ONLYDIR, mask, AT_FDCWD, dir); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
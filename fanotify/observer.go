@@ -0,0 +1,44 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrObserver is returned for permission classes and masks of an observer
+// group, see WithObserver.
+var ErrObserver = errors.New("fanotify: observer group can not block processes")
+
+// WithObserver makes the group an observer: Initialize refuses
+// FAN_CLASS_CONTENT and FAN_CLASS_PRE_CONTENT, and Mark and MarkFd refuse
+// masks with permission events, so that the group can never block other
+// processes. Building with the 'fanotify_observer' tag makes every group an
+// observer, see ObserverBuild.
+func WithObserver() Option {
+	return func(handle *NotifyFD) {
+		handle.observer = true
+	}
+}
+
+// Observer reports whether handle is an observer group.
+func (handle *NotifyFD) Observer() bool {
+	return ObserverBuild || handle.observer
+}
+
+// checkObserverInit rejects permission classes of an observer group.
+func (handle *NotifyFD) checkObserverInit(flags InitFlags) error {
+	if handle.Observer() && flags.Class() != FAN_CLASS_NOTIF {
+		return fmt.Errorf("fanotify: init error, class %#x, %w", uint(flags.Class()), ErrObserver)
+	}
+
+	return nil
+}
+
+// checkObserverMask rejects permission events of an observer group.
+func (handle *NotifyFD) checkObserverMask(mask EventMask) error {
+	if handle.Observer() && mask&eventPermBits != 0 {
+		return fmt.Errorf("fanotify: mark error, permission events %s, %w", mask&eventPermBits, ErrObserver)
+	}
+
+	return nil
+}
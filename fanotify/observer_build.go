@@ -0,0 +1,7 @@
+//go:build fanotify_observer
+
+package fanotify
+
+// ObserverBuild is set by the 'fanotify_observer' build tag, every group is
+// an observer then, see WithObserver.
+const ObserverBuild = true
@@ -0,0 +1,48 @@
+package fanotify
+
+// EventAccess is the access mode event Fds are opened with.
+type EventAccess int
+
+// Event Fd access modes.
+const (
+	// EventReadOnly opens event Fds with O_RDONLY.
+	EventReadOnly EventAccess = iota + 1
+	// EventWriteOnly opens event Fds with O_WRONLY.
+	EventWriteOnly
+	// EventReadWrite opens event Fds with O_RDWR.
+	EventReadWrite
+	// EventPathOnly opens event Fds with O_PATH, they identify the object
+	// but can not be read, kernels without O_PATH support fail Initialize.
+	EventPathOnly
+)
+
+// WithRawOpenFlags makes Initialize pass event_f_flags to fanotify_init as
+// given, without adding the O_LARGEFILE and O_CLOEXEC defaults.
+func WithRawOpenFlags() Option {
+	return func(handle *NotifyFD) {
+		handle.rawOpenFlags = true
+	}
+}
+
+// WithEventAccess sets the access mode of event Fds, replacing the one in
+// the Initialize openFlags.
+func WithEventAccess(access EventAccess) Option {
+	return func(handle *NotifyFD) {
+		handle.eventAccess = access
+	}
+}
+
+// WithNoatime opens event Fds with O_NOATIME, so reads done by scanners do
+// not update the file access time.
+func WithNoatime() Option {
+	return func(handle *NotifyFD) {
+		handle.eventNoatime = true
+	}
+}
+
+// WithAppend opens event Fds with O_APPEND, it needs write access.
+func WithAppend() Option {
+	return func(handle *NotifyFD) {
+		handle.eventAppend = true
+	}
+}
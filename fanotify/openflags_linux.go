@@ -0,0 +1,81 @@
+package fanotify
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// defaultOpenFlags are added to event_f_flags by Initialize, O_LARGEFILE is
+// 0 on 64-bit architectures and mandatory for large files on 32-bit ones.
+const defaultOpenFlags = unix.O_LARGEFILE | unix.O_CLOEXEC
+
+// eventFlagBits are the event_f_flags accepted by fanotify_init, O_PATH
+// is left to the kernel to accept or reject.
+const eventFlagBits = unix.O_ACCMODE | unix.O_APPEND | unix.O_NONBLOCK |
+	unix.O_SYNC | unix.O_DSYNC | unix.O_CLOEXEC | unix.O_LARGEFILE |
+	unix.O_NOATIME | unix.O_PATH
+
+// openFlags returns event_f_flags for fanotify_init, openFlags amended by
+// the event Fd options.
+func (handle *NotifyFD) openFlags(openFlags int) (int, error) {
+	switch handle.eventAccess {
+	case 0:
+	case EventReadOnly:
+		openFlags = openFlags&^unix.O_ACCMODE | unix.O_RDONLY
+	case EventWriteOnly:
+		openFlags = openFlags&^unix.O_ACCMODE | unix.O_WRONLY
+	case EventReadWrite:
+		openFlags = openFlags&^unix.O_ACCMODE | unix.O_RDWR
+	case EventPathOnly:
+		openFlags = openFlags&^unix.O_ACCMODE | unix.O_PATH
+	default:
+		return 0, fmt.Errorf("fanotify: init error, unknown event access %d, %w", handle.eventAccess, unix.EINVAL)
+	}
+
+	if handle.eventNoatime {
+		openFlags |= unix.O_NOATIME
+	}
+
+	if handle.eventAppend {
+		openFlags |= unix.O_APPEND
+	}
+
+	if !handle.rawOpenFlags {
+		openFlags |= defaultOpenFlags
+	}
+
+	return openFlags, validateOpenFlags(openFlags)
+}
+
+// validateOpenFlags rejects event_f_flags combinations fanotify_init or the
+// per event open would fail on, with a reason instead of a bare EINVAL.
+func validateOpenFlags(openFlags int) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("fanotify: init error, %s, %w", reason, unix.EINVAL)
+	}
+
+	if bits := openFlags &^ eventFlagBits; bits != 0 {
+		return invalid(fmt.Sprintf("unsupported event fd flags %#x", bits))
+	}
+
+	if openFlags&unix.O_ACCMODE == unix.O_ACCMODE {
+		return invalid("invalid event fd access mode")
+	}
+
+	if openFlags&unix.O_PATH != 0 {
+		if openFlags&unix.O_ACCMODE != unix.O_RDONLY {
+			return invalid("O_PATH event fds can not have read or write access")
+		}
+
+		if openFlags&(unix.O_APPEND|unix.O_NOATIME|unix.O_SYNC|unix.O_DSYNC) != 0 {
+			return invalid("O_PATH event fds only take O_CLOEXEC")
+		}
+	}
+
+	if openFlags&unix.O_APPEND != 0 && openFlags&unix.O_ACCMODE == unix.O_RDONLY {
+		return invalid("O_APPEND event fds need write access")
+	}
+
+	return nil
+}
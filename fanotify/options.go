@@ -0,0 +1,16 @@
+package fanotify
+
+// Option configures a NotifyFD created by Initialize.
+type Option func(*NotifyFD)
+
+// Enricher attaches additional data to an event right after it was read,
+// before it is returned to the caller. Enrichers are best effort and must not
+// close or take over the event Fd.
+type Enricher func(*EventMetadata)
+
+// WithEnricher adds enrichers that are run, in order, for every returned event.
+func WithEnricher(enrichers ...Enricher) Option {
+	return func(handle *NotifyFD) {
+		handle.enrichers = append(handle.enrichers, enrichers...)
+	}
+}
@@ -0,0 +1,182 @@
+package fanotify
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrPathUnresolved is returned by GetPath for handles created with
+// WithPathResolution(PathNever).
+var ErrPathUnresolved = errors.New("fanotify: path resolution disabled")
+
+// PathResolution selects when event paths are resolved.
+type PathResolution int
+
+const (
+	// PathLazy resolves the path on the first GetPath call, the default.
+	PathLazy PathResolution = iota
+	// PathEager resolves the path as soon as the event is read, before
+	// filters and enrichers, capturing it before the file is renamed.
+	PathEager
+	// PathNever skips resolution, GetPath returns ErrPathUnresolved and
+	// events carry no path.
+	PathNever
+)
+
+// Event path states, see EventMetadata.pathState.
+const (
+	pathUnresolved int32 = iota
+	pathStoring
+	pathResolved
+)
+
+// WithPathResolution sets when event paths are resolved. Whatever the mode,
+// an event path is resolved at most once, later GetPath calls, including
+// failed ones, return the first result.
+func WithPathResolution(mode PathResolution) Option {
+	return func(handle *NotifyFD) {
+		handle.pathResolution = mode
+	}
+}
+
+// WithBatchPathCache shares resolved paths, including failures, between
+// events for the same file read in one batch from the kernel, e.g. for
+// files opened repeatedly. It replaces a readlink per event with a statx,
+// which pays off when batches often repeat files, and requires the default
+// buffered Rd.
+//
+// Files are told apart by mount, device and inode, so the same file reached
+// through different bind mounts keeps its paths. Non-directories with more
+// than one hard link are not cached, their events may name different links.
+// Before Linux 5.8, lacking STATX_MNT_ID, bind mounts of one filesystem are
+// conflated, and a file renamed within the batch keeps its first path.
+func WithBatchPathCache() Option {
+	return func(handle *NotifyFD) {
+		handle.pathCache = &pathCache{entries: make(map[fileObject]pathResult)}
+	}
+}
+
+type pathResult struct {
+	path string
+	err  error
+}
+
+// pathCache holds paths of the current read batch.
+type pathCache struct {
+	mu      sync.Mutex
+	entries map[fileObject]pathResult
+}
+
+// reset starts a new batch.
+func (c *pathCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) != 0 {
+		c.entries = make(map[fileObject]pathResult)
+	}
+}
+
+// resolve returns the path of fd from the batch, resolving it on a miss.
+func (c *pathCache) resolve(fd int32) (string, error) {
+	key, shared, err := pathKey(int(fd))
+	if err != nil || !shared {
+		return readFdLink(fd)
+	}
+
+	c.mu.Lock()
+	res, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok {
+		return res.path, res.err
+	}
+
+	res.path, res.err = readFdLink(fd)
+
+	c.mu.Lock()
+	c.entries[key] = res
+	c.mu.Unlock()
+
+	return res.path, res.err
+}
+
+// startBatch resets the batch cache when the next read reaches the kernel,
+// handle.readMu is held. It returns whether the read starts a new batch,
+// always for an unbuffered Rd.
+func (handle *NotifyFD) startBatch() bool {
+	rd, ok := handle.Rd.(*bufio.Reader)
+	if !ok {
+		return true
+	}
+
+	if rd.Buffered() != 0 {
+		return false
+	}
+
+	if handle.pathCache != nil {
+		handle.pathCache.reset()
+	}
+
+	return true
+}
+
+// preparePath applies the handle path resolution mode to a read event.
+func (handle *NotifyFD) preparePath(event *EventMetadata) {
+	event.pathCache = handle.pathCache
+
+	switch handle.pathResolution {
+	case PathEager:
+		_, _ = event.GetPath()
+	case PathNever:
+		event.storePath("", ErrPathUnresolved)
+	}
+}
+
+// resolvePath returns the memoized event path, resolving it once.
+func (metadata *EventMetadata) resolvePath() (string, error) {
+	if atomic.LoadInt32(&metadata.pathState) == pathResolved {
+		return metadata.path, metadata.pathErr
+	}
+
+	var (
+		path string
+		err  error
+	)
+
+	if metadata.pathCache != nil {
+		path, err = metadata.pathCache.resolve(metadata.Fd)
+	} else {
+		path, err = readFdLink(metadata.Fd)
+	}
+
+	metadata.storePath(path, err)
+
+	return path, err
+}
+
+// storePath memoizes the event path unless another caller did already.
+func (metadata *EventMetadata) storePath(path string, err error) {
+	if !atomic.CompareAndSwapInt32(&metadata.pathState, pathUnresolved, pathStoring) {
+		return
+	}
+
+	metadata.path, metadata.pathErr = path, err
+	atomic.StoreInt32(&metadata.pathState, pathResolved)
+}
+
+// readFdLink resolves fd through procfs.
+func readFdLink(fd int32) (string, error) {
+	path, err := os.Readlink(filepath.Join(ProcFsFd, strconv.FormatUint(uint64(fd), 10)))
+	if err != nil {
+		return "", fmt.Errorf("fanotify: path error, %w", err)
+	}
+
+	return path, nil
+}
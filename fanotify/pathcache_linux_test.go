@@ -0,0 +1,58 @@
+package fanotify
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestBatchPathCacheHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	link := filepath.Join(dir, "link")
+	other := filepath.Join(dir, "other")
+
+	for _, path := range []string{file, other} {
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Link(file, link); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newFakeHandle(t, WithBatchPathCache())
+	fake.Rd = bufio.NewReaderSize(fake.Rd, ReadBufferSize)
+
+	// one batch, the links of one inode resolve to their own names
+	paths := []string{file, link, other, other}
+	events := make([][]byte, 0, len(paths))
+
+	for _, path := range paths {
+		fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events = append(events, encodeEvent(FAN_OPEN, int32(fd), 1))
+	}
+
+	fake.send(t, events...)
+
+	for _, want := range paths {
+		ev, err := fake.GetEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if path, err := ev.GetPath(); err != nil || path != want {
+			t.Errorf("got path %q and %v, want %q", path, err, want)
+		}
+
+		_ = ev.Close()
+	}
+}
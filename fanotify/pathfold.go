@@ -0,0 +1,103 @@
+package fanotify
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// PathFolding selects how path filters compare event paths with patterns,
+// for case-insensitive filesystems and names stored in differing unicode
+// forms. Both the patterns and the kernel-reported paths are folded.
+type PathFolding uint8
+
+const (
+	// FoldCase compares paths case-insensitively, by unicode simple case
+	// folding, e.g. for vfat or ext4 casefold directories.
+	FoldCase PathFolding = 1 << iota
+	// NormalizeUnicode compares paths in unicode normalization form C, so
+	// that precomposed and decomposed names, e.g. written by macOS clients
+	// of a file share, match the same patterns.
+	NormalizeUnicode
+)
+
+// Fold returns path folded as selected.
+func (folding PathFolding) Fold(path string) string {
+	if folding&NormalizeUnicode != 0 {
+		path = norm.NFC.String(path)
+	}
+
+	if folding&FoldCase != 0 {
+		path = strings.Map(foldRune, path)
+	}
+
+	return path
+}
+
+// foldRune maps r to the smallest rune of its case folding orbit, so that
+// all case variants of a letter map to the same rune.
+func foldRune(r rune) rune {
+	if r < utf8.RuneSelf {
+		if 'a' <= r && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+
+		return r
+	}
+
+	min := r
+
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+
+	return min
+}
+
+// MatchPathFold is MatchPath comparing pattern and path folded as selected.
+func MatchPathFold(pattern, path string, folding PathFolding) bool {
+	return MatchPath(folding.Fold(pattern), folding.Fold(path))
+}
+
+// IncludePathsFold is IncludePaths comparing paths folded as selected.
+func IncludePathsFold(folding PathFolding, patterns ...string) Filter {
+	patterns = foldPatterns(folding, patterns)
+
+	return func(metadata *EventMetadata) bool {
+		path, err := metadata.GetPath()
+		if err != nil {
+			return false
+		}
+
+		return matchAny(patterns, folding.Fold(path))
+	}
+}
+
+// ExcludePathsFold is ExcludePaths comparing paths folded as selected.
+func ExcludePathsFold(folding PathFolding, patterns ...string) Filter {
+	patterns = foldPatterns(folding, patterns)
+
+	return func(metadata *EventMetadata) bool {
+		path, err := metadata.GetPath()
+		if err != nil {
+			return true
+		}
+
+		return !matchAny(patterns, folding.Fold(path))
+	}
+}
+
+// foldPatterns folds patterns once, for matching folded paths.
+func foldPatterns(folding PathFolding, patterns []string) []string {
+	out := make([]string, len(patterns))
+
+	for i, pattern := range patterns {
+		out[i] = folding.Fold(pattern)
+	}
+
+	return out
+}
@@ -0,0 +1,150 @@
+package fanotify
+
+import (
+	"sort"
+	"strings"
+)
+
+// PathMapper translates a path resolved through /proc/self/fd, in the mount
+// namespace of this process, into the path consumers expect, e.g. the path
+// inside a chroot, container or bind mount. It returns path unchanged when
+// it does not apply.
+type PathMapper func(path string) string
+
+// WithPathMapper adds mappers applied, in order, to paths of delivered
+// events, see EventMetadata.MappedPath. GetPath, filters and actions working
+// on the file keep using the unmapped path.
+func WithPathMapper(mappers ...PathMapper) Option {
+	return func(handle *NotifyFD) {
+		handle.pathMappers = append(handle.pathMappers, mappers...)
+	}
+}
+
+// MappedPath returns the event path translated by WithPathMapper mappers,
+// it is the path used by Event.
+func (metadata *EventMetadata) MappedPath() (string, error) {
+	path, err := metadata.GetPath()
+	if err != nil {
+		return "", err
+	}
+
+	for _, mapper := range metadata.pathMappers {
+		path = mapper(path)
+	}
+
+	return path, nil
+}
+
+// PrefixMapper replaces path prefixes on path component boundaries, the
+// longest matching prefix wins, e.g. {"/srv/jail": "/"} for a chroot or
+// {"/mnt/data": "/data"} for a bind mount.
+func PrefixMapper(rules map[string]string) PathMapper {
+	prefixes := make([]string, 0, len(rules))
+
+	for prefix := range rules {
+		prefixes = append(prefixes, prefix)
+	}
+
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+
+	return func(path string) string {
+		for _, prefix := range prefixes {
+			if rest, ok := cutPathPrefix(path, prefix); ok {
+				return joinRest(rules[prefix], rest)
+			}
+		}
+
+		return path
+	}
+}
+
+// OverlayMapper strips overlayfs merged directory prefixes of container
+// runtimes storing layers below root, "<root>/<id>/merged/etc/passwd"
+// becomes "/etc/passwd", e.g. with root "/var/lib/docker/overlay2". Paths
+// of other directories below root, such as layer "diff" directories, are
+// left unchanged.
+func OverlayMapper(root string) PathMapper {
+	return func(path string) string {
+		rest, ok := cutPathPrefix(path, root)
+		if !ok {
+			return path
+		}
+
+		// rest is "/<id>/merged/..."
+		parts := strings.SplitN(strings.TrimPrefix(rest, "/"), "/", 3)
+		if len(parts) < 2 || parts[1] != "merged" {
+			return path
+		}
+
+		if len(parts) == 2 {
+			return "/"
+		}
+
+		return "/" + parts[2]
+	}
+}
+
+// RootfsMapper translates paths below container root filesystems, such as
+// "/run/containerd/io.containerd.runtime.v2.task/k8s.io/<id>/rootfs", to
+// the path inside the container, prefixed with the container name, rootfs
+// maps root filesystem directories to names. A path below a rootfs named
+// "web" becomes "web:/etc/passwd", an empty name yields the plain path.
+func RootfsMapper(rootfs map[string]string) PathMapper {
+	rules := make(map[string]string, len(rootfs))
+
+	for dir := range rootfs {
+		rules[dir] = "/"
+	}
+
+	strip := PrefixMapper(rules)
+
+	return func(path string) string {
+		for dir, name := range rootfs {
+			if _, ok := cutPathPrefix(path, dir); !ok {
+				continue
+			}
+
+			mapped := strip(path)
+			if name == "" {
+				return mapped
+			}
+
+			return name + ":" + mapped
+		}
+
+		return path
+	}
+}
+
+// cutPathPrefix returns the part of path after prefix, "" or starting with
+// a slash, when prefix is a leading path of path.
+func cutPathPrefix(path, prefix string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	if !strings.HasPrefix(path, prefix) {
+		return "", false
+	}
+
+	rest := path[len(prefix):]
+	if rest != "" && rest[0] != '/' {
+		return "", false
+	}
+
+	return rest, true
+}
+
+// joinRest appends rest, "" or starting with a slash, to base.
+func joinRest(base, rest string) string {
+	base = strings.TrimSuffix(base, "/")
+
+	switch {
+	case rest == "" && base == "":
+		return "/"
+	case rest == "":
+		return base
+	default:
+		return base + rest
+	}
+}
@@ -0,0 +1,20 @@
+package fanotify
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Pending returns the number of bytes of events queued in the kernel and not
+// read yet, via ioctl(FIONREAD) on the fanotify fd. Events already read
+// ahead into Rd are not included.
+func (handle *NotifyFD) Pending() (int, error) {
+	// TIOCINQ is FIONREAD, x/sys/unix only names it per architecture as such
+	n, err := unix.IoctlGetInt(handle.Fd, unix.TIOCINQ)
+	if err != nil {
+		return 0, fmt.Errorf("fanotify: pending error, %w", err)
+	}
+
+	return n, nil
+}
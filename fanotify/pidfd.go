@@ -0,0 +1,200 @@
+package fanotify
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// ErrNoPidfd is returned for events without a pidfd record, the group was
+// initialized without FAN_REPORT_PIDFD (kernel 5.15+).
+var ErrNoPidfd = errors.New("fanotify: no pidfd reported")
+
+// ErrProcessGone is returned when the process that generated the event
+// exited, so its PID may already belong to another process.
+var ErrProcessGone = errors.New("fanotify: process exited")
+
+// pidfdInfoLen is the size of struct fanotify_event_info_pidfd.
+const pidfdInfoLen = infoHeaderLen + 4
+
+// Pidfd record states.
+const (
+	pidfdNone int32 = iota
+	pidfdSet
+	pidfdClosed
+)
+
+// ProcessSnapshot is procfs data of the process that generated an event,
+// verified to belong to that very process. Exe and Cmdline are empty for
+// kernel threads and for processes that exited but were not reaped yet.
+type ProcessSnapshot struct {
+	PID     int
+	Comm    string
+	Exe     string
+	Cmdline []string
+	UID     int
+}
+
+// parsePidfd picks up the pidfd record, the kernel installs the pidfd in
+// the reading process, so it has to be closed with the event.
+func (metadata *EventMetadata) parsePidfd() {
+	metadata.EachInfoRecord(func(record InfoRecord) bool {
+		pidfd, ok := record.Pidfd()
+		if !ok {
+			return true
+		}
+
+		metadata.pidfd = int32(pidfd)
+		atomic.StoreInt32(&metadata.pidfdState, pidfdSet)
+
+		return false
+	})
+}
+
+// PidFd returns the pidfd reported with the event, it is owned by the event
+// and closed by Close. ErrProcessGone is returned when the process exited
+// before the event was read.
+func (metadata *EventMetadata) PidFd() (int, error) {
+	switch atomic.LoadInt32(&metadata.pidfdState) {
+	case pidfdNone:
+		return -1, ErrNoPidfd
+	case pidfdClosed:
+		return -1, fmt.Errorf("fanotify: pidfd error, %w", syscall.EBADF)
+	}
+
+	switch metadata.pidfd {
+	case FAN_NOPIDFD:
+		return -1, ErrProcessGone
+	case FAN_EPIDFD:
+		return -1, fmt.Errorf("fanotify: pidfd error, kernel failed to create pidfd")
+	}
+
+	return int(metadata.pidfd), nil
+}
+
+// closePidfd closes the reported pidfd once.
+func (metadata *EventMetadata) closePidfd() error {
+	if !atomic.CompareAndSwapInt32(&metadata.pidfdState, pidfdSet, pidfdClosed) || metadata.pidfd < 0 {
+		return nil
+	}
+
+	if err := sysClose(int(metadata.pidfd)); err != nil {
+		return fmt.Errorf("fanotify: close error, %w", err)
+	}
+
+	return nil
+}
+
+// VerifyProcess returns nil when the process that generated the event is
+// still running under the reported PID, checking it through the pidfd
+// (signal 0 and the pidfd fdinfo), and ErrProcessGone otherwise.
+func (metadata *EventMetadata) VerifyProcess() error {
+	pidfd, err := metadata.PidFd()
+	if err != nil {
+		return err
+	}
+
+	if err := pidfdAlive(pidfd); err != nil {
+		return err
+	}
+
+	pid, err := pidfdPID(pidfd)
+	if err != nil {
+		return err
+	}
+
+	if pid != metadata.GetPID() {
+		return ErrProcessGone
+	}
+
+	return nil
+}
+
+// verifyProcessPidfd is VerifyProcess for groups that may not report
+// pidfds, without a pidfd the process is not verified.
+func (metadata *EventMetadata) verifyProcessPidfd() error {
+	if err := metadata.VerifyProcess(); err != nil && !errors.Is(err, ErrNoPidfd) {
+		return err
+	}
+
+	return nil
+}
+
+// ProcessSnapshot reads procfs data of the process that generated the event.
+// The pidfd pins the PID, so the process is verified before and after
+// reading, data of a recycled PID is never returned.
+func (metadata *EventMetadata) ProcessSnapshot() (*ProcessSnapshot, error) {
+	if err := metadata.VerifyProcess(); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(ProcFs, strconv.Itoa(metadata.GetPID()))
+
+	comm, err := metadata.GetComm()
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := metadata.GetUID()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &ProcessSnapshot{
+		PID:  metadata.GetPID(),
+		Comm: comm,
+		UID:  uid,
+	}
+
+	// kernel threads and exited, not yet reaped, processes have neither
+	// exe nor cmdline
+	snapshot.Exe, _ = os.Readlink(filepath.Join(dir, "exe"))
+
+	if content, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		for _, arg := range bytes.Split(bytes.TrimSuffix(content, []byte{0}), []byte{0}) {
+			if len(arg) > 0 {
+				snapshot.Cmdline = append(snapshot.Cmdline, string(arg))
+			}
+		}
+	}
+
+	if err := metadata.VerifyProcess(); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// pidfdPID returns the PID a pidfd refers to from its fdinfo, -1 once the
+// process was reaped.
+func pidfdPID(pidfd int) (int, error) {
+	f, err := os.Open(filepath.Join(ProcFsFdInfo, strconv.Itoa(pidfd)))
+	if err != nil {
+		return -1, fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) > 1 && fields[0] == "Pid:" {
+			pid, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return -1, fmt.Errorf("fanotify: procfs error, %w", err)
+			}
+
+			return pid, nil
+		}
+	}
+
+	return -1, fmt.Errorf("fanotify: procfs error, no Pid in fdinfo of pidfd %d", pidfd)
+}
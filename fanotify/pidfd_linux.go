@@ -0,0 +1,23 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// pidfdAlive sends signal 0 through pidfd, which fails with ESRCH once the
+// process exited.
+func pidfdAlive(pidfd int) error {
+	err := unix.PidfdSendSignal(pidfd, 0, nil, 0)
+	if errors.Is(err, unix.ESRCH) {
+		return ErrProcessGone
+	}
+
+	if err != nil {
+		return fmt.Errorf("fanotify: pidfd error, %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package fanotify
+
+import (
+	"sort"
+	"sync"
+)
+
+// PIDSet is a set of process IDs, safe for concurrent use. The zero value is
+// an empty set.
+type PIDSet struct {
+	mu   sync.RWMutex
+	pids map[int]struct{}
+}
+
+// Add adds pids to the set.
+func (s *PIDSet) Add(pids ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pids == nil {
+		s.pids = make(map[int]struct{}, len(pids))
+	}
+
+	for _, pid := range pids {
+		s.pids[pid] = struct{}{}
+	}
+}
+
+// Remove removes pids from the set.
+func (s *PIDSet) Remove(pids ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, pid := range pids {
+		delete(s.pids, pid)
+	}
+}
+
+// Contains reports whether pid is in the set.
+func (s *PIDSet) Contains(pid int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.pids[pid]
+
+	return ok
+}
+
+// Len returns the number of PIDs in the set.
+func (s *PIDSet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.pids)
+}
+
+// List returns the PIDs of the set, sorted.
+func (s *PIDSet) List() []int {
+	s.mu.RLock()
+	out := make([]int, 0, len(s.pids))
+
+	for pid := range s.pids {
+		out = append(out, pid)
+	}
+	s.mu.RUnlock()
+
+	sort.Ints(out)
+
+	return out
+}
+
+// WithIgnoredPIDs adds pids to the ignored PIDs of the handle, see
+// IgnoredPIDs.
+func WithIgnoredPIDs(pids ...int) Option {
+	return func(handle *NotifyFD) {
+		handle.ignored.Add(pids...)
+	}
+}
+
+// IgnoredPIDs returns the set of processes whose events are dropped like
+// those of skipPIDs, by GetEvent and every reader of the handle, e.g. Run,
+// Iter, EventRing, RunSharded, URingReader and Watcher. It can be changed at
+// any time, e.g. to add a helper process spawned later, and is carried over
+// by WithRecovery.
+func (handle *NotifyFD) IgnoredPIDs() *PIDSet {
+	return &handle.ignored
+}
+
+// skipPID reports whether events of pid are dropped, as it is in skipPIDs
+// or the ignored PIDs or descends from this process, see
+// WithSkipDescendants.
+func (handle *NotifyFD) skipPID(pid int, skipPIDs []int) bool {
+	for i := range skipPIDs {
+		if pid == skipPIDs[i] {
+			return true
+		}
+	}
+
+	if handle.ignored.Contains(pid) {
+		return true
+	}
+
+	return handle.descendants != nil && handle.descendants.contains(pid)
+}
@@ -0,0 +1,275 @@
+package fanotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Mark types used in WatchPlan.
+const (
+	MarkTypeInode      = "inode"
+	MarkTypeMount      = "mount"
+	MarkTypeFilesystem = "fs"
+	MarkTypeMountNS    = "mntns"
+)
+
+// WatchPlan is a declarative set of marks and filters, it can be stored as
+// JSON and applied to a NotifyFD with Apply.
+type WatchPlan struct {
+	Marks   []PlanMark  `json:"marks"`
+	Filters PlanFilters `json:"filters,omitempty"`
+}
+
+// PlanMark is one mark of a WatchPlan.
+type PlanMark struct {
+	Path string `json:"path"`
+	// Type is one of MarkTypeInode (default), MarkTypeMount,
+	// MarkTypeFilesystem or MarkTypeMountNS, whose Path is a mount namespace
+	// file, e.g. /proc/self/ns/mnt.
+	Type       string    `json:"type,omitempty"`
+	Mask       EventMask `json:"mask,omitempty"`
+	IgnoreMask EventMask `json:"ignore_mask,omitempty"`
+	// IgnoreSurviveModify keeps IgnoreMask after the file is modified.
+	IgnoreSurviveModify bool `json:"ignore_survive_modify,omitempty"`
+	OnlyDir             bool `json:"only_dir,omitempty"`
+	DontFollow          bool `json:"dont_follow,omitempty"`
+}
+
+// PlanFilters are the serializable built-in filters of a WatchPlan.
+type PlanFilters struct {
+	ExcludePIDs  []int    `json:"exclude_pids,omitempty"`
+	ExcludeUIDs  []int    `json:"exclude_uids,omitempty"`
+	IncludeUIDs  []int    `json:"include_uids,omitempty"`
+	IncludePaths []string `json:"include_paths,omitempty"`
+	ExcludePaths []string `json:"exclude_paths,omitempty"`
+	Scope        []string `json:"scope,omitempty"`
+	// FoldCase and NormalizeUnicode apply to IncludePaths and ExcludePaths,
+	// see PathFolding.
+	FoldCase         bool `json:"fold_case,omitempty"`
+	NormalizeUnicode bool `json:"normalize_unicode,omitempty"`
+}
+
+// ReadWatchPlan decodes JSON encoded plan from rd.
+func ReadWatchPlan(rd io.Reader) (WatchPlan, error) {
+	var plan WatchPlan
+
+	dec := json.NewDecoder(rd)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&plan); err != nil {
+		return plan, fmt.Errorf("fanotify: plan error, %w", err)
+	}
+
+	return plan, nil
+}
+
+// LoadWatchPlan reads JSON encoded plan from file.
+func LoadWatchPlan(path string) (WatchPlan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return WatchPlan{}, fmt.Errorf("fanotify: plan error, %w", err)
+	}
+	defer f.Close()
+
+	return ReadWatchPlan(f)
+}
+
+// Write encodes plan as indented JSON to w.
+func (plan WatchPlan) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(plan); err != nil {
+		return fmt.Errorf("fanotify: plan error, %w", err)
+	}
+
+	return nil
+}
+
+// Save writes JSON encoded plan to file.
+func (plan WatchPlan) Save(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("fanotify: plan error, %w", err)
+	}
+
+	if err := plan.Write(f); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("fanotify: plan error, %w", err)
+	}
+
+	return nil
+}
+
+// flags returns fanotify_mark flags of mark, without the operation.
+func (mark PlanMark) flags() (MarkFlags, error) {
+	var flags MarkFlags
+
+	switch mark.Type {
+	case "", MarkTypeInode:
+	case MarkTypeMount:
+		flags = FAN_MARK_MOUNT
+	case MarkTypeFilesystem:
+		flags = FAN_MARK_FILESYSTEM
+	case MarkTypeMountNS:
+		flags = FAN_MARK_MNTNS
+	default:
+		return 0, fmt.Errorf("fanotify: plan error, unknown mark type %q", mark.Type)
+	}
+
+	if mark.OnlyDir {
+		flags |= FAN_MARK_ONLYDIR
+	}
+
+	if mark.DontFollow {
+		flags |= FAN_MARK_DONT_FOLLOW
+	}
+
+	return flags, nil
+}
+
+// Filters returns filters described by plan.
+func (f PlanFilters) Filters() []Filter {
+	var out []Filter
+
+	if len(f.ExcludePIDs) > 0 {
+		out = append(out, ExcludePIDs(f.ExcludePIDs...))
+	}
+
+	if len(f.ExcludeUIDs) > 0 {
+		out = append(out, ExcludeUIDs(f.ExcludeUIDs...))
+	}
+
+	if len(f.IncludeUIDs) > 0 {
+		out = append(out, IncludeUIDs(f.IncludeUIDs...))
+	}
+
+	if len(f.Scope) > 0 {
+		out = append(out, InScope(f.Scope...))
+	}
+
+	var folding PathFolding
+
+	if f.FoldCase {
+		folding |= FoldCase
+	}
+
+	if f.NormalizeUnicode {
+		folding |= NormalizeUnicode
+	}
+
+	if len(f.IncludePaths) > 0 {
+		out = append(out, IncludePathsFold(folding, f.IncludePaths...))
+	}
+
+	if len(f.ExcludePaths) > 0 {
+		out = append(out, ExcludePathsFold(folding, f.ExcludePaths...))
+	}
+
+	return out
+}
+
+// Apply adds all marks of plan and replaces filters with the plan filters.
+// Marks already applied are kept, so Apply can be repeated to restore a plan
+// after restart or a queue overflow.
+func (handle *NotifyFD) Apply(plan WatchPlan) error {
+	for _, mark := range plan.Marks {
+		if err := handle.AddMark(mark); err != nil {
+			return err
+		}
+	}
+
+	handle.SetFilters(plan.Filters.Filters()...)
+
+	return nil
+}
+
+// AddMark adds the mask and ignore mask of mark.
+func (handle *NotifyFD) AddMark(mark PlanMark) error {
+	return handle.planMark(FAN_MARK_ADD, mark)
+}
+
+// RemoveMark removes the mask and ignore mask of mark, marks left without
+// mask bits are destroyed by the kernel.
+func (handle *NotifyFD) RemoveMark(mark PlanMark) error {
+	return handle.planMark(FAN_MARK_REMOVE, mark)
+}
+
+// planMark applies op, FAN_MARK_ADD or FAN_MARK_REMOVE, to the masks of
+// mark.
+func (handle *NotifyFD) planMark(op MarkFlags, mark PlanMark) error {
+	flags, err := mark.flags()
+	if err != nil {
+		return err
+	}
+
+	if mark.Mask != 0 {
+		if err := handle.Mark(op|flags, mark.Mask, AT_FDCWD, mark.Path); err != nil {
+			return err
+		}
+	}
+
+	if mark.IgnoreMask != 0 {
+		flags |= FAN_MARK_IGNORED_MASK
+
+		if mark.IgnoreSurviveModify {
+			flags |= FAN_MARK_IGNORED_SURV_MODIFY
+		}
+
+		if err := handle.Mark(op|flags, mark.IgnoreMask, AT_FDCWD, mark.Path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Plan returns a plan of the currently recorded marks, see Marks. Marks of
+// relative paths under a directory Fd and FAN_MARK_IGNORE marks, e.g. of
+// IgnoreNoise, are left out. Filters are functions and can not be
+// recovered, the plan has none.
+func (handle *NotifyFD) Plan() WatchPlan {
+	var plan WatchPlan
+
+	for _, spec := range handle.Marks() {
+		if spec.DirFd != AT_FDCWD && !filepath.IsAbs(spec.Path) || spec.Flags&FAN_MARK_IGNORE != 0 {
+			continue
+		}
+
+		mark := PlanMark{
+			Path:       spec.Path,
+			OnlyDir:    spec.Flags&FAN_MARK_ONLYDIR != 0,
+			DontFollow: spec.Flags&FAN_MARK_DONT_FOLLOW != 0,
+		}
+
+		switch {
+		case spec.Flags&markTypeFlags == FAN_MARK_MNTNS:
+			mark.Type = MarkTypeMountNS
+		case spec.Flags&FAN_MARK_FILESYSTEM != 0:
+			mark.Type = MarkTypeFilesystem
+		case spec.Flags&FAN_MARK_MOUNT != 0:
+			mark.Type = MarkTypeMount
+		default:
+			mark.Type = MarkTypeInode
+		}
+
+		if spec.Flags&FAN_MARK_IGNORED_MASK != 0 {
+			mark.IgnoreMask = spec.Mask
+			mark.IgnoreSurviveModify = spec.Flags&FAN_MARK_IGNORED_SURV_MODIFY != 0
+		} else {
+			mark.Mask = spec.Mask
+		}
+
+		plan.Marks = append(plan.Marks, mark)
+	}
+
+	return plan
+}
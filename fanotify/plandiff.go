@@ -0,0 +1,162 @@
+package fanotify
+
+// PlanDiff is the change from one set of plan marks to another, see
+// DiffMarks.
+type PlanDiff struct {
+	// Add are mask bits to add.
+	Add []PlanMark `json:"add,omitempty"`
+	// Remove are mask bits to remove.
+	Remove []PlanMark `json:"remove,omitempty"`
+	// Reset are marks removed before Add, as the kernel clears
+	// IgnoreSurviveModify only by destroying the mark, their events are
+	// missed in between.
+	Reset []PlanMark `json:"reset,omitempty"`
+}
+
+// Empty reports whether the diff changes nothing.
+func (diff PlanDiff) Empty() bool {
+	return len(diff.Add) == 0 && len(diff.Remove) == 0 && len(diff.Reset) == 0
+}
+
+// planKey identifies a kernel mark, lookup flags such as OnlyDir do not
+// change the marked object.
+type planKey struct {
+	typ  string
+	path string
+}
+
+// mergeMarks merges marks of the same object, in order of first appearance.
+func mergeMarks(marks []PlanMark) ([]planKey, map[planKey]PlanMark) {
+	var keys []planKey
+
+	merged := make(map[planKey]PlanMark, len(marks))
+
+	for _, mark := range marks {
+		if mark.Type == "" {
+			mark.Type = MarkTypeInode
+		}
+
+		key := planKey{mark.Type, mark.Path}
+
+		prev, ok := merged[key]
+		if !ok {
+			keys = append(keys, key)
+			merged[key] = mark
+
+			continue
+		}
+
+		prev.Mask |= mark.Mask
+		prev.IgnoreMask |= mark.IgnoreMask
+		prev.IgnoreSurviveModify = prev.IgnoreSurviveModify || mark.IgnoreSurviveModify
+		prev.OnlyDir = prev.OnlyDir || mark.OnlyDir
+		prev.DontFollow = prev.DontFollow || mark.DontFollow
+		merged[key] = prev
+	}
+
+	return keys, merged
+}
+
+// DiffMarks returns the changes turning the current marks into next, such
+// as those of NotifyFD.Plan and a new WatchPlan.
+func DiffMarks(current, next []PlanMark) PlanDiff {
+	curKeys, cur := mergeMarks(current)
+	nextKeys, want := mergeMarks(next)
+
+	var diff PlanDiff
+
+	seen := make(map[planKey]bool, len(cur)+len(want))
+
+	for _, key := range append(nextKeys, curKeys...) {
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		c, w := cur[key], want[key]
+
+		if _, ok := want[key]; !ok {
+			// marks only in current keep their lookup flags for the removal
+			w.OnlyDir, w.DontFollow = c.OnlyDir, c.DontFollow
+		}
+
+		base := PlanMark{Path: key.path, Type: key.typ, OnlyDir: w.OnlyDir, DontFollow: w.DontFollow}
+		add, remove := base, base
+
+		add.Mask = w.Mask &^ c.Mask
+		remove.Mask = c.Mask &^ w.Mask
+
+		switch {
+		case c.IgnoreMask != 0 && w.IgnoreMask != 0 && c.IgnoreSurviveModify && !w.IgnoreSurviveModify:
+			reset := base
+			reset.Mask, reset.IgnoreMask, reset.IgnoreSurviveModify = c.Mask, c.IgnoreMask, true
+			diff.Reset = append(diff.Reset, reset)
+
+			add.Mask, add.IgnoreMask = w.Mask, w.IgnoreMask
+			remove.Mask = 0
+		case w.IgnoreSurviveModify && !c.IgnoreSurviveModify:
+			// adding with the flag sets it for the whole ignore mask
+			add.IgnoreMask = w.IgnoreMask
+			add.IgnoreSurviveModify = w.IgnoreMask != 0
+			remove.IgnoreMask = c.IgnoreMask &^ w.IgnoreMask
+		default:
+			add.IgnoreMask = w.IgnoreMask &^ c.IgnoreMask
+			add.IgnoreSurviveModify = w.IgnoreSurviveModify && add.IgnoreMask != 0
+			remove.IgnoreMask = c.IgnoreMask &^ w.IgnoreMask
+			remove.IgnoreSurviveModify = c.IgnoreSurviveModify && remove.IgnoreMask != 0
+		}
+
+		if add.Mask != 0 || add.IgnoreMask != 0 {
+			diff.Add = append(diff.Add, add)
+		}
+
+		if remove.Mask != 0 || remove.IgnoreMask != 0 {
+			diff.Remove = append(diff.Remove, remove)
+		}
+	}
+
+	return diff
+}
+
+// ApplyDiff applies diff, additions before removals so that no event
+// covered by both the old and the new marks is missed while the marks
+// change, except for Reset marks.
+func (handle *NotifyFD) ApplyDiff(diff PlanDiff) error {
+	for _, mark := range diff.Reset {
+		if err := handle.RemoveMark(mark); err != nil {
+			return err
+		}
+	}
+
+	for _, mark := range diff.Add {
+		if err := handle.AddMark(mark); err != nil {
+			return err
+		}
+	}
+
+	for _, mark := range diff.Remove {
+		if err := handle.RemoveMark(mark); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ApplyConfig moves the handle to plan without recreating the group, which
+// would drop queued events: only the marks that differ from the recorded
+// ones, see Plan, are added or removed, and filters are replaced with the
+// plan filters. Marks not in plan are removed, including those applied by
+// other means than plans. It returns the diff it applied, the marks stay
+// partially changed when applying fails.
+func (handle *NotifyFD) ApplyConfig(plan WatchPlan) (PlanDiff, error) {
+	diff := DiffMarks(handle.Plan().Marks, plan.Marks)
+
+	if err := handle.ApplyDiff(diff); err != nil {
+		return diff, err
+	}
+
+	handle.SetFilters(plan.Filters.Filters()...)
+
+	return diff, nil
+}
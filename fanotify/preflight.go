@@ -0,0 +1,104 @@
+package fanotify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Init flags that require CAP_SYS_ADMIN even on kernels supporting
+// unprivileged fanotify (5.13+), FANOTIFY_ADMIN_INIT_FLAGS of the kernel.
+const adminInitFlags = FAN_CLASS_CONTENT | FAN_CLASS_PRE_CONTENT |
+	FAN_UNLIMITED_QUEUE | FAN_UNLIMITED_MARKS |
+	FAN_REPORT_TID | FAN_REPORT_PIDFD
+
+// Capabilities from linux/capability.h.
+const (
+	capSysAdmin   = 21
+	capAuditWrite = 29
+)
+
+// PreflightConfig describes the fanotify setup a caller is about to create.
+type PreflightConfig struct {
+	// InitFlags are the planned fanotify_init flags.
+	InitFlags InitFlags
+	// MarkFlags is all planned fanotify_mark flags OR-ed together.
+	MarkFlags MarkFlags
+	// Marks is the number of marks planned per group.
+	Marks int
+	// Groups is the number of fanotify groups planned, 0 means 1.
+	Groups int
+	// QueuedEvents is the largest expected burst of unread events.
+	QueuedEvents int
+}
+
+// PreflightError lists every problem found by Preflight.
+type PreflightError struct {
+	Problems []string
+}
+
+// Error implements error.
+func (e *PreflightError) Error() string {
+	return "fanotify: preflight failed: " + strings.Join(e.Problems, "; ")
+}
+
+// Preflight verifies that cfg can be set up by the current process before
+// the first fanotify call, so EPERM/EMFILE/ENOSPC become actionable errors:
+// it checks CAP_SYS_ADMIN (or the unprivileged mode constraints when it is
+// missing), CAP_AUDIT_WRITE for FAN_ENABLE_AUDIT and the per-user limits
+// from /proc/sys/fs/fanotify.
+func Preflight(cfg PreflightConfig) error {
+	admin, err := HasCapability(capSysAdmin)
+	if err != nil {
+		return err
+	}
+
+	auditWrite, err := HasCapability(capAuditWrite)
+	if err != nil {
+		return err
+	}
+
+	problems := capabilityProblems(cfg, admin, auditWrite)
+
+	limits, err := ReadLimits()
+	if err != nil {
+		return err
+	}
+
+	problems = append(problems, limits.Warnings(cfg)...)
+
+	if len(problems) > 0 {
+		return &PreflightError{Problems: problems}
+	}
+
+	return nil
+}
+
+// capabilityProblems returns the problems of cfg for a process with or
+// without CAP_SYS_ADMIN and CAP_AUDIT_WRITE, as checked by fanotify_init.
+func capabilityProblems(cfg PreflightConfig, admin, auditWrite bool) []string {
+	var problems []string
+
+	if !admin {
+		if cfg.InitFlags&adminInitFlags != 0 {
+			problems = append(problems, fmt.Sprintf(
+				"init flags %#x need CAP_SYS_ADMIN (permission classes, unlimited queue/marks, report tid/pidfd)",
+				cfg.InitFlags&adminInitFlags,
+			))
+		}
+
+		if cfg.InitFlags&initFidBits == 0 {
+			problems = append(problems,
+				"without CAP_SYS_ADMIN only groups reporting FIDs are allowed (kernel 5.13+)")
+		}
+
+		if cfg.MarkFlags&(FAN_MARK_MOUNT|FAN_MARK_FILESYSTEM) != 0 {
+			problems = append(problems, "mount and filesystem marks need CAP_SYS_ADMIN")
+		}
+	}
+
+	if !auditWrite && cfg.InitFlags&FAN_ENABLE_AUDIT != 0 {
+		problems = append(problems, "FAN_ENABLE_AUDIT needs CAP_AUDIT_WRITE")
+	}
+
+	return problems
+}
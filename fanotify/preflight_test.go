@@ -0,0 +1,63 @@
+package fanotify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCapabilityProblems(t *testing.T) {
+	tests := []struct {
+		name       string
+		flags      InitFlags
+		admin      bool
+		auditWrite bool
+		// want are substrings of the expected problems, in order
+		want []string
+	}{
+		{
+			name:  "report pidfd needs admin",
+			flags: FAN_CLASS_NOTIF | FAN_REPORT_FID | FAN_REPORT_PIDFD,
+			want:  []string{"need CAP_SYS_ADMIN"},
+		},
+		{
+			name:  "report pidfd with admin",
+			flags: FAN_CLASS_NOTIF | FAN_REPORT_PIDFD,
+			admin: true,
+		},
+		{
+			name:  "audit needs audit write",
+			flags: FAN_CLASS_CONTENT | FAN_ENABLE_AUDIT,
+			admin: true,
+			want:  []string{"CAP_AUDIT_WRITE"},
+		},
+		{
+			name:       "audit with audit write only",
+			flags:      FAN_CLASS_NOTIF | FAN_REPORT_FID | FAN_ENABLE_AUDIT,
+			auditWrite: true,
+		},
+		{
+			name:  "dir fid alone is unprivileged",
+			flags: FAN_CLASS_NOTIF | FAN_REPORT_DIR_FID,
+		},
+		{
+			name:  "no fid is privileged",
+			flags: FAN_CLASS_NOTIF,
+			want:  []string{"reporting FIDs"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := capabilityProblems(PreflightConfig{InitFlags: tt.flags}, tt.admin, tt.auditWrite)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+
+			for i := range tt.want {
+				if !strings.Contains(got[i], tt.want[i]) {
+					t.Fatalf("got %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
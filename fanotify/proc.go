@@ -0,0 +1,34 @@
+package fanotify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcFs is the procfs mount point.
+const ProcFs = "/proc"
+
+// GetComm returns command name of the process that generated the event,
+// read from '/proc/PID/comm'.
+func (metadata *EventMetadata) GetComm() (string, error) {
+	content, err := os.ReadFile(filepath.Join(ProcFs, strconv.Itoa(metadata.GetPID()), "comm"))
+	if err != nil {
+		return "", fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	return strings.TrimSuffix(string(content), "\n"), nil
+}
+
+// GetUID returns real UID of the process that generated the event, see
+// GetCredentials.
+func (metadata *EventMetadata) GetUID() (int, error) {
+	creds, err := metadata.GetCredentials()
+	if err != nil {
+		return 0, err
+	}
+
+	return creds.UID, nil
+}
@@ -0,0 +1,139 @@
+package fanotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// Proc connector constants, see linux/connector.h and linux/cn_proc.h.
+const (
+	cnIdxProc          = 0x1
+	cnValProc          = 0x1
+	cnMsgLen           = 20
+	procCnMcastListen  = 1
+	procEventHeaderLen = 16
+)
+
+// procConnector receives process events of the kernel proc connector, which
+// reports a fork before the child runs, so before any of its fanotify events.
+type procConnector struct {
+	fd  int
+	buf []byte
+}
+
+// openProcConnector subscribes to process events, it needs the initial PID
+// namespace, as PIDs are reported from there, and on some kernels
+// CAP_NET_ADMIN.
+func openProcConnector() (*procConnector, error) {
+	status, err := os.ReadFile(filepath.Join(ProcFs, "self", "status"))
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: proc connector error, %w", err)
+	}
+
+	for _, line := range bytes.Split(status, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("NSpid:")) && len(bytes.Fields(line)) > 2 {
+			return nil, fmt.Errorf("fanotify: proc connector error, not in the initial PID namespace")
+		}
+	}
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: proc connector error, %w", err)
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: cnIdxProc}); err != nil {
+		unix.Close(fd)
+
+		return nil, fmt.Errorf("fanotify: proc connector error, %w", err)
+	}
+
+	msg := make([]byte, unix.NLMSG_HDRLEN+cnMsgLen+4)
+	binary.LittleEndian.PutUint32(msg[0:], uint32(len(msg)))
+	binary.LittleEndian.PutUint16(msg[4:], unix.NLMSG_DONE)
+	binary.LittleEndian.PutUint32(msg[unix.NLMSG_HDRLEN:], cnIdxProc)
+	binary.LittleEndian.PutUint32(msg[unix.NLMSG_HDRLEN+4:], cnValProc)
+	binary.LittleEndian.PutUint16(msg[unix.NLMSG_HDRLEN+16:], 4)
+	binary.LittleEndian.PutUint32(msg[unix.NLMSG_HDRLEN+cnMsgLen:], procCnMcastListen)
+
+	if err := unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+
+		return nil, fmt.Errorf("fanotify: proc connector error, %w", err)
+	}
+
+	return &procConnector{fd: fd, buf: make([]byte, os.Getpagesize())}, nil
+}
+
+// drain passes the queued fork and exit events to fn without blocking. It
+// returns unix.ENOBUFS once after events were lost to a full socket buffer,
+// events queued after the loss are passed on the next call.
+func (c *procConnector) drain(fn func(procEvent)) error {
+	for {
+		n, _, err := unix.Recvfrom(c.fd, c.buf, 0)
+		if errors.Is(err, unix.EAGAIN) {
+			return nil
+		}
+
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("fanotify: proc connector error, %w", err)
+		}
+
+		for msg := c.buf[:n]; len(msg) >= unix.NLMSG_HDRLEN; {
+			size := int(binary.LittleEndian.Uint32(msg[0:]))
+			if size < unix.NLMSG_HDRLEN || size > len(msg) {
+				break
+			}
+
+			if ev, ok := parseProcEvent(msg[unix.NLMSG_HDRLEN:size]); ok {
+				fn(ev)
+			}
+
+			// messages are aligned to 4 bytes
+			size = (size + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+			if size > len(msg) {
+				break
+			}
+
+			msg = msg[size:]
+		}
+	}
+}
+
+// parseProcEvent decodes a cn_msg carrying a fork or exit proc_event.
+func parseProcEvent(data []byte) (procEvent, bool) {
+	const off = cnMsgLen + procEventHeaderLen
+
+	if len(data) < off+16 || binary.LittleEndian.Uint32(data[0:]) != cnIdxProc {
+		return procEvent{}, false
+	}
+
+	ev := procEvent{what: binary.LittleEndian.Uint32(data[cnMsgLen:])}
+
+	switch ev.what {
+	case procEventFork:
+		ev.parentTgid = int(binary.LittleEndian.Uint32(data[off+4:]))
+		ev.pid = int(binary.LittleEndian.Uint32(data[off+8:]))
+		ev.tgid = int(binary.LittleEndian.Uint32(data[off+12:]))
+	case procEventExit:
+		ev.pid = int(binary.LittleEndian.Uint32(data[off:]))
+		ev.tgid = int(binary.LittleEndian.Uint32(data[off+4:]))
+	default:
+		return procEvent{}, false
+	}
+
+	return ev, true
+}
+
+func (c *procConnector) close() error {
+	return unix.Close(c.fd)
+}
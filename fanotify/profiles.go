@@ -0,0 +1,74 @@
+package fanotify
+
+import "os"
+
+// profileInitFlags are init flags shared by the monitoring profiles,
+// FAN_NONBLOCK lets Run, Iter and Watcher be interrupted by ctx.
+const profileInitFlags InitFlags = FAN_CLOEXEC | FAN_NONBLOCK | FAN_UNLIMITED_QUEUE | FAN_UNLIMITED_MARKS
+
+// Monitoring profile masks.
+const (
+	// FileChangeMask reports file content changes.
+	FileChangeMask EventMask = FAN_MODIFY | FAN_CLOSE_WRITE
+	// ExecMask reports program executions.
+	ExecMask EventMask = FAN_OPEN_EXEC
+	// AccessGateMask asks for a decision on every open and exec.
+	AccessGateMask EventMask = FAN_OPEN_PERM | FAN_OPEN_EXEC_PERM
+)
+
+// NewFileChangeMonitor returns a notification group reporting writes to
+// files on the mount at mount, see FileChangeMask. Use FAN_CLOSE_WRITE
+// events to act once per written file.
+func NewFileChangeMonitor(mount string, opts ...Option) (*NotifyFD, error) {
+	return newProfile(profileInitFlags|FAN_CLASS_NOTIF, opts, func(handle *NotifyFD) error {
+		return handle.Mark(FAN_MARK_ADD|FAN_MARK_MOUNT, FileChangeMask, AT_FDCWD, mount)
+	})
+}
+
+// NewExecMonitor returns a notification group reporting program executions
+// on the root mount, see ExecMask. Other mounts are added with
+// Mark(FAN_MARK_ADD|FAN_MARK_MOUNT, ExecMask, unix.AT_FDCWD, mount).
+func NewExecMonitor(opts ...Option) (*NotifyFD, error) {
+	return newProfile(profileInitFlags|FAN_CLASS_NOTIF, opts, func(handle *NotifyFD) error {
+		return handle.Mark(FAN_MARK_ADD|FAN_MARK_MOUNT, ExecMask, AT_FDCWD, "/")
+	})
+}
+
+// NewAccessGate returns a permission group asking for a decision on every
+// open and exec of paths, directories gate their direct children, see
+// AccessGateMask. Decide with OnPerm handlers and Run, or respond to events
+// from GetEvent with ResponseAllow and ResponseDeny.
+func NewAccessGate(paths ...string) (*NotifyFD, error) {
+	return newProfile(profileInitFlags|FAN_CLASS_CONTENT, nil, func(handle *NotifyFD) error {
+		for _, path := range paths {
+			mask := AccessGateMask
+
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				mask |= FAN_EVENT_ON_CHILD
+			}
+
+			if err := handle.Mark(FAN_MARK_ADD, mask, AT_FDCWD, path); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// newProfile initializes a group and applies its marks, closing the group
+// when marking fails.
+func newProfile(flags InitFlags, opts []Option, mark func(*NotifyFD) error) (*NotifyFD, error) {
+	handle, err := Initialize(flags, os.O_RDONLY, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mark(handle); err != nil {
+		_ = handle.Close()
+
+		return nil, err
+	}
+
+	return handle, nil
+}
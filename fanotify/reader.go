@@ -0,0 +1,49 @@
+package fanotify
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Sizes of the largest info records, struct fanotify_event_info_fid with a
+// MAX_HANDLE_SZ file handle and a NAME_MAX name, one per FID, DFID_NAME,
+// OLD_DFID_NAME and NEW_DFID_NAME record, plus pidfd and error records.
+const (
+	maxFidInfoLen = infoHeaderLen + 8 + 8 + 128 + 256
+	maxInfoLen    = 4*maxFidInfoLen + (infoHeaderLen + 4) + (infoHeaderLen + 8)
+)
+
+// ReadBufferSize is the size of the buffered reader created by Initialize,
+// it holds at least one event of the largest size the kernel reports, so a
+// read never ends inside an event.
+const ReadBufferSize = 8192
+
+// compile time check that ReadBufferSize fits the largest event
+const _ = uint(ReadBufferSize - FAN_EVENT_METADATA_LEN - maxInfoLen)
+
+// TruncatedEventError is returned by GetEvent when an event is shorter than
+// its metadata claims or does not fit the read buffer. Its Fd is closed, a
+// permission event allowed first. Data buffered after it is dropped to
+// resynchronize on the next kernel read, that always starts at an event
+// boundary.
+type TruncatedEventError struct {
+	EventLen uint32
+	Read     int
+}
+
+// Error implements error.
+func (err *TruncatedEventError) Error() string {
+	return fmt.Sprintf(
+		"fanotify: truncated event, read %d of %d bytes, buffered events dropped to resynchronize",
+		err.Read, err.EventLen,
+	)
+}
+
+// resync drops buffered data of a desynchronized stream, when reading goes
+// through a buffered reader such as the one created by Initialize.
+func resync(rd io.Reader) {
+	if rd, ok := rd.(*bufio.Reader); ok {
+		_, _ = rd.Discard(rd.Buffered())
+	}
+}
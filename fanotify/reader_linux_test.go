@@ -0,0 +1,45 @@
+package fanotify
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestTruncatedEventAnswered(t *testing.T) {
+	tests := []struct {
+		name     string
+		eventLen uint32
+	}{
+		{name: "shorter than metadata", eventLen: FAN_EVENT_METADATA_LEN - 1},
+		{name: "larger than read buffer", eventLen: ReadBufferSize + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeHandle(t)
+
+			fd := eventFd(t)
+			record := encodeEvent(FAN_OPEN_PERM, fd, 1)
+			binary.LittleEndian.PutUint32(record, tt.eventLen)
+
+			fake.send(t, record)
+
+			var truncated *TruncatedEventError
+			if ev, err := fake.GetEvent(); !errors.As(err, &truncated) {
+				t.Fatalf("got %+v and %v, want *TruncatedEventError", ev, err)
+			}
+
+			if _, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0); !errors.Is(err, unix.EBADF) {
+				t.Fatalf("event Fd %d still open", fd)
+			}
+
+			responses := fake.closeResponses()
+			if len(responses) != 1 || responses[0].Fd != fd || responses[0].Response != FAN_ALLOW {
+				t.Fatalf("got responses %+v, want allow for Fd %d", responses, fd)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package fanotify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordVersion is the recording format version written by Recorder.
+const RecordVersion = 1
+
+// RecordHeader is the first line of a recording.
+type RecordHeader struct {
+	Version  int       `json:"fanotify_recording"`
+	Started  time.Time `json:"started"`
+	Hostname string    `json:"hostname,omitempty"`
+}
+
+// Recorder writes events to a recording, newline delimited JSON of Event
+// values preceded by RecordHeader. It implements Sink.
+type Recorder struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewRecorder writes recording header to w and returns Recorder appending
+// events to it.
+func NewRecorder(w io.Writer) (*Recorder, error) {
+	r := &Recorder{
+		w:   w,
+		buf: bufio.NewWriter(w),
+	}
+	r.enc = json.NewEncoder(r.buf)
+
+	hdr := RecordHeader{
+		Version: RecordVersion,
+		Started: time.Now(),
+	}
+	hdr.Hostname, _ = os.Hostname()
+
+	if err := r.enc.Encode(hdr); err != nil {
+		return nil, fmt.Errorf("fanotify: record error, %w", err)
+	}
+
+	if err := r.buf.Flush(); err != nil {
+		return nil, fmt.Errorf("fanotify: record error, %w", err)
+	}
+
+	return r, nil
+}
+
+// Record appends event metadata to recording, the event Fd is not closed.
+func (r *Recorder) Record(metadata *EventMetadata) error {
+	return r.Write(metadata.Event())
+}
+
+// Write appends event to recording. Every event is flushed, so a recording
+// of a crashed process stays readable up to the last event.
+func (r *Recorder) Write(ev Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.enc.Encode(ev); err != nil {
+		return fmt.Errorf("fanotify: record error, %w", err)
+	}
+
+	if err := r.buf.Flush(); err != nil {
+		return fmt.Errorf("fanotify: record error, %w", err)
+	}
+
+	return nil
+}
+
+// Publish implements Sink.
+func (r *Recorder) Publish(_ context.Context, ev Event) error {
+	return r.Write(ev)
+}
+
+// Close implements Sink, underlying writer is closed when it is an io.Closer.
+func (r *Recorder) Close() error {
+	if c, ok := r.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// Replayer reads events from a recording written by Recorder.
+type Replayer struct {
+	Header RecordHeader
+
+	dec *json.Decoder
+}
+
+// NewReplayer reads and validates recording header from rd.
+func NewReplayer(rd io.Reader) (*Replayer, error) {
+	r := &Replayer{
+		dec: json.NewDecoder(bufio.NewReader(rd)),
+	}
+
+	if err := r.dec.Decode(&r.Header); err != nil {
+		return nil, fmt.Errorf("fanotify: replay error, %w", err)
+	}
+
+	if r.Header.Version != RecordVersion {
+		return nil, fmt.Errorf("fanotify: replay error, unsupported recording version %d", r.Header.Version)
+	}
+
+	return r, nil
+}
+
+// Next returns the next recorded event, io.EOF at the end of recording.
+func (r *Replayer) Next() (Event, error) {
+	var ev Event
+
+	err := r.dec.Decode(&ev)
+	if errors.Is(err, io.EOF) {
+		return ev, io.EOF
+	}
+
+	if err != nil {
+		return ev, fmt.Errorf("fanotify: replay error, %w", err)
+	}
+
+	return ev, nil
+}
+
+// Replay passes every recorded event to fn until the end of recording, fn
+// error or ctx cancellation. With positive speed the original gaps between
+// events are kept, divided by speed, otherwise events are replayed at once.
+func (r *Replayer) Replay(ctx context.Context, speed float64, fn func(Event) error) error {
+	var last time.Time
+
+	for {
+		ev, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if speed > 0 && !last.IsZero() && ev.Time.After(last) {
+			timer := time.NewTimer(time.Duration(float64(ev.Time.Sub(last)) / speed))
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		last = ev.Time
+
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package fanotify
+
+import (
+	"bytes"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxHeldMoves bounds FAN_MOVED_FROM events a MoveCorrelator holds, the
+// oldest is dropped beyond it.
+const maxHeldMoves = 1024
+
+// RenameEvent is a rename reported by FAN_RENAME or synthesized by a
+// MoveCorrelator from a FAN_MOVED_FROM and FAN_MOVED_TO pair. A rename out
+// of the watched directories, without a FAN_MOVED_TO, has an empty NewName.
+type RenameEvent struct {
+	Time  time.Time
+	PID   int
+	IsDir bool
+
+	OldDir  FileHandle
+	OldName string
+	NewDir  FileHandle
+	NewName string
+
+	// OldPath and NewPath are resolved through the mount fd given to
+	// NewMoveCorrelator, they are empty when resolving failed.
+	OldPath string
+	NewPath string
+
+	// Synthetic is set for pairs, unset for FAN_RENAME events.
+	Synthetic bool
+}
+
+// MoveCorrelator pairs FAN_MOVED_FROM and FAN_MOVED_TO events of the same
+// directory into RenameEvents, for kernels without FAN_RENAME (before
+// 5.17). Events need the parent directory and name, the group has to be
+// initialized with FAN_REPORT_DFID_NAME.
+//
+// fanotify has no move cookie, a FAN_MOVED_TO is paired with the latest
+// FAN_MOVED_FROM of the same directory and file type seen within window,
+// the kernel queues both halves back to back. Moves between directories
+// are not paired.
+type MoveCorrelator struct {
+	window  time.Duration
+	mountFd int
+	pool    *MountPool
+
+	mu   sync.Mutex
+	held []heldMove
+}
+
+// heldMove is an unpaired FAN_MOVED_FROM, it owns copies of the record
+// data, so that event storage can be reused.
+type heldMove struct {
+	time  time.Time
+	pid   int
+	isDir bool
+	dir   FileHandle
+	name  string
+}
+
+// NewMoveCorrelator returns a correlator pairing moves within window.
+// mountFd is an fd of the watched filesystem used to resolve directory
+// handles to paths with open_by_handle_at, which needs
+// CAP_DAC_READ_SEARCH, -1 leaves paths empty.
+func NewMoveCorrelator(window time.Duration, mountFd int) *MoveCorrelator {
+	return &MoveCorrelator{
+		window:  window,
+		mountFd: mountFd,
+	}
+}
+
+// SetMountPool resolves directory handles through the pool instead of the
+// mount fd, moves on any pooled filesystem get paths, see MountPool. Set it
+// before feeding events.
+func (c *MoveCorrelator) SetMountPool(pool *MountPool) {
+	c.pool = pool
+}
+
+// Add feeds ev to the correlator, it returns a RenameEvent for FAN_RENAME
+// events and for a FAN_MOVED_TO completing a pair, nil otherwise. Unpaired
+// FAN_MOVED_TO events, a move into the directory, are not reported. Marks
+// with both FAN_RENAME and FAN_MOVE report every rename twice.
+func (c *MoveCorrelator) Add(ev *EventMetadata) *RenameEvent {
+	mask := EventMask(ev.Mask)
+	isDir := mask&FAN_ONDIR != 0
+
+	switch {
+	case mask&FAN_RENAME != 0:
+		oldDir, oldName, ok := ev.fid(FAN_EVENT_INFO_TYPE_OLD_DFID_NAME)
+		if !ok {
+			return nil
+		}
+
+		newDir, newName, _ := ev.fid(FAN_EVENT_INFO_TYPE_NEW_DFID_NAME)
+
+		return c.rename(heldMove{
+			time:  ev.Time,
+			pid:   ev.GetPID(),
+			isDir: isDir,
+			dir:   oldDir,
+			name:  oldName,
+		}, newDir, newName, false)
+	case mask&FAN_MOVED_FROM != 0:
+		dir, name, ok := ev.fid(FAN_EVENT_INFO_TYPE_DFID_NAME)
+		if !ok {
+			return nil
+		}
+
+		c.hold(heldMove{
+			time:  ev.Time,
+			pid:   ev.GetPID(),
+			isDir: isDir,
+			dir:   copyHandle(dir),
+			name:  name,
+		})
+	case mask&FAN_MOVED_TO != 0:
+		dir, name, ok := ev.fid(FAN_EVENT_INFO_TYPE_DFID_NAME)
+		if !ok {
+			return nil
+		}
+
+		from, ok := c.match(dir, isDir, ev.Time)
+		if !ok {
+			return nil
+		}
+
+		return c.rename(from, dir, name, true)
+	}
+
+	return nil
+}
+
+// Expire removes FAN_MOVED_FROM events held longer than window at now and
+// returns them as renames out of the watched directories, call it
+// periodically.
+func (c *MoveCorrelator) Expire(now time.Time) []RenameEvent {
+	c.mu.Lock()
+
+	var expired []heldMove
+
+	kept := c.held[:0]
+
+	for _, move := range c.held {
+		if now.Sub(move.time) > c.window {
+			expired = append(expired, move)
+		} else {
+			kept = append(kept, move)
+		}
+	}
+
+	c.held = kept
+	c.mu.Unlock()
+
+	out := make([]RenameEvent, 0, len(expired))
+
+	for _, move := range expired {
+		out = append(out, *c.rename(move, FileHandle{}, "", true))
+	}
+
+	return out
+}
+
+// Len returns the number of held FAN_MOVED_FROM events.
+func (c *MoveCorrelator) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.held)
+}
+
+func (c *MoveCorrelator) hold(move heldMove) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.held) >= maxHeldMoves {
+		c.held = append(c.held[:0], c.held[1:]...)
+	}
+
+	c.held = append(c.held, move)
+}
+
+// match removes and returns the latest held move from dir within window.
+func (c *MoveCorrelator) match(dir FileHandle, isDir bool, now time.Time) (heldMove, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := len(c.held) - 1; i >= 0; i-- {
+		move := c.held[i]
+
+		if move.isDir != isDir || !sameHandle(move.dir, dir) || now.Sub(move.time) > c.window {
+			continue
+		}
+
+		c.held = append(c.held[:i], c.held[i+1:]...)
+
+		return move, true
+	}
+
+	return heldMove{}, false
+}
+
+func (c *MoveCorrelator) rename(from heldMove, newDir FileHandle, newName string, synthetic bool) *RenameEvent {
+	ev := &RenameEvent{
+		Time:      from.time,
+		PID:       from.pid,
+		IsDir:     from.isDir,
+		OldDir:    copyHandle(from.dir),
+		OldName:   from.name,
+		NewDir:    copyHandle(newDir),
+		NewName:   newName,
+		Synthetic: synthetic,
+	}
+
+	if c.mountFd < 0 && c.pool == nil {
+		return ev
+	}
+
+	if dir, err := c.resolve(ev.OldDir); err == nil {
+		ev.OldPath = filepath.Join(dir, ev.OldName)
+	}
+
+	if newName == "" {
+		return ev
+	}
+
+	if dir, err := c.resolve(ev.NewDir); err == nil {
+		ev.NewPath = filepath.Join(dir, ev.NewName)
+	}
+
+	return ev
+}
+
+// resolve returns the path of directory h through the pool, when set, or
+// the correlator mount fd.
+func (c *MoveCorrelator) resolve(h FileHandle) (string, error) {
+	if c.pool != nil {
+		return c.pool.Resolve(h)
+	}
+
+	return resolveHandle(c.mountFd, h)
+}
+
+func copyHandle(h FileHandle) FileHandle {
+	h.Handle = append([]byte(nil), h.Handle...)
+
+	return h
+}
+
+func sameHandle(a, b FileHandle) bool {
+	return a.Fsid == b.Fsid && a.Type == b.Type && bytes.Equal(a.Handle, b.Handle)
+}
@@ -0,0 +1,27 @@
+package fanotify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// resolveHandle returns the current path of the directory h on the
+// filesystem of mountFd.
+func resolveHandle(mountFd int, h FileHandle) (string, error) {
+	fd, err := openHandle(mountFd, h, "", unix.O_PATH)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(fd)
+
+	path, err := os.Readlink(filepath.Join(ProcFsFd, strconv.Itoa(fd)))
+	if err != nil {
+		return "", fmt.Errorf("fanotify: handle error, %w", err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,223 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// responseSize is the size of struct fanotify_response.
+const responseSize = 8
+
+// ErrResponded is returned by responses to an event that was answered
+// before, by the event methods, the NotifyFD ones or a ResponseBatcher.
+var ErrResponded = errors.New("fanotify: event already answered")
+
+// Allow answers a permission event with FAN_ALLOW through the NotifyFD it
+// was read from and closes its Fd. An event is answered once, later
+// responses return ErrResponded and leave the Fd to the first responder. A
+// failed response is not retried, the Fd is closed all the same.
+func (metadata *EventMetadata) Allow() error {
+	return metadata.answer(func(handle *NotifyFD) error {
+		return handle.ResponseAllow(metadata)
+	})
+}
+
+// Deny answers a permission event with FAN_DENY, see Allow.
+func (metadata *EventMetadata) Deny() error {
+	return metadata.answer(func(handle *NotifyFD) error {
+		return handle.ResponseDeny(metadata)
+	})
+}
+
+// Responded reports whether the event was answered, by its own methods,
+// the NotifyFD ones or a ResponseBatcher.
+func (metadata *EventMetadata) Responded() bool {
+	return atomic.LoadInt32(&metadata.responded) != 0
+}
+
+// claimResponse marks the event answered, it returns 'false' when it was
+// already.
+func (metadata *EventMetadata) claimResponse() bool {
+	return atomic.CompareAndSwapInt32(&metadata.responded, 0, 1)
+}
+
+// answer sends the response of respond and closes the event Fd, unless the
+// event was answered before.
+func (metadata *EventMetadata) answer(respond func(handle *NotifyFD) error) error {
+	if metadata.handle == nil {
+		return fmt.Errorf("fanotify: response error, event not read from a NotifyFD")
+	}
+
+	if !metadata.IsPermission() {
+		return fmt.Errorf("fanotify: response error, not a permission event")
+	}
+
+	err := respond(metadata.handle)
+	if errors.Is(err, ErrResponded) {
+		return err
+	}
+
+	if cerr := metadata.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// ResponseBatcher queues permission responses and writes them with a single
+// writev, instead of one write per event. The kernel handles one response
+// per iovec inside that one syscall. A batch is written once it holds max
+// responses or interval after its first response, whichever comes first,
+// interval bounds the added decision latency.
+type ResponseBatcher struct {
+	handle   *NotifyFD
+	max      int
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending []*EventMetadata
+	allow   []bool
+	timer   *time.Timer
+	err     error
+	closed  bool
+}
+
+// NewResponseBatcher returns a batcher writing responses to notify.
+func NewResponseBatcher(notify *NotifyFD, max int, interval time.Duration) *ResponseBatcher {
+	if max <= 0 {
+		max = 1
+	}
+
+	// keep the iovec count below IOV_MAX
+	if max > 1024 {
+		max = 1024
+	}
+
+	return &ResponseBatcher{
+		handle:   notify,
+		max:      max,
+		interval: interval,
+	}
+}
+
+// Allow queues an allow response. The batcher takes over the event and
+// closes its Fd once the response was written, events handed out by Run or
+// Iter need Retain. Errors of a batch written by the interval timer are
+// returned by the next call.
+func (b *ResponseBatcher) Allow(ev *EventMetadata) error {
+	return b.queue(ev, true)
+}
+
+// Deny queues a deny response, see Allow.
+func (b *ResponseBatcher) Deny(ev *EventMetadata) error {
+	return b.queue(ev, false)
+}
+
+func (b *ResponseBatcher) queue(ev *EventMetadata, allow bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// the response is written unbatched, the event must not be left
+	// unanswered
+	if b.closed {
+		response := uint32(FAN_DENY)
+		if allow {
+			response = FAN_ALLOW
+		}
+
+		err := b.handle.respond(ev, response)
+		if errors.Is(err, ErrResponded) {
+			return err
+		}
+
+		if cerr := ev.Close(); err == nil {
+			err = cerr
+		}
+
+		if err == nil {
+			err = fmt.Errorf("fanotify: response error, batcher closed")
+		}
+
+		return err
+	}
+
+	if !ev.claimResponse() {
+		return ErrResponded
+	}
+
+	b.pending = append(b.pending, ev)
+	b.allow = append(b.allow, allow)
+
+	if len(b.pending) >= b.max || b.interval <= 0 {
+		return b.flushLocked()
+	}
+
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, b.flushTimer)
+	}
+
+	err := b.err
+	b.err = nil
+
+	return err
+}
+
+// Flush writes all queued responses now.
+func (b *ResponseBatcher) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.flushLocked()
+}
+
+// Close writes queued responses. Later Allow and Deny calls write their
+// response at once, unbatched, and return an error.
+func (b *ResponseBatcher) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	return b.flushLocked()
+}
+
+func (b *ResponseBatcher) flushTimer() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.flushLocked(); err != nil {
+		b.err = err
+	}
+}
+
+func (b *ResponseBatcher) flushLocked() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	err := b.err
+	b.err = nil
+
+	if len(b.pending) == 0 {
+		return err
+	}
+
+	if werr := b.write(); err == nil {
+		err = werr
+	}
+
+	for _, ev := range b.pending {
+		if cerr := ev.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	b.pending = b.pending[:0]
+	b.allow = b.allow[:0]
+
+	return err
+}
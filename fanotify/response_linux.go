@@ -0,0 +1,72 @@
+package fanotify
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// write sends all pending responses, a rejected response is reported and
+// the ones after it are still sent.
+func (b *ResponseBatcher) write() error {
+	buf := make([]byte, responseSize*len(b.pending))
+
+	for i, ev := range b.pending {
+		response := uint32(FAN_DENY)
+		if b.allow[i] {
+			response = FAN_ALLOW
+		}
+
+		binary.LittleEndian.PutUint32(buf[i*responseSize:], uint32(ev.Fd))
+		binary.LittleEndian.PutUint32(buf[i*responseSize+4:], response)
+	}
+
+	var errs error
+
+	b.handle.writeMu.Lock()
+	defer b.handle.writeMu.Unlock()
+
+	for len(buf) > 0 {
+		iovs := make([][]byte, 0, len(buf)/responseSize)
+
+		for off := 0; off < len(buf); off += responseSize {
+			iovs = append(iovs, buf[off:off+responseSize])
+		}
+
+		var n int
+
+		err := b.handle.retry(func() (err error) {
+			n, err = unix.Writev(b.handle.Fd, iovs)
+
+			return err
+		})
+
+		// the kernel stops at the first rejected response, it is written
+		// alone to get its error and skipped
+		if err != nil || n < len(buf) {
+			if n < 0 {
+				n = 0
+			}
+
+			buf = buf[n-n%responseSize:]
+
+			err := b.handle.retry(func() error {
+				_, err := unix.Write(b.handle.Fd, buf[:responseSize])
+
+				return err
+			})
+			if err != nil && errs == nil {
+				errs = fmt.Errorf("fanotify: response error, %w", err)
+			}
+
+			buf = buf[responseSize:]
+
+			continue
+		}
+
+		buf = buf[n:]
+	}
+
+	return errs
+}
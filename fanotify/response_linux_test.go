@@ -0,0 +1,37 @@
+package fanotify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResponseBatcherClosed(t *testing.T) {
+	fake := newFakeHandle(t)
+	b := NewResponseBatcher(fake.NotifyFD, 16, time.Hour)
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fd := eventFd(t)
+	fake.send(t, encodeEvent(FAN_OPEN_PERM, fd, 1))
+
+	ev, err := fake.GetEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Deny(ev); err == nil {
+		t.Fatal("Deny after Close succeeded")
+	}
+
+	// the event is answered all the same
+	responses := fake.closeResponses()
+	if len(responses) != 1 || responses[0].Fd != fd || responses[0].Response != FAN_DENY {
+		t.Fatalf("got responses %+v, want deny for Fd %d", responses, fd)
+	}
+
+	if !ev.Responded() {
+		t.Fatal("event not marked answered")
+	}
+}
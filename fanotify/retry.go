@@ -0,0 +1,64 @@
+package fanotify
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// ErrWouldBlock is returned by GetEvent when a FAN_NONBLOCK handle has no
+// event queued, WaitEvent waits for one instead. It matches unix.EAGAIN with
+// errors.Is.
+var ErrWouldBlock error = wouldBlockError{}
+
+type wouldBlockError struct{}
+
+func (wouldBlockError) Error() string {
+	return "fanotify: no event available"
+}
+
+func (wouldBlockError) Is(target error) bool {
+	return target == syscall.EAGAIN
+}
+
+// RetryPolicy controls how syscalls interrupted by a signal (EINTR) are
+// retried. Reads and response writes already retry EINTR, the policy covers
+// marks, path resolution and batched responses.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, 1 disables retrying.
+	Attempts int
+	// Backoff is the delay before the second attempt, it grows linearly.
+	Backoff time.Duration
+}
+
+// DefaultRetryPolicy is used when no policy is set with WithRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 8}
+
+// WithRetryPolicy sets the EINTR retry policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(handle *NotifyFD) {
+		handle.retryPolicy = &policy
+	}
+}
+
+// retry calls fn until it does not fail with EINTR or attempts run out.
+func (handle *NotifyFD) retry(fn func() error) error {
+	policy := DefaultRetryPolicy
+	if handle.retryPolicy != nil {
+		policy = *handle.retryPolicy
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := handle.injectFault(FaultEINTR)
+		if err == nil {
+			err = fn()
+		}
+		if !errors.Is(err, syscall.EINTR) || attempt >= policy.Attempts {
+			return err
+		}
+
+		if policy.Backoff > 0 {
+			time.Sleep(policy.Backoff * time.Duration(attempt))
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package fanotify
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrRingFull is returned by EventRing.Next when every slot or the whole
+// arena is taken by events not released yet.
+var ErrRingFull = errors.New("fanotify: event ring full")
+
+// EventRing reads events into preallocated storage: a fixed number of
+// EventMetadata slots and a byte arena holding their raw data (Raw and
+// InfoRecords). Reading does not allocate, so memory stays flat during
+// bursts. Events returned by Next are valid until Release, which recycles
+// their slot and arena space, they must not be kept after it.
+//
+// Space is reclaimed in read order, an event released early frees its slot
+// once all older events were released as well.
+type EventRing struct {
+	handle *NotifyFD
+
+	// nextMu serializes Next, mu guards the ring state
+	nextMu sync.Mutex
+	mu     sync.Mutex
+
+	slots    []EventMetadata
+	offsets  []int
+	released []bool
+	head     int
+	count    int
+
+	arena     []byte
+	arenaHead int
+	arenaTail int
+}
+
+// NewEventRing returns a ring reading from notify with slots events and an
+// arena of arenaBytes, which needs room for at least one event of
+// ReadBufferSize bytes. Average events take 24 to a few hundred bytes,
+// depending on FAN_REPORT_* flags.
+func NewEventRing(notify *NotifyFD, slots, arenaBytes int) (*EventRing, error) {
+	if slots <= 0 {
+		return nil, fmt.Errorf("fanotify: ring error, invalid slot count %d", slots)
+	}
+
+	if arenaBytes < ReadBufferSize {
+		return nil, fmt.Errorf("fanotify: ring error, arena of %d bytes below %d", arenaBytes, ReadBufferSize)
+	}
+
+	return &EventRing{
+		handle:   notify,
+		slots:    make([]EventMetadata, slots),
+		offsets:  make([]int, slots),
+		released: make([]bool, slots),
+		arena:    make([]byte, arenaBytes),
+	}, nil
+}
+
+// Next reads the next event into the ring, with GetEvent semantics for
+// skipPIDs and filters: dropped events are skipped and the following event
+// is read. It returns ErrRingFull without reading when there is no room,
+// release events first.
+func (r *EventRing) Next(skipPIDs ...int) (*EventMetadata, error) {
+	r.nextMu.Lock()
+	defer r.nextMu.Unlock()
+
+	for {
+		ev, err := r.next(skipPIDs)
+		if !errors.Is(err, ErrSkipped) {
+			return ev, err
+		}
+	}
+}
+
+// next reads one event into the ring, r.nextMu is held.
+func (r *EventRing) next(skipPIDs []int) (*EventMetadata, error) {
+	slot, off, ok := r.reserve()
+	if !ok {
+		return nil, ErrRingFull
+	}
+
+	event := &r.slots[slot]
+
+	r.handle.readMu.Lock()
+	_, err := r.handle.readEvent(event, r.arena[off:off+ReadBufferSize:off+ReadBufferSize])
+	r.handle.readMu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	event.ring, event.slot = r, slot
+
+	r.mu.Lock()
+	r.offsets[slot] = off
+	r.arenaTail = off
+
+	// events above ReadBufferSize are read into their own slice
+	if len(event.raw) <= ReadBufferSize {
+		r.arenaTail += len(event.raw)
+	}
+	r.count++
+	r.mu.Unlock()
+
+	ev, err := r.handle.process(event, skipPIDs)
+	if ev == nil {
+		r.free(slot)
+	}
+
+	return ev, err
+}
+
+// Release closes event and returns its storage to the ring.
+func (r *EventRing) Release(event *EventMetadata) error {
+	if event.ring != r {
+		return fmt.Errorf("fanotify: ring error, event not owned by ring")
+	}
+
+	err := event.Close()
+	r.free(event.slot)
+
+	return err
+}
+
+// Len returns the number of events not released yet.
+func (r *EventRing) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.count
+}
+
+// reserve returns the next slot and an arena offset with room for the
+// largest event.
+func (r *EventRing) reserve() (slot, off int, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.count == len(r.slots) {
+		return 0, 0, false
+	}
+
+	slot = (r.head + r.count) % len(r.slots)
+
+	switch {
+	case r.count == 0:
+		r.arenaHead, r.arenaTail = 0, 0
+
+		return slot, 0, true
+	case r.arenaTail > r.arenaHead:
+		if len(r.arena)-r.arenaTail >= ReadBufferSize {
+			return slot, r.arenaTail, true
+		}
+
+		// wrap around when the start of the arena is free
+		if r.arenaHead >= ReadBufferSize {
+			return slot, 0, true
+		}
+	case r.arenaHead-r.arenaTail >= ReadBufferSize:
+		return slot, r.arenaTail, true
+	}
+
+	return 0, 0, false
+}
+
+// free marks slot released and reclaims storage of the oldest released
+// events.
+func (r *EventRing) free(slot int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.released[slot] {
+		return
+	}
+
+	r.released[slot] = true
+
+	for r.count > 0 && r.released[r.head] {
+		r.released[r.head] = false
+		r.slots[r.head].ring = nil
+		r.head = (r.head + 1) % len(r.slots)
+		r.count--
+	}
+
+	if r.count > 0 {
+		r.arenaHead = r.offsets[r.head]
+	}
+}
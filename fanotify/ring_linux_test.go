@@ -0,0 +1,50 @@
+package fanotify
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestEventRingDebugFdLeaks(t *testing.T) {
+	DebugFdLeaks = true
+	defer func() { DebugFdLeaks = false }()
+
+	fake := newFakeHandle(t)
+
+	ring, err := NewEventRing(fake.NotifyFD, 4, 4*ReadBufferSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for round := 0; round < 3; round++ {
+		fake.send(t,
+			encodeEvent(FAN_OPEN, eventFd(t), 1),
+			encodeEvent(FAN_CLOSE_WRITE, eventFd(t), 2),
+		)
+
+		first, err := ring.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := ring.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := len(OpenEventFds()); n != 2 {
+			t.Fatalf("round %d: %d tracked Fds, want 2", round, n)
+		}
+
+		// ring events carry no finalizer, collecting must not close them
+		runtime.GC()
+
+		for _, ev := range []*EventMetadata{first, second} {
+			if err := ring.Release(ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		CheckFdLeaksT(t)
+	}
+}
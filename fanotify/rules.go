@@ -0,0 +1,290 @@
+package fanotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// RuleAction is what a matching Rule does with an event.
+type RuleAction string
+
+// Rule actions, drop ends evaluation, other actions accumulate.
+const (
+	// RuleDrop drops the event like a Filter returning 'false', permission
+	// events are allowed.
+	RuleDrop RuleAction = "drop"
+	// RuleTag adds Rule.Tag to EventMetadata.Tags.
+	RuleTag RuleAction = "tag"
+	// RuleRoute publishes the event to the sink registered as Rule.Sink.
+	RuleRoute RuleAction = "route"
+	// RuleEscalate calls the escalation handler, see RuleSet.OnEscalate.
+	RuleEscalate RuleAction = "escalate"
+)
+
+// Rule matches events when all of its set conditions match.
+type Rule struct {
+	Name string `json:"name,omitempty"`
+	// Mask selects events having any of the mask bits set, in ParseMask
+	// syntax, e.g. "open,close_write".
+	Mask string `json:"mask,omitempty"`
+	// Path is matched with MatchPath against the event path.
+	Path string `json:"path,omitempty"`
+	// UID is the real UID of the process that generated the event.
+	UID *int `json:"uid,omitempty"`
+	// Comm is a filepath.Match glob matched against the process command name.
+	Comm string `json:"comm,omitempty"`
+
+	Action RuleAction `json:"action"`
+	Tag    string     `json:"tag,omitempty"`
+	Sink   string     `json:"sink,omitempty"`
+}
+
+// RulesFile is the rule file format read by LoadRules.
+type RulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadRules reads a JSON RulesFile.
+func LoadRules(path string) ([]Rule, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: rules error, %w", err)
+	}
+
+	var file RulesFile
+
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("fanotify: rules error, %s: %w", path, err)
+	}
+
+	return file.Rules, nil
+}
+
+type compiledRule struct {
+	Rule
+	name string
+	mask EventMask
+}
+
+// RuleSet evaluates rules, in order, over events. Register it with a
+// NotifyFD through WithRules, or call Apply from a read loop.
+type RuleSet struct {
+	rules []compiledRule
+
+	mu         sync.RWMutex
+	sinks      map[string]Sink
+	onEscalate func(*EventMetadata)
+	onError    func(error)
+	suppressor *Suppressor
+}
+
+// NewRuleSet validates rules and returns a RuleSet evaluating them.
+func NewRuleSet(rules ...Rule) (*RuleSet, error) {
+	rs := &RuleSet{
+		rules: make([]compiledRule, 0, len(rules)),
+		sinks: make(map[string]Sink),
+	}
+
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+
+		compiled := compiledRule{Rule: rule, name: name}
+
+		if rule.Mask != "" {
+			mask, err := ParseMask(rule.Mask)
+			if err != nil {
+				return nil, fmt.Errorf("fanotify: rule %s error, %w", name, err)
+			}
+
+			compiled.mask = mask
+		}
+
+		for _, pattern := range []string{rule.Path, rule.Comm} {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("fanotify: rule %s error, %w", name, err)
+			}
+		}
+
+		switch rule.Action {
+		case RuleDrop, RuleEscalate:
+		case RuleTag:
+			if rule.Tag == "" {
+				return nil, fmt.Errorf("fanotify: rule %s error, tag action without tag", name)
+			}
+		case RuleRoute:
+			if rule.Sink == "" {
+				return nil, fmt.Errorf("fanotify: rule %s error, route action without sink", name)
+			}
+		default:
+			return nil, fmt.Errorf("fanotify: rule %s error, unknown action %q", name, rule.Action)
+		}
+
+		rs.rules = append(rs.rules, compiled)
+	}
+
+	return rs, nil
+}
+
+// Route registers sink under name for route rules, events routed to a name
+// without a sink are reported to OnError.
+func (rs *RuleSet) Route(name string, sink Sink) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.sinks[name] = sink
+}
+
+// OnEscalate sets the handler called for events matched by escalate rules,
+// escalated events are only tagged "escalated" without it.
+func (rs *RuleSet) OnEscalate(fn func(*EventMetadata)) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.onEscalate = fn
+}
+
+// OnError sets a handler for failed route publishes, they are dropped by
+// default.
+func (rs *RuleSet) OnError(fn func(error)) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.onError = fn
+}
+
+// Suppress makes rules named by windows of s, a Rule Name or the rule index
+// for unnamed ones, not match events of the window paths.
+func (rs *RuleSet) Suppress(s *Suppressor) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.suppressor = s
+}
+
+// Apply evaluates rules over event, tagging, routing and escalating it, and
+// returns 'false' when a drop rule matched. It is a Filter.
+func (rs *RuleSet) Apply(event *EventMetadata) bool {
+	rs.mu.RLock()
+	sinks, onEscalate, onError, suppressor := rs.sinks, rs.onEscalate, rs.onError, rs.suppressor
+	rs.mu.RUnlock()
+
+	var (
+		facts    ruleFacts
+		escalate bool
+	)
+
+	for i := range rs.rules {
+		rule := &rs.rules[i]
+
+		if !facts.match(event, rule) {
+			continue
+		}
+
+		if suppressor != nil && suppressor.suppressesRule(rule.name, event) {
+			continue
+		}
+
+		switch rule.Action {
+		case RuleDrop:
+			return false
+		case RuleTag:
+			event.tag(rule.Tag)
+		case RuleRoute:
+			sink, ok := sinks[rule.Sink]
+			if !ok {
+				if onError != nil {
+					onError(fmt.Errorf("fanotify: route error, no sink %q", rule.Sink))
+				}
+
+				continue
+			}
+
+			if err := sink.Publish(context.Background(), event.Event()); err != nil && onError != nil {
+				onError(fmt.Errorf("fanotify: route error, %s: %w", rule.Sink, err))
+			}
+		case RuleEscalate:
+			escalate = true
+		}
+	}
+
+	if escalate {
+		event.tag("escalated")
+
+		if onEscalate != nil {
+			onEscalate(event)
+		}
+	}
+
+	return true
+}
+
+// WithRules adds rs as a filter, see RuleSet.Apply, for events read by
+// GetEvent, Run and Watcher. Like all filters rules run before enrichers,
+// routed events therefore carry no enricher data.
+func WithRules(rs *RuleSet) Option {
+	return WithFilter(rs.Apply)
+}
+
+// ruleFacts caches per event values looked up by rules.
+type ruleFacts struct {
+	comm    string
+	commErr error
+
+	haveComm bool
+}
+
+// match reports whether all set conditions of rule match event, events
+// lacking a looked up value do not match.
+func (f *ruleFacts) match(event *EventMetadata, rule *compiledRule) bool {
+	if rule.mask != 0 && event.Mask&uint64(rule.mask) == 0 {
+		return false
+	}
+
+	if rule.UID != nil {
+		// GetCredentials is memoized by the event
+		creds, err := event.GetCredentials()
+		if err != nil || creds.UID != *rule.UID {
+			return false
+		}
+	}
+
+	if rule.Comm != "" {
+		if !f.haveComm {
+			f.comm, f.commErr = event.GetComm()
+			f.haveComm = true
+		}
+
+		if ok, _ := filepath.Match(rule.Comm, f.comm); f.commErr != nil || !ok {
+			return false
+		}
+	}
+
+	if rule.Path != "" {
+		// GetPath is memoized by the event
+		path, err := event.GetPath()
+		if err != nil || !MatchPath(rule.Path, path) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tag adds tag to event tags once.
+func (metadata *EventMetadata) tag(tag string) {
+	for _, v := range metadata.Tags {
+		if v == tag {
+			return
+		}
+	}
+
+	metadata.Tags = append(metadata.Tags, tag)
+}
@@ -0,0 +1,154 @@
+package fanotify
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+)
+
+// SampleRule samples events matching all of its set conditions, with either
+// a Rate or an Every.
+type SampleRule struct {
+	Name string `json:"name,omitempty"`
+	// Mask selects events having any of the mask bits set.
+	Mask EventMask `json:"mask,omitempty"`
+	// Prefix selects events for paths at or below the directory.
+	Prefix string `json:"prefix,omitempty"`
+	// Rate keeps each event with this probability, in (0, 1].
+	Rate float64 `json:"rate,omitempty"`
+	// Every keeps every Nth event.
+	Every uint64 `json:"every,omitempty"`
+}
+
+// SampleCount is the accounting of one SampleRule.
+type SampleCount struct {
+	Rule string
+	// Seen are the matched events, Kept the ones that were not sampled out.
+	Seen uint64
+	Kept uint64
+}
+
+type sampleRule struct {
+	SampleRule
+	name   string
+	weight float64
+
+	seen uint64
+	kept uint64
+}
+
+// Sampler thins out high-volume events, e.g. FAN_ACCESS of log
+// directories, for telemetry pipelines. The first matching rule samples an
+// event; events matching no rule and permission events, which a decision
+// is needed for, are always kept.
+//
+// Kept events carry the rule weight in EventMetadata.SampleWeight, 1/Rate or
+// Every, summing weights of kept events extrapolates the rate of matched
+// events.
+type Sampler struct {
+	rules []*sampleRule
+}
+
+// NewSampler validates rules and returns a Sampler applying them.
+func NewSampler(rules ...SampleRule) (*Sampler, error) {
+	s := &Sampler{rules: make([]*sampleRule, 0, len(rules))}
+
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+
+		compiled := &sampleRule{SampleRule: rule, name: name}
+
+		switch {
+		case rule.Rate != 0 && rule.Every != 0:
+			return nil, fmt.Errorf("fanotify: sample rule %s error, both rate and every", name)
+		case rule.Every != 0:
+			compiled.weight = float64(rule.Every)
+		case rule.Rate > 0 && rule.Rate <= 1:
+			compiled.weight = 1 / rule.Rate
+		default:
+			return nil, fmt.Errorf("fanotify: sample rule %s error, rate %v out of (0, 1]", name, rule.Rate)
+		}
+
+		s.rules = append(s.rules, compiled)
+	}
+
+	return s, nil
+}
+
+// Apply samples event and returns 'false' when it is sampled out, it is a
+// Filter.
+func (s *Sampler) Apply(event *EventMetadata) bool {
+	if event.Mask&permissionEvents != 0 {
+		return true
+	}
+
+	var (
+		path     string
+		havePath bool
+	)
+
+	for _, rule := range s.rules {
+		if rule.Mask != 0 && event.Mask&uint64(rule.Mask) == 0 {
+			continue
+		}
+
+		if rule.Prefix != "" {
+			if !havePath {
+				// GetPath is memoized by the event
+				path, _ = event.GetPath()
+				havePath = true
+			}
+
+			if _, ok := cutPathPrefix(path, rule.Prefix); !ok || path == "" {
+				continue
+			}
+		}
+
+		seen := atomic.AddUint64(&rule.seen, 1)
+
+		var keep bool
+
+		if rule.Every != 0 {
+			// the first of every Every events is kept
+			keep = (seen-1)%rule.Every == 0
+		} else {
+			keep = rand.Float64() < rule.Rate
+		}
+
+		if !keep {
+			return false
+		}
+
+		atomic.AddUint64(&rule.kept, 1)
+		event.SampleWeight = rule.weight
+
+		return true
+	}
+
+	return true
+}
+
+// Counts returns the accounting of all rules, in rule order.
+func (s *Sampler) Counts() []SampleCount {
+	counts := make([]SampleCount, len(s.rules))
+
+	for i, rule := range s.rules {
+		counts[i] = SampleCount{
+			Rule: rule.name,
+			Seen: atomic.LoadUint64(&rule.seen),
+			Kept: atomic.LoadUint64(&rule.kept),
+		}
+	}
+
+	return counts
+}
+
+// WithSampling adds s as a filter, see Sampler.Apply. Register it after
+// filters whose drops should not count as seen.
+func WithSampling(s *Sampler) Option {
+	return WithFilter(s.Apply)
+}
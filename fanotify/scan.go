@@ -0,0 +1,191 @@
+package fanotify
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// WithExistingFiles makes Run publish an event for every file that already
+// exists in the marked trees before reading kernel events, so that
+// consumers starting late still see a complete picture. Synthesized events
+// have Synthetic set, no mask bits other than FAN_ONDIR for directories and
+// no PID.
+//
+// Mount and filesystem marks are walked from the marked path down without
+// crossing into other filesystems, directory marks with FAN_EVENT_ON_CHILD
+// (and inotify watches of directories) cover direct children, other marks
+// only the marked object. Files changed while walking can be reported by a
+// synthesized and a kernel event, kernel events queue up in the meantime.
+func WithExistingFiles() WatcherOption {
+	return func(w *Watcher) {
+		w.scanExisting = true
+	}
+}
+
+// scanRoot is a marked object to synthesize events for.
+type scanRoot struct {
+	path string
+	// tree walks all descendants on the same filesystem, children direct
+	// children only
+	tree     bool
+	children bool
+	// dev is the device of path, -1 when it can not be stat'ed
+	dev int64
+}
+
+// scan publishes synthesized events for all scan roots until ctx is done.
+func (w *Watcher) scan(ctx context.Context) {
+	roots := w.scanRoots()
+
+	for i, root := range roots {
+		if coveredRoot(roots, i) {
+			continue
+		}
+
+		err := walkRoot(ctx, root, func(path string, dir bool) {
+			ev := Event{Time: time.Now(), Path: path, Synthetic: true}
+			if dir {
+				ev.Mask = FAN_ONDIR
+			}
+
+			w.publishEvent(ctx, ev)
+			atomic.AddUint64(&w.published, 1)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			w.error(err)
+		}
+	}
+}
+
+// coveredRoot reports whether roots[i] is walked by another root already,
+// so that overlapping marks do not report files twice.
+func coveredRoot(roots []scanRoot, i int) bool {
+	for j, other := range roots {
+		switch {
+		case j == i:
+			continue
+		case other == roots[i] && j < i:
+			return true
+		case other.tree && other.dev == roots[i].dev && other.path != roots[i].path &&
+			strings.HasPrefix(roots[i].path, strings.TrimSuffix(other.path, "/")+"/"):
+			return true
+		case other.tree && !roots[i].tree && other.path == roots[i].path:
+			return true
+		case other.children && !roots[i].tree && !roots[i].children &&
+			filepath.Dir(roots[i].path) == filepath.Clean(other.path):
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanRoots returns scan roots for the current marks or inotify watches.
+func (w *Watcher) scanRoots() []scanRoot {
+	var roots []scanRoot
+
+	if w.inotify != nil {
+		w.inotify.mu.Lock()
+		defer w.inotify.mu.Unlock()
+
+		for _, path := range w.inotify.watches {
+			roots = append(roots, newScanRoot(path, false, true))
+		}
+
+		return roots
+	}
+
+	for _, spec := range w.Notify().Marks() {
+		if spec.Flags&markIgnoreFlags != 0 || spec.Path == "" || spec.Flags&markTypeFlags == FAN_MARK_MNTNS {
+			continue
+		}
+
+		path := spec.Path
+		if spec.DirFd != AT_FDCWD && !filepath.IsAbs(path) {
+			dir, err := os.Readlink(filepath.Join(ProcFsFd, strconv.Itoa(spec.DirFd)))
+			if err != nil {
+				continue
+			}
+
+			path = filepath.Join(dir, path)
+		}
+
+		roots = append(roots, newScanRoot(path, spec.Flags&markTypeFlags != 0, spec.Mask&FAN_EVENT_ON_CHILD != 0))
+	}
+
+	return roots
+}
+
+func newScanRoot(path string, tree, children bool) scanRoot {
+	root := scanRoot{path: path, tree: tree, children: children, dev: -1}
+
+	if st, err := lstatPath(path); err == nil {
+		root.dev = int64(st.Dev)
+		// only directories have children
+		root.children = children && st.IsDir()
+	}
+
+	return root
+}
+
+// walkRoot calls fn for the objects root covers.
+func walkRoot(ctx context.Context, root scanRoot, fn func(path string, dir bool)) error {
+	st, err := lstatPath(root.path)
+	if err != nil {
+		return &os.PathError{Op: "lstat", Path: root.path, Err: err}
+	}
+
+	dev := st.Dev
+	isDir := st.IsDir()
+
+	if !isDir || (!root.tree && !root.children) {
+		fn(root.path, isDir)
+
+		return nil
+	}
+
+	if !root.tree {
+		entries, err := os.ReadDir(root.path)
+
+		for _, entry := range entries {
+			fn(filepath.Join(root.path, entry.Name()), entry.IsDir())
+		}
+
+		return err
+	}
+
+	return filepath.WalkDir(root.path, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			// unreadable directories are skipped, the walk goes on
+			return nil
+		}
+
+		if path == root.path {
+			return nil
+		}
+
+		if d.IsDir() {
+			if sub, err := lstatPath(path); err == nil && sub.Dev != dev {
+				return filepath.SkipDir
+			}
+		}
+
+		fn(path, d.IsDir())
+
+		return nil
+	})
+}
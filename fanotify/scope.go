@@ -0,0 +1,117 @@
+package fanotify
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Scope is a set of directory subtrees stored as a trie of path components,
+// lookups cost one map access per component of the checked path regardless
+// of the number of directories. It gives subtree semantics to mount and
+// filesystem marks, which watch a whole mount or superblock.
+type Scope struct {
+	root scopeNode
+}
+
+type scopeNode struct {
+	children map[string]*scopeNode
+	// end marks a configured directory, everything below it is in scope
+	end bool
+}
+
+// NewScope returns a Scope of directories, paths are cleaned and must be
+// absolute, relative ones are ignored.
+func NewScope(dirs ...string) *Scope {
+	s := new(Scope)
+
+	for _, dir := range dirs {
+		s.Add(dir)
+	}
+
+	return s
+}
+
+// Add adds directory subtree to scope, it is not safe to call concurrently
+// with Contains.
+func (s *Scope) Add(dir string) {
+	if !filepath.IsAbs(dir) {
+		return
+	}
+
+	node := &s.root
+
+	for _, name := range splitPath(dir) {
+		if node.end {
+			// an ancestor already covers dir
+			return
+		}
+
+		if node.children == nil {
+			node.children = make(map[string]*scopeNode)
+		}
+
+		next, ok := node.children[name]
+		if !ok {
+			next = new(scopeNode)
+			node.children[name] = next
+		}
+
+		node = next
+	}
+
+	node.end = true
+	node.children = nil
+}
+
+// Contains reports whether path is one of the scope directories or below one.
+func (s *Scope) Contains(path string) bool {
+	node := &s.root
+
+	if !filepath.IsAbs(path) {
+		return false
+	}
+
+	if node.end {
+		return true
+	}
+
+	for _, name := range splitPath(path) {
+		if node = node.children[name]; node == nil {
+			return false
+		}
+
+		if node.end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter returns a Filter keeping only events for paths in scope. Events
+// without a resolvable path are dropped.
+func (s *Scope) Filter() Filter {
+	return func(metadata *EventMetadata) bool {
+		path, err := metadata.GetPath()
+		if err != nil {
+			return false
+		}
+
+		return s.Contains(path)
+	}
+}
+
+// InScope keeps only events for paths in listed directory subtrees, see Scope.
+func InScope(dirs ...string) Filter {
+	return NewScope(dirs...).Filter()
+}
+
+// splitPath returns the components of a cleaned absolute path.
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(filepath.Clean(path), "/")
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,84 @@
+package fanotify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// SelinuxXattr is the extended attribute holding the SELinux file context.
+const SelinuxXattr = "security.selinux"
+
+// SecurityContext are the mandatory access control labels of an event, as
+// used by SELinux or AppArmor policies.
+type SecurityContext struct {
+	// Subject is the context of the process, e.g.
+	// "unconfined_u:unconfined_r:unconfined_t:s0" for SELinux or
+	// "/usr/sbin/cupsd (enforce)" for AppArmor.
+	Subject string `json:"subject,omitempty"`
+	// Object is the SELinux context of the file, AppArmor does not label
+	// files.
+	Object string `json:"object,omitempty"`
+}
+
+// GetSubjectContext returns the security context of the process that
+// generated the event, read from '/proc/PID/attr/current'. When the group
+// reports pidfds the process is verified as for GetCredentials.
+func (metadata *EventMetadata) GetSubjectContext() (string, error) {
+	if err := metadata.verifyProcessPidfd(); err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(filepath.Join(ProcFs, strconv.Itoa(metadata.GetPID()), "attr", "current"))
+	if err != nil {
+		return "", fmt.Errorf("fanotify: procfs error, %w", err)
+	}
+
+	if err := metadata.verifyProcessPidfd(); err != nil {
+		return "", err
+	}
+
+	return trimContext(content), nil
+}
+
+// GetObjectContext returns the SELinux context of the file, read from the
+// SelinuxXattr attribute of the event Fd.
+func (metadata *EventMetadata) GetObjectContext() (string, error) {
+	if metadata.Fd < 0 {
+		return "", fmt.Errorf("fanotify: xattr error, event without Fd, %w", syscall.EBADF)
+	}
+
+	val, err := metadata.GetXattr(SelinuxXattr)
+	if err != nil {
+		return "", err
+	}
+
+	return trimContext(val), nil
+}
+
+// trimContext strips the NUL and newline terminators the kernel and
+// userspace tools leave on contexts.
+func trimContext(b []byte) string {
+	return strings.TrimRight(string(b), "\x00\n")
+}
+
+// WithSecurityContext enriches every event with its subject and object
+// security contexts, see GetSubjectContext and GetObjectContext, so that
+// fanotify activity can be correlated with MAC decisions, e.g. AVC denials
+// in the audit log. Contexts that are unavailable, without an active LSM or
+// for exited processes, are left empty, events without any carry none.
+func WithSecurityContext() Option {
+	return WithEnricher(func(metadata *EventMetadata) {
+		var sc SecurityContext
+
+		sc.Subject, _ = metadata.GetSubjectContext()
+		sc.Object, _ = metadata.GetObjectContext()
+
+		if sc != (SecurityContext{}) {
+			metadata.Security = &sc
+		}
+	})
+}
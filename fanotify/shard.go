@@ -0,0 +1,133 @@
+package fanotify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ShardConfig configures RunSharded.
+type ShardConfig struct {
+	// Readers is the number of reader goroutines, GOMAXPROCS when zero.
+	Readers int
+	// CPUs, when set, pins reader i to CPU CPUs[i%len(CPUs)], e.g. the CPUs
+	// of the NUMA node of the workload, the Go scheduler then keeps the
+	// reader on its own OS thread.
+	CPUs []int
+}
+
+// RunSharded is Run with events read and dispatched by several goroutines,
+// for event rates where a single reader, or the handlers it runs, saturate
+// one CPU.
+//
+// Readers share the group: every read(2) takes whole events from the kernel
+// queue, the syscall itself is serialized by the kernel, decoding, filters,
+// enrichers, handlers and responses run in parallel. Events are therefore
+// dispatched out of order across readers, and handlers must be safe for
+// concurrent use. Throughput scales with readers while handlers dominate
+// the cost per event, e.g. permission handlers hashing content, and not at
+// all for trivial handlers, see the live/permission benchmarks of the bench
+// command.
+//
+// Several groups marked identically all receive every event, so sharding by
+// group means marking disjoint paths, one group each, merged by a Manager.
+//
+// RunSharded reads the handle File directly and must not be mixed with
+// GetEvent, Run or an EventRing.
+func (handle *NotifyFD) RunSharded(ctx context.Context, cfg ShardConfig, skipPIDs ...int) error {
+	readers := cfg.Readers
+	if readers <= 0 {
+		readers = runtime.GOMAXPROCS(0)
+	}
+
+	defer handle.denyWg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stop := interruptOnDone(ctx, handle.File, handle.error)
+	defer stop()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	for i := 0; i < readers; i++ {
+		cpu := -1
+		if len(cfg.CPUs) != 0 {
+			cpu = cfg.CPUs[i%len(cfg.CPUs)]
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := handle.runShard(ctx, cpu, skipPIDs); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr == nil {
+		return ctx.Err()
+	}
+
+	return firstErr
+}
+
+// runShard is one RunSharded reader, pinned to cpu unless it is negative.
+func (handle *NotifyFD) runShard(ctx context.Context, cpu int, skipPIDs []int) error {
+	if cpu >= 0 {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		if err := pinThread(cpu); err != nil {
+			return fmt.Errorf("fanotify: shard error, cpu %d: %w", cpu, err)
+		}
+	}
+
+	rd := bufio.NewReaderSize(handle.File, ReadBufferSize)
+	hdr := make([]byte, FAN_EVENT_METADATA_LEN)
+
+	var batch time.Time
+
+	for {
+		fresh := rd.Buffered() == 0
+
+		ev, err := handle.decodeEvent(rd, hdr, new(EventMetadata), nil)
+		if err == nil {
+			handle.stampBatch(ev, &batch, fresh)
+			ev, err = handle.process(ev, skipPIDs)
+		}
+
+		if ctx.Err() != nil {
+			if ev != nil {
+				_ = handle.skip(ev)
+			}
+
+			return nil
+		}
+
+		if errors.Is(err, ErrSkipped) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		handle.dispatch(ev)
+	}
+}
@@ -0,0 +1,12 @@
+package fanotify
+
+import "golang.org/x/sys/unix"
+
+// pinThread restricts the calling OS thread to cpu.
+func pinThread(cpu int) error {
+	var set unix.CPUSet
+
+	set.Set(cpu)
+
+	return unix.SchedSetaffinity(0, &set)
+}
@@ -0,0 +1,215 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// tableName restricts journal table names to plain identifiers, they are
+// part of the statements.
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Journal records events in an SQL table indexed by path, pid and time, so
+// that small deployments can answer "what touched /etc/shadow yesterday"
+// from an embedded database without a SIEM.
+//
+// It uses database/sql with the driver the caller registered, e.g. an
+// SQLite driver, statements use SQLite syntax with "?" placeholders. Events
+// are stored as their JSON encoding, see Encode, along with the indexed
+// columns.
+type Journal struct {
+	db     *sql.DB
+	table  string
+	insert *sql.Stmt
+}
+
+// NewJournal creates table and its indices in db unless they exist and
+// returns a sink writing events to it.
+func NewJournal(ctx context.Context, db *sql.DB, table string) (*Journal, error) {
+	if !tableName.MatchString(table) {
+		return nil, fmt.Errorf("sink: journal error, invalid table name %q", table)
+	}
+
+	schema := []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (
+			id INTEGER PRIMARY KEY,
+			time INTEGER NOT NULL,
+			pid INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			mask INTEGER NOT NULL,
+			event TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + table + `_path ON ` + table + ` (path, time)`,
+		`CREATE INDEX IF NOT EXISTS ` + table + `_pid ON ` + table + ` (pid, time)`,
+		`CREATE INDEX IF NOT EXISTS ` + table + `_time ON ` + table + ` (time)`,
+	}
+
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("sink: journal error, schema: %w", err)
+		}
+	}
+
+	insert, err := db.PrepareContext(ctx,
+		`INSERT INTO `+table+` (time, pid, path, mask, event) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return nil, fmt.Errorf("sink: journal error, %w", err)
+	}
+
+	return &Journal{
+		db:     db,
+		table:  table,
+		insert: insert,
+	}, nil
+}
+
+// Publish implements fanotify.Sink.
+func (s *Journal) Publish(ctx context.Context, ev fanotify.Event) error {
+	data, err := Encode(ev)
+	if err != nil {
+		return err
+	}
+
+	// masks above 1<<63 do not fit an SQL INTEGER, the kernel sets none
+	if _, err := s.insert.ExecContext(ctx, ev.Time.UnixNano(), ev.PID, ev.Path, int64(ev.Mask), string(data)); err != nil {
+		return fmt.Errorf("sink: journal error, %w", err)
+	}
+
+	return nil
+}
+
+// Close implements fanotify.Sink, the database is owned by the caller.
+func (s *Journal) Close() error {
+	return s.insert.Close()
+}
+
+// JournalQuery selects journal events matching all of its set fields.
+type JournalQuery struct {
+	// Path is matched exactly, or as a directory prefix when it ends with
+	// "/", like MatchPath.
+	Path string
+	PID  int
+	// Mask selects events having any of the mask bits set.
+	Mask uint64
+	// Since and Until bound the event time, Until is exclusive.
+	Since time.Time
+	Until time.Time
+	// Limit caps the number of events returned, the newest ones are
+	// dropped.
+	Limit int
+}
+
+// Query returns events matching q, oldest first.
+func (s *Journal) Query(ctx context.Context, q JournalQuery) ([]fanotify.Event, error) {
+	where, args := q.where()
+
+	stmt := `SELECT event FROM ` + s.table + where + ` ORDER BY time, id`
+	if q.Limit > 0 {
+		stmt += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sink: journal error, %w", err)
+	}
+	defer rows.Close()
+
+	var events []fanotify.Event
+
+	for rows.Next() {
+		var (
+			data string
+			ev   fanotify.Event
+		)
+
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("sink: journal error, %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return nil, fmt.Errorf("sink: journal error, %w", err)
+		}
+
+		events = append(events, ev)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sink: journal error, %w", err)
+	}
+
+	return events, nil
+}
+
+// Touched returns events for path, a file or a directory prefix ending with
+// "/", within the last period.
+func (s *Journal) Touched(ctx context.Context, path string, period time.Duration) ([]fanotify.Event, error) {
+	return s.Query(ctx, JournalQuery{Path: path, Since: time.Now().Add(-period)})
+}
+
+// Prune deletes events older than before, for retention, and returns the
+// number of deleted events.
+func (s *Journal) Prune(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM `+s.table+` WHERE time < ?`, before.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("sink: journal error, %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("sink: journal error, %w", err)
+	}
+
+	return n, nil
+}
+
+// where returns the WHERE clause of q with its arguments.
+func (q JournalQuery) where() (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	switch {
+	case strings.HasSuffix(q.Path, "/"):
+		// a range over the path index, "0" follows "/"
+		conds = append(conds, `path >= ? AND path < ?`)
+		args = append(args, q.Path, strings.TrimSuffix(q.Path, "/")+"0")
+	case q.Path != "":
+		conds = append(conds, `path = ?`)
+		args = append(args, q.Path)
+	}
+
+	if q.PID != 0 {
+		conds = append(conds, `pid = ?`)
+		args = append(args, q.PID)
+	}
+
+	if q.Mask != 0 {
+		conds = append(conds, `mask & ? != 0`)
+		args = append(args, int64(q.Mask))
+	}
+
+	if !q.Since.IsZero() {
+		conds = append(conds, `time >= ?`)
+		args = append(args, q.Since.UnixNano())
+	}
+
+	if !q.Until.IsZero() {
+		conds = append(conds, `time < ?`)
+		args = append(args, q.Until.UnixNano())
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return ` WHERE ` + strings.Join(conds, ` AND `), args
+}
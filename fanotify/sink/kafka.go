@@ -0,0 +1,49 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// KafkaProducer is the subset of a Kafka producer used by Kafka, wrap the
+// writer of your client library (e.g. kafka-go Writer.WriteMessages or a
+// sarama SyncProducer) to satisfy it.
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, key, value []byte) error
+}
+
+// Kafka produces JSON encoded events to a Kafka topic, keyed by path so
+// that events for one file keep their order within a partition.
+type Kafka struct {
+	producer KafkaProducer
+	topic    string
+}
+
+// NewKafka returns a sink producing events to topic with producer.
+func NewKafka(producer KafkaProducer, topic string) *Kafka {
+	return &Kafka{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+// Publish implements fanotify.Sink.
+func (s *Kafka) Publish(ctx context.Context, ev fanotify.Event) error {
+	data, err := Encode(ev)
+	if err != nil {
+		return err
+	}
+
+	if err := s.producer.Produce(ctx, s.topic, []byte(ev.Path), data); err != nil {
+		return fmt.Errorf("sink: kafka error, %w", err)
+	}
+
+	return nil
+}
+
+// Close implements fanotify.Sink, the producer is owned by the caller.
+func (s *Kafka) Close() error {
+	return nil
+}
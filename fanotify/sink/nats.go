@@ -0,0 +1,47 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// NATSPublisher is the subset of a NATS connection used by NATS,
+// *nats.Conn from github.com/nats-io/nats.go satisfies it as is.
+type NATSPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATS publishes JSON encoded events to a NATS subject.
+type NATS struct {
+	conn    NATSPublisher
+	subject string
+}
+
+// NewNATS returns a sink publishing events to subject over conn.
+func NewNATS(conn NATSPublisher, subject string) *NATS {
+	return &NATS{
+		conn:    conn,
+		subject: subject,
+	}
+}
+
+// Publish implements fanotify.Sink.
+func (s *NATS) Publish(_ context.Context, ev fanotify.Event) error {
+	data, err := Encode(ev)
+	if err != nil {
+		return err
+	}
+
+	if err := s.conn.Publish(s.subject, data); err != nil {
+		return fmt.Errorf("sink: nats error, %w", err)
+	}
+
+	return nil
+}
+
+// Close implements fanotify.Sink, the connection is owned by the caller.
+func (s *NATS) Close() error {
+	return nil
+}
@@ -0,0 +1,63 @@
+// Package sink provides reference fanotify.Sink implementations that publish
+// events to message buses for SIEM pipelines, or journal them locally.
+//
+// Adapters are defined against small interfaces instead of concrete client
+// libraries, so this package does not pull NATS or Kafka clients into every
+// build, wrap the client you already use to satisfy them.
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// Encode returns the JSON encoding of event used by all sinks in this package.
+func Encode(ev fanotify.Event) ([]byte, error) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return nil, fmt.Errorf("sink: encode error, %w", err)
+	}
+
+	return data, nil
+}
+
+// JSONLines writes events as newline delimited JSON.
+type JSONLines struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	w   io.Writer
+}
+
+// NewJSONLines returns a sink writing events to w.
+func NewJSONLines(w io.Writer) *JSONLines {
+	return &JSONLines{
+		enc: json.NewEncoder(w),
+		w:   w,
+	}
+}
+
+// Publish implements fanotify.Sink.
+func (s *JSONLines) Publish(_ context.Context, ev fanotify.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.enc.Encode(ev); err != nil {
+		return fmt.Errorf("sink: write error, %w", err)
+	}
+
+	return nil
+}
+
+// Close implements fanotify.Sink, w is closed when it is an io.Closer.
+func (s *JSONLines) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
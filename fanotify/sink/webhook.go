@@ -0,0 +1,378 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// ErrWebhookClosed is returned by Webhook.Publish after Close.
+var ErrWebhookClosed = errors.New("sink: webhook closed")
+
+// WebhookConfig configures a Webhook, zero fields take the defaults noted.
+type WebhookConfig struct {
+	// Client sends the requests, one with a 10s timeout by default.
+	Client *http.Client
+	// Header is added to every request, e.g. Authorization.
+	Header http.Header
+	// BatchSize is the number of events per request, 100 by default.
+	BatchSize int
+	// Interval is how long a partial batch waits for more events, 1s by
+	// default.
+	Interval time.Duration
+	// Gzip compresses request bodies, with Content-Encoding: gzip.
+	Gzip bool
+	// Attempts is the number of deliveries tried per batch, 5 by default.
+	Attempts int
+	// Backoff is the delay before the second attempt, 500ms by default, it
+	// doubles for every further attempt up to MaxBackoff, 30s by default. A
+	// Retry-After of the endpoint up to MaxBackoff takes precedence.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Queue is the number of batches waiting for delivery, 16 by default,
+	// events of further batches are dropped.
+	Queue int
+	// OnError is called with the error of every failed batch.
+	OnError func(error)
+}
+
+// WebhookStats are delivery metrics of a Webhook, counted in events except
+// for Requests and Retries.
+type WebhookStats struct {
+	Delivered uint64
+	// Failed are events of batches that ran out of attempts or were
+	// rejected with a 4xx status other than 408 and 429.
+	Failed  uint64
+	Dropped uint64
+	// Requests are sent requests, Retries the ones repeating a batch.
+	Requests uint64
+	Retries  uint64
+}
+
+// Webhook posts events as JSON arrays to an HTTP endpoint, e.g. an existing
+// alerting receiver. Publish only queues, batches are delivered by one
+// goroutine in order, retrying network errors and 408, 429 and 5xx
+// statuses with exponential backoff.
+type Webhook struct {
+	url string
+	cfg WebhookConfig
+
+	mu     sync.Mutex
+	batch  []fanotify.Event
+	timer  *time.Timer
+	closed bool
+
+	acker fanotify.Acker
+
+	queue chan []fanotify.Event
+	stop  chan struct{}
+	done  chan struct{}
+
+	stats WebhookStats
+}
+
+// NewWebhook returns a sink posting events to url.
+func NewWebhook(url string, cfg WebhookConfig) *Webhook {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = 5
+	}
+
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 500 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+
+	if cfg.Queue <= 0 {
+		cfg.Queue = 16
+	}
+
+	s := &Webhook{
+		url:   url,
+		cfg:   cfg,
+		queue: make(chan []fanotify.Event, cfg.Queue),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Publish implements fanotify.Sink, it queues ev without waiting for
+// delivery.
+func (s *Webhook) Publish(_ context.Context, ev fanotify.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrWebhookClosed
+	}
+
+	s.batch = append(s.batch, ev)
+
+	if len(s.batch) >= s.cfg.BatchSize {
+		s.flushLocked()
+	} else if s.timer == nil {
+		s.timer = time.AfterFunc(s.cfg.Interval, s.Flush)
+	}
+
+	return nil
+}
+
+// Flush queues the partial batch for delivery now.
+func (s *Webhook) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flushLocked()
+}
+
+func (s *Webhook) flushLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	if len(s.batch) == 0 || s.closed {
+		return
+	}
+
+	select {
+	case s.queue <- s.batch:
+	default:
+		atomic.AddUint64(&s.stats.Dropped, uint64(len(s.batch)))
+	}
+
+	s.batch = nil
+}
+
+// SetAcker implements fanotify.AckingSink, delivered events are
+// acknowledged once the endpoint accepted their batch, and a delivery after
+// failed ones is reported as reconnect.
+func (s *Webhook) SetAcker(acker fanotify.Acker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.acker = acker
+}
+
+// Stats returns delivery metrics.
+func (s *Webhook) Stats() WebhookStats {
+	return WebhookStats{
+		Delivered: atomic.LoadUint64(&s.stats.Delivered),
+		Failed:    atomic.LoadUint64(&s.stats.Failed),
+		Dropped:   atomic.LoadUint64(&s.stats.Dropped),
+		Requests:  atomic.LoadUint64(&s.stats.Requests),
+		Retries:   atomic.LoadUint64(&s.stats.Retries),
+	}
+}
+
+// Run blocks until ctx is done, then closes the sink, delivering queued
+// batches, so that the delivery goroutine is bound to ctx, e.g. in an
+// errgroup next to fanotify.Watcher.Run. It returns nil after Close, else
+// ctx.Err().
+func (s *Webhook) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+	case <-s.stop:
+		return nil
+	}
+
+	s.Close()
+
+	return ctx.Err()
+}
+
+// Close implements fanotify.Sink, it delivers queued batches and waits for
+// them. Failing batches are not retried after Close.
+func (s *Webhook) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.flushLocked()
+		s.closed = true
+		close(s.queue)
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+
+	return nil
+}
+
+func (s *Webhook) run() {
+	defer close(s.done)
+
+	var failing bool
+
+	for batch := range s.queue {
+		if err := s.deliver(batch); err != nil {
+			atomic.AddUint64(&s.stats.Failed, uint64(len(batch)))
+			failing = true
+
+			if s.cfg.OnError != nil {
+				s.cfg.OnError(err)
+			}
+
+			continue
+		}
+
+		atomic.AddUint64(&s.stats.Delivered, uint64(len(batch)))
+
+		s.mu.Lock()
+		acker := s.acker
+		s.mu.Unlock()
+
+		if acker != nil {
+			s.ack(acker, batch, failing)
+		}
+
+		failing = false
+	}
+}
+
+// ack acknowledges the delivered batch, before reporting a reconnect so
+// that the batch is not retransmitted.
+func (s *Webhook) ack(acker fanotify.Acker, batch []fanotify.Event, reconnected bool) {
+	seqs := make([]uint64, 0, len(batch))
+	for _, ev := range batch {
+		seqs = append(seqs, ev.Seq)
+	}
+
+	acker.Ack(seqs...)
+
+	if reconnected {
+		acker.Reconnected()
+	}
+}
+
+// deliver posts batch until it is accepted, rejected or attempts run out.
+func (s *Webhook) deliver(batch []fanotify.Event) error {
+	body, err := s.encode(batch)
+	if err != nil {
+		return err
+	}
+
+	backoff := s.cfg.Backoff
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			atomic.AddUint64(&s.stats.Retries, 1)
+		}
+
+		wait, err := s.post(body)
+		if err == nil || wait < 0 || attempt >= s.cfg.Attempts {
+			return err
+		}
+
+		if wait == 0 || wait > s.cfg.MaxBackoff {
+			wait = backoff
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-s.stop:
+			return err
+		}
+
+		if backoff *= 2; backoff > s.cfg.MaxBackoff {
+			backoff = s.cfg.MaxBackoff
+		}
+	}
+}
+
+// encode returns the request body of batch.
+func (s *Webhook) encode(batch []fanotify.Event) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := io.Writer(&buf)
+
+	var zw *gzip.Writer
+	if s.cfg.Gzip {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+
+	if err := json.NewEncoder(w).Encode(batch); err != nil {
+		return nil, fmt.Errorf("sink: encode error, %w", err)
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("sink: encode error, %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// post sends body once. On failure it returns the Retry-After delay, zero
+// for the backoff, or a negative one when retrying is pointless.
+func (s *Webhook) post(body []byte) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return -1, fmt.Errorf("sink: webhook error, %w", err)
+	}
+
+	for k, v := range s.cfg.Header {
+		req.Header[k] = v
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if s.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	atomic.AddUint64(&s.stats.Requests, 1)
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("sink: webhook error, %w", err)
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return 0, nil
+	case code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500:
+		var wait time.Duration
+
+		if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && sec > 0 {
+			wait = time.Duration(sec) * time.Second
+		}
+
+		return wait, fmt.Errorf("sink: webhook error, status %s", resp.Status)
+	default:
+		return -1, fmt.Errorf("sink: webhook error, status %s", resp.Status)
+	}
+}
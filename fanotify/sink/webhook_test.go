@@ -0,0 +1,84 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/s3rj1k/go-fanotify/fanotify"
+)
+
+// checkGoroutines fails t when more than before goroutines are left, they
+// are given a moment to return.
+func checkGoroutines(t testing.TB, before int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines left, want %d:\n%s",
+				runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWebhookRunCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	var requests int32
+
+	// the failing endpoint keeps the batch waiting for a retry
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	transport := &http.Transport{}
+
+	s := NewWebhook(endpoint.URL, WebhookConfig{
+		Client:    &http.Client{Transport: transport},
+		BatchSize: 1,
+		Backoff:   time.Hour,
+	})
+
+	if err := s.Publish(context.Background(), fanotify.Event{PID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for atomic.LoadInt32(&requests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() { done <- s.Run(ctx) }()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Run: got %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+
+	if err := s.Publish(context.Background(), fanotify.Event{PID: 2}); !errors.Is(err, ErrWebhookClosed) {
+		t.Fatalf("Publish after Run: got %v, want ErrWebhookClosed", err)
+	}
+
+	transport.CloseIdleConnections()
+	endpoint.Close()
+	checkGoroutines(t, before)
+}
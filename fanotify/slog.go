@@ -0,0 +1,34 @@
+//go:build go1.21
+
+package fanotify
+
+import (
+	"log/slog"
+)
+
+// LogValue implements slog.LogValuer, the event is logged as a group with
+// the fields of String, plus the read time:
+//
+//	logger.Info("event", "event", ev)
+func (metadata *EventMetadata) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, 6)
+
+	attrs = append(attrs,
+		slog.String("mask", EventMask(metadata.Mask).String()),
+		slog.Int("pid", metadata.GetPID()),
+		slog.Int("fd", int(metadata.Fd)),
+		slog.String("fd_state", metadata.fdStateName()),
+	)
+
+	if path, ok := metadata.cachedPath(); ok {
+		attrs = append(attrs, slog.String("path", path))
+	} else if name := metadata.recordName(); name != "" {
+		attrs = append(attrs, slog.String("name", name))
+	}
+
+	if !metadata.Time.IsZero() {
+		attrs = append(attrs, slog.Time("time", metadata.Time))
+	}
+
+	return slog.GroupValue(attrs...)
+}
@@ -0,0 +1,152 @@
+package fanotify
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Snapshot is file content of an event captured in a sealed memfd, see
+// ContentMemfd, so that analysis after the event was answered sees exactly
+// what was opened, even when the file changed since.
+type Snapshot struct {
+	// Event is the event the content was captured for.
+	Event Event
+	// File is the sealed memfd holding the content, at offset 0.
+	File *os.File
+	// Size is the number of bytes captured.
+	Size int64
+	// Truncated is set when the file was larger than the capture limit.
+	Truncated bool
+	// Allowed is the decision taken for a DeferredAnalyzer permission event.
+	Allowed bool
+}
+
+// Snapshot captures up to maxSize bytes of file content, all of it when
+// maxSize is not positive. The snapshot outlives the event, close it when
+// done.
+func (metadata *EventMetadata) Snapshot(maxSize int64) (*Snapshot, error) {
+	file, err := metadata.ContentMemfd(maxSize)
+	if err != nil && !errors.Is(err, ErrContentTooLarge) {
+		return nil, err
+	}
+
+	st, serr := file.Stat()
+	if serr != nil {
+		_ = file.Close()
+
+		return nil, serr
+	}
+
+	return &Snapshot{
+		Event:     metadata.Event(),
+		File:      file,
+		Size:      st.Size(),
+		Truncated: err != nil,
+	}, nil
+}
+
+// Close closes the snapshot memfd.
+func (s *Snapshot) Close() error {
+	return s.File.Close()
+}
+
+// DeferredAnalyzer splits permission decisions into a fast decision taken
+// while the process waits and a deep analysis of the same content later,
+// e.g. a full scan raising alerts for files already allowed by a hash
+// allowlist. Content is snapshotted before the decision, analysis runs on
+// one worker goroutine in event order.
+type DeferredAnalyzer struct {
+	maxSize int64
+	analyze func(*Snapshot)
+
+	mu      sync.RWMutex
+	queue   chan *Snapshot
+	closed  bool
+	done    chan struct{}
+	dropped uint64
+}
+
+// NewDeferredAnalyzer starts an analyzer calling analyze with snapshots of
+// up to maxSize bytes, see EventMetadata.Snapshot. At most queue snapshots,
+// each holding its content in memory, wait for analysis, snapshots of
+// further events are dropped. analyze closes the snapshots it is passed.
+func NewDeferredAnalyzer(maxSize int64, queue int, analyze func(*Snapshot)) *DeferredAnalyzer {
+	if queue <= 0 {
+		queue = 1
+	}
+
+	a := &DeferredAnalyzer{
+		maxSize: maxSize,
+		analyze: analyze,
+		queue:   make(chan *Snapshot, queue),
+		done:    make(chan struct{}),
+	}
+
+	go a.run()
+
+	return a
+}
+
+func (a *DeferredAnalyzer) run() {
+	defer close(a.done)
+
+	for s := range a.queue {
+		a.analyze(s)
+	}
+}
+
+// Wrap returns a PermHandler snapshotting event content, deciding with
+// decide and queueing the snapshot for analysis.
+func (a *DeferredAnalyzer) Wrap(decide PermHandler) PermHandler {
+	return func(ev *EventMetadata) bool {
+		s, err := ev.Snapshot(a.maxSize)
+		if err != nil {
+			atomic.AddUint64(&a.dropped, 1)
+
+			return decide(ev)
+		}
+
+		s.Allowed = decide(ev)
+		a.enqueue(s)
+
+		return s.Allowed
+	}
+}
+
+// enqueue queues s for analysis or drops it.
+func (a *DeferredAnalyzer) enqueue(s *Snapshot) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if !a.closed {
+		select {
+		case a.queue <- s:
+			return
+		default:
+		}
+	}
+
+	atomic.AddUint64(&a.dropped, 1)
+	_ = s.Close()
+}
+
+// Dropped returns the number of events that were not analyzed, because
+// the queue was full, the analyzer closed or content could not be captured.
+func (a *DeferredAnalyzer) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Close stops queueing snapshots and waits for the queued ones to be
+// analyzed.
+func (a *DeferredAnalyzer) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	<-a.done
+}
@@ -0,0 +1,394 @@
+package fanotify
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrSpillClosed is returned by SpillBuffer.Publish after Close.
+var ErrSpillClosed = errors.New("fanotify: spill buffer closed")
+
+// spillHeader is the size of the length prefix of a spilled event.
+const spillHeader = 4
+
+// SpillConfig configures a SpillBuffer.
+type SpillConfig struct {
+	// Path is the ring file, it is truncated on start and removed on Close.
+	Path string
+	// MaxBytes bounds the ring file, the oldest spilled events are dropped
+	// to make room for new ones.
+	MaxBytes int64
+	// Memory is the number of events buffered in memory before spilling,
+	// 1024 when zero.
+	Memory int
+	// OnError receives delivery and decoding errors, they are dropped when nil.
+	OnError func(error)
+}
+
+// SpillStats are SpillBuffer counters.
+type SpillStats struct {
+	// Memory is the number of events buffered in memory.
+	Memory int
+	// Depth is the number of events in the ring file.
+	Depth int
+	// DepthBytes is the ring file space used.
+	DepthBytes int64
+	// Spilled is the number of events ever written to the ring file.
+	Spilled uint64
+	// Dropped is the number of events lost to a full ring file or Close.
+	Dropped uint64
+}
+
+// SpillBuffer is a Sink that decouples the reader from a slow sink. Events
+// are buffered in memory and, once that is full, spilled to a bounded ring
+// file, a background goroutine delivers them in order as the sink catches
+// up. It keeps the kernel queue drained while the sink stalls.
+type SpillBuffer struct {
+	next    Sink
+	onError func(error)
+	memMax  int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	mem     []Event
+	ring    *spillRing
+	busy    bool
+	closed  bool
+	spilled uint64
+	dropped uint64
+}
+
+// NewSpillBuffer returns a SpillBuffer delivering events to next.
+func NewSpillBuffer(next Sink, cfg SpillConfig) (*SpillBuffer, error) {
+	if cfg.MaxBytes <= spillHeader {
+		return nil, fmt.Errorf("fanotify: spill error, ring size %d too small", cfg.MaxBytes)
+	}
+
+	f, err := os.OpenFile(cfg.Path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: spill error, %w", err)
+	}
+
+	if cfg.Memory <= 0 {
+		cfg.Memory = 1024
+	}
+
+	s := &SpillBuffer{
+		next:    next,
+		onError: cfg.OnError,
+		memMax:  cfg.Memory,
+		done:    make(chan struct{}),
+		ring:    &spillRing{f: f, size: cfg.MaxBytes},
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	go s.deliver()
+
+	return s, nil
+}
+
+// Publish implements Sink, it only blocks on the ring file write.
+func (s *SpillBuffer) Publish(_ context.Context, ev Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrSpillClosed
+	}
+
+	defer s.cond.Broadcast()
+
+	// once spilling started, events go to the ring to keep the order
+	if s.ring.count == 0 && len(s.mem) < s.memMax {
+		s.mem = append(s.mem, ev)
+
+		return nil
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("fanotify: spill error, %w", err)
+	}
+
+	evicted, err := s.ring.push(data)
+	s.dropped += uint64(evicted)
+
+	if err != nil {
+		s.dropped++
+
+		return err
+	}
+
+	s.spilled++
+
+	return nil
+}
+
+// Flush waits until all buffered events were delivered or ctx is done.
+func (s *SpillBuffer) Flush(ctx context.Context) error {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for (len(s.mem) > 0 || s.ring.count > 0 || s.busy) && !s.closed && ctx.Err() == nil {
+		s.cond.Wait()
+	}
+
+	return ctx.Err()
+}
+
+// Stats returns current counters.
+func (s *SpillBuffer) Stats() SpillStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return SpillStats{
+		Memory:     len(s.mem),
+		Depth:      s.ring.count,
+		DepthBytes: s.ring.tail - s.ring.head,
+		Spilled:    s.spilled,
+		Dropped:    s.dropped,
+	}
+}
+
+// Run blocks until ctx is done, then closes the buffer, so that the
+// delivery goroutine is bound to ctx, e.g. in an errgroup next to
+// Watcher.Run. It returns nil after Close, else the Close error or
+// ctx.Err(). Call Flush before cancelling ctx to deliver buffered events.
+func (s *SpillBuffer) Run(ctx context.Context) error {
+	return runUntilDone(ctx, s.done, s.Close)
+}
+
+// Close implements Sink. Delivery in progress is cancelled, events still
+// buffered are dropped, use Flush first to deliver them. The ring file is
+// removed and next is closed.
+func (s *SpillBuffer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+
+		return nil
+	}
+
+	s.closed = true
+	s.cancel()
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	<-s.done
+
+	s.mu.Lock()
+	s.dropped += uint64(len(s.mem) + s.ring.count)
+	s.mem = nil
+	s.mu.Unlock()
+
+	err := s.ring.f.Close()
+	if rerr := os.Remove(s.ring.f.Name()); err == nil {
+		err = rerr
+	}
+
+	if err != nil {
+		err = fmt.Errorf("fanotify: spill error, %w", err)
+	}
+
+	if nerr := s.next.Close(); err == nil {
+		err = nerr
+	}
+
+	return err
+}
+
+func (s *SpillBuffer) deliver() {
+	defer close(s.done)
+
+	for {
+		ev, ok, err := s.pop()
+		if !ok {
+			return
+		}
+
+		if err != nil {
+			s.error(err)
+
+			continue
+		}
+
+		if err := s.next.Publish(s.ctx, ev); err != nil {
+			s.error(fmt.Errorf("fanotify: sink error, %w", err))
+		}
+
+		s.mu.Lock()
+		s.busy = false
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+// pop waits for the oldest buffered event, it returns 'false' after Close.
+// An event that can not be read back from the ring is dropped and returned
+// as error.
+func (s *SpillBuffer) pop() (Event, bool, error) {
+	var ev Event
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.mem) == 0 && s.ring.count == 0 && !s.closed {
+		s.cond.Wait()
+	}
+
+	if s.closed {
+		return ev, false, nil
+	}
+
+	if len(s.mem) > 0 {
+		ev = s.mem[0]
+		s.mem = s.mem[1:]
+		s.busy = true
+
+		return ev, true, nil
+	}
+
+	data, err := s.ring.pop()
+	if err == nil {
+		err = json.Unmarshal(data, &ev)
+	}
+
+	if err != nil {
+		s.dropped++
+
+		return ev, true, fmt.Errorf("fanotify: spill error, %w", err)
+	}
+
+	s.busy = true
+
+	return ev, true, nil
+}
+
+func (s *SpillBuffer) error(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// spillRing stores length prefixed records in a fixed size file used as a
+// ring, head and tail are ever growing logical offsets.
+type spillRing struct {
+	f          *os.File
+	size       int64
+	head, tail int64
+	count      int
+}
+
+// push appends data, evicting the oldest records when there is no room.
+func (r *spillRing) push(data []byte) (evicted int, err error) {
+	need := int64(spillHeader + len(data))
+	if need > r.size {
+		return 0, fmt.Errorf("fanotify: spill error, event of %d bytes exceeds ring size", len(data))
+	}
+
+	for r.tail-r.head+need > r.size {
+		if _, err := r.pop(); err != nil {
+			return evicted, err
+		}
+
+		evicted++
+	}
+
+	buf := make([]byte, need)
+	binary.LittleEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[spillHeader:], data)
+
+	if err := r.writeAt(buf, r.tail); err != nil {
+		return evicted, err
+	}
+
+	r.tail += need
+	r.count++
+
+	return evicted, nil
+}
+
+// pop removes and returns the oldest record.
+func (r *spillRing) pop() ([]byte, error) {
+	hdr := make([]byte, spillHeader)
+
+	if err := r.readAt(hdr, r.head); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, binary.LittleEndian.Uint32(hdr))
+
+	if err := r.readAt(data, r.head+spillHeader); err != nil {
+		return nil, err
+	}
+
+	r.head += int64(spillHeader + len(data))
+	r.count--
+
+	if r.count == 0 {
+		r.head, r.tail = 0, 0
+	}
+
+	return data, nil
+}
+
+func (r *spillRing) writeAt(p []byte, off int64) error {
+	pos := off % r.size
+	n := int64(len(p))
+
+	if n > r.size-pos {
+		n = r.size - pos
+	}
+
+	if _, err := r.f.WriteAt(p[:n], pos); err != nil {
+		return fmt.Errorf("fanotify: spill error, %w", err)
+	}
+
+	if _, err := r.f.WriteAt(p[n:], 0); err != nil {
+		return fmt.Errorf("fanotify: spill error, %w", err)
+	}
+
+	return nil
+}
+
+func (r *spillRing) readAt(p []byte, off int64) error {
+	pos := off % r.size
+	n := int64(len(p))
+
+	if n > r.size-pos {
+		n = r.size - pos
+	}
+
+	if _, err := r.f.ReadAt(p[:n], pos); err != nil {
+		return fmt.Errorf("fanotify: spill error, %w", err)
+	}
+
+	if _, err := r.f.ReadAt(p[n:], 0); err != nil {
+		return fmt.Errorf("fanotify: spill error, %w", err)
+	}
+
+	return nil
+}
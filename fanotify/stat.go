@@ -0,0 +1,136 @@
+package fanotify
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// File type and mode bits of FileStat.Mode, as in stat(2).
+const (
+	modeType   = 0o170000
+	modeSocket = 0o140000
+	modeSymlnk = 0o120000
+	modeReg    = 0o100000
+	modeBlock  = 0o060000
+	modeDir    = 0o040000
+	modeChar   = 0o020000
+	modeFifo   = 0o010000
+	modeSetuid = 0o4000
+	modeSetgid = 0o2000
+	modeSticky = 0o1000
+)
+
+// FileStat is the stat data of a file, the fields of unix.Stat_t the
+// package uses, so that its API builds on every platform.
+type FileStat struct {
+	Dev   uint64
+	Ino   uint64
+	Nlink uint64
+	Mode  uint32
+	Uid   uint32
+	Gid   uint32
+	Rdev  uint64
+	Size  int64
+	// Blocks is the number of 512 byte blocks allocated.
+	Blocks int64
+	Atime  time.Time
+	Mtime  time.Time
+	Ctime  time.Time
+}
+
+// IsDir reports whether st describes a directory.
+func (st FileStat) IsDir() bool {
+	return st.Mode&modeType == modeDir
+}
+
+// IsRegular reports whether st describes a regular file.
+func (st FileStat) IsRegular() bool {
+	return st.Mode&modeType == modeReg
+}
+
+// Stat returns fstat data for event metadata supplied Fd. Unlike a path based
+// stat it always describes the object the event was generated for.
+func (metadata *EventMetadata) Stat() (FileStat, error) {
+	st, err := fstatFd(int(metadata.Fd))
+	if err != nil {
+		return st, fmt.Errorf("fanotify: stat error, %w", err)
+	}
+
+	return st, nil
+}
+
+// Size returns file size for event metadata supplied Fd.
+func (metadata *EventMetadata) Size() (int64, error) {
+	st, err := metadata.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return st.Size, nil
+}
+
+// Mode returns file mode for event metadata supplied Fd.
+func (metadata *EventMetadata) Mode() (os.FileMode, error) {
+	st, err := metadata.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return fileMode(st.Mode), nil
+}
+
+// Owner returns file owner UID and GID for event metadata supplied Fd.
+func (metadata *EventMetadata) Owner() (uid, gid int, err error) {
+	st, err := metadata.Stat()
+	if err != nil {
+		return -1, -1, err
+	}
+
+	return int(st.Uid), int(st.Gid), nil
+}
+
+// DevIno returns device and inode numbers for event metadata supplied Fd,
+// together they identify a file independently of its path.
+func (metadata *EventMetadata) DevIno() (dev, ino uint64, err error) {
+	st, err := metadata.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return st.Dev, st.Ino, nil
+}
+
+// fileMode converts stat mode bits to os.FileMode, the same way os.Stat does.
+func fileMode(mode uint32) os.FileMode {
+	out := os.FileMode(mode & 0o777)
+
+	switch mode & modeType {
+	case modeBlock:
+		out |= os.ModeDevice
+	case modeChar:
+		out |= os.ModeDevice | os.ModeCharDevice
+	case modeDir:
+		out |= os.ModeDir
+	case modeFifo:
+		out |= os.ModeNamedPipe
+	case modeSymlnk:
+		out |= os.ModeSymlink
+	case modeSocket:
+		out |= os.ModeSocket
+	}
+
+	if mode&modeSetgid != 0 {
+		out |= os.ModeSetgid
+	}
+
+	if mode&modeSetuid != 0 {
+		out |= os.ModeSetuid
+	}
+
+	if mode&modeSticky != 0 {
+		out |= os.ModeSticky
+	}
+
+	return out
+}
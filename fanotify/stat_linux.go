@@ -0,0 +1,57 @@
+package fanotify
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fstatFd returns the stat data of fd.
+func fstatFd(fd int) (FileStat, error) {
+	var st unix.Stat_t
+
+	if err := unix.Fstat(fd, &st); err != nil {
+		return FileStat{}, err
+	}
+
+	return newFileStat(&st), nil
+}
+
+// statPath returns the stat data of path, following a final symlink.
+func statPath(path string) (FileStat, error) {
+	var st unix.Stat_t
+
+	if err := unix.Stat(path, &st); err != nil {
+		return FileStat{}, err
+	}
+
+	return newFileStat(&st), nil
+}
+
+// lstatPath returns the stat data of path, not following a final symlink.
+func lstatPath(path string) (FileStat, error) {
+	var st unix.Stat_t
+
+	if err := unix.Lstat(path, &st); err != nil {
+		return FileStat{}, err
+	}
+
+	return newFileStat(&st), nil
+}
+
+func newFileStat(st *unix.Stat_t) FileStat {
+	return FileStat{
+		Dev:    uint64(st.Dev),
+		Ino:    uint64(st.Ino),
+		Nlink:  uint64(st.Nlink),
+		Mode:   uint32(st.Mode),
+		Uid:    st.Uid,
+		Gid:    st.Gid,
+		Rdev:   uint64(st.Rdev),
+		Size:   int64(st.Size),
+		Blocks: int64(st.Blocks),
+		Atime:  time.Unix(st.Atim.Unix()),
+		Mtime:  time.Unix(st.Mtim.Unix()),
+		Ctime:  time.Unix(st.Ctim.Unix()),
+	}
+}
@@ -0,0 +1,189 @@
+package fanotify
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// PIDCount is the number of events generated by a process.
+type PIDCount struct {
+	PID   int
+	Count uint64
+}
+
+// PathCount is the number of events seen for a path.
+type PathCount struct {
+	Path  string
+	Count uint64
+}
+
+// Stats aggregates event counts in total, per process and per path. It
+// implements Sink, so a Watcher can feed it directly.
+type Stats struct {
+	mu     sync.Mutex
+	total  uint64
+	byPID  map[int]uint64
+	byPath map[string]uint64
+
+	// max caps byPID and byPath entries when positive
+	max     int
+	dropped uint64
+
+	pending     int
+	pendingPeak int
+}
+
+// NewStats returns empty Stats.
+func NewStats() *Stats {
+	return &Stats{
+		byPID:  make(map[int]uint64),
+		byPath: make(map[string]uint64),
+	}
+}
+
+// NewLimitedStats returns empty Stats counting at most max distinct
+// processes and max distinct paths, see MemoryLimits.Stats.
+func NewLimitedStats(max int) *Stats {
+	s := NewStats()
+	s.max = max
+
+	return s
+}
+
+// Observe counts event.
+func (s *Stats) Observe(ev Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.total++
+
+	if _, ok := s.byPID[ev.PID]; ok || s.max <= 0 || len(s.byPID) < s.max {
+		s.byPID[ev.PID]++
+	} else {
+		s.dropped++
+	}
+
+	if ev.Path == "" {
+		return
+	}
+
+	if _, ok := s.byPath[ev.Path]; ok || s.max <= 0 || len(s.byPath) < s.max {
+		s.byPath[ev.Path]++
+	} else {
+		s.dropped++
+	}
+}
+
+// Dropped returns the number of process and path counts not kept by
+// NewLimitedStats Stats, as their processes or paths were new once the cap
+// was reached.
+func (s *Stats) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dropped
+}
+
+// Publish implements Sink.
+func (s *Stats) Publish(_ context.Context, ev Event) error {
+	s.Observe(ev)
+
+	return nil
+}
+
+// Close implements Sink.
+func (s *Stats) Close() error {
+	return nil
+}
+
+// Total returns the number of observed events.
+func (s *Stats) Total() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.total
+}
+
+// TopProcesses returns up to n processes with most events, n <= 0 means all.
+func (s *Stats) TopProcesses(n int) []PIDCount {
+	s.mu.Lock()
+	out := make([]PIDCount, 0, len(s.byPID))
+
+	for pid, count := range s.byPID {
+		out = append(out, PIDCount{PID: pid, Count: count})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+
+		return out[i].PID < out[j].PID
+	})
+
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+
+	return out
+}
+
+// TopPaths returns up to n paths with most events, n <= 0 means all.
+func (s *Stats) TopPaths(n int) []PathCount {
+	s.mu.Lock()
+	out := make([]PathCount, 0, len(s.byPath))
+
+	for path, count := range s.byPath {
+		out = append(out, PathCount{Path: path, Count: count})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+
+		return out[i].Path < out[j].Path
+	})
+
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+
+	return out
+}
+
+// ObservePending records a kernel queue depth sample, e.g. from
+// NotifyFD.Pending.
+func (s *Stats) ObservePending(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = n
+
+	if n > s.pendingPeak {
+		s.pendingPeak = n
+	}
+}
+
+// Pending returns the last and the largest queue depth sample since Reset.
+func (s *Stats) Pending() (last, peak int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pending, s.pendingPeak
+}
+
+// Reset drops all counts.
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.total = 0
+	s.dropped = 0
+	s.pendingPeak = s.pending
+	s.byPID = make(map[int]uint64)
+	s.byPath = make(map[string]uint64)
+}
@@ -0,0 +1,191 @@
+package fanotify
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Suppression is a maintenance window muting events for a path set, e.g.
+// package upgrades or backups, until it expires.
+type Suppression struct {
+	ID uint64 `json:"id"`
+	// Paths are MatchPath patterns, all paths when empty.
+	Paths []string `json:"paths,omitempty"`
+	// Rules, when set, only disables the named RuleSet rules for the paths,
+	// events are delivered otherwise.
+	Rules []string `json:"rules,omitempty"`
+	// Permissions also drops permission events of the paths, which allows
+	// them without a decision. Without it permission events are delivered.
+	Permissions bool      `json:"permissions,omitempty"`
+	Until       time.Time `json:"until"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+// matches reports whether the window covers path.
+func (s *Suppression) matches(path string) bool {
+	return len(s.Paths) == 0 || matchAny(s.Paths, path)
+}
+
+// Suppressor holds suppression windows, register it with WithSuppressor to
+// drop events and with RuleSet.Suppress to disable rules. Windows expire by
+// themselves.
+type Suppressor struct {
+	mu      sync.RWMutex
+	windows map[uint64]*Suppression
+	nextID  uint64
+
+	// active is the number of windows, so that events skip the lock while
+	// nothing is suppressed
+	active     int32
+	suppressed uint64
+}
+
+// NewSuppressor returns a Suppressor without windows.
+func NewSuppressor() *Suppressor {
+	return &Suppressor{windows: make(map[uint64]*Suppression)}
+}
+
+// Suppress opens window for d, ignoring its ID and Until, and returns the
+// window as stored.
+func (s *Suppressor) Suppress(window Suppression, d time.Duration) Suppression {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	window.ID = s.nextID
+	window.Until = time.Now().Add(d)
+	window.Paths = append([]string(nil), window.Paths...)
+	window.Rules = append([]string(nil), window.Rules...)
+
+	s.windows[window.ID] = &window
+	atomic.StoreInt32(&s.active, int32(len(s.windows)))
+
+	return window
+}
+
+// Lift closes the window with id before it expires, it returns 'false' for
+// unknown or expired windows.
+func (s *Suppressor) Lift(id uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireLocked(time.Now())
+
+	_, ok := s.windows[id]
+	delete(s.windows, id)
+	atomic.StoreInt32(&s.active, int32(len(s.windows)))
+
+	return ok
+}
+
+// Windows returns the open windows, by ID.
+func (s *Suppressor) Windows() []Suppression {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireLocked(time.Now())
+
+	windows := make([]Suppression, 0, len(s.windows))
+	for _, w := range s.windows {
+		windows = append(windows, *w)
+	}
+
+	sort.Slice(windows, func(i, j int) bool { return windows[i].ID < windows[j].ID })
+
+	return windows
+}
+
+// Suppressed returns the number of events dropped by Apply.
+func (s *Suppressor) Suppressed() uint64 {
+	return atomic.LoadUint64(&s.suppressed)
+}
+
+func (s *Suppressor) expireLocked(now time.Time) {
+	for id, w := range s.windows {
+		if !now.Before(w.Until) {
+			delete(s.windows, id)
+		}
+	}
+
+	atomic.StoreInt32(&s.active, int32(len(s.windows)))
+}
+
+// covering calls fn for open windows until it returns 'true', expired
+// windows are skipped and removed by the next write.
+func (s *Suppressor) covering(fn func(*Suppression) bool) bool {
+	if atomic.LoadInt32(&s.active) == 0 {
+		return false
+	}
+
+	now := time.Now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, w := range s.windows {
+		if now.Before(w.Until) && fn(w) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Apply returns 'false' for events covered by a window without Rules, it is
+// a Filter.
+func (s *Suppressor) Apply(event *EventMetadata) bool {
+	var (
+		path     string
+		havePath bool
+	)
+
+	perm := event.Mask&permissionEvents != 0
+
+	suppressed := s.covering(func(w *Suppression) bool {
+		if len(w.Rules) != 0 || (perm && !w.Permissions) {
+			return false
+		}
+
+		if len(w.Paths) != 0 && !havePath {
+			// GetPath is memoized by the event
+			path, _ = event.GetPath()
+			havePath = true
+		}
+
+		return w.matches(path)
+	})
+
+	if suppressed {
+		atomic.AddUint64(&s.suppressed, 1)
+	}
+
+	return !suppressed
+}
+
+// suppressesRule reports whether a window disables rule for event.
+func (s *Suppressor) suppressesRule(rule string, event *EventMetadata) bool {
+	return s.covering(func(w *Suppression) bool {
+		for _, name := range w.Rules {
+			if name != rule {
+				continue
+			}
+
+			if len(w.Paths) == 0 {
+				return true
+			}
+
+			path, err := event.GetPath()
+
+			return err == nil && w.matches(path)
+		}
+
+		return false
+	})
+}
+
+// WithSuppressor adds s as a filter, see Suppressor.Apply.
+func WithSuppressor(s *Suppressor) Option {
+	return WithFilter(s.Apply)
+}
@@ -0,0 +1,63 @@
+package fanotify
+
+import "golang.org/x/sys/unix"
+
+// The Linux values of AT_FDCWD and the mode bits of FileStat fail to compile
+// when they differ from golang.org/x/sys, see headers_linux.go.
+var _ = [...][0]struct{}{
+	[AT_FDCWD - unix.AT_FDCWD]struct{}{},
+	[modeType - unix.S_IFMT]struct{}{},
+	[modeSocket - unix.S_IFSOCK]struct{}{},
+	[modeSymlnk - unix.S_IFLNK]struct{}{},
+	[modeReg - unix.S_IFREG]struct{}{},
+	[modeBlock - unix.S_IFBLK]struct{}{},
+	[modeDir - unix.S_IFDIR]struct{}{},
+	[modeChar - unix.S_IFCHR]struct{}{},
+	[modeFifo - unix.S_IFIFO]struct{}{},
+	[modeSetuid - unix.S_ISUID]struct{}{},
+	[modeSetgid - unix.S_ISGID]struct{}{},
+	[modeSticky - unix.S_ISVTX]struct{}{},
+}
+
+// The syscalls of the portable code, with stubs on other platforms.
+
+func sysClose(fd int) error {
+	return unix.Close(fd)
+}
+
+func sysDup(fd int) (int, error) {
+	return unix.Dup(fd)
+}
+
+// sysDupCloexec duplicates fd with FD_CLOEXEC set.
+func sysDupCloexec(fd int) (int, error) {
+	return unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 0)
+}
+
+// sysOpenRead opens path read only with O_CLOEXEC, outside the runtime
+// poller.
+func sysOpenRead(path string) (int, error) {
+	return unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+}
+
+func sysPread(fd int, p []byte, off int64) (int, error) {
+	return unix.Pread(fd, p, off)
+}
+
+// sysLinkFollow links dst to the file the symlink at src resolves to, also
+// for procfs magic links.
+func sysLinkFollow(src, dst string) error {
+	return unix.Linkat(unix.AT_FDCWD, src, unix.AT_FDCWD, dst, unix.AT_SYMLINK_FOLLOW)
+}
+
+func sysChmod(path string, mode uint32) error {
+	return unix.Chmod(path, mode)
+}
+
+func sysFchmod(fd int, mode uint32) error {
+	return unix.Fchmod(fd, mode)
+}
+
+func sysUnlink(path string) error {
+	return unix.Unlink(path)
+}
@@ -0,0 +1,145 @@
+package fanotify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Systemd notification states sent by a Watcher created with WithSystemd.
+const (
+	SdNotifyReady    = "READY=1"
+	SdNotifyStopping = "STOPPING=1"
+	SdNotifyWatchdog = "WATCHDOG=1"
+)
+
+// SdNotify sends state to the service manager via $NOTIFY_SOCKET, it returns
+// 'false' without an error when not running under systemd.
+func SdNotify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+
+	addr := &net.UnixAddr{
+		Name: socket,
+		Net:  "unixgram",
+	}
+
+	if socket[0] == '@' {
+		addr.Name = "\x00" + socket[1:] // abstract namespace
+	}
+
+	conn, err := net.DialUnix(addr.Net, nil, addr)
+	if err != nil {
+		return false, fmt.Errorf("fanotify: sd_notify error, %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("fanotify: sd_notify error, %w", err)
+	}
+
+	return true, nil
+}
+
+// SdWatchdogInterval returns the keepalive interval requested by systemd
+// (half of $WATCHDOG_USEC), or zero when the watchdog is disabled.
+func SdWatchdogInterval() time.Duration {
+	if pid, err := strconv.Atoi(os.Getenv("WATCHDOG_PID")); err == nil && pid != os.Getpid() {
+		return 0
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// WithSystemd makes Run report READY=1 once it starts reading (marks are
+// expected to be applied before Run), STOPPING=1 when it returns, and send
+// WATCHDOG=1 keepalives as long as the reader loop is alive: either waiting
+// for the kernel or having finished an event within the watchdog interval.
+// A reader stuck in a sink therefore gets the service restarted.
+func WithSystemd() WatcherOption {
+	return func(w *Watcher) {
+		w.systemd = true
+	}
+}
+
+// Reader loop states used for liveness tracking.
+const (
+	readerIdle int32 = iota
+	readerReading
+	readerProcessing
+)
+
+func (w *Watcher) setReaderState(state int32) {
+	atomic.StoreInt64(&w.lastProgress, time.Now().UnixNano())
+	atomic.StoreInt32(&w.readerState, state)
+}
+
+// readerAlive reports whether the reader loop made progress within d.
+func (w *Watcher) readerAlive(d time.Duration) bool {
+	switch atomic.LoadInt32(&w.readerState) {
+	case readerReading:
+		return true
+	case readerProcessing:
+		return time.Since(time.Unix(0, atomic.LoadInt64(&w.lastProgress))) < d
+	default:
+		return false
+	}
+}
+
+// startSystemd reports readiness and runs the watchdog until stop is called.
+func (w *Watcher) startSystemd() (stop func()) {
+	if _, err := SdNotify(SdNotifyReady); err != nil {
+		w.error(err)
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		interval := SdWatchdogInterval()
+		if interval <= 0 {
+			<-done
+
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !w.readerAlive(interval) {
+					continue
+				}
+
+				if _, err := SdNotify(SdNotifyWatchdog); err != nil {
+					w.error(err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+
+		if _, err := SdNotify(SdNotifyStopping); err != nil {
+			w.error(err)
+		}
+	}
+}
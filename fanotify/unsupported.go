@@ -0,0 +1,211 @@
+//go:build !linux
+
+package fanotify
+
+import (
+	"context"
+	"os"
+)
+
+// Initialize returns ErrUnsupportedPlatform.
+func Initialize(fanotifyFlags InitFlags, openFlags int, opts ...Option) (*NotifyFD, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// Mark returns ErrUnsupportedPlatform.
+func (handle *NotifyFD) Mark(flags MarkFlags, mask EventMask, dirFd int, path string) error {
+	return ErrUnsupportedPlatform
+}
+
+// MarkFd returns ErrUnsupportedPlatform.
+func (handle *NotifyFD) MarkFd(flags MarkFlags, mask EventMask, fd int) error {
+	return ErrUnsupportedPlatform
+}
+
+// MarkPathSecure returns ErrUnsupportedPlatform.
+func (handle *NotifyFD) MarkPathSecure(flags MarkFlags, mask EventMask, root, path string) error {
+	return ErrUnsupportedPlatform
+}
+
+func (handle *NotifyFD) waitReadable() error {
+	return ErrUnsupportedPlatform
+}
+
+// GetMountID returns ErrUnsupportedPlatform.
+func (metadata *EventMetadata) GetMountID() (int, error) {
+	return 0, ErrUnsupportedPlatform
+}
+
+func fdObject(fd int) (fileObject, error) {
+	return fileObject{}, ErrUnsupportedPlatform
+}
+
+func pathObject(path string) (fileObject, error) {
+	return fileObject{}, ErrUnsupportedPlatform
+}
+
+func pathKey(fd int) (fileObject, bool, error) {
+	return fileObject{}, false, ErrUnsupportedPlatform
+}
+
+// CurrentKernel returns ErrUnsupportedPlatform.
+func CurrentKernel() (KernelVersion, error) {
+	return KernelVersion{}, ErrUnsupportedPlatform
+}
+
+// HasCapability returns ErrUnsupportedPlatform.
+func HasCapability(capability int) (bool, error) {
+	return false, ErrUnsupportedPlatform
+}
+
+// DropCapabilities returns ErrUnsupportedPlatform.
+func DropCapabilities(keep ...int) error {
+	return ErrUnsupportedPlatform
+}
+
+func (b *ResponseBatcher) write() error {
+	return ErrUnsupportedPlatform
+}
+
+func fgetxattr(fd int, name string, dest []byte) (int, error) {
+	return 0, ErrUnsupportedPlatform
+}
+
+func flistxattr(fd int, dest []byte) (int, error) {
+	return 0, ErrUnsupportedPlatform
+}
+
+// Pending returns ErrUnsupportedPlatform.
+func (handle *NotifyFD) Pending() (int, error) {
+	return 0, ErrUnsupportedPlatform
+}
+
+func pidfdAlive(pidfd int) error {
+	return ErrUnsupportedPlatform
+}
+
+func fstatFd(fd int) (FileStat, error) {
+	return FileStat{}, ErrUnsupportedPlatform
+}
+
+func statPath(path string) (FileStat, error) {
+	return FileStat{}, ErrUnsupportedPlatform
+}
+
+func lstatPath(path string) (FileStat, error) {
+	return FileStat{}, ErrUnsupportedPlatform
+}
+
+func newInotifyWatch(mask EventMask, paths []string) (*inotifyWatch, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+func (in *inotifyWatch) next() (Event, bool, error) {
+	return Event{}, false, ErrUnsupportedPlatform
+}
+
+// Pending returns ErrUnsupportedPlatform.
+func (in *inotifyWatch) Pending() (int, error) {
+	return 0, ErrUnsupportedPlatform
+}
+
+func resolveHandle(mountFd int, h FileHandle) (string, error) {
+	return "", ErrUnsupportedPlatform
+}
+
+func openHandle(mountFd int, h FileHandle, name string, flags int) (int, error) {
+	return -1, ErrUnsupportedPlatform
+}
+
+func mountFsid(path string) ([2]int32, error) {
+	return [2]int32{}, ErrUnsupportedPlatform
+}
+
+func openMount(path string, fsid [2]int32) (int, error) {
+	return -1, ErrUnsupportedPlatform
+}
+
+func mountTableChanged(fd int) bool {
+	return false
+}
+
+func pinThread(cpu int) error {
+	return ErrUnsupportedPlatform
+}
+
+// NewURingReader returns ErrUnsupportedPlatform.
+func NewURingReader(notify *NotifyFD) (*URingReader, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// Next returns ErrUnsupportedPlatform.
+func (r *URingReader) Next(ctx context.Context, skipPIDs ...int) (*EventMetadata, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// Close returns ErrUnsupportedPlatform.
+func (r *URingReader) Close() error {
+	return ErrUnsupportedPlatform
+}
+
+// SpliceContent returns ErrUnsupportedPlatform.
+func (metadata *EventMetadata) SpliceContent(pipeFd int, maxSize int64) (int64, error) {
+	return 0, ErrUnsupportedPlatform
+}
+
+// ContentMemfd returns ErrUnsupportedPlatform.
+func (metadata *EventMetadata) ContentMemfd(maxSize int64) (*os.File, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// procConnector is not supported.
+type procConnector struct{}
+
+// openProcConnector returns ErrUnsupportedPlatform.
+func openProcConnector() (*procConnector, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+func (c *procConnector) drain(fn func(procEvent)) error {
+	return ErrUnsupportedPlatform
+}
+
+func (c *procConnector) close() error {
+	return nil
+}
+
+func sysClose(fd int) error {
+	return ErrUnsupportedPlatform
+}
+
+func sysDup(fd int) (int, error) {
+	return -1, ErrUnsupportedPlatform
+}
+
+func sysDupCloexec(fd int) (int, error) {
+	return -1, ErrUnsupportedPlatform
+}
+
+func sysOpenRead(path string) (int, error) {
+	return -1, ErrUnsupportedPlatform
+}
+
+func sysPread(fd int, p []byte, off int64) (int, error) {
+	return 0, ErrUnsupportedPlatform
+}
+
+func sysLinkFollow(src, dst string) error {
+	return ErrUnsupportedPlatform
+}
+
+func sysChmod(path string, mode uint32) error {
+	return ErrUnsupportedPlatform
+}
+
+func sysFchmod(fd int, mode uint32) error {
+	return ErrUnsupportedPlatform
+}
+
+func sysUnlink(path string) error {
+	return ErrUnsupportedPlatform
+}
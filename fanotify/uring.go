@@ -0,0 +1,47 @@
+package fanotify
+
+import "time"
+
+// URingReader is an experimental event reader submitting reads of the
+// fanotify fd through io_uring instead of read(2). Reads go into two
+// buffers registered with the ring: while events of one are decoded, the
+// read into the other is already queued, so a batch of events costs one
+// io_uring_enter instead of a read and a wakeup. One read is in flight at a
+// time, events keep the kernel queue order.
+//
+// It needs kernel 5.11+ (IORING_FEAT_EXT_ARG) with io_uring enabled, see
+// kernel.io_uring_disabled. A URingReader replaces GetEvent, Run and
+// EventRing for its handle and is not safe for concurrent use. The ring is
+// private to the reader, other fds are not submitted through it.
+type URingReader struct {
+	handle *NotifyFD
+
+	fd    int
+	rings []byte
+	cring []byte
+	sqes  []byte
+	cqes  []byte
+
+	sq uringQueue
+	cq uringQueue
+
+	bufs [uringBuffers][]byte
+	// cur is the buffer being decoded, rest its undecoded events and batch
+	// the read time of its events for WithLatency
+	cur   int
+	rest  []byte
+	batch time.Time
+	hdr   [FAN_EVENT_METADATA_LEN]byte
+}
+
+// uringBuffers is the number of registered read buffers.
+const uringBuffers = 2
+
+// uringQueue holds the mmapped ring fields of a submission or completion
+// queue, array is the submission queue index array.
+type uringQueue struct {
+	head  *uint32
+	tail  *uint32
+	mask  uint32
+	array []uint32
+}
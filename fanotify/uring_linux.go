@@ -0,0 +1,387 @@
+package fanotify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// io_uring constants of linux/io_uring.h, not provided by x/sys.
+const (
+	uringEntries = 4
+
+	uringFeatSingleMmap = 1 << 0
+	uringFeatExtArg     = 1 << 8
+
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	uringEnterGetEvents = 1 << 0
+	uringEnterExtArg    = 1 << 3
+
+	uringRegisterBuffers = 0
+
+	uringOpReadFixed = 4
+	uringOpPollAdd   = 6
+
+	uringSQEIOLink = 1 << 2
+
+	uringSQESize = 64
+	uringCQESize = 16
+
+	// uringWait bounds a wait for completions, so that Next notices a
+	// cancelled context.
+	uringWait = 100 * time.Millisecond
+)
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  uringSQOffsets
+	cqOff                                                                  uringCQOffsets
+}
+
+type uringSQE struct {
+	opcode, flags uint8
+	ioprio        uint16
+	fd            int32
+	off, addr     uint64
+	len, opFlags  uint32
+	userData      uint64
+	bufIndex      uint16
+	personality   uint16
+	spliceFdIn    int32
+	addr3, pad    uint64
+}
+
+type uringGetEventsArg struct {
+	sigmask   uint64
+	sigmaskSz uint32
+	pad       uint32
+	ts        uint64
+}
+
+// NewURingReader sets up an io_uring reading events of notify, the first
+// read is submitted right away.
+func NewURingReader(notify *NotifyFD) (*URingReader, error) {
+	var params uringParams
+
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uringEntries, uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("fanotify: io_uring error, setup: %w", errno)
+	}
+
+	r := &URingReader{handle: notify, fd: int(fd)}
+
+	if err := r.setup(&params); err != nil {
+		_ = r.Close()
+
+		return nil, err
+	}
+
+	if err := r.submit(0); err != nil {
+		_ = r.Close()
+
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// setup maps the rings and registers the read buffers.
+func (r *URingReader) setup(params *uringParams) error {
+	if params.features&uringFeatExtArg == 0 {
+		return fmt.Errorf("fanotify: io_uring error, kernel lacks IORING_FEAT_EXT_ARG: %w", ErrUnsupportedPlatform)
+	}
+
+	sqSize := int(params.sqOff.array + params.sqEntries*4)
+	cqSize := int(params.cqOff.cqes + params.cqEntries*uringCQESize)
+
+	if params.features&uringFeatSingleMmap != 0 && cqSize > sqSize {
+		sqSize = cqSize
+	}
+
+	var err error
+
+	if r.rings, err = uringMmap(r.fd, uringOffSQRing, sqSize); err != nil {
+		return err
+	}
+
+	r.cring = r.rings
+
+	if params.features&uringFeatSingleMmap == 0 {
+		if r.cring, err = uringMmap(r.fd, uringOffCQRing, cqSize); err != nil {
+			r.cring = nil
+
+			return err
+		}
+	}
+
+	if r.sqes, err = uringMmap(r.fd, uringOffSQEs, int(params.sqEntries)*uringSQESize); err != nil {
+		return err
+	}
+
+	r.sq = uringQueue{
+		head:  uringField(r.rings, params.sqOff.head),
+		tail:  uringField(r.rings, params.sqOff.tail),
+		mask:  *uringField(r.rings, params.sqOff.ringMask),
+		array: unsafe.Slice(uringField(r.rings, params.sqOff.array), params.sqEntries),
+	}
+
+	r.cq = uringQueue{
+		head: uringField(r.cring, params.cqOff.head),
+		tail: uringField(r.cring, params.cqOff.tail),
+		mask: *uringField(r.cring, params.cqOff.ringMask),
+	}
+
+	r.cqes = r.cring[params.cqOff.cqes:cqSize]
+
+	var iovecs [uringBuffers]unix.Iovec
+
+	for i := range r.bufs {
+		buf, err := unix.Mmap(-1, 0, ReadBufferSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+		if err != nil {
+			return fmt.Errorf("fanotify: io_uring error, buffer: %w", err)
+		}
+
+		r.bufs[i] = buf
+		iovecs[i].Base = &buf[0]
+		iovecs[i].SetLen(len(buf))
+	}
+
+	_, _, errno := unix.Syscall6(unix.SYS_IO_URING_REGISTER, uintptr(r.fd), uringRegisterBuffers,
+		uintptr(unsafe.Pointer(&iovecs[0])), uringBuffers, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("fanotify: io_uring error, register buffers: %w", errno)
+	}
+
+	return nil
+}
+
+// uringMmap maps a ring region of the io_uring fd.
+func uringMmap(fd int, offset int64, size int) ([]byte, error) {
+	b, err := unix.Mmap(fd, offset, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: io_uring error, mmap %#x: %w", offset, err)
+	}
+
+	return b, nil
+}
+
+// uringField returns the ring field at offset off of a mapped ring.
+func uringField(ring []byte, off uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&ring[off]))
+}
+
+// submit queues a read of the fanotify fd into buffer buf, linked behind a
+// poll so that the read does not fail with EAGAIN on a non-blocking fd.
+func (r *URingReader) submit(buf int) error {
+	fd := int32(r.handle.Fd)
+
+	r.push(uringSQE{
+		opcode:   uringOpPollAdd,
+		flags:    uringSQEIOLink,
+		fd:       fd,
+		opFlags:  unix.POLLIN,
+		userData: uint64(buf) << 1,
+	})
+
+	r.push(uringSQE{
+		opcode:   uringOpReadFixed,
+		fd:       fd,
+		addr:     uint64(uintptr(unsafe.Pointer(&r.bufs[buf][0]))),
+		len:      uint32(len(r.bufs[buf])),
+		bufIndex: uint16(buf),
+		userData: uint64(buf)<<1 | 1,
+	})
+
+	for {
+		_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), 2, 0, 0, 0, 0)
+
+		switch {
+		case errno == 0:
+			return nil
+		case errno == unix.EINTR:
+			continue
+		default:
+			return fmt.Errorf("fanotify: io_uring error, submit: %w", errno)
+		}
+	}
+}
+
+// push adds sqe to the submission queue, which always has room as at most
+// one poll and read pair is queued.
+func (r *URingReader) push(sqe uringSQE) {
+	tail := atomic.LoadUint32(r.sq.tail)
+	idx := tail & r.sq.mask
+
+	*(*uringSQE)(unsafe.Pointer(&r.sqes[int(idx)*uringSQESize])) = sqe
+	r.sq.array[idx] = idx
+
+	atomic.StoreUint32(r.sq.tail, tail+1)
+}
+
+// complete waits for the next completion and returns its user data and
+// result.
+func (r *URingReader) complete(ctx context.Context) (uint64, int32, error) {
+	for {
+		head := atomic.LoadUint32(r.cq.head)
+
+		if head != atomic.LoadUint32(r.cq.tail) {
+			cqe := r.cqes[int(head&r.cq.mask)*uringCQESize:]
+			userData := *(*uint64)(unsafe.Pointer(&cqe[0]))
+			res := *(*int32)(unsafe.Pointer(&cqe[8]))
+
+			atomic.StoreUint32(r.cq.head, head+1)
+
+			return userData, res, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+
+		ts := unix.NsecToTimespec(int64(uringWait))
+		arg := uringGetEventsArg{ts: uint64(uintptr(unsafe.Pointer(&ts)))}
+
+		_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), 0, 1,
+			uringEnterGetEvents|uringEnterExtArg, uintptr(unsafe.Pointer(&arg)), unsafe.Sizeof(arg))
+		runtime.KeepAlive(&ts)
+
+		if errno != 0 && errno != unix.ETIME && errno != unix.EINTR {
+			return 0, 0, fmt.Errorf("fanotify: io_uring error, wait: %w", errno)
+		}
+	}
+}
+
+// Next returns the next event, with GetEvent semantics for skipPIDs and
+// filters: dropped events are skipped and the following event is read. It
+// waits for events until ctx is done and returns its error then.
+func (r *URingReader) Next(ctx context.Context, skipPIDs ...int) (*EventMetadata, error) {
+	for {
+		ev, err := r.next(ctx, skipPIDs)
+		if !errors.Is(err, ErrSkipped) {
+			return ev, err
+		}
+	}
+}
+
+// next returns one event, ErrSkipped when it was dropped.
+func (r *URingReader) next(ctx context.Context, skipPIDs []int) (*EventMetadata, error) {
+	fresh := len(r.rest) == 0
+
+	for len(r.rest) == 0 {
+		userData, res, err := r.complete(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		buf := int(userData >> 1)
+
+		if userData&1 == 0 {
+			// poll completions only matter when they failed, the linked read
+			// is then cancelled and resubmitted
+			if res < 0 && res != -int32(unix.ECANCELED) {
+				return nil, fmt.Errorf("fanotify: io_uring error, poll: %w", unix.Errno(-res))
+			}
+
+			continue
+		}
+
+		if res < 0 {
+			switch errno := unix.Errno(-res); errno {
+			case unix.EAGAIN, unix.EINTR, unix.ECANCELED:
+				if err := r.submit(buf); err != nil {
+					return nil, err
+				}
+
+				continue
+			default:
+				return nil, fmt.Errorf("fanotify: io_uring error, read: %w", errno)
+			}
+		}
+
+		// queue the read into the other buffer before decoding this one, it
+		// was fully decoded before this read completed
+		if err := r.submit((buf + 1) % uringBuffers); err != nil {
+			return nil, err
+		}
+
+		r.cur, r.rest = buf, r.bufs[buf][:res]
+	}
+
+	rd := bytes.NewReader(r.rest)
+
+	// events are copied out of the registered buffer, it is reused by the
+	// read after next
+	event, err := r.handle.decodeEvent(rd, r.hdr[:], new(EventMetadata), nil)
+	r.rest = r.rest[len(r.rest)-rd.Len():]
+
+	if err != nil {
+		r.rest = nil
+
+		return nil, err
+	}
+
+	r.handle.stampBatch(event, &r.batch, fresh)
+
+	return r.handle.process(event, skipPIDs)
+}
+
+// Close unmaps the rings and buffers and closes the io_uring fd, reads in
+// flight are cancelled. The handle stays open.
+func (r *URingReader) Close() error {
+	var firstErr error
+
+	unmap := func(b []byte) {
+		if b == nil {
+			return
+		}
+
+		if err := unix.Munmap(b); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := unix.Close(r.fd); err != nil {
+		firstErr = err
+	}
+
+	if r.cring != nil && &r.cring[0] != &r.rings[0] {
+		unmap(r.cring)
+	}
+
+	unmap(r.sqes)
+	unmap(r.rings)
+
+	for _, b := range r.bufs {
+		unmap(b)
+	}
+
+	r.rings, r.cring, r.sqes, r.cqes, r.rest = nil, nil, nil, nil, nil
+	r.bufs = [uringBuffers][]byte{}
+
+	if firstErr != nil {
+		return fmt.Errorf("fanotify: io_uring error, close: %w", firstErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package fanotify
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// VersionError is returned by GetEvent for events with a metadata version
+// rejected by the version policy.
+type VersionError struct {
+	Version     uint8
+	MetadataLen uint16
+}
+
+// Error implements error.
+func (err *VersionError) Error() string {
+	return fmt.Sprintf(
+		"fanotify: wrong metadata version %d (metadata length %d), expected %d",
+		err.Version, err.MetadataLen, FANOTIFY_METADATA_VERSION,
+	)
+}
+
+// VersionPolicy decides whether an event with a metadata version other than
+// FANOTIFY_METADATA_VERSION is delivered, returning an error drops the event
+// and GetEvent returns that error.
+type VersionPolicy func(event *EventMetadata) error
+
+// WithVersionPolicy sets the metadata version policy, StrictVersion is used
+// by default.
+func WithVersionPolicy(policy VersionPolicy) Option {
+	return func(handle *NotifyFD) {
+		handle.versionPolicy = policy
+	}
+}
+
+// StrictVersion rejects every event with a different metadata version.
+func StrictVersion(event *EventMetadata) error {
+	return &VersionError{Version: event.Vers, MetadataLen: event.Metadata_len}
+}
+
+// LenientVersion accepts events of other metadata versions as long as the
+// metadata is at least as large as the known one, so the known fields stay
+// valid, and rejects them otherwise. warn is called once for every new
+// version accepted, log.Printf is used when it is nil.
+func LenientVersion(warn func(error)) VersionPolicy {
+	var (
+		mu   sync.Mutex
+		seen = make(map[uint8]struct{})
+	)
+
+	if warn == nil {
+		warn = func(err error) {
+			log.Printf("%v, continuing\n", err)
+		}
+	}
+
+	return func(event *EventMetadata) error {
+		err := &VersionError{Version: event.Vers, MetadataLen: event.Metadata_len}
+
+		if event.Metadata_len < FAN_EVENT_METADATA_LEN {
+			return err
+		}
+
+		mu.Lock()
+		_, ok := seen[event.Vers]
+		seen[event.Vers] = struct{}{}
+		mu.Unlock()
+
+		if !ok {
+			warn(err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,192 @@
+package fanotify
+
+import (
+	"time"
+)
+
+// WatchdogReason tells why the watchdog of a DecisionExecutor answered
+// events.
+type WatchdogReason string
+
+// Watchdog reasons.
+const (
+	// WatchdogPending means MaxPending decisions were pending.
+	WatchdogPending WatchdogReason = "pending"
+	// WatchdogAge means decisions were pending longer than MaxAge.
+	WatchdogAge WatchdogReason = "age"
+)
+
+// WatchdogConfig configures the safety valve of a DecisionExecutor: while
+// decide is stalled, e.g. when a scanner backend died, every process
+// accessing a marked file blocks. The watchdog answers such events with a
+// default response instead, allow unless Deny, and raises OnAlert. Pending
+// decisions are the queued ones and the ones being decided that were not
+// answered yet.
+type WatchdogConfig struct {
+	// MaxPending answers events submitted while this many decisions are
+	// pending right away, without queueing them, disabled when zero.
+	MaxPending int
+	// MaxAge answers pending decisions of events read longer ago, queued or
+	// being decided, checked every quarter of MaxAge, disabled when zero.
+	// The result of a decide answered meanwhile is dropped.
+	MaxAge time.Duration
+	// Deny answers with deny instead of allow.
+	Deny bool
+	// OnAlert is called after the watchdog answered events, for
+	// WatchdogPending once when the pending decisions reach MaxPending and
+	// again only after they went below. It must not block.
+	OnAlert func(WatchdogAlert)
+}
+
+// WatchdogAlert describes events answered by the watchdog.
+type WatchdogAlert struct {
+	Reason WatchdogReason
+	// Answered is the number of events answered with the default response.
+	Answered int
+	// Pending is the number of decisions left pending.
+	Pending int
+	// Oldest is the age of the oldest answered event.
+	Oldest time.Duration
+}
+
+// pendingLocked returns the number of pending decisions.
+func (x *DecisionExecutor) pendingLocked() int {
+	return x.queued + x.active - x.stale
+}
+
+// overloadLocked accounts a fallback answer of a new event when MaxPending
+// decisions are pending, raise is set for the first one of an overload.
+func (x *DecisionExecutor) overloadLocked() (alert WatchdogAlert, raise, ok bool) {
+	pending := x.pendingLocked()
+
+	if x.watchdog.MaxPending <= 0 || pending < x.watchdog.MaxPending {
+		x.overloaded = false
+
+		return alert, false, false
+	}
+
+	raise = !x.overloaded
+	x.overloaded = true
+	x.fallback++
+	x.countLocked(!x.watchdog.Deny)
+
+	return WatchdogAlert{Reason: WatchdogPending, Answered: 1, Pending: pending}, raise, true
+}
+
+// watch answers expired decisions until Close.
+func (x *DecisionExecutor) watch() {
+	defer x.watchWG.Done()
+
+	interval := x.watchdog.MaxAge / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-x.stop:
+			return
+		case <-ticker.C:
+			x.expire()
+		}
+	}
+}
+
+// expire answers pending decisions older than MaxAge. Queued events are
+// taken out of the queue, events being decided are answered under mu, so
+// that the worker does not close the event fd before.
+func (x *DecisionExecutor) expire() {
+	var (
+		expired []*EventMetadata
+		errs    []error
+	)
+
+	alert := WatchdogAlert{Reason: WatchdogAge}
+	now := time.Now()
+	allow := !x.watchdog.Deny
+
+	account := func(ev *EventMetadata) {
+		if age := now.Sub(ev.Time); age > alert.Oldest {
+			alert.Oldest = age
+		}
+
+		alert.Answered++
+		x.fallback++
+		x.countLocked(allow)
+	}
+
+	x.mu.Lock()
+
+	for mount, q := range x.mounts {
+		// events of a mount are queued in read order
+		n := 0
+		for n < len(q.events) && now.Sub(q.events[n].ev.Time) >= x.watchdog.MaxAge {
+			d := q.events[n]
+			d.answered = true
+			q.events[n] = nil
+			expired = append(expired, d.ev)
+			account(d.ev)
+			n++
+		}
+
+		if n > 0 {
+			q.events = q.events[n:]
+			x.queued -= n
+			x.dropMountLocked(mount)
+		}
+	}
+
+	for d := range x.inflight {
+		if d.answered || now.Sub(d.ev.Time) < x.watchdog.MaxAge {
+			continue
+		}
+
+		d.answered = true
+		x.stale++
+		account(d.ev)
+
+		if err := x.respond(d.ev, allow); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	alert.Pending = x.pendingLocked()
+
+	if alert.Answered > 0 {
+		x.cond.Broadcast()
+	}
+
+	x.mu.Unlock()
+
+	for _, err := range errs {
+		x.error(err)
+	}
+
+	for _, ev := range expired {
+		x.answerRelease(ev, allow)
+	}
+
+	if alert.Answered > 0 {
+		x.alert(alert)
+	}
+}
+
+// answerRelease answers ev and closes it.
+func (x *DecisionExecutor) answerRelease(ev *EventMetadata, allow bool) {
+	if err := x.respond(ev, allow); err != nil {
+		x.error(err)
+	}
+
+	if err := ev.release(); err != nil {
+		x.error(err)
+	}
+}
+
+func (x *DecisionExecutor) alert(alert WatchdogAlert) {
+	if x.watchdog.OnAlert != nil {
+		x.watchdog.OnAlert(alert)
+	}
+}
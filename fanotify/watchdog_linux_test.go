@@ -0,0 +1,146 @@
+package fanotify
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    WatchdogConfig
+		reason WatchdogReason
+		want   uint32
+	}{
+		{
+			name:   "age allows",
+			cfg:    WatchdogConfig{MaxAge: 20 * time.Millisecond},
+			reason: WatchdogAge,
+			want:   FAN_ALLOW,
+		},
+		{
+			name:   "age denies",
+			cfg:    WatchdogConfig{MaxAge: 20 * time.Millisecond, Deny: true},
+			reason: WatchdogAge,
+			want:   FAN_DENY,
+		},
+		{
+			name:   "pending allows",
+			cfg:    WatchdogConfig{MaxPending: 1},
+			reason: WatchdogPending,
+			want:   FAN_ALLOW,
+		},
+		{
+			name:   "pending denies",
+			cfg:    WatchdogConfig{MaxPending: 1, Deny: true},
+			reason: WatchdogPending,
+			want:   FAN_DENY,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeHandle(t)
+
+			// decide stalls on the first event, then answers the opposite of
+			// the default response
+			var (
+				calls   int32
+				release = make(chan struct{})
+				decided = uint32(FAN_ALLOW)
+			)
+
+			if !tt.cfg.Deny {
+				decided = FAN_DENY
+			}
+
+			decide := func(ev *EventMetadata) bool {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					<-release
+				}
+
+				return tt.cfg.Deny
+			}
+
+			alerts := make(chan WatchdogAlert, 8)
+			cfg := tt.cfg
+			cfg.OnAlert = func(alert WatchdogAlert) { alerts <- alert }
+
+			x := NewDecisionExecutor(fake.NotifyFD, decide, ExecutorConfig{Workers: 1, Watchdog: cfg})
+
+			submit := func() int32 {
+				fd := eventFd(t)
+				fake.send(t, encodeEvent(FAN_OPEN_PERM, fd, 1))
+
+				ev, err := fake.GetEvent()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := x.Submit(ev); err != nil {
+					t.Fatal(err)
+				}
+
+				return fd
+			}
+
+			stalled := submit()
+
+			// the stalled event is answered by age, a new one by pending
+			fallback := stalled
+			if tt.reason == WatchdogPending {
+				fallback = submit()
+			}
+
+			responses := fake.waitResponses(t, 1)
+			if responses[0].Fd != fallback || responses[0].Response != tt.want {
+				t.Fatalf("got responses %+v, want %d for Fd %d", responses, tt.want, fallback)
+			}
+
+			close(release)
+
+			want := []FanotifyResponse{{Fd: fallback, Response: tt.want}}
+			if tt.reason == WatchdogPending {
+				want = append(want, FanotifyResponse{Fd: stalled, Response: decided})
+				fake.waitResponses(t, len(want))
+			} else {
+				// the dropped result of the stalled decide is not written
+				for x.Stats().Active != 0 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			// once decide recovered events are decided again
+			want = append(want, FanotifyResponse{Fd: submit(), Response: decided})
+			fake.waitResponses(t, len(want))
+
+			if err := x.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			responses = fake.closeResponses()
+			if len(responses) != len(want) {
+				t.Fatalf("got responses %+v, want %+v", responses, want)
+			}
+
+			for i := range want {
+				if responses[i] != want[i] {
+					t.Fatalf("got responses %+v, want %+v", responses, want)
+				}
+			}
+
+			if len(alerts) != 1 {
+				t.Fatalf("got %d alerts, want 1", len(alerts))
+			}
+
+			if alert := <-alerts; alert.Reason != tt.reason || alert.Answered != 1 {
+				t.Fatalf("got alert %+v, want %s answering 1", alert, tt.reason)
+			}
+
+			if stats := x.Stats(); stats.Fallback != 1 || stats.Allowed+stats.Denied != uint64(len(want)) {
+				t.Fatalf("got stats %+v, want 1 fallback of %d", stats, len(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package fanotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sink receives events published by a Watcher.
+type Sink interface {
+	Publish(ctx context.Context, ev Event) error
+	Close() error
+}
+
+// WatcherOption configures a Watcher created by NewWatcher.
+type WatcherOption func(*Watcher)
+
+// WithSink adds sinks every event is published to, in order.
+func WithSink(sinks ...Sink) WatcherOption {
+	return func(w *Watcher) {
+		w.sinks = append(w.sinks, sinks...)
+	}
+}
+
+// WithSkipPIDs skips events generated by listed PIDs, as GetEvent does.
+func WithSkipPIDs(pids ...int) WatcherOption {
+	return func(w *Watcher) {
+		w.skipPIDs = append(w.skipPIDs, pids...)
+	}
+}
+
+// WithErrorHandler sets a handler for non fatal errors (sink and per event
+// errors), they are dropped by default.
+func WithErrorHandler(fn func(error)) WatcherOption {
+	return func(w *Watcher) {
+		w.onError = fn
+	}
+}
+
+// Watcher reads events from a NotifyFD and publishes them to sinks. Event
+// Fds are closed before the sinks run, permission events not answered by a
+// filter are allowed.
+type Watcher struct {
+	notify   *NotifyFD
+	sinks    []Sink
+	skipPIDs []int
+	onError  func(error)
+	systemd  bool
+	recovery *RecoveryConfig
+
+	// inotify replaces notify for the inotify backend, owned makes Close
+	// close the backend
+	inotify *inotifyWatch
+	owned   bool
+
+	scanExisting bool
+	scanned      bool
+
+	pendingThreshold int
+	onPending        func(int)
+
+	mu         sync.Mutex
+	recoveries int
+	lastErr    error
+
+	readerState  int32
+	lastProgress int64
+	lastRead     int64
+	lastEvent    int64
+	published    uint64
+	dropped      uint64
+	seq          uint64
+
+	life lifecycle
+}
+
+// NewWatcher returns a Watcher reading from notify. The handle should be
+// initialized with FAN_NONBLOCK so that Run can be interrupted by ctx.
+func NewWatcher(notify *NotifyFD, opts ...WatcherOption) *Watcher {
+	w := &Watcher{
+		notify: notify,
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Run reads and publishes events until ctx is done or reading fails,
+// it returns ctx.Err() after cancellation. With WithRecovery a failed
+// NotifyFD is replaced instead. Truncated events are reported to the error
+// handler and skipped.
+func (w *Watcher) Run(ctx context.Context) error {
+	if w.systemd {
+		defer w.startSystemd()()
+	}
+
+	defer w.setReaderState(readerIdle)
+
+	if w.scanExisting && !w.scanned {
+		w.scanned = true
+		w.scan(ctx)
+	}
+
+	for {
+		err := w.read(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		w.setError(err)
+
+		if err := w.recover(ctx, err); err != nil {
+			return err
+		}
+	}
+}
+
+// Start runs Run on a goroutine owned by the Watcher, until Stop is called
+// or ctx is done. A Watcher can be started once.
+func (w *Watcher) Start(ctx context.Context) error {
+	return w.life.start(ctx, w.Run)
+}
+
+// Stop stops a started Watcher and waits for its goroutine to exit, it
+// returns the Run error, nil when stopped by Stop or ctx. Once Stop returns
+// nothing is published anymore and every event read was either published
+// or dropped, see WatcherHealth. Sinks stay open until Close.
+func (w *Watcher) Stop() error {
+	return w.life.stop()
+}
+
+// Done returns a channel closed once a started Watcher exited.
+func (w *Watcher) Done() <-chan struct{} {
+	return w.life.wait()
+}
+
+// read reads and publishes events from the current NotifyFD until ctx is
+// done or reading fails.
+func (w *Watcher) read(ctx context.Context) error {
+	if w.inotify != nil {
+		return w.readInotify(ctx)
+	}
+
+	notify := w.Notify()
+
+	stop := interruptOnDone(ctx, notify.File, w.error)
+	defer stop()
+
+	for {
+		w.setReaderState(readerReading)
+
+		ev, err := notify.WaitEvent(w.skipPIDs...)
+
+		w.setReaderState(readerProcessing)
+		atomic.StoreInt64(&w.lastRead, time.Now().UnixNano())
+
+		if ctx.Err() != nil {
+			if ev != nil {
+				atomic.AddUint64(&w.dropped, 1)
+				_ = notify.skip(ev)
+			}
+
+			return ctx.Err()
+		}
+
+		var truncated *TruncatedEventError
+		if errors.As(err, &truncated) {
+			w.error(err)
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		w.publish(ctx, notify, ev)
+		notify.delivered(ev)
+		atomic.AddUint64(&w.published, 1)
+		atomic.StoreInt64(&w.lastEvent, time.Now().UnixNano())
+		w.checkPending(notify)
+	}
+}
+
+// readInotify reads and publishes events of the inotify backend until ctx
+// is done or reading fails.
+func (w *Watcher) readInotify(ctx context.Context) error {
+	stop := interruptOnDone(ctx, w.inotify.file, w.error)
+	defer stop()
+
+	for {
+		w.setReaderState(readerReading)
+
+		ev, ok, err := w.inotify.next()
+
+		w.setReaderState(readerProcessing)
+		atomic.StoreInt64(&w.lastRead, time.Now().UnixNano())
+
+		if ctx.Err() != nil {
+			if ok {
+				atomic.AddUint64(&w.dropped, 1)
+			}
+
+			return ctx.Err()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		w.publishEvent(ctx, ev)
+		atomic.AddUint64(&w.published, 1)
+		atomic.StoreInt64(&w.lastEvent, time.Now().UnixNano())
+		w.checkPending(w.inotify)
+	}
+}
+
+// publish publishes ev to the sinks, a permission event not answered by a
+// filter is allowed first, so that the process does not wait for them.
+func (w *Watcher) publish(ctx context.Context, notify *NotifyFD, ev *EventMetadata) {
+	var data Event
+	if len(w.sinks) != 0 {
+		data = ev.Event()
+	}
+
+	if err := notify.skip(ev); err != nil {
+		w.error(err)
+	}
+
+	if len(w.sinks) == 0 {
+		return
+	}
+
+	w.publishEvent(ctx, data)
+}
+
+func (w *Watcher) publishEvent(ctx context.Context, data Event) {
+	data.Seq = atomic.AddUint64(&w.seq, 1)
+
+	for _, sink := range w.sinks {
+		if err := sink.Publish(ctx, data); err != nil {
+			w.error(fmt.Errorf("fanotify: sink error, %w", err))
+		}
+	}
+}
+
+// Close closes all sinks, the NotifyFD is left open unless the Watcher was
+// created by WatchPaths. After a recovery it is the replacement returned by
+// Notify.
+func (w *Watcher) Close() error {
+	var err error
+
+	for _, sink := range w.sinks {
+		if e := sink.Close(); e != nil && err == nil {
+			err = fmt.Errorf("fanotify: sink error, %w", e)
+		}
+	}
+
+	if !w.owned {
+		return err
+	}
+
+	closer := io.Closer(w.inotify)
+	if w.inotify == nil {
+		closer = w.Notify()
+	}
+
+	if e := closer.Close(); e != nil && !errors.Is(e, os.ErrClosed) && err == nil {
+		err = e
+	}
+
+	return err
+}
+
+func (w *Watcher) error(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// interruptOnDone unblocks a pending read on a nonblocking file, e.g. of a
+// FAN_NONBLOCK handle, when ctx is done, by moving the read deadline into
+// the past.
+func interruptOnDone(ctx context.Context, file *os.File, onError func(error)) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		select {
+		case <-ctx.Done():
+			if err := file.SetReadDeadline(time.Now()); err != nil &&
+				!errors.Is(err, os.ErrNoDeadline) && onError != nil {
+				onError(err)
+			}
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+
+		_ = file.SetReadDeadline(time.Time{})
+	}
+}
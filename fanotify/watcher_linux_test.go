@@ -0,0 +1,79 @@
+package fanotify
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// recordSink records published events.
+type recordSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *recordSink) Publish(ctx context.Context, ev Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, ev)
+
+	return nil
+}
+
+func (s *recordSink) Close() error {
+	return nil
+}
+
+func TestWatcherAllowsPermissionEvents(t *testing.T) {
+	DebugFdLeaks = true
+	defer func() { DebugFdLeaks = false }()
+
+	defer CheckFdLeaksT(t)
+
+	fake := newFakeHandle(t)
+
+	allowed, denied := eventFd(t), eventFd(t)
+
+	// the filter answers one event itself
+	fake.SetFilters(func(ev *EventMetadata) bool {
+		if ev.Fd == denied {
+			if err := ev.Deny(); err != nil {
+				t.Error(err)
+			}
+		}
+
+		return true
+	})
+
+	fake.send(t,
+		encodeEvent(FAN_OPEN_PERM, allowed, 1),
+		encodeEvent(FAN_OPEN_PERM, denied, 1),
+	)
+	fake.closeEvents()
+
+	sink := &recordSink{}
+
+	var errs []error
+
+	w := NewWatcher(fake.NotifyFD, WithSink(sink), WithErrorHandler(func(err error) { errs = append(errs, err) }))
+
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("Run returned nil at the end of the events")
+	}
+
+	if len(errs) != 0 {
+		t.Fatalf("got errors %v, want none", errs)
+	}
+
+	if len(sink.events) != 2 {
+		t.Fatalf("got %d published events, want 2", len(sink.events))
+	}
+
+	want := []FanotifyResponse{{Fd: allowed, Response: FAN_ALLOW}, {Fd: denied, Response: FAN_DENY}}
+
+	responses := fake.closeResponses()
+	if len(responses) != len(want) || responses[0] != want[0] || responses[1] != want[1] {
+		t.Fatalf("got responses %+v, want %+v", responses, want)
+	}
+}
@@ -0,0 +1,103 @@
+package fanotify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// WithXattrs enriches every event with extended attributes of the touched
+// file read via fgetxattr on the event Fd, e.g. "security.selinux" or
+// "security.capability". A name ending with ".*" selects every attribute
+// with that prefix, e.g. "user.*". Missing attributes are skipped.
+func WithXattrs(names ...string) Option {
+	return WithEnricher(func(metadata *EventMetadata) {
+		if metadata.Fd < 0 {
+			return
+		}
+
+		for _, name := range names {
+			if prefix := strings.TrimSuffix(name, "*"); prefix != name {
+				for _, attr := range listXattrs(int(metadata.Fd)) {
+					if strings.HasPrefix(attr, prefix) {
+						metadata.setXattr(attr)
+					}
+				}
+
+				continue
+			}
+
+			metadata.setXattr(name)
+		}
+	})
+}
+
+// GetXattr returns extended attribute value read via fgetxattr on event metadata supplied Fd.
+func (metadata *EventMetadata) GetXattr(name string) ([]byte, error) {
+	fd := int(metadata.Fd)
+
+	for {
+		size, err := fgetxattr(fd, name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("fanotify: xattr error, %s: %w", name, err)
+		}
+
+		buf := make([]byte, size)
+
+		n, err := fgetxattr(fd, name, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue // attribute grew in between
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("fanotify: xattr error, %s: %w", name, err)
+		}
+
+		return buf[:n], nil
+	}
+}
+
+func (metadata *EventMetadata) setXattr(name string) {
+	val, err := metadata.GetXattr(name)
+	if err != nil {
+		return
+	}
+
+	if metadata.Xattrs == nil {
+		metadata.Xattrs = make(map[string][]byte)
+	}
+
+	metadata.Xattrs[name] = val
+}
+
+func listXattrs(fd int) []string {
+	for {
+		size, err := flistxattr(fd, nil)
+		if err != nil || size == 0 {
+			return nil
+		}
+
+		buf := make([]byte, size)
+
+		n, err := flistxattr(fd, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue
+		}
+
+		if err != nil {
+			return nil
+		}
+
+		var out []string
+
+		for _, name := range bytes.Split(buf[:n], []byte{0}) {
+			if len(name) > 0 {
+				out = append(out, string(name))
+			}
+		}
+
+		return out
+	}
+}
@@ -0,0 +1,11 @@
+package fanotify
+
+import "golang.org/x/sys/unix"
+
+func fgetxattr(fd int, name string, dest []byte) (int, error) {
+	return unix.Fgetxattr(fd, name, dest)
+}
+
+func flistxattr(fd int, dest []byte) (int, error) {
+	return unix.Flistxattr(fd, dest)
+}